@@ -0,0 +1,151 @@
+// Package antivirus проверяет загружаемые файлы антивирусом ClamAV по протоколу clamd (INSTREAM)
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Ошибки проверки
+var (
+	ErrUnavailable = errors.New("антивирус недоступен") // Демон недоступен или ответил ошибкой
+	// Поток больше StreamMaxLength из clamd.conf (по умолчанию 25 МБ): демон такой файл не проверяет
+	ErrTooLarge = errors.New("файл больше лимита проверки антивирусом")
+)
+
+// Result результат проверки; Signature — имя найденной сигнатуры
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner проверяет содержимое файла
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (*Result, error)
+}
+
+// chunkSize размер блока INSTREAM; clamd ограничивает весь поток StreamMaxLength, а не блок
+const chunkSize = 64 << 10
+
+// Clamd клиент clamd. Каждая проверка открывает отдельное соединение
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd создает клиент. Адрес: "host:port", "tcp://host:port", "unix:///run/clamd.sock" или путь к сокету
+func NewClamd(address string, timeout time.Duration) *Clamd {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		network, address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "/"):
+		network = "unix"
+	}
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	return &Clamd{network: network, address: address, timeout: timeout}
+}
+
+// Ping проверяет, что демон отвечает
+func (c *Clamd) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "PING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: %s", ErrUnavailable, reply)
+	}
+	return nil
+}
+
+// Scan передает содержимое демону командой INSTREAM
+func (c *Clamd) Scan(ctx context.Context, content io.Reader) (*Result, error) {
+	reply, err := c.command(ctx, "INSTREAM", content)
+	if err != nil {
+		return nil, err
+	}
+	return parseReply(reply)
+}
+
+// command выполняет команду в z-формате (строки завершаются нулевым байтом)
+func (c *Clamd) command(ctx context.Context, name string, stream io.Reader) (string, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := io.WriteString(conn, "z"+name+"\x00"); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if stream != nil {
+		if err := writeChunks(conn, stream); err != nil {
+			return "", err
+		}
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// writeChunks пишет поток блоками "длина (4 байта, big-endian) + данные" и завершает его пустым блоком
+func writeChunks(conn net.Conn, stream io.Reader) error {
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(stream, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				// Демон закрывает соединение, если поток превысил StreamMaxLength; ответ ждет в сокете
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Ошибку записи не возвращаем по той же причине: ответ демона важнее
+	conn.Write([]byte{0, 0, 0, 0})
+	return nil
+}
+
+// parseReply разбирает ответ вида "stream: OK" или "stream: Eicar-Signature FOUND".
+// Превышение StreamMaxLength демон сообщает строкой "INSTREAM size limit exceeded. ERROR"
+func parseReply(reply string) (*Result, error) {
+	_, status, _ := strings.Cut(reply, ": ")
+	switch {
+	case strings.Contains(reply, "size limit exceeded"):
+		return nil, fmt.Errorf("%w: %s", ErrTooLarge, reply)
+	case status == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, reply)
+	}
+}
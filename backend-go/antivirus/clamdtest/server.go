@@ -0,0 +1,157 @@
+// Package clamdtest реализует фиктивный демон clamd для тестов и локальной разработки:
+// команды PING и INSTREAM в z-формате, сигнатура EICAR и ограничение размера потока
+package clamdtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// EICAR стандартная тестовая строка антивирусов
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Server фиктивный демон
+type Server struct {
+	Addr string
+
+	listener net.Listener
+
+	mu         sync.Mutex
+	signatures map[string]string // Подстрока содержимого → имя сигнатуры
+	maxLength  int64             // StreamMaxLength; 0 — без ограничения
+	scanned    int
+}
+
+// NewServer запускает демон на случайном локальном TCP-порту
+func NewServer() *Server {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Listen запускает демон на адресе addr
+func Listen(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:       listener.Addr().String(),
+		listener:   listener,
+		signatures: map[string]string{EICAR: "Eicar-Test-Signature"},
+	}
+	go s.serve()
+	return s, nil
+}
+
+// AddSignature добавляет сигнатуру
+func (s *Server) AddSignature(pattern, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signatures[pattern] = name
+}
+
+// SetStreamMaxLength ограничивает размер потока INSTREAM, как StreamMaxLength в clamd.conf
+func (s *Server) SetStreamMaxLength(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxLength = n
+}
+
+// Scanned число проверенных потоков
+func (s *Server) Scanned() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scanned
+}
+
+func (s *Server) Close() {
+	s.listener.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// Команды в z-формате: "zINSTREAM\0"
+	command, err := r.ReadString(0)
+	if err != nil || !strings.HasPrefix(command, "z") {
+		return
+	}
+	command = strings.TrimSuffix(strings.TrimPrefix(command, "z"), "\x00")
+	const terminator = "\x00"
+
+	switch command {
+	case "PING":
+		io.WriteString(conn, "PONG"+terminator)
+	case "INSTREAM":
+		data, ok := s.readStream(r)
+		if !ok {
+			io.WriteString(conn, "INSTREAM size limit exceeded. ERROR"+terminator)
+			return
+		}
+		io.WriteString(conn, "stream: "+s.verdict(data)+terminator)
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND"+terminator)
+	}
+}
+
+// readStream читает блоки INSTREAM до пустого; false — превышен StreamMaxLength.
+// Остаток потока дочитывается, чтобы клиент получил ответ, а не сброс соединения
+func (s *Server) readStream(r io.Reader) ([]byte, bool) {
+	s.mu.Lock()
+	maxLength := s.maxLength
+	s.mu.Unlock()
+
+	var data bytes.Buffer
+	exceeded := false
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, size); err != nil {
+			return nil, false
+		}
+		n := int64(binary.BigEndian.Uint32(size))
+		if n == 0 {
+			return data.Bytes(), !exceeded
+		}
+		if maxLength > 0 && int64(data.Len())+n > maxLength {
+			exceeded = true
+		}
+		var dst io.Writer = &data
+		if exceeded {
+			dst = io.Discard
+		}
+		if _, err := io.CopyN(dst, r, n); err != nil {
+			return nil, false
+		}
+	}
+}
+
+func (s *Server) verdict(data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scanned++
+	for pattern, name := range s.signatures {
+		if bytes.Contains(data, []byte(pattern)) {
+			return name + " FOUND"
+		}
+	}
+	return "OK"
+}
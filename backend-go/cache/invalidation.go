@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// PermissionsChannel канал Postgres для рассылки инвалидации прав между репликами
+const PermissionsChannel = "permissions_invalidated"
+
+// InvalidateAllRoles значение сообщения, сбрасывающее кэш всех ролей
+const InvalidateAllRoles = "*"
+
+// listenTimeout сколько старт сервера ждет подключения слушателя; дальше подписка
+// завершается в фоне, а до нее изменения прав доходят по истечении TTL кэша
+const listenTimeout = 5 * time.Second
+
+// InvalidationBroadcaster рассылает инвалидацию кэша прав другим репликам
+type InvalidationBroadcaster interface {
+	Broadcast(roleCode string)
+}
+
+// NoopBroadcaster используется, когда реплика одна (и в тестах)
+type NoopBroadcaster struct{}
+
+func (NoopBroadcaster) Broadcast(string) {}
+
+// PgBroadcaster рассылает инвалидацию через LISTEN/NOTIFY Postgres
+type PgBroadcaster struct {
+	db       *gorm.DB
+	listener *pq.Listener
+}
+
+func NewPgBroadcaster(db *gorm.DB, dsn string) *PgBroadcaster {
+	return &PgBroadcaster{
+		db: db,
+		listener: pq.NewListener(dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Permissions listener: %v", err)
+			}
+		}),
+	}
+}
+
+// Broadcast отправляет код роли другим репликам
+func (b *PgBroadcaster) Broadcast(roleCode string) {
+	if err := b.db.Exec("SELECT pg_notify(?, ?)", PermissionsChannel, roleCode).Error; err != nil {
+		log.Printf("Failed to broadcast permissions invalidation for %s: %v", roleCode, err)
+	}
+}
+
+// Listen подписывается на канал и сбрасывает записи кэша по входящим сообщениям.
+// Сообщения собственной реплики тоже приходят — повторная инвалидация безопасна.
+// pq.Listener ждет соединения без ограничения по времени, поэтому подписка идет в фоне:
+// Listen возвращает ошибку, только если она пришла за listenTimeout
+func (b *PgBroadcaster) Listen(pc *PermissionCache) error {
+	result := make(chan error, 1)
+	go func() {
+		err := b.listener.Listen(PermissionsChannel)
+		if err != nil {
+			log.Printf("Permissions listener: LISTEN %s: %v", PermissionsChannel, err)
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			return err
+		}
+	case <-time.After(listenTimeout):
+		log.Printf("Permissions listener: no connection after %s, subscribing in background", listenTimeout)
+	}
+
+	go func() {
+		for n := range b.listener.Notify {
+			// nil приходит после переподключения: пропущенные сообщения неизвестны
+			if n == nil || n.Extra == InvalidateAllRoles {
+				pc.InvalidateAll()
+				continue
+			}
+			pc.Invalidate(n.Extra)
+		}
+	}()
+	return nil
+}
+
+// Close останавливает подписку
+func (b *PgBroadcaster) Close() error {
+	return b.listener.Close()
+}
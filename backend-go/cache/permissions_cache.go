@@ -26,16 +26,21 @@ var (
 // GetCache возвращает singleton экземпляр кэша
 func GetCache() *PermissionCache {
 	once.Do(func() {
-		permCache = &PermissionCache{
-			cache: make(map[string]*CacheEntry),
-			ttl:   5 * time.Minute,
-		}
+		permCache = NewPermissionCache(5 * time.Minute)
 		// Запускаем фоновую очистку устаревших записей
 		permCache.startCleanup()
 	})
 	return permCache
 }
 
+// NewPermissionCache создает отдельный кэш без фоновой очистки (для тестов)
+func NewPermissionCache(ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		cache: make(map[string]*CacheEntry),
+		ttl:   ttl,
+	}
+}
+
 // Get получает права роли из кэша
 func (pc *PermissionCache) Get(roleCode string) ([]string, bool) {
 	pc.mu.RLock()
@@ -0,0 +1,68 @@
+// migrate-storage переносит файлы документов в хранилище из конфигурации (STORAGE_BACKEND).
+// Файлы, загруженные до появления хранилища, читаются с диска по FilePath; с -from=local
+// уже сохраненные в локальном каталоге (UPLOAD_DIR) файлы копируются, например, в S3
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"portal-razvitie/config"
+	"portal-razvitie/database"
+	"portal-razvitie/services"
+	"portal-razvitie/storage"
+)
+
+func main() {
+	from := flag.String("from", "", "исходное хранилище для уже перенесенных файлов: local или пусто (только файлы с диска)")
+	deleteSource := flag.Bool("delete-source", false, "удалять исходные файлы после переноса")
+	flag.Parse()
+
+	cfg := config.Load()
+	target, err := storage.New(cfg.Storage())
+	if err != nil {
+		log.Fatalf("target storage: %v", err)
+	}
+
+	var source storage.Storage
+	switch *from {
+	case "":
+	case storage.BackendLocal:
+		if cfg.StorageBackend == storage.BackendLocal {
+			log.Fatal("source and target storage are the same; set STORAGE_BACKEND=s3 to migrate to S3")
+		}
+		if source, err = storage.NewLocal(cfg.UploadDir); err != nil {
+			log.Fatalf("source storage: %v", err)
+		}
+	default:
+		log.Fatalf("unsupported source storage %q", *from)
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		log.Fatalf("database: %v", err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		log.Fatalf("migrations: %v", err)
+	}
+	if err := database.MigrateDocumentRevisions(db); err != nil {
+		log.Fatalf("document revisions: %v", err)
+	}
+
+	result, err := services.NewDocumentService(db, target).MigrateFiles(context.Background(), source, *deleteSource)
+	if err != nil {
+		log.Fatalf("migration: %v", err)
+	}
+
+	log.Printf("✅ Moved: %d, already in storage: %d", result.Moved, result.Skipped)
+	if len(result.Missing) > 0 {
+		log.Printf("⚠️ Files not found for document revisions: %v", result.Missing)
+	}
+	for id, reason := range result.Failed {
+		log.Printf("❌ Document revision %d: %s", id, reason)
+	}
+	if len(result.Failed) > 0 {
+		log.Fatalf("%d revisions failed, rerun the command to retry", len(result.Failed))
+	}
+}
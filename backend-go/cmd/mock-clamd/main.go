@@ -0,0 +1,34 @@
+// mock-clamd запускает фиктивный демон clamd для локальной проверки антивирусной проверки загрузок.
+// Заражеными считаются файлы со строкой EICAR или с подстрокой из -signature
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"portal-razvitie/antivirus/clamdtest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:3310", "адрес демона")
+	signature := flag.String("signature", "", "дополнительная подстрока, которая считается вирусом")
+	maxLength := flag.Int64("stream-max-length", 100<<20, "ограничение размера потока в байтах (StreamMaxLength)")
+	flag.Parse()
+
+	server, err := clamdtest.Listen(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.SetStreamMaxLength(*maxLength)
+	if *signature != "" {
+		server.AddSignature(*signature, "Mock-Signature")
+	}
+
+	log.Printf("Mock clamd: %s", server.Addr)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	server.Close()
+}
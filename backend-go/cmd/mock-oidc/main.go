@@ -0,0 +1,34 @@
+// mock-oidc запускает фиктивный OpenID Connect провайдер для локальной разработки SSO.
+// Вход проходит без формы от имени пользователя из флагов; ?login_hint= подменяет логин и subject
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"portal-razvitie/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9400", "адрес провайдера")
+	clientID := flag.String("client-id", "portal-razvitie", "client_id приложения")
+	login := flag.String("login", "sso.user", "preferred_username пользователя")
+	name := flag.String("name", "Пользователь SSO", "имя пользователя")
+	groups := flag.String("groups", "portal-mp", "группы через запятую")
+	flag.Parse()
+
+	issuer := "http://" + *addr
+	provider := oidctest.NewProvider(issuer, *clientID, oidctest.Identity{
+		Subject:           "mock|" + *login,
+		Email:             *login + "@example.local",
+		EmailVerified:     true,
+		Name:              *name,
+		PreferredUsername: *login,
+		Groups:            strings.Split(*groups, ","),
+	})
+
+	log.Printf("Mock OIDC provider: issuer %s, client_id %s", issuer, *clientID)
+	log.Fatal(http.ListenAndServe(*addr, provider.Handler()))
+}
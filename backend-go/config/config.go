@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"portal-razvitie/storage"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,6 +23,51 @@ type Config struct {
 	CORSOrigin  string
 	UploadDir   string
 	Environment string // development, production
+
+	// Рассылка инвалидации кэша прав через LISTEN/NOTIFY; выключается, если LISTEN недоступен
+	// (PgBouncer в режиме transaction) — тогда изменения прав доходят до реплик по TTL кэша
+	PermissionsListen bool
+
+	// Политика загрузки: общий лимит размера файла и антивирус clamd (выключен, если адрес пуст)
+	UploadMaxSize    int64  // Байт
+	UploadSessionDir string // Части докачиваемых загрузок; общий каталог для всех реплик
+	ClamdAddress     string
+	ClamdTimeout     time.Duration
+	ClamdMaxSize     int64 // Байт; не больше StreamMaxLength в clamd.conf
+
+	// Утилита отрисовки первой страницы PDF для миниатюр (Poppler); не найдена — без миниатюр PDF
+	PreviewPDFRenderer string
+	// Утилита извлечения текста PDF для поиска (Poppler); не найдена — PDF ищутся только по названию
+	PreviewPDFText string
+
+	// Ключ подписи ссылок на скачивание документов без входа; одинаковый на всех репликах
+	DocumentLinkSecret string
+	// Внешний адрес сервера (https://portal.example.ru) для ссылок, которые отправляются получателям
+	PublicURL string
+
+	// Хранилище файлов документов: local (UploadDir) или s3
+	StorageBackend string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PathStyle    bool // MinIO и большинство локальных S3 требуют path-style адресацию
+
+	// Ключ подписи токенов сеанса, выдаваемых при входе; одинаковый на всех репликах
+	SessionSecret string
+	SessionTTL    time.Duration
+	// Вход по заголовку X-User-ID без токена (переключатель пользователей); по умолчанию только в development
+	AuthUserHeader bool
+
+	// OpenID Connect (SSO); вход через провайдера включен, если задан OIDCIssuer
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string            // Страница фронтенда, куда провайдер возвращает код
+	OIDCGroupsClaim  string            // Утверждение с группами, допускается путь: realm_access.roles
+	OIDCGroupRoles   map[string]string // Группа провайдера → Role.Code
+	OIDCStateSecret  string            // Ключ шифрования state; одинаковый на всех репликах
 }
 
 func Load() *Config {
@@ -36,8 +86,42 @@ func Load() *Config {
 		CORSOrigin:  getEnv("CORS_ORIGIN", "http://localhost:4200"),
 		UploadDir:   getEnv("UPLOAD_DIR", "./uploads"),
 		Environment: getEnv("ENVIRONMENT", "development"),
+
+		PermissionsListen: getEnv("PERMISSIONS_LISTEN", "true") == "true",
+
+		UploadMaxSize: getEnvInt64("UPLOAD_MAX_SIZE_MB", 1024) << 20,
+		ClamdAddress:  getEnv("CLAMD_ADDRESS", ""),
+		ClamdTimeout:  time.Duration(getEnvInt64("CLAMD_TIMEOUT_SECONDS", 60)) * time.Second,
+		ClamdMaxSize:  getEnvInt64("CLAMD_MAX_SIZE_MB", 25) << 20,
+
+		PreviewPDFRenderer: getEnv("PREVIEW_PDF_RENDERER", "pdftoppm"),
+		PreviewPDFText:     getEnv("PREVIEW_PDF_TEXT", "pdftotext"),
+		DocumentLinkSecret: getEnv("DOCUMENT_LINK_SECRET", ""),
+		PublicURL:          getEnv("PUBLIC_URL", ""),
+
+		StorageBackend: getEnv("STORAGE_BACKEND", "local"),
+		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+		S3Region:       getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:       getEnv("S3_BUCKET", ""),
+		S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
+		S3PathStyle:    getEnv("S3_PATH_STYLE", "true") == "true",
+
+		SessionSecret: getEnv("SESSION_SECRET", ""),
+		SessionTTL:    time.Duration(getEnvInt64("SESSION_TTL_HOURS", 12)) * time.Hour,
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", "portal-razvitie"),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:4200/auth/callback"),
+		OIDCGroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCGroupRoles:   parseMapping(getEnv("OIDC_GROUP_ROLES", "")),
+		OIDCStateSecret:  getEnv("OIDC_STATE_SECRET", ""),
 	}
 
+	config.AuthUserHeader = getEnv("AUTH_USER_HEADER", strconv.FormatBool(config.Environment == "development")) == "true"
+	config.UploadSessionDir = getEnv("UPLOAD_SESSION_DIR", filepath.Join(config.UploadDir, ".sessions"))
+
 	return config
 }
 
@@ -46,9 +130,54 @@ func (c *Config) GetDSN() string {
 		c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName)
 }
 
+// Storage параметры хранилища файлов документов
+func (c *Config) Storage() storage.Config {
+	return storage.Config{
+		Backend:     c.StorageBackend,
+		LocalDir:    c.UploadDir,
+		S3Endpoint:  c.S3Endpoint,
+		S3Region:    c.S3Region,
+		S3Bucket:    c.S3Bucket,
+		S3AccessKey: c.S3AccessKey,
+		S3SecretKey: c.S3SecretKey,
+		S3PathStyle: c.S3PathStyle,
+	}
+}
+
+// OIDCEnabled включен ли вход через OpenID Connect
+func (c *Config) OIDCEnabled() bool {
+	return c.OIDCIssuer != ""
+}
+
+// UserHeaderAuthEnabled принимается ли X-User-ID без токена. С SSO заголовок отключен всегда:
+// иначе он обходил бы вход через провайдера
+func (c *Config) UserHeaderAuthEnabled() bool {
+	return c.AuthUserHeader && !c.OIDCEnabled()
+}
+
+// parseMapping разбирает пары вида "portal-admins=admin;portal-mp=МП"
+func parseMapping(value string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(pair, "=")
+		if ok && strings.TrimSpace(key) != "" && strings.TrimSpace(val) != "" {
+			result[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+	return result
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AbsenceController struct {
+	service *services.AbsenceService
+}
+
+func NewAbsenceController(service *services.AbsenceService) *AbsenceController {
+	return &AbsenceController{service: service}
+}
+
+// GetMyAbsences возвращает отсутствия текущего пользователя
+func (ctrl *AbsenceController) GetMyAbsences(c *gin.Context) {
+	ctrl.list(c, c.MustGet("user").(*models.User).ID)
+}
+
+// CreateMyAbsence регистрирует отсутствие текущего пользователя
+func (ctrl *AbsenceController) CreateMyAbsence(c *gin.Context) {
+	ctrl.create(c, c.MustGet("user").(*models.User).ID)
+}
+
+// DeleteMyAbsence отменяет отсутствие текущего пользователя
+func (ctrl *AbsenceController) DeleteMyAbsence(c *gin.Context) {
+	ctrl.delete(c, c.MustGet("user").(*models.User).ID)
+}
+
+// GetUserAbsences возвращает отсутствия пользователя (для администраторов)
+func (ctrl *AbsenceController) GetUserAbsences(c *gin.Context) {
+	if userID, ok := parseAbsenceUser(c); ok {
+		ctrl.list(c, userID)
+	}
+}
+
+// CreateUserAbsence регистрирует отсутствие за пользователя (для администраторов)
+func (ctrl *AbsenceController) CreateUserAbsence(c *gin.Context) {
+	if userID, ok := parseAbsenceUser(c); ok {
+		ctrl.create(c, userID)
+	}
+}
+
+// DeleteUserAbsence отменяет отсутствие пользователя (для администраторов)
+func (ctrl *AbsenceController) DeleteUserAbsence(c *gin.Context) {
+	if userID, ok := parseAbsenceUser(c); ok {
+		ctrl.delete(c, userID)
+	}
+}
+
+func (ctrl *AbsenceController) list(c *gin.Context, userID uint) {
+	absences, err := ctrl.service.GetAbsences(userID)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить отсутствия", err))
+		return
+	}
+	c.JSON(http.StatusOK, absences)
+}
+
+func (ctrl *AbsenceController) create(c *gin.Context, userID uint) {
+	var absence models.UserAbsence
+	if err := c.ShouldBindJSON(&absence); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	if err := ctrl.service.CreateAbsence(userID, &absence); err != nil {
+		c.Error(absenceError(err, "Не удалось зарегистрировать отсутствие"))
+		return
+	}
+	c.JSON(http.StatusCreated, absence)
+}
+
+func (ctrl *AbsenceController) delete(c *gin.Context, userID uint) {
+	id, err := helpers.ParseIDParam(c, "absenceId")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID отсутствия", err))
+		return
+	}
+
+	if err := ctrl.service.DeleteAbsence(userID, id); err != nil {
+		c.Error(absenceError(err, "Не удалось отменить отсутствие"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func parseAbsenceUser(c *gin.Context) (uint, bool) {
+	userID, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID пользователя", err))
+		return 0, false
+	}
+	return userID, true
+}
+
+// absenceError сопоставляет ошибки AbsenceService с HTTP-статусами
+func absenceError(err error, fallback string) *middleware.AppError {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return middleware.NewAppError(http.StatusNotFound, "Отсутствие не найдено", err)
+	case errors.Is(err, services.ErrAbsenceOverlap):
+		return middleware.NewAppError(http.StatusConflict, err.Error(), err)
+	case errors.Is(err, services.ErrAbsenceInvalidPeriod), errors.Is(err, services.ErrAbsenceDelegate):
+		return middleware.NewAppError(http.StatusBadRequest, err.Error(), err)
+	default:
+		return middleware.NewAppError(http.StatusInternalServerError, fallback, err)
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type APITokenController struct {
+	service *services.APITokenService
+}
+
+func NewAPITokenController(service *services.APITokenService) *APITokenController {
+	return &APITokenController{service: service}
+}
+
+// GetMyTokens возвращает персональные токены текущего пользователя
+func (ctrl *APITokenController) GetMyTokens(c *gin.Context) {
+	tokens, err := ctrl.service.GetTokens(c.MustGet("user").(*models.User).ID)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить токены", err))
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateMyToken выпускает токен; значение токена возвращается только в этом ответе
+func (ctrl *APITokenController) CreateMyToken(c *gin.Context) {
+	var input services.APITokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	token, err := ctrl.service.CreateToken(c.MustGet("user").(*models.User).ID, input, helpers.Permissions(c))
+	if err != nil {
+		c.Error(apiTokenError(err, "Не удалось выпустить токен"))
+		return
+	}
+	c.JSON(http.StatusCreated, token)
+}
+
+// RevokeMyToken отзывает токен текущего пользователя
+func (ctrl *APITokenController) RevokeMyToken(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "tokenId")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID токена", err))
+		return
+	}
+
+	if err := ctrl.service.RevokeToken(c.MustGet("user").(*models.User).ID, id); err != nil {
+		c.Error(apiTokenError(err, "Не удалось отозвать токен"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiTokenError сопоставляет ошибки APITokenService с HTTP-статусами
+func apiTokenError(err error, fallback string) *middleware.AppError {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return middleware.NewAppError(http.StatusNotFound, "Токен не найден", err)
+	case errors.Is(err, services.ErrAPITokenName), errors.Is(err, services.ErrAPITokenNoScope),
+		errors.Is(err, services.ErrAPITokenPermission), errors.Is(err, services.ErrAPITokenExpiryValue):
+		return middleware.NewAppError(http.StatusBadRequest, err.Error(), err)
+	default:
+		return middleware.NewAppError(http.StatusInternalServerError, fallback, err)
+	}
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AssignmentController struct {
+	service *services.AssignmentService
+}
+
+func NewAssignmentController(service *services.AssignmentService) *AssignmentController {
+	return &AssignmentController{service: service}
+}
+
+// GetRules возвращает правила назначения по ролям и доступные стратегии
+func (ctrl *AssignmentController) GetRules(c *gin.Context) {
+	rules, err := ctrl.service.GetRules()
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить правила назначения", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"rules":           rules,
+		"strategies":      ctrl.service.Strategies(),
+		"defaultStrategy": models.DefaultAssignmentStrategy,
+	})
+}
+
+// SetRule задает стратегию назначения для роли
+func (ctrl *AssignmentController) SetRule(c *gin.Context) {
+	var body struct {
+		Strategy string `json:"strategy" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	rule, err := ctrl.service.SetRule(c.Param("role"), body.Strategy)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownAssignmentStrategy):
+			c.Error(middleware.NewAppError(http.StatusBadRequest, err.Error(), err))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.Error(middleware.NewAppError(http.StatusNotFound, "Роль не найдена", err))
+		default:
+			c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось сохранить правило назначения", err))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule возвращает роли стратегию по умолчанию
+func (ctrl *AssignmentController) DeleteRule(c *gin.Context) {
+	if err := ctrl.service.DeleteRule(c.Param("role")); err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось удалить правило назначения", err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"portal-razvitie/models"
 	"portal-razvitie/services"
@@ -19,9 +20,12 @@ func NewAuthController(authService *services.AuthService) *AuthController {
 type UserWithPerms struct {
 	models.User
 	Permissions []string `json:"permissions"`
+	// Сеанс, выданный при входе: токен передается в Authorization: Bearer
+	Session *services.Session `json:"session,omitempty"`
 }
 
-// Login simulates a login by returning the user matching the login param
+// Login simulates a login by returning the user matching the login param.
+// No password is checked, so the route is registered only in development without OIDC
 func (ctrl *AuthController) Login(c *gin.Context) {
 	var body struct {
 		Login string `json:"login" binding:"required"`
@@ -33,15 +37,19 @@ func (ctrl *AuthController) Login(c *gin.Context) {
 	}
 
 	user, perms, err := ctrl.authService.Login(body.Login)
+	if errors.Is(err, services.ErrUserInactive) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is deactivated"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	c.JSON(http.StatusOK, UserWithPerms{User: *user, Permissions: perms})
+	c.JSON(http.StatusOK, UserWithPerms{User: *user, Permissions: perms, Session: ctrl.authService.IssueSession(user)})
 }
 
-// GetUsers returns all available users (for the demo switcher)
+// GetUsers returns active users (for the demo switcher, registered only in development)
 func (ctrl *AuthController) GetUsers(c *gin.Context) {
 	usersWithPerms, err := ctrl.authService.GetAllUsersWithPerms()
 	if err != nil {
@@ -1,20 +1,24 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"portal-razvitie/helpers"
 	"portal-razvitie/models"
 	"portal-razvitie/services"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CommentsController struct {
 	commentService *services.CommentService
+	teamService    *services.ProjectTeamService
 }
 
-func NewCommentsController(commentService *services.CommentService) *CommentsController {
-	return &CommentsController{commentService: commentService}
+func NewCommentsController(commentService *services.CommentService, teamService *services.ProjectTeamService) *CommentsController {
+	return &CommentsController{commentService: commentService, teamService: teamService}
 }
 
 // GetComments godoc
@@ -52,6 +56,21 @@ func (cc *CommentsController) CreateComment(c *gin.Context) {
 
 	user := c.MustGet("user").(*models.User)
 
+	// Комментировать задачу может тот, кто может ее редактировать
+	canEdit, err := cc.teamService.CanEditTask(user.ID, helpers.Access(c), req.TaskID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !canEdit {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: task:edit required, or task:edit_own for own tasks"})
+		return
+	}
+
 	comment, err := cc.commentService.CreateComment(req.TaskID, user.ID, req.Content)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"portal-razvitie/helpers"
 	"portal-razvitie/services"
 
 	"github.com/gin-gonic/gin"
@@ -25,7 +26,7 @@ func NewDashboardController(activityService *services.ActivityService, taskServi
 // @Summary Get recent user activities
 // @Router /api/dashboard/activity [get]
 func (dc *DashboardController) GetRecentActivity(c *gin.Context) {
-	activities, err := dc.activityService.GetRecentActivities(20)
+	activities, err := dc.activityService.GetRecentActivities(helpers.ProjectScope(c), 20)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DocumentExtractionController struct {
+	service    *services.DocumentExtractionService
+	docService *services.DocumentService
+}
+
+func NewDocumentExtractionController(service *services.DocumentExtractionService, docService *services.DocumentService) *DocumentExtractionController {
+	return &DocumentExtractionController{service: service, docService: docService}
+}
+
+// GetRules возвращает правила извлечения сумм типа документа
+func (ctrl *DocumentExtractionController) GetRules(c *gin.Context) {
+	rules, err := ctrl.service.GetRules(c.Param("code"))
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить правила извлечения", err))
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule добавляет правило типу документа
+func (ctrl *DocumentExtractionController) CreateRule(c *gin.Context) {
+	var rule models.DocumentExtractionRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+	if err := ctrl.service.CreateRule(c.Param("code"), &rule); err != nil {
+		c.Error(extractionError(err, "Не удалось создать правило извлечения"))
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule изменяет правило типа документа
+func (ctrl *DocumentExtractionController) UpdateRule(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "ruleId")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID правила", err))
+		return
+	}
+	var input models.DocumentExtractionRule
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+	rule, err := ctrl.service.UpdateRule(c.Param("code"), id, input)
+	if err != nil {
+		c.Error(extractionError(err, "Не удалось сохранить правило извлечения"))
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule удаляет правило типа документа
+func (ctrl *DocumentExtractionController) DeleteRule(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "ruleId")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID правила", err))
+		return
+	}
+	if err := ctrl.service.DeleteRule(c.Param("code"), id); err != nil {
+		c.Error(extractionError(err, "Не удалось удалить правило извлечения"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Extract повторно извлекает суммы из текущей версии документа, например после изменения правил
+func (ctrl *DocumentExtractionController) Extract(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID документа", err))
+		return
+	}
+	doc, err := ctrl.docService.GetByID(int(id))
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusNotFound, "Документ не найден", err))
+		return
+	}
+	extractions, err := ctrl.service.ExtractCurrent(c.Request.Context(), doc)
+	if err != nil {
+		c.Error(extractionError(err, "Не удалось извлечь значения из документа"))
+		return
+	}
+	if extractions == nil {
+		extractions = []models.DocumentExtraction{}
+	}
+	c.JSON(http.StatusOK, extractions)
+}
+
+// GetForTask возвращает последние извлеченные из документов значения полей задачи
+// со сверкой: mismatch — значение в задаче расходится с документом
+func (ctrl *DocumentExtractionController) GetForTask(c *gin.Context) {
+	taskID, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID задачи", err))
+		return
+	}
+	extractions, err := ctrl.service.GetForTask(taskID)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить значения из документов", err))
+		return
+	}
+	c.JSON(http.StatusOK, extractions)
+}
+
+// Apply записывает предложенное документом значение в поле задачи
+func (ctrl *DocumentExtractionController) Apply(c *gin.Context) {
+	taskID, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID задачи", err))
+		return
+	}
+	extractionID, err := helpers.ParseIDParam(c, "extractionId")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID значения", err))
+		return
+	}
+	extraction, err := ctrl.service.Apply(taskID, extractionID)
+	if err != nil {
+		c.Error(extractionError(err, "Не удалось применить значение из документа"))
+		return
+	}
+	c.JSON(http.StatusOK, extraction)
+}
+
+// extractionError сопоставляет ошибки DocumentExtractionService с HTTP-статусами
+func extractionError(err error, fallback string) *middleware.AppError {
+	switch {
+	case errors.Is(err, services.ErrExtractionRuleNotFound), errors.Is(err, services.ErrExtractionNotFound),
+		errors.Is(err, services.ErrUnknownDocumentType), errors.Is(err, services.ErrRevisionNotFound):
+		return middleware.NewAppError(http.StatusNotFound, err.Error(), err)
+	case errors.Is(err, services.ErrExtractionRuleInvalid):
+		return middleware.NewAppError(http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, services.ErrExtractionNoValue):
+		return middleware.NewAppError(http.StatusConflict, err.Error(), err)
+	default:
+		return middleware.NewAppError(http.StatusInternalServerError, fallback, err)
+	}
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// documentLinkPath публичный адрес скачивания по подписанной ссылке (без авторизации)
+const documentLinkPath = "/api/public/document-links/"
+
+type DocumentLinkController struct {
+	service    *services.DocumentLinkService
+	docService *services.DocumentService
+	publicURL  string // Внешний адрес сервера для ссылок, которые уходят получателям
+}
+
+func NewDocumentLinkController(service *services.DocumentLinkService, docService *services.DocumentService, publicURL string) *DocumentLinkController {
+	return &DocumentLinkController{service: service, docService: docService, publicURL: strings.TrimRight(publicURL, "/")}
+}
+
+// issuedDocumentLink выпущенная ссылка с готовым адресом для отправки получателю
+type issuedDocumentLink struct {
+	*services.IssuedDocumentLink
+	URL string `json:"url"`
+}
+
+// CreateLink выпускает ссылку на скачивание документа; токен возвращается только в этом ответе
+func (ctrl *DocumentLinkController) CreateLink(c *gin.Context) {
+	doc, ok := ctrl.document(c)
+	if !ok {
+		return
+	}
+	var input services.DocumentLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	link, err := ctrl.service.Issue(doc, c.MustGet("user").(*models.User), input)
+	if err != nil {
+		c.Error(documentLinkError(err, "Не удалось выпустить ссылку"))
+		return
+	}
+	c.JSON(http.StatusCreated, issuedDocumentLink{IssuedDocumentLink: link, URL: ctrl.publicURL + documentLinkPath + link.Token})
+}
+
+// GetLinks возвращает ссылки документа с журналом обращений
+func (ctrl *DocumentLinkController) GetLinks(c *gin.Context) {
+	doc, ok := ctrl.document(c)
+	if !ok {
+		return
+	}
+	links, err := ctrl.service.GetLinks(doc.ID)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить ссылки", err))
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// RevokeLink отзывает ссылку документа
+func (ctrl *DocumentLinkController) RevokeLink(c *gin.Context) {
+	doc, ok := ctrl.document(c)
+	if !ok {
+		return
+	}
+	linkID, err := helpers.ParseIDParam(c, "linkId")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID ссылки", err))
+		return
+	}
+	if err := ctrl.service.Revoke(doc.ID, linkID); err != nil {
+		c.Error(documentLinkError(err, "Не удалось отозвать ссылку"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Download отдает файл по подписанной ссылке без авторизации
+func (ctrl *DocumentLinkController) Download(c *gin.Context) {
+	redeemed, err := ctrl.service.Redeem(c.Param("token"), services.DocumentLinkClient{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		c.Error(documentLinkError(err, "Не удалось открыть ссылку"))
+		return
+	}
+
+	// Ссылку могут переслать дальше: ответ не должен оседать в общих кэшах
+	c.Header("Cache-Control", "private, no-store")
+	file, err := ctrl.docService.OpenRevision(c.Request.Context(), &redeemed.Revision)
+	if err != nil && redeemed.Link.SingleUse {
+		// Файл не отдан: одноразовая ссылка должна остаться рабочей
+		if releaseErr := ctrl.service.Release(&redeemed.Link); releaseErr != nil {
+			log.Printf("⚠️ Failed to release single-use link %d after storage error: %v", redeemed.Link.ID, releaseErr)
+		}
+	}
+	sendDocumentFile(c, file, err, redeemed.Revision.Name, redeemed.Revision.ContentType)
+}
+
+func (ctrl *DocumentLinkController) document(c *gin.Context) (*models.ProjectDocument, bool) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID документа", err))
+		return nil, false
+	}
+	doc, err := ctrl.docService.GetByID(int(id))
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusNotFound, "Документ не найден", err))
+		return nil, false
+	}
+	return doc, true
+}
+
+func documentLinkError(err error, message string) *middleware.AppError {
+	switch {
+	case errors.Is(err, services.ErrDocumentLinkInvalid), errors.Is(err, services.ErrDocumentLinkNotFound),
+		errors.Is(err, services.ErrRevisionNotFound):
+		return middleware.NewAppError(http.StatusNotFound, err.Error(), err)
+	case errors.Is(err, services.ErrDocumentLinkExpired), errors.Is(err, services.ErrDocumentLinkUsed),
+		errors.Is(err, services.ErrDocumentLinkRevoked):
+		return middleware.NewAppError(http.StatusGone, err.Error(), err)
+	case errors.Is(err, services.ErrDocumentLinkTTL):
+		return middleware.NewAppError(http.StatusBadRequest, err.Error(), err)
+	}
+	return middleware.NewAppError(http.StatusInternalServerError, message, err)
+}
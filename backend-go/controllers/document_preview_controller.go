@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+	"portal-razvitie/storage"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DocumentPreviewController struct {
+	service    *services.DocumentPreviewService
+	docService *services.DocumentService
+}
+
+func NewDocumentPreviewController(service *services.DocumentPreviewService, docService *services.DocumentService) *DocumentPreviewController {
+	return &DocumentPreviewController{service: service, docService: docService}
+}
+
+// documentPreviewResponse состояние предпросмотра и, когда он готов, его содержимое:
+// листы книги, текст документа или адрес миниатюры
+type documentPreviewResponse struct {
+	*models.DocumentPreview
+	Sheets   []services.PreviewSheet `json:"sheets,omitempty"`
+	Text     string                  `json:"text,omitempty"`
+	ImageURL string                  `json:"imageUrl,omitempty"`
+}
+
+// GetPreview возвращает предпросмотр версии документа (?version=N, по умолчанию текущей).
+// Пока предпросмотр строится, ответ 202 без содержимого
+func (ctrl *DocumentPreviewController) GetPreview(c *gin.Context) {
+	p, ok := ctrl.preview(c)
+	if !ok {
+		return
+	}
+	response := documentPreviewResponse{DocumentPreview: p}
+	if p.Status == models.PreviewReady {
+		switch p.Kind {
+		case models.PreviewThumbnail:
+			response.ImageURL = fmt.Sprintf("/api/documents/%d/preview/image?version=%d", p.DocumentID, p.Version)
+		case models.PreviewTable, models.PreviewText:
+			if !ctrl.readContent(c, p, &response) {
+				return
+			}
+		}
+	}
+	if p.Status == models.PreviewPending || p.Status == models.PreviewProcessing {
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetPreviewImage отдает миниатюру версии документа
+func (ctrl *DocumentPreviewController) GetPreviewImage(c *gin.Context) {
+	p, ok := ctrl.preview(c)
+	if !ok {
+		return
+	}
+	if p.Status != models.PreviewReady || p.Kind != models.PreviewThumbnail {
+		c.Error(middleware.NewAppError(http.StatusNotFound, "Миниатюра не готова", nil))
+		return
+	}
+	content, err := ctrl.service.Open(c.Request.Context(), p)
+	if err != nil {
+		c.Error(previewOpenError(err))
+		return
+	}
+	defer content.Close()
+	// Предпросмотр версии не меняется: ключ кэша — номер версии в адресе
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.DataFromReader(http.StatusOK, p.Size, p.ContentType, content, nil)
+}
+
+// readContent добавляет в ответ листы книги или текст документа
+func (ctrl *DocumentPreviewController) readContent(c *gin.Context, p *models.DocumentPreview, response *documentPreviewResponse) bool {
+	content, err := ctrl.service.Open(c.Request.Context(), p)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Предпросмотр поставлен в очередь заново
+		c.JSON(http.StatusAccepted, documentPreviewResponse{DocumentPreview: p})
+		return false
+	}
+	if err != nil {
+		c.Error(previewOpenError(err))
+		return false
+	}
+	defer content.Close()
+
+	if p.Kind == models.PreviewTable {
+		var table services.PreviewTableData
+		err = json.NewDecoder(content).Decode(&table)
+		response.Sheets = table.Sheets
+	} else {
+		var text []byte
+		text, err = io.ReadAll(content)
+		response.Text = string(text)
+	}
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось прочитать предпросмотр", err))
+		return false
+	}
+	return true
+}
+
+func (ctrl *DocumentPreviewController) preview(c *gin.Context) (*models.DocumentPreview, bool) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID документа", err))
+		return nil, false
+	}
+	doc, err := ctrl.docService.GetByID(int(id))
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusNotFound, "Документ не найден", err))
+		return nil, false
+	}
+	version := doc.Version
+	if value := c.Query("version"); value != "" {
+		if version, err = strconv.Atoi(value); err != nil {
+			c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный номер версии", err))
+			return nil, false
+		}
+	}
+
+	p, err := ctrl.service.Get(doc.ID, version)
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		c.Error(middleware.NewAppError(http.StatusNotFound, err.Error(), err))
+		return nil, false
+	}
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить предпросмотр", err))
+		return nil, false
+	}
+	return p, true
+}
+
+func previewOpenError(err error) *middleware.AppError {
+	if errors.Is(err, storage.ErrNotFound) {
+		return middleware.NewAppError(http.StatusNotFound, "Предпросмотр строится заново, повторите запрос позже", err)
+	}
+	return middleware.NewAppError(http.StatusInternalServerError, "Не удалось открыть предпросмотр", err)
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DocumentTypeController struct {
+	service *services.DocumentTypeService
+}
+
+func NewDocumentTypeController(service *services.DocumentTypeService) *DocumentTypeController {
+	return &DocumentTypeController{service: service}
+}
+
+// GetTypes возвращает справочник типов документов; ?all=true — вместе с неактивными
+func (ctrl *DocumentTypeController) GetTypes(c *gin.Context) {
+	types, err := ctrl.service.GetTypes(c.Query("all") != "true")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить типы документов", err))
+		return
+	}
+	c.JSON(http.StatusOK, types)
+}
+
+// CreateType добавляет тип документа
+func (ctrl *DocumentTypeController) CreateType(c *gin.Context) {
+	var docType models.DocumentType
+	if err := c.ShouldBindJSON(&docType); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+	if err := ctrl.service.CreateType(&docType); err != nil {
+		c.Error(documentTypeError(err, "Не удалось создать тип документа"))
+		return
+	}
+	c.JSON(http.StatusCreated, docType)
+}
+
+// UpdateType изменяет тип документа по коду
+func (ctrl *DocumentTypeController) UpdateType(c *gin.Context) {
+	var input models.DocumentType
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+	docType, err := ctrl.service.UpdateType(c.Param("code"), input)
+	if err != nil {
+		c.Error(documentTypeError(err, "Не удалось сохранить тип документа"))
+		return
+	}
+	c.JSON(http.StatusOK, docType)
+}
+
+// DeleteType удаляет неиспользуемый тип документа
+func (ctrl *DocumentTypeController) DeleteType(c *gin.Context) {
+	if err := ctrl.service.DeleteType(c.Param("code")); err != nil {
+		c.Error(documentTypeError(err, "Не удалось удалить тип документа"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetProjectMissing возвращает обязательные документы, которых не хватает открытым задачам проекта
+func (ctrl *DocumentTypeController) GetProjectMissing(c *gin.Context) {
+	projectID, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID проекта", err))
+		return
+	}
+	missing, err := ctrl.service.MissingForProject(projectID)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось проверить документы проекта", err))
+		return
+	}
+	c.JSON(http.StatusOK, missing)
+}
+
+// documentTypeError сопоставляет ошибки DocumentTypeService с HTTP-статусами
+func documentTypeError(err error, fallback string) *middleware.AppError {
+	switch {
+	case errors.Is(err, services.ErrUnknownDocumentType):
+		return middleware.NewAppError(http.StatusNotFound, err.Error(), err)
+	case errors.Is(err, services.ErrDocumentTypeInvalid):
+		return middleware.NewAppError(http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, services.ErrDocumentTypeCodeTaken), errors.Is(err, services.ErrDocumentTypeInUse):
+		return middleware.NewAppError(http.StatusConflict, err.Error(), err)
+	default:
+		return middleware.NewAppError(http.StatusInternalServerError, fallback, err)
+	}
+}
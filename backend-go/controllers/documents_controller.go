@@ -1,30 +1,41 @@
 package controllers
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
-	"portal-razvitie/config"
+	"portal-razvitie/helpers"
 	"portal-razvitie/models"
 	"portal-razvitie/services"
+	"portal-razvitie/storage"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type DocumentsController struct {
-	config     *config.Config
-	docService *services.DocumentService
+	docService     *services.DocumentService
+	teamService    *services.ProjectTeamService
+	docTypeService *services.DocumentTypeService
+	uploadPolicy   *services.UploadPolicy
+	uploadSessions *services.UploadSessionService
 }
 
-func NewDocumentsController(cfg *config.Config, docService *services.DocumentService) *DocumentsController {
+func NewDocumentsController(docService *services.DocumentService, teamService *services.ProjectTeamService, docTypeService *services.DocumentTypeService, uploadPolicy *services.UploadPolicy, uploadSessions *services.UploadSessionService) *DocumentsController {
 	return &DocumentsController{
-		config:     cfg,
-		docService: docService,
+		docService:     docService,
+		teamService:    teamService,
+		docTypeService: docTypeService,
+		uploadPolicy:   uploadPolicy,
+		uploadSessions: uploadSessions,
 	}
 }
 
@@ -36,7 +47,7 @@ func NewDocumentsController(cfg *config.Config, docService *services.DocumentSer
 // @Produce json
 // @Param projectId formData int true "Project ID"
 // @Param file formData file true "File to upload"
-// @Param type formData string true "Document type"
+// @Param type formData string true "Document type code (or name)"
 // @Param taskId formData int false "Task ID (optional)"
 // @Success 201 {object} models.ProjectDocument
 // @Failure 400 {object} map[string]string
@@ -44,7 +55,6 @@ func NewDocumentsController(cfg *config.Config, docService *services.DocumentSer
 func (dc *DocumentsController) Upload(c *gin.Context) {
 	// Parse form data
 	projectIdStr := c.PostForm("projectId")
-	docType := c.PostForm("type")
 	taskIdStr := c.PostForm("taskId")
 
 	projectIdUint, err := strconv.ParseUint(projectIdStr, 10, 32)
@@ -54,12 +64,28 @@ func (dc *DocumentsController) Upload(c *gin.Context) {
 	}
 	projectId := uint(projectIdUint)
 
+	// Тип документа берется из справочника: по коду или по названию
+	docType, err := dc.docTypeService.Resolve(c.PostForm("type"))
+	if errors.Is(err, services.ErrUnknownDocumentType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var taskId *int
 	if taskIdStr != "" {
 		tid, err := strconv.Atoi(taskIdStr)
-		if err == nil {
-			taskId = &tid
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+			return
 		}
+		taskId = &tid
+	}
+	if !dc.authorizeUpload(c, projectId, taskId) {
+		return
 	}
 
 	// Get uploaded file
@@ -69,60 +95,182 @@ func (dc *DocumentsController) Upload(c *gin.Context) {
 		return
 	}
 
-	// Create uploads directory if not exists
-	uploadsDir := dc.config.UploadDir
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
+	content, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer content.Close()
+
+	upload := uploadOf(c, file)
+	if !dc.checkUpload(c, docType, &upload, content) {
 		return
 	}
 
-	// Generate unique filename
-	uniqueFileName := fmt.Sprintf("%s_%s", uuid.New().String(), filepath.Base(file.Filename))
-	filePath := filepath.Join(uploadsDir, uniqueFileName)
+	doc := models.ProjectDocument{
+		ProjectID: projectId,
+		TaskID:    taskId,
+		Type:      docType.Name,
+		TypeCode:  docType.Code,
+		Status:    "Доступен",
+	}
 
-	// Save file
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
+	// Файл сохраняется в хранилище (диск или S3) как первая версия документа
+	if err := dc.docService.Upload(c.Request.Context(), &doc, upload, content); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 		return
 	}
 
-	// Count existing documents for versioning
-	existingCount, err := dc.docService.Count(projectId, docType)
+	c.JSON(http.StatusCreated, doc)
+}
+
+// CreateUploadSession godoc
+// @Summary Start a resumable upload
+// @Description Declares file name, size and optional SHA-256; parts are sent with PATCH /api/documents/uploads/{id}
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param input body services.UploadSessionInput true "New document (projectId, taskId, type) or new version (documentId)"
+// @Success 201 {object} models.UploadSession
+// @Router /api/documents/uploads [post]
+func (dc *DocumentsController) CreateUploadSession(c *gin.Context) {
+	var input services.UploadSessionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	projectId, taskId := input.ProjectID, input.TaskID
+	if input.DocumentID != nil {
+		doc, err := dc.docService.GetByID(int(*input.DocumentID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		projectId, taskId = doc.ProjectID, doc.TaskID
+	}
+	if !dc.authorizeUpload(c, projectId, taskId) {
+		return
+	}
+
+	session, err := dc.uploadSessions.Create(c.MustGet("user").(*models.User), input)
 	if err != nil {
-		// Log warning but proceed with version 1?
-		// Better to just assume 0 if error is not critical, but here error likely means DB issue.
-		// Let's assume 0.
-		existingCount = 0
+		uploadError(c, err)
+		return
 	}
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, session)
+}
 
-	version := int(existingCount) + 1
+// GetUploadSession godoc
+// @Summary Resumable upload status
+// @Description Returns the accepted offset to resume an interrupted upload from
+// @Tags documents
+// @Produce json
+// @Param uploadId path string true "Upload session ID"
+// @Success 200 {object} models.UploadSession
+// @Router /api/documents/uploads/{uploadId} [get]
+func (dc *DocumentsController) GetUploadSession(c *gin.Context) {
+	session, err := dc.uploadSessions.Get(c.MustGet("user").(*models.User).ID, c.Param("uploadId"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(session.Received, 10))
+	c.JSON(http.StatusOK, session)
+}
 
-	// Create document record
-	doc := models.ProjectDocument{
-		ProjectID:   projectId,
-		TaskID:      taskId,
-		Name:        file.Filename,
-		Type:        docType,
-		UploadDate:  time.Now().UTC(),
-		Version:     version,
-		Author:      "Системный Администратор",
-		Status:      "Доступен",
-		FileName:    uniqueFileName,
-		FilePath:    filePath,
-		ContentType: file.Header.Get("Content-Type"),
-		Size:        file.Size,
+// UploadChunk godoc
+// @Summary Upload a part of the file
+// @Description Body is the raw part. Upload-Offset must equal the accepted offset; Upload-Checksum: "sha256 <base64>" is optional
+// @Tags documents
+// @Accept application/offset+octet-stream
+// @Produce json
+// @Param uploadId path string true "Upload session ID"
+// @Param Upload-Offset header int true "Offset of the part"
+// @Param Upload-Checksum header string false "sha256 <base64 digest of the part>"
+// @Success 200 {object} models.UploadSession
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/documents/uploads/{uploadId} [patch]
+func (dc *DocumentsController) UploadChunk(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Заголовок Upload-Offset обязателен"})
+		return
+	}
+	digest, err := chunkDigest(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := dc.docService.Create(&doc); err != nil {
-		// Remove uploaded file if database insert fails
-		os.Remove(filePath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	session, err := dc.uploadSessions.WriteChunk(c.MustGet("user").(*models.User).ID, c.Param("uploadId"), offset, c.Request.Body, digest)
+	if session != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(session.Received, 10))
+	}
+	if errors.Is(err, services.ErrUploadOffsetMismatch) {
+		// Клиент продолжает с принятого смещения
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "offset": session.Received})
+		return
+	}
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// CompleteUploadSession godoc
+// @Summary Finish a resumable upload
+// @Description Verifies SHA-256 and upload policy, then creates the document or its new version
+// @Tags documents
+// @Produce json
+// @Param uploadId path string true "Upload session ID"
+// @Success 201 {object} models.ProjectDocument
+// @Router /api/documents/uploads/{uploadId}/complete [post]
+func (dc *DocumentsController) CompleteUploadSession(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	session, err := dc.uploadSessions.Get(user.ID, c.Param("uploadId"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	// Права проверяются заново: за время загрузки пользователя могли исключить из команды
+	projectId, taskId := session.ProjectID, session.TaskID
+	if session.DocumentID != nil {
+		doc, err := dc.docService.GetByID(int(*session.DocumentID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+			return
+		}
+		projectId, taskId = doc.ProjectID, doc.TaskID
+	}
+	if !dc.authorizeUpload(c, projectId, taskId) {
 		return
 	}
 
+	doc, err := dc.uploadSessions.Complete(c.Request.Context(), user, session.ID)
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
 	c.JSON(http.StatusCreated, doc)
 }
 
+// AbortUploadSession godoc
+// @Summary Cancel a resumable upload
+// @Tags documents
+// @Param uploadId path string true "Upload session ID"
+// @Success 204
+// @Router /api/documents/uploads/{uploadId} [delete]
+func (dc *DocumentsController) AbortUploadSession(c *gin.Context) {
+	if err := dc.uploadSessions.Abort(c.MustGet("user").(*models.User).ID, c.Param("uploadId")); err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 // GetById godoc
 // @Summary Get document by ID
 // @Description Get document metadata by ID
@@ -196,6 +344,64 @@ func (dc *DocumentsController) GetByTask(c *gin.Context) {
 	c.JSON(http.StatusOK, docs)
 }
 
+// GetProjectArchive godoc
+// @Summary Download project documents as ZIP
+// @Description Streams a ZIP with folders "stage/document type" and manifest.csv
+// @Tags documents
+// @Produce application/zip
+// @Param projectId path int true "Project ID"
+// @Param versions query string false "all — include every version, otherwise only current ones"
+// @Success 200 {file} file
+// @Router /api/documents/project/{projectId}/archive [get]
+func (dc *DocumentsController) GetProjectArchive(c *gin.Context) {
+	projectId, err := strconv.ParseUint(c.Param("projectId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+	dc.sendArchive(c, services.ArchiveOptions{ProjectID: uint(projectId)}, fmt.Sprintf("project-%d-documents.zip", projectId))
+}
+
+// GetTaskArchive godoc
+// @Summary Download task documents as ZIP
+// @Tags documents
+// @Produce application/zip
+// @Param taskId path int true "Task ID"
+// @Param versions query string false "all — include every version, otherwise only current ones"
+// @Success 200 {file} file
+// @Router /api/documents/task/{taskId}/archive [get]
+func (dc *DocumentsController) GetTaskArchive(c *gin.Context) {
+	taskId, err := strconv.Atoi(c.Param("taskId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+	dc.sendArchive(c, services.ArchiveOptions{TaskID: &taskId}, fmt.Sprintf("task-%d-documents.zip", taskId))
+}
+
+// sendArchive собирает архив и отдает его потоком, не сохраняя на диск
+func (dc *DocumentsController) sendArchive(c *gin.Context, opts services.ArchiveOptions, name string) {
+	opts.AllVersions = c.Query("versions") == "all"
+	archive, err := dc.docService.BuildArchive(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if archive.Len() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Документов нет"})
+		return
+	}
+
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	// Ответ уже начат: при ошибке клиент получит оборванный архив, остается только записать ее в лог
+	if err := archive.Write(c.Request.Context(), c.Writer); err != nil {
+		log.Printf("⚠️ Document archive %s interrupted: %v", name, err)
+	}
+}
+
 // Download godoc
 // @Summary Download a document
 // @Description Download document file by ID
@@ -218,28 +424,8 @@ func (dc *DocumentsController) Download(c *gin.Context) {
 		return
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(doc.FilePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Файл не найден на сервере"})
-		return
-	}
-
-	// Open file
-	file, err := os.Open(doc.FilePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
-		return
-	}
-	defer file.Close()
-
-	// Set headers
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", doc.Name))
-	c.Header("Content-Type", doc.ContentType)
-
-	// Stream file
-	io.Copy(c.Writer, file)
+	file, err := dc.docService.Open(c.Request.Context(), doc)
+	sendDocumentFile(c, file, err, doc.Name, doc.ContentType)
 }
 
 // Delete godoc
@@ -263,19 +449,295 @@ func (dc *DocumentsController) Delete(c *gin.Context) {
 		return
 	}
 
-	// Delete file from disk if exists
-	if _, err := os.Stat(doc.FilePath); err == nil {
-		if err := os.Remove(doc.FilePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
+	// Delete database record and the file from the storage
+	if err := dc.docService.Remove(c.Request.Context(), doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetVersions godoc
+// @Summary List document versions
+// @Description Get all versions of a document, latest first
+// @Tags documents
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {array} models.DocumentRevision
+// @Router /api/documents/{id}/versions [get]
+func (dc *DocumentsController) GetVersions(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	revisions, err := dc.docService.GetRevisions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// UploadVersion godoc
+// @Summary Upload a new document version
+// @Description Upload a new file version; the document keeps its ID and type
+// @Tags documents
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param file formData file true "File to upload"
+// @Param comment formData string false "What changed"
+// @Success 201 {object} models.DocumentRevision
+// @Router /api/documents/{id}/versions [post]
+func (dc *DocumentsController) UploadVersion(c *gin.Context) {
+	doc, ok := dc.documentFromParam(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не выбран"})
+		return
+	}
+	content, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer content.Close()
+
+	// Новая версия проверяется по типу документа; старые документы без типа — только общей политикой
+	var docType *models.DocumentType
+	if doc.TypeCode != "" {
+		docType, err = dc.docTypeService.GetByCode(doc.TypeCode)
+		if errors.Is(err, services.ErrUnknownDocumentType) {
+			docType = nil
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 	}
+	upload := uploadOf(c, file)
+	if !dc.checkUpload(c, docType, &upload, content) {
+		return
+	}
 
-	// Delete database record
-	if err := dc.docService.Delete(doc); err != nil {
+	revision, err := dc.docService.AddRevision(c.Request.Context(), doc, upload, content)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+	c.JSON(http.StatusCreated, revision)
+}
+
+// DownloadVersion godoc
+// @Summary Download a document version
+// @Tags documents
+// @Produce application/octet-stream
+// @Param id path int true "Document ID"
+// @Param number path int true "Version number"
+// @Success 200 {file} file
+// @Router /api/documents/{id}/versions/{number}/download [get]
+func (dc *DocumentsController) DownloadVersion(c *gin.Context) {
+	revision, ok := dc.revisionFromParams(c)
+	if !ok {
+		return
+	}
+
+	file, err := dc.docService.OpenRevision(c.Request.Context(), revision)
+	sendDocumentFile(c, file, err, revision.Name, revision.ContentType)
+}
+
+// RestoreVersion godoc
+// @Summary Restore a document version
+// @Description Make an earlier version current by adding it as a new version
+// @Tags documents
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param number path int true "Version number"
+// @Success 201 {object} models.DocumentRevision
+// @Router /api/documents/{id}/versions/{number}/restore [post]
+func (dc *DocumentsController) RestoreVersion(c *gin.Context) {
+	doc, ok := dc.documentFromParam(c)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version number"})
+		return
+	}
+
+	revision, err := dc.docService.RestoreRevision(doc, number, c.MustGet("user").(*models.User))
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusCreated, revision)
+}
 
-	c.Status(http.StatusNoContent)
+func (dc *DocumentsController) documentFromParam(c *gin.Context) (*models.ProjectDocument, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+	doc, err := dc.docService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return nil, false
+	}
+	return doc, true
+}
+
+func (dc *DocumentsController) revisionFromParams(c *gin.Context) (*models.DocumentRevision, bool) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version number"})
+		return nil, false
+	}
+	revision, err := dc.docService.GetRevision(id, number)
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return revision, true
+}
+
+// authorizeUpload проверяет, что пользователь видит проект и может добавлять в него документы:
+// документы задачи добавляет тот, кто может редактировать задачу; задача должна быть из этого проекта
+func (dc *DocumentsController) authorizeUpload(c *gin.Context, projectId uint, taskId *int) bool {
+	allowed, err := dc.teamService.CanViewProject(helpers.ProjectScope(c), projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return false
+	}
+
+	if taskId != nil {
+		taskProject, err := dc.teamService.ProjectIDOf(models.EntityTask, uint(*taskId))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if err != nil || taskProject != projectId {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Task does not belong to the project"})
+			return false
+		}
+	}
+
+	user := c.MustGet("user").(*models.User)
+	var canEdit bool
+	if taskId != nil {
+		canEdit, err = dc.teamService.CanEditTask(user.ID, helpers.Access(c), uint(*taskId))
+	} else {
+		canEdit, err = dc.teamService.CanEditProjectFiles(user.ID, helpers.Access(c), projectId)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !canEdit {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: task:edit required, or task:edit_own for own tasks"})
+		return false
+	}
+	return true
+}
+
+// checkUpload проверяет файл политикой загрузки; при отказе отвечает ошибкой
+func (dc *DocumentsController) checkUpload(c *gin.Context, docType *models.DocumentType, upload *services.DocumentUpload, content io.ReadSeeker) bool {
+	if err := dc.uploadPolicy.Check(c.Request.Context(), docType, upload, content); err != nil {
+		uploadError(c, err)
+		return false
+	}
+	return true
+}
+
+// uploadError отвечает на ошибку политики загрузки и докачиваемой загрузки
+func uploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadTooLarge), errors.Is(err, services.ErrUploadTooLargeToScan):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadForbidden), errors.Is(err, services.ErrUploadContentMismatch),
+		errors.Is(err, services.ErrDocumentFileRejected), errors.Is(err, services.ErrUnknownDocumentType),
+		errors.Is(err, services.ErrUploadSessionInvalid), errors.Is(err, services.ErrUploadIncomplete),
+		errors.Is(err, services.ErrUploadChunkOverflow):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadInfected), errors.Is(err, services.ErrUploadChecksum):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadScanFailed):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.ErrUploadScanFailed.Error()})
+	case errors.Is(err, services.ErrUploadSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadCompleting):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	}
+}
+
+// chunkDigest разбирает заголовок Upload-Checksum в формате tus: "sha256 <base64>"
+func chunkDigest(header string) ([]byte, error) {
+	if header == "" {
+		return nil, nil
+	}
+	algorithm, value, _ := strings.Cut(strings.TrimSpace(header), " ")
+	digest, err := base64.StdEncoding.DecodeString(value)
+	if !strings.EqualFold(algorithm, "sha256") || err != nil || len(digest) != sha256.Size {
+		return nil, errors.New("Upload-Checksum: ожидается \"sha256 <base64>\"")
+	}
+	return digest, nil
+}
+
+// uploadOf описывает загружаемый файл и его автора
+func uploadOf(c *gin.Context, file *multipart.FileHeader) services.DocumentUpload {
+	return services.DocumentUpload{
+		Name:        file.Filename,
+		ContentType: file.Header.Get("Content-Type"),
+		Size:        file.Size,
+		Comment:     c.PostForm("comment"),
+		UploadedBy:  c.MustGet("user").(*models.User),
+	}
+}
+
+// sendDocumentFile отдает файл документа как вложение
+func sendDocumentFile(c *gin.Context, file io.ReadCloser, err error, name, contentType string) {
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Файл не найден на сервере"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		return
+	}
+	defer file.Close()
+
+	// Set headers
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Header("Content-Type", contentType)
+
+	// Stream file
+	io.Copy(c.Writer, file)
 }
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"net/http"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProjectStatusController struct {
+	service *services.ProjectStatusService
+}
+
+func NewProjectStatusController(service *services.ProjectStatusService) *ProjectStatusController {
+	return &ProjectStatusController{service: service}
+}
+
+// GetStatusSets возвращает наборы статусов по типам проектов
+// @Summary Get project status sets
+// @Tags project-statuses
+// @Produce json
+// @Param projectType query string false "Тип проекта"
+// @Router /api/project-statuses [get]
+func (c *ProjectStatusController) GetStatusSets(ctx *gin.Context) {
+	if projectType := ctx.Query("projectType"); projectType != "" {
+		if !models.IsValidProjectType(projectType) {
+			ctx.Error(middleware.NewAppError(http.StatusBadRequest, "Недопустимый тип проекта", nil))
+			return
+		}
+		ctx.JSON(http.StatusOK, c.service.GetStatusSet(projectType))
+		return
+	}
+	ctx.JSON(http.StatusOK, c.service.GetAllStatusSets())
+}
+
+// ReplaceStatusSet заменяет набор статусов для типа проекта
+// @Summary Replace project status set
+// @Tags project-statuses
+// @Accept json
+// @Produce json
+// @Param projectType path string true "Тип проекта"
+// @Router /api/project-statuses/{projectType} [put]
+func (c *ProjectStatusController) ReplaceStatusSet(ctx *gin.Context) {
+	projectType := ctx.Param("projectType")
+	if !models.IsValidProjectType(projectType) {
+		ctx.Error(middleware.NewAppError(http.StatusBadRequest, "Недопустимый тип проекта", nil))
+		return
+	}
+
+	var statuses []models.ProjectStatusDefinition
+	if err := ctx.ShouldBindJSON(&statuses); err != nil {
+		ctx.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	if err := c.service.ReplaceStatusSet(projectType, statuses); err != nil {
+		ctx.Error(middleware.NewAppError(http.StatusBadRequest, err.Error(), err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.service.GetStatusSet(projectType))
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProjectTeamController struct {
+	service *services.ProjectTeamService
+}
+
+func NewProjectTeamController(service *services.ProjectTeamService) *ProjectTeamController {
+	return &ProjectTeamController{service: service}
+}
+
+// GetMembers возвращает команду проекта
+func (ctrl *ProjectTeamController) GetMembers(c *gin.Context) {
+	projectID, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID проекта", err))
+		return
+	}
+
+	members, err := ctrl.service.GetMembers(projectID)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить команду проекта", err))
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// AddMember добавляет участника в команду проекта
+func (ctrl *ProjectTeamController) AddMember(c *gin.Context) {
+	projectID, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID проекта", err))
+		return
+	}
+
+	var member models.ProjectMember
+	if err := c.ShouldBindJSON(&member); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	if err := ctrl.service.AddMember(projectID, &member); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, err.Error(), err))
+		return
+	}
+	c.JSON(http.StatusCreated, member)
+}
+
+// RemoveMember исключает участника из команды проекта
+func (ctrl *ProjectTeamController) RemoveMember(c *gin.Context) {
+	projectID, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID проекта", err))
+		return
+	}
+	memberID, err := helpers.ParseIDParam(c, "memberId")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID участника", err))
+		return
+	}
+
+	if err := ctrl.service.RemoveMember(projectID, memberID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Error(middleware.NewAppError(http.StatusNotFound, "Участник не найден", err))
+			return
+		}
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось исключить участника", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Участник исключен из команды"})
+}
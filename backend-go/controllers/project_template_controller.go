@@ -1,22 +1,43 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"portal-razvitie/helpers"
 	"portal-razvitie/models"
 	"portal-razvitie/services"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type ProjectTemplateController struct {
-	service *services.ProjectTemplateService
-	db      *gorm.DB
+	service           *services.ProjectTemplateService
+	migrationService  *services.TemplateMigrationService
+	exchangeService   *services.TemplateExchangeService
+	simulationService *services.TemplateSimulationService
+	db                *gorm.DB
 }
 
-func NewProjectTemplateController(service *services.ProjectTemplateService, db *gorm.DB) *ProjectTemplateController {
-	return &ProjectTemplateController{service: service, db: db}
+func NewProjectTemplateController(
+	service *services.ProjectTemplateService,
+	migrationService *services.TemplateMigrationService,
+	exchangeService *services.TemplateExchangeService,
+	simulationService *services.TemplateSimulationService,
+	db *gorm.DB,
+) *ProjectTemplateController {
+	return &ProjectTemplateController{
+		service:           service,
+		migrationService:  migrationService,
+		exchangeService:   exchangeService,
+		simulationService: simulationService,
+		db:                db,
+	}
 }
 
 // AddTask добавляет существующую TaskDefinition в шаблон
@@ -278,13 +299,16 @@ func (c *ProjectTemplateController) GetKnownTasks(ctx *gin.Context) {
 		ResponsibleRole string `json:"responsibleRole"`
 		TaskType        string `json:"taskType"`
 		TaskTemplateID  *uint  `json:"taskTemplateId"`
+		ProjectStatus   string `json:"projectStatus"`
+		StatusOrder     int    `json:"statusOrder"`
 	}
 
 	var tasks []KnownTask
 	// Select distinct tasks by name, prioritizing most recent ones
 	err := c.db.Raw(`
 		SELECT DISTINCT ON ("Name") 
-			"Code", "Name", "Duration", "Stage", "ResponsibleRole", "TaskType", "TaskTemplateID"
+			"Code", "Name", "Duration", "Stage", "ResponsibleRole", "TaskType", "TaskTemplateID",
+			"ProjectStatus", "StatusOrder"
 		FROM "TemplateTask"
 		ORDER BY "Name", "CreatedAt" DESC
 	`).Scan(&tasks).Error
@@ -296,3 +320,256 @@ func (c *ProjectTemplateController) GetKnownTasks(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, tasks)
 }
+
+// Publish публикует черновик шаблона как новую версию
+func (c *ProjectTemplateController) Publish(ctx *gin.Context) {
+	id, err := helpers.ParseIDParam(ctx, "id")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		return
+	}
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil && ctx.Request.ContentLength > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := ctx.MustGet("user").(*models.User)
+	version, err := c.service.Publish(uint(id), user.ID, req.Comment)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, version)
+}
+
+// GetVersions возвращает список опубликованных версий шаблона
+func (c *ProjectTemplateController) GetVersions(ctx *gin.Context) {
+	id, err := helpers.ParseIDParam(ctx, "id")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		return
+	}
+
+	versions, err := c.service.GetVersions(uint(id))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, versions)
+}
+
+// GetVersion возвращает версию шаблона с задачами
+func (c *ProjectTemplateController) GetVersion(ctx *gin.Context) {
+	id, err := helpers.ParseIDParam(ctx, "id")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		return
+	}
+
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+
+	v, err := c.service.GetVersion(uint(id), version)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, v)
+}
+
+// MigrateProject переводит проект на указанную версию шаблона.
+// С dryRun=true возвращает только план изменений
+func (c *ProjectTemplateController) MigrateProject(ctx *gin.Context) {
+	projectID, err := helpers.ParseIDParam(ctx, "id")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid project ID"})
+		return
+	}
+
+	var req struct {
+		Version int  `json:"version" binding:"required,gt=0"`
+		DryRun  bool `json:"dryRun"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var plan *services.TemplateMigrationPlan
+	if req.DryRun {
+		plan, err = c.migrationService.PlanMigration(uint(projectID), req.Version)
+	} else {
+		user := ctx.MustGet("user").(*models.User)
+		plan, err = c.migrationService.MigrateProject(uint(projectID), req.Version, user.ID)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, plan)
+}
+
+// templateExchangeFormat определяет формат обмена по параметру format или Content-Type
+func templateExchangeFormat(ctx *gin.Context) string {
+	if format := strings.ToLower(ctx.Query("format")); format != "" {
+		if format == "yml" {
+			return "yaml"
+		}
+		return format
+	}
+	contentType := ctx.ContentType()
+	switch {
+	case strings.Contains(contentType, "yaml"):
+		return "yaml"
+	case strings.Contains(contentType, "xml"):
+		return "bpmn"
+	default:
+		return "json"
+	}
+}
+
+// Export выгружает шаблон в JSON, YAML или BPMN 2.0.
+// ?version=N выгружает опубликованную версию вместо черновика
+func (c *ProjectTemplateController) Export(ctx *gin.Context) {
+	id, err := helpers.ParseIDParam(ctx, "id")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		return
+	}
+
+	version := 0
+	if v := ctx.Query("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+	}
+
+	doc, err := c.exchangeService.Export(uint(id), version)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var (
+		data        []byte
+		contentType string
+		extension   string
+	)
+	switch format := templateExchangeFormat(ctx); format {
+	case "bpmn":
+		data, err = c.exchangeService.MarshalBPMN(doc)
+		contentType, extension = "application/xml", "bpmn"
+	case "yaml":
+		data, err = c.exchangeService.MarshalDocument(doc, format)
+		contentType, extension = "application/x-yaml", "yaml"
+	case "json":
+		data, err = c.exchangeService.MarshalDocument(doc, format)
+		contentType, extension = "application/json", "json"
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format: " + format})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("project-template-%d", id)
+	if version > 0 {
+		filename += fmt.Sprintf("-v%d", version)
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", filename, extension))
+	ctx.Data(http.StatusOK, contentType, data)
+}
+
+// Import создает новый неактивный шаблон из файла JSON, YAML или BPMN 2.0.
+// ?name= переопределяет название шаблона из файла
+func (c *ProjectTemplateController) Import(ctx *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, services.MaxTemplateImportSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file exceeds %d MB", services.MaxTemplateImportSize>>20)})
+		return
+	}
+	if err != nil || len(data) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "empty request body"})
+		return
+	}
+
+	var doc *services.TemplateExchangeDocument
+	switch format := templateExchangeFormat(ctx); format {
+	case "bpmn":
+		doc, err = c.exchangeService.UnmarshalBPMN(data)
+	case "json", "yaml":
+		doc, err = c.exchangeService.UnmarshalDocument(data, format)
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format: " + format})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := c.exchangeService.Import(doc, ctx.Query("name"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, result)
+}
+
+// Simulate выполняет пробный прогон шаблона (сохраненного или переданного в запросе)
+// без создания проекта. Дата старта — YYYY-MM-DD или RFC3339
+func (c *ProjectTemplateController) Simulate(ctx *gin.Context) {
+	var req struct {
+		services.TemplateSimulationRequest
+		StartDate string `json:"startDate" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		startDate, err = time.Parse(time.RFC3339, req.StartDate)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid startDate"})
+		return
+	}
+	req.TemplateSimulationRequest.StartDate = startDate
+
+	// Сохраненный шаблон можно указать в пути: /project-templates/:id/simulate
+	if ctx.Param("id") != "" {
+		id, err := helpers.ParseIDParam(ctx, "id")
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+			return
+		}
+		req.TemplateID = &id
+	}
+
+	result, err := c.simulationService.Simulate(req.TemplateSimulationRequest)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
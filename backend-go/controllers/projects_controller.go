@@ -1,28 +1,35 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"portal-razvitie/helpers"
 	"portal-razvitie/middleware"
 	"portal-razvitie/models"
 	"portal-razvitie/services"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type ProjectsController struct {
 	projectService *services.ProjectService
+	statusService  *services.ProjectStatusService
+	storeService   *services.StoreService
 }
 
-func NewProjectsController(projectService *services.ProjectService) *ProjectsController {
+func NewProjectsController(projectService *services.ProjectService, statusService *services.ProjectStatusService, storeService *services.StoreService) *ProjectsController {
 	return &ProjectsController{
 		projectService: projectService,
+		statusService:  statusService,
+		storeService:   storeService,
 	}
 }
 
-// GetProjects возвращает список всех проектов
+// GetProjects возвращает список проектов, видимых пользователю
 func (ctrl *ProjectsController) GetProjects(c *gin.Context) {
-	projects, err := ctrl.projectService.FindAll()
+	projects, err := ctrl.projectService.FindAll(helpers.ProjectScope(c))
 	if err != nil {
 		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить список проектов", err))
 		return
@@ -65,6 +72,22 @@ func (ctrl *ProjectsController) CreateProject(c *gin.Context) {
 		return
 	}
 
+	// project:create может быть выдано на регион/ЦФО: проверяем область магазина и проекта
+	store, err := ctrl.storeService.GetStore(project.StoreID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Магазин не найден", err))
+		return
+	}
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить магазин", err))
+		return
+	}
+	area := (&models.Project{Region: project.Region, CFO: project.CFO, Store: store}).Area()
+	if !helpers.Access(c).HasPermissionIn(models.PermProjectCreate, area.Region, area.CFO) {
+		c.Error(middleware.NewAppError(http.StatusForbidden, "Недостаточно прав для создания проекта в этом регионе", nil))
+		return
+	}
+
 	// Создание проекта через сервис (с транзакцией)
 	user := c.MustGet("user").(*models.User)
 	if err := ctrl.projectService.CreateProject(&project, user.ID); err != nil {
@@ -105,7 +128,8 @@ func (ctrl *ProjectsController) UpdateProject(c *gin.Context) {
 	c.JSON(http.StatusOK, project)
 }
 
-// UpdateProjectStatus обновляет статус проекта
+// UpdateProjectStatus вручную переводит проект в другой статус.
+// Переход проверяется машиной состояний, установленный статус закрепляется
 func (ctrl *ProjectsController) UpdateProjectStatus(c *gin.Context) {
 	id, err := helpers.ParseIDParam(c, "id")
 	if err != nil {
@@ -115,21 +139,34 @@ func (ctrl *ProjectsController) UpdateProjectStatus(c *gin.Context) {
 
 	var request struct {
 		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
 		return
 	}
+	request.Reason = strings.TrimSpace(request.Reason)
 
-	// Валидация статуса через константы
-	if !models.IsValidProjectStatus(request.Status) {
-		c.Error(middleware.NewAppError(http.StatusBadRequest, "Недопустимый статус проекта", nil))
+	project, err := ctrl.projectService.FindByID(uint(id))
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusNotFound, "Проект не найден", err))
 		return
 	}
 
 	user := c.MustGet("user").(*models.User)
-	if err := ctrl.projectService.UpdateStatus(uint(id), request.Status, user.ID); err != nil {
+	area := project.Area()
+	roles := helpers.Access(c).RolesIn(area.Region, area.CFO)
+	if err := ctrl.statusService.CheckTransition(project, request.Status, request.Reason, roles); err != nil {
+		c.Error(middleware.NewAppError(statusTransitionErrorCode(err), err.Error(), err))
+		return
+	}
+
+	if err := ctrl.projectService.UpdateStatus(uint(id), project.Status, request.Status, request.Reason, user.ID); err != nil {
+		if errors.Is(err, services.ErrStatusChanged) {
+			c.Error(middleware.NewAppError(http.StatusConflict, err.Error(), err))
+			return
+		}
 		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось обновить статус проекта", err))
 		return
 	}
@@ -137,6 +174,70 @@ func (ctrl *ProjectsController) UpdateProjectStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Статус обновлен"})
 }
 
+// GetStatusTransitions возвращает переходы, доступные из текущего статуса проекта
+func (ctrl *ProjectsController) GetStatusTransitions(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID проекта", err))
+		return
+	}
+
+	project, err := ctrl.projectService.FindByID(uint(id))
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusNotFound, "Проект не найден", err))
+		return
+	}
+
+	area := project.Area()
+	transitions, err := ctrl.statusService.AvailableTransitions(project, helpers.Access(c).RolesIn(area.Region, area.CFO))
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить переходы статуса", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currentStatus": project.Status,
+		"statusPinned":  project.StatusPinned,
+		"transitions":   transitions,
+	})
+}
+
+// UnpinProjectStatus снимает закрепление ручного статуса и пересчитывает статус по задачам
+func (ctrl *ProjectsController) UnpinProjectStatus(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID проекта", err))
+		return
+	}
+
+	if err := ctrl.projectService.UnpinStatus(uint(id)); err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось снять закрепление статуса", err))
+		return
+	}
+
+	user := c.MustGet("user").(*models.User)
+	if err := ctrl.statusService.UpdateProjectStatus(uint(id), user.ID); err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось пересчитать статус проекта", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Закрепление статуса снято"})
+}
+
+// statusTransitionErrorCode подбирает HTTP-код для ошибки перехода статуса
+func statusTransitionErrorCode(err error) int {
+	switch {
+	case errors.Is(err, services.ErrStatusTransitionForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrStatusReasonRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrStatusTransitionNotAllowed), errors.Is(err, services.ErrStatusGuardFailed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // DeleteProject удаляет проект
 func (ctrl *ProjectsController) DeleteProject(c *gin.Context) {
 	id, err := helpers.ParseIDParam(c, "id")
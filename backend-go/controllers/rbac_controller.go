@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"portal-razvitie/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type RBACController struct {
@@ -66,8 +68,15 @@ func (ctrl *RBACController) UpdateRolePermissions(c *gin.Context) {
 	}
 
 	updatedRole, err := ctrl.rbacService.UpdateRolePermissions(id, body.PermissionCodes)
+	if errors.Is(err, services.ErrUnknownPermission) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
 	if err != nil {
-		// Simple error check, could be more specific (e.g. 404)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
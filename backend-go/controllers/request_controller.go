@@ -1,20 +1,25 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"portal-razvitie/helpers"
 	"portal-razvitie/models"
+	"portal-razvitie/repositories"
 	"portal-razvitie/services"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type RequestController struct {
-	service *services.RequestService
+	service     *services.RequestService
+	teamService *services.ProjectTeamService
 }
 
-func NewRequestController(service *services.RequestService) *RequestController {
-	return &RequestController{service: service}
+func NewRequestController(service *services.RequestService, teamService *services.ProjectTeamService) *RequestController {
+	return &RequestController{service: service, teamService: teamService}
 }
 
 // CreateRequest создает новую заявку
@@ -26,6 +31,9 @@ func (ctrl *RequestController) CreateRequest(c *gin.Context) {
 		return
 	}
 
+	// Инициатор — текущий пользователь, а не значение из тела запроса
+	request.CreatedByUserID = c.MustGet("user").(*models.User).ID
+
 	if err := ctrl.service.CreateRequest(&request); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -43,15 +51,44 @@ func (ctrl *RequestController) GetRequest(c *gin.Context) {
 		return
 	}
 
-	request, err := ctrl.service.GetRequest(uint(id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+	request, ok := ctrl.visibleRequest(c, uint(id))
+	if !ok {
 		return
 	}
 
 	c.JSON(http.StatusOK, request)
 }
 
+// visibleRequest загружает заявку и проверяет, что текущий пользователь ее видит;
+// иначе отвечает 404 и возвращает false
+func (ctrl *RequestController) visibleRequest(c *gin.Context, id uint) (*models.Request, bool) {
+	request, err := ctrl.service.GetRequest(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return nil, false
+	}
+
+	allowed, err := ctrl.teamService.CanViewRequest(helpers.ProjectScope(c), request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заявка не найдена"})
+		return nil, false
+	}
+	return request, true
+}
+
+// actionError отвечает на ошибку действия с заявкой: нехватка прав — 403, остальное — 400
+func actionError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, services.ErrRequestForbidden) {
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
 // GetAllRequests возвращает все заявки или фильтрованные по параметрам
 // GET /api/requests
 // Query params: createdBy, assignedTo, status
@@ -62,6 +99,7 @@ func (ctrl *RequestController) GetAllRequests(c *gin.Context) {
 
 	var requests []models.Request
 	var err error
+	scope := helpers.ProjectScope(c)
 
 	// Фильтрация по создателю
 	if createdByStr != "" {
@@ -70,7 +108,7 @@ func (ctrl *RequestController) GetAllRequests(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ID создателя"})
 			return
 		}
-		requests, err = ctrl.service.GetRequestsByCreator(uint(createdBy))
+		requests, err = ctrl.service.GetRequestsByCreator(scope, uint(createdBy))
 	} else if assignedToStr != "" {
 		// Фильтрация по ответственному
 		assignedTo, parseErr := strconv.ParseUint(assignedToStr, 10, 32)
@@ -78,10 +116,10 @@ func (ctrl *RequestController) GetAllRequests(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ID ответственного"})
 			return
 		}
-		requests, err = ctrl.service.GetRequestsByAssignee(uint(assignedTo))
+		requests, err = ctrl.service.GetRequestsByAssignee(scope, uint(assignedTo))
 	} else {
 		// Все заявки
-		requests, err = ctrl.service.GetAllRequests()
+		requests, err = ctrl.service.GetAllRequests(scope)
 	}
 
 	if err != nil {
@@ -112,16 +150,12 @@ func (ctrl *RequestController) TakeInWork(c *gin.Context) {
 		return
 	}
 
-	var body struct {
-		UserID uint `json:"userId" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := ctrl.visibleRequest(c, uint(id)); !ok {
 		return
 	}
 
-	if err := ctrl.service.TakeInWork(uint(id), body.UserID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := ctrl.service.TakeInWork(uint(id), c.MustGet("user").(*models.User).ID); err != nil {
+		actionError(c, err)
 		return
 	}
 
@@ -139,7 +173,6 @@ func (ctrl *RequestController) AnswerRequest(c *gin.Context) {
 	}
 
 	var body struct {
-		UserID   uint   `json:"userId" binding:"required"`
 		Response string `json:"response" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -147,8 +180,12 @@ func (ctrl *RequestController) AnswerRequest(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.service.AnswerRequest(uint(id), body.UserID, body.Response); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := ctrl.visibleRequest(c, uint(id)); !ok {
+		return
+	}
+
+	if err := ctrl.service.AnswerRequest(uint(id), c.MustGet("user").(*models.User).ID, body.Response); err != nil {
+		actionError(c, err)
 		return
 	}
 
@@ -165,16 +202,12 @@ func (ctrl *RequestController) CloseRequest(c *gin.Context) {
 		return
 	}
 
-	var body struct {
-		UserID uint `json:"userId" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := ctrl.visibleRequest(c, uint(id)); !ok {
 		return
 	}
 
-	if err := ctrl.service.CloseRequest(uint(id), body.UserID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := ctrl.service.CloseRequest(uint(id), c.MustGet("user").(*models.User).ID); err != nil {
+		actionError(c, err)
 		return
 	}
 
@@ -192,7 +225,6 @@ func (ctrl *RequestController) RejectRequest(c *gin.Context) {
 	}
 
 	var body struct {
-		UserID uint   `json:"userId" binding:"required"`
 		Reason string `json:"reason" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -200,8 +232,12 @@ func (ctrl *RequestController) RejectRequest(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.service.RejectRequest(uint(id), body.UserID, body.Reason); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := ctrl.visibleRequest(c, uint(id)); !ok {
+		return
+	}
+
+	if err := ctrl.service.RejectRequest(uint(id), c.MustGet("user").(*models.User).ID, body.Reason); err != nil {
+		actionError(c, err)
 		return
 	}
 
@@ -209,7 +245,7 @@ func (ctrl *RequestController) RejectRequest(c *gin.Context) {
 	c.JSON(http.StatusOK, request)
 }
 
-// UpdateRequest обновляет заявку
+// UpdateRequest изменяет название, описание, приоритет и срок заявки
 // PUT /api/requests/:id
 func (ctrl *RequestController) UpdateRequest(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -218,15 +254,29 @@ func (ctrl *RequestController) UpdateRequest(c *gin.Context) {
 		return
 	}
 
-	var request models.Request
-	if err := c.ShouldBindJSON(&request); err != nil {
+	var body struct {
+		Title       string     `json:"title" binding:"required"`
+		Description string     `json:"description"`
+		Priority    string     `json:"priority"`
+		DueDate     *time.Time `json:"dueDate"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	request.ID = uint(id)
-	if err := ctrl.service.UpdateRequest(&request); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if _, ok := ctrl.visibleRequest(c, uint(id)); !ok {
+		return
+	}
+
+	request, err := ctrl.service.UpdateRequest(uint(id), c.MustGet("user").(*models.User).ID, services.RequestUpdate{
+		Title:       body.Title,
+		Description: body.Description,
+		Priority:    body.Priority,
+		DueDate:     body.DueDate,
+	})
+	if err != nil {
+		actionError(c, err)
 		return
 	}
 
@@ -242,23 +292,20 @@ func (ctrl *RequestController) DeleteRequest(c *gin.Context) {
 		return
 	}
 
-	var body struct {
-		UserID uint `json:"userId" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := ctrl.visibleRequest(c, uint(id)); !ok {
 		return
 	}
 
-	if err := ctrl.service.DeleteRequest(uint(id), body.UserID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := ctrl.service.DeleteRequest(uint(id), c.MustGet("user").(*models.User).ID); err != nil {
+		actionError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Заявка успешно удалена"})
 }
 
-// GetUserRequestsStats возвращает статистику по заявкам пользователя
+// GetUserRequestsStats возвращает статистику по заявкам пользователя: своим, замещаемых
+// сотрудников или любого — при доступе ко всем проектам
 // GET /api/requests/stats/:userId
 func (ctrl *RequestController) GetUserRequestsStats(c *gin.Context) {
 	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
@@ -267,6 +314,11 @@ func (ctrl *RequestController) GetUserRequestsStats(c *gin.Context) {
 		return
 	}
 
+	if !canSeeUserStats(helpers.ProjectScope(c), uint(userID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к статистике пользователя"})
+		return
+	}
+
 	stats, err := ctrl.service.GetUserRequestsStats(uint(userID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -275,3 +327,15 @@ func (ctrl *RequestController) GetUserRequestsStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+func canSeeUserStats(scope repositories.ProjectScope, userID uint) bool {
+	if scope.ViewAll {
+		return true
+	}
+	for _, id := range append([]uint{scope.UserID}, scope.ActingFor...) {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
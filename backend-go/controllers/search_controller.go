@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchController struct {
+	service *services.SearchService
+}
+
+func NewSearchController(service *services.SearchService) *SearchController {
+	return &SearchController{service: service}
+}
+
+// Search ищет по проектам, магазинам, задачам, комментариям, заявкам и документам:
+// ?q=отказ арендодателя&types=project,document&limit=20
+func (ctrl *SearchController) Search(c *gin.Context) {
+	query := services.SearchQuery{Text: c.Query("q")}
+	if types := c.Query("types"); types != "" {
+		query.Types = strings.Split(types, ",")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверное число результатов", err))
+			return
+		}
+		query.Limit = n
+	}
+
+	results, err := ctrl.service.Search(helpers.ProjectScope(c), query)
+	if errors.Is(err, services.ErrSearchQueryEmpty) || errors.Is(err, services.ErrSearchTypeUnknown) {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, err.Error(), err))
+		return
+	}
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось выполнить поиск", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"query": query.Text, "results": results})
+}
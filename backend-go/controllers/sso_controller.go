@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/middleware"
+	"portal-razvitie/oidc"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SSOController struct {
+	service     *services.SSOService
+	authService *services.AuthService
+}
+
+func NewSSOController(service *services.SSOService, authService *services.AuthService) *SSOController {
+	return &SSOController{service: service, authService: authService}
+}
+
+// ssoBindingCookie cookie, привязывающая незавершенный вход к браузеру, который его начал
+const ssoBindingCookie = "sso_binding"
+
+// Authorize возвращает адрес страницы входа провайдера, на который фронтенд перенаправляет пользователя,
+// и ставит браузеру cookie привязки входа
+func (ctrl *SSOController) Authorize(c *gin.Context) {
+	binding := oidc.NewBinding()
+	url, err := ctrl.service.AuthorizationURL(c.Request.Context(), binding)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadGateway, "Провайдер входа недоступен", err))
+		return
+	}
+	setBindingCookie(c, binding, int(oidc.StateTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+// Callback завершает вход по коду и state, полученным фронтендом от провайдера, и выдает токен сеанса
+func (ctrl *SSOController) Callback(c *gin.Context) {
+	var body struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	binding, _ := c.Cookie(ssoBindingCookie)
+	user, perms, err := ctrl.service.Callback(c.Request.Context(), body.Code, body.State, binding)
+	if err != nil {
+		c.Error(ssoError(err))
+		return
+	}
+	setBindingCookie(c, "", -1)
+	c.JSON(http.StatusOK, UserWithPerms{User: *user, Permissions: perms, Session: ctrl.authService.IssueSession(user)})
+}
+
+// setBindingCookie ставит (maxAge > 0) или удаляет (maxAge < 0) cookie привязки входа.
+// Она нужна только запросам /api/auth/oidc и недоступна скриптам страницы
+func setBindingCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ssoBindingCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ssoError сопоставляет ошибки SSOService с HTTP-статусами
+func ssoError(err error) *middleware.AppError {
+	switch {
+	case errors.Is(err, oidc.ErrInvalidState):
+		return middleware.NewAppError(http.StatusUnauthorized, "Сеанс входа истек, повторите вход", err)
+	case errors.Is(err, oidc.ErrInvalidToken), errors.Is(err, oidc.ErrTokenExpired), errors.Is(err, oidc.ErrExchange):
+		return middleware.NewAppError(http.StatusUnauthorized, "Провайдер не подтвердил вход", err)
+	case errors.Is(err, services.ErrSSONoRole), errors.Is(err, services.ErrSSOLoginTaken):
+		return middleware.NewAppError(http.StatusForbidden, err.Error(), err)
+	case errors.Is(err, services.ErrUserInactive):
+		return middleware.NewAppError(http.StatusForbidden, "Пользователь деактивирован", err)
+	default:
+		return middleware.NewAppError(http.StatusBadGateway, "Не удалось выполнить вход через провайдера", err)
+	}
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"portal-razvitie/helpers"
 	"portal-razvitie/models"
 	"portal-razvitie/services"
 	"strconv"
@@ -12,12 +13,14 @@ import (
 type TasksController struct {
 	taskService     *services.TaskService
 	activityService *services.ActivityService
+	teamService     *services.ProjectTeamService
 }
 
-func NewTasksController(taskService *services.TaskService, activityService *services.ActivityService) *TasksController {
+func NewTasksController(taskService *services.TaskService, activityService *services.ActivityService, teamService *services.ProjectTeamService) *TasksController {
 	return &TasksController{
 		taskService:     taskService,
 		activityService: activityService,
+		teamService:     teamService,
 	}
 }
 
@@ -41,30 +44,17 @@ func (tc *TasksController) GetHistory(c *gin.Context) {
 }
 
 // GetAllTasks godoc
-// @Summary Get all tasks (filtered by user role)
+// @Summary Get all tasks (filtered by project visibility)
 // @Produce json
 // @Router /api/tasks [get]
 func (tc *TasksController) GetAllTasks(c *gin.Context) {
-	// Get current user from context (set by AuthMiddleware)
-	userInterface, exists := c.Get("user")
-	if !exists {
+	if _, exists := c.Get("user"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	user := userInterface.(*models.User)
-
-	var tasks []models.ProjectTask
-	var err error
-
-	// Admin and БА see all tasks
-	if user.Role == "admin" || user.Role == "БА" {
-		tasks, err = tc.taskService.GetAllTasks()
-	} else {
-		// Other roles see only their assigned tasks
-		tasks, err = tc.taskService.GetTasksByResponsibleUser(user.ID)
-	}
-
+	// Задачи проектов, видимых пользователю (все — при project:view_all)
+	tasks, err := tc.taskService.GetAllTasks(helpers.ProjectScope(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -73,7 +63,7 @@ func (tc *TasksController) GetAllTasks(c *gin.Context) {
 }
 
 // GetProjectTasks godoc
-// @Summary Get all tasks for a project (visible to all roles)
+// @Summary Get all tasks for a project (visible to the project team)
 // @Router /api/tasks/project/{projectId} [get]
 func (tc *TasksController) GetProjectTasks(c *gin.Context) {
 	projectId, err := strconv.Atoi(c.Param("projectId"))
@@ -88,7 +78,7 @@ func (tc *TasksController) GetProjectTasks(c *gin.Context) {
 		return
 	}
 
-	// All roles can see all project tasks
+	// Доступ к проекту проверяется middleware.RequireProjectAccess
 	// Editing permissions are controlled in UpdateTask method
 
 	c.JSON(http.StatusOK, tasks)
@@ -104,6 +94,17 @@ func (tc *TasksController) CreateTask(c *gin.Context) {
 		return
 	}
 
+	// Задачу можно добавить только в проект, который пользователь видит
+	allowed, err := tc.teamService.CanViewProject(helpers.ProjectScope(c), task.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
 	user := c.MustGet("user").(*models.User)
 	if err := tc.taskService.CreateTask(&task, user.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -136,19 +137,6 @@ func (tc *TasksController) UpdateTask(c *gin.Context) {
 
 	user := c.MustGet("user").(*models.User)
 
-	// Check ownership (unless admin or БА)
-	if user.Role != "admin" && user.Role != "БА" {
-		existingTask, err := tc.taskService.GetTask(uint(id))
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
-			return
-		}
-		if existingTask.ResponsibleUserID == nil || *existingTask.ResponsibleUserID != int(user.ID) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own tasks"})
-			return
-		}
-	}
-
 	if err := tc.taskService.UpdateTask(&task, user.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -178,19 +166,6 @@ func (tc *TasksController) UpdateTaskStatus(c *gin.Context) {
 
 	user := c.MustGet("user").(*models.User)
 
-	// Check ownership (unless admin or БА)
-	if user.Role != "admin" && user.Role != "БА" {
-		task, err := tc.taskService.GetTask(uint(id))
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
-			return
-		}
-		if task.ResponsibleUserID == nil || *task.ResponsibleUserID != int(user.ID) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update status of your own tasks"})
-			return
-		}
-	}
-
 	if err := tc.taskService.UpdateStatus(uint(id), statusUpdate.Status, user.ID); err != nil {
 		// Could distinguish between validation errors and internal errors
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -228,19 +203,6 @@ func (tc *TasksController) DeleteTask(c *gin.Context) {
 
 	user := c.MustGet("user").(*models.User)
 
-	// Check ownership (unless admin or БА)
-	if user.Role != "admin" && user.Role != "БА" {
-		task, err := tc.taskService.GetTask(uint(id))
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
-			return
-		}
-		if task.ResponsibleUserID == nil || *task.ResponsibleUserID != int(user.ID) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own tasks"})
-			return
-		}
-	}
-
 	if err := tc.taskService.DeleteTask(uint(id), user.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -248,27 +210,3 @@ func (tc *TasksController) DeleteTask(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Task deleted"})
 }
-
-// DebugAssignments godoc
-// @Summary Debug task assignments
-// @Router /api/tasks/debug-assignments [get]
-func (tc *TasksController) DebugAssignments(c *gin.Context) {
-	tasks, err := tc.taskService.GetRecentTasks(10)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	result := make([]map[string]interface{}, len(tasks))
-	for i, task := range tasks {
-		result[i] = map[string]interface{}{
-			"id":                task.ID,
-			"name":              task.Name,
-			"responsible":       task.Responsible,
-			"responsibleUserId": task.ResponsibleUserID,
-			"createdAt":         task.CreatedAt,
-		}
-	}
-
-	c.JSON(http.StatusOK, result)
-}
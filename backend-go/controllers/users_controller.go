@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/middleware"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type UsersController struct {
+	service *services.UserService
+}
+
+func NewUsersController(service *services.UserService) *UsersController {
+	return &UsersController{service: service}
+}
+
+// GetUsers возвращает пользователей; ?includeInactive=true добавляет деактивированных
+func (ctrl *UsersController) GetUsers(c *gin.Context) {
+	users, err := ctrl.service.GetUsers(c.Query("includeInactive") == "true")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось получить пользователей", err))
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser возвращает пользователя
+func (ctrl *UsersController) GetUser(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID пользователя", err))
+		return
+	}
+
+	user, err := ctrl.service.GetUser(id)
+	if err != nil {
+		c.Error(userError(err, "Не удалось получить пользователя"))
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser создает пользователя
+func (ctrl *UsersController) CreateUser(c *gin.Context) {
+	var input services.UserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	user, err := ctrl.service.CreateUser(input)
+	if err != nil {
+		c.Error(userError(err, "Не удалось создать пользователя"))
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser меняет данные и роль пользователя
+func (ctrl *UsersController) UpdateUser(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID пользователя", err))
+		return
+	}
+
+	var input services.UserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+		return
+	}
+
+	user, err := ctrl.service.UpdateUser(id, input)
+	if err != nil {
+		c.Error(userError(err, "Не удалось изменить пользователя"))
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// DeactivateUser деактивирует пользователя и передает его работу преемнику
+func (ctrl *UsersController) DeactivateUser(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID пользователя", err))
+		return
+	}
+
+	var body struct {
+		ReassignToUserID *uint `json:"reassignToUserId"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный формат запроса", err))
+			return
+		}
+	}
+
+	actor := c.MustGet("user").(*models.User)
+	result, err := ctrl.service.Deactivate(id, body.ReassignToUserID, actor.ID)
+	if err != nil {
+		c.Error(userError(err, "Не удалось деактивировать пользователя"))
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ActivateUser возвращает доступ пользователю
+func (ctrl *UsersController) ActivateUser(c *gin.Context) {
+	id, err := helpers.ParseIDParam(c, "id")
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверный ID пользователя", err))
+		return
+	}
+
+	user, err := ctrl.service.Activate(id)
+	if err != nil {
+		c.Error(userError(err, "Не удалось активировать пользователя"))
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// userError сопоставляет ошибки UserService с HTTP-статусами
+func userError(err error, fallback string) *middleware.AppError {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return middleware.NewAppError(http.StatusNotFound, "Пользователь не найден", err)
+	case errors.Is(err, services.ErrUserLoginTaken), errors.Is(err, services.ErrUserSubjectTaken), errors.Is(err, services.ErrReassignRequired):
+		return middleware.NewAppError(http.StatusConflict, err.Error(), err)
+	case errors.Is(err, services.ErrUserInvalid), errors.Is(err, services.ErrUserUnknownRole), errors.Is(err, services.ErrUserPrimaryRole), errors.Is(err, services.ErrUserCapacity), errors.Is(err, services.ErrInvalidSuccessor),
+		errors.Is(err, services.ErrCannotDeactivateSelf):
+		return middleware.NewAppError(http.StatusBadRequest, err.Error(), err)
+	default:
+		return middleware.NewAppError(http.StatusInternalServerError, fallback, err)
+	}
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"portal-razvitie/middleware"
+	"portal-razvitie/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WorkloadController struct {
+	service *services.WorkloadService
+}
+
+func NewWorkloadController(service *services.WorkloadService) *WorkloadController {
+	return &WorkloadController{service: service}
+}
+
+// GetWorkload возвращает загрузку сотрудников: ?role=МП&region=Урал&weeks=8
+func (ctrl *WorkloadController) GetWorkload(c *gin.Context) {
+	filter := services.WorkloadFilter{
+		Role:   c.Query("role"),
+		Region: c.Query("region"),
+	}
+	if weeks := c.Query("weeks"); weeks != "" {
+		n, err := strconv.Atoi(weeks)
+		if err != nil || n <= 0 {
+			c.Error(middleware.NewAppError(http.StatusBadRequest, "Неверное число недель", err))
+			return
+		}
+		filter.Weeks = n
+	}
+
+	report, err := ctrl.service.GetWorkload(filter)
+	if err != nil {
+		c.Error(middleware.NewAppError(http.StatusInternalServerError, "Не удалось построить отчет о загрузке", err))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
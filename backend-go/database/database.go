@@ -87,9 +87,22 @@ func AutoMigrate(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		&models.Store{},
 		&models.User{},
+		&models.UserRole{},
+		&models.UserAbsence{},
+		&models.APIToken{},
+		&models.AssignmentRule{},
 		&models.Project{},
+		&models.ProjectMember{},
 		&models.ProjectTask{},
 		&models.ProjectDocument{},
+		&models.DocumentRevision{},
+		&models.DocumentType{},
+		&models.UploadSession{},
+		&models.DocumentLink{},
+		&models.DocumentLinkAccess{},
+		&models.DocumentPreview{},
+		&models.DocumentExtractionRule{},
+		&models.DocumentExtraction{},
 		&models.Notification{},
 		&models.Role{},
 		&models.Permission{},
@@ -98,6 +111,9 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.TaskDefinition{},
 		&models.ProjectTemplate{},
 		&models.TemplateTask{},
+		&models.ProjectTemplateVersion{},
+		&models.TemplateVersionTask{},
+		&models.ProjectStatusDefinition{},
 		&models.Request{},
 	)
 
@@ -3,6 +3,7 @@ package database
 import (
 	"log"
 	"portal-razvitie/models"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -177,54 +178,75 @@ func SeedUsers(db *gorm.DB) error {
 	return db.Create(&users).Error
 }
 
-// SeedRBAC populates Roles and Permissions tables from the hardcoded configuration
+// SeedRBAC синхронизирует таблицы Role/Permission с каталогом models.PermissionCatalog:
+// создает недостающие права, обновляет описания, удаляет права, которых нет в каталоге.
+// Новые роли получают права по умолчанию; настроенным ролям выдаются только новые права,
+// а новые права самообслуживания (models.SelfServicePermissions) — всем существующим ролям
 func SeedRBAC(db *gorm.DB) error {
 	log.Println("🔐 Seeding RBAC data...")
 
 	// 1. Sync Permissions
-	permDescriptions := map[string]string{
-		models.PermProjectCreate: "Создание проектов",
-		models.PermProjectView:   "Просмотр проектов",
-		models.PermProjectEdit:   "Редактирование проектов",
-		models.PermProjectDelete: "Удаление проектов",
+	known := make(map[string]bool)
+	createdPerms := make(map[string]bool)
+	defaultRoles := make(map[string][]string)
+	var roleOrder []string
+	for _, def := range models.PermissionCatalog {
+		known[def.Code] = true
 
-		models.PermTaskView:    "Просмотр задач",
-		models.PermTaskCreate:  "Создание задач",
-		models.PermTaskEdit:    "Редактирование любых задач",
-		models.PermTaskEditOwn: "Редактирование своих задач",
-
-		models.PermUserView:   "Просмотр пользователей",
-		models.PermUserManage: "Управление пользователями",
-
-		models.PermStoreView:   "Просмотр магазинов",
-		models.PermStoreManage: "Управление магазинами",
+		var p models.Permission
+		result := db.Where(models.Permission{Code: def.Code}).FirstOrCreate(&p)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			createdPerms[def.Code] = true
+		}
+		if p.Description != def.Description {
+			p.Description = def.Description
+			if err := db.Save(&p).Error; err != nil {
+				return err
+			}
+		}
 
-		models.PermRoleManage: "Управление ролями и правами",
+		for _, roleCode := range def.DefaultRoles {
+			if _, ok := defaultRoles[roleCode]; !ok {
+				roleOrder = append(roleOrder, roleCode)
+			}
+			defaultRoles[roleCode] = append(defaultRoles[roleCode], def.Code)
+		}
 	}
 
-	uniquePerms := make(map[string]bool)
-	for _, perms := range models.RolePermissions {
-		for _, p := range perms {
-			uniquePerms[p] = true
+	// 2. Remove permissions dropped from the catalogue
+	var allPerms []models.Permission
+	if err := db.Find(&allPerms).Error; err != nil {
+		return err
+	}
+	var obsolete []models.Permission
+	for _, p := range allPerms {
+		if !known[p.Code] {
+			obsolete = append(obsolete, p)
 		}
 	}
-
-	for code := range uniquePerms {
-		var p models.Permission
-		if err := db.Where(models.Permission{Code: code}).FirstOrCreate(&p).Error; err != nil {
+	if len(obsolete) > 0 {
+		var roles []models.Role
+		if err := db.Find(&roles).Error; err != nil {
 			return err
 		}
-		// Update description
-		if desc, ok := permDescriptions[code]; ok && p.Description != desc {
-			p.Description = desc
-			if err := db.Save(&p).Error; err != nil {
+		for i := range roles {
+			if err := db.Model(&roles[i]).Association("Permissions").Delete(obsolete); err != nil {
 				return err
 			}
 		}
+		if err := db.Delete(&obsolete).Error; err != nil {
+			return err
+		}
+		log.Printf("Removed %d permissions missing from the catalogue", len(obsolete))
 	}
 
-	// 2. Sync Roles and Links
-	for roleCode, permCodes := range models.RolePermissions {
+	// 3. Sync Roles and Links
+	for _, roleCode := range roleOrder {
+		permCodes := defaultRoles[roleCode]
+
 		var role models.Role
 		if err := db.Where(models.Role{Code: roleCode}).FirstOrCreate(&role).Error; err != nil {
 			return err
@@ -232,28 +254,67 @@ func SeedRBAC(db *gorm.DB) error {
 
 		// Проверяем существующие права роли
 		var existingPerms []models.Permission
-		db.Model(&role).Association("Permissions").Find(&existingPerms)
+		if err := db.Model(&role).Association("Permissions").Find(&existingPerms); err != nil {
+			return err
+		}
 
-		// Обновляем права только если роль новая (нет прав)
+		// Права по умолчанию выдаются только новой роли (без прав)
 		if len(existingPerms) == 0 {
 			log.Printf("Initializing permissions for new role '%s'", roleCode)
 
-			// Find permission objects for this role
 			var perms []models.Permission
 			if err := db.Where("\"Code\" IN ?", permCodes).Find(&perms).Error; err != nil {
 				return err
 			}
-
-			// Replace associations (updates role_permissions table)
 			if err := db.Model(&role).Association("Permissions").Replace(perms); err != nil {
 				return err
 			}
-		} else {
-			log.Printf("Skipping role '%s' - already has %d permissions (preserving custom config)",
-				roleCode, len(existingPerms))
+			continue
+		}
+
+		var newCodes []string
+		for _, code := range permCodes {
+			if createdPerms[code] {
+				newCodes = append(newCodes, code)
+			}
+		}
+		if len(newCodes) > 0 {
+			var perms []models.Permission
+			if err := db.Where("\"Code\" IN ?", newCodes).Find(&perms).Error; err != nil {
+				return err
+			}
+			if err := db.Model(&role).Association("Permissions").Append(perms); err != nil {
+				return err
+			}
+			log.Printf("Granted new permissions %v to role '%s'", newCodes, roleCode)
 		}
 	}
 
+	// 4. Права самообслуживания закрывают маршруты, которые раньше были открыты всем:
+	// при появлении такого права его получают все роли, включая созданные через /rbac/roles
+	var selfService []string
+	for _, code := range models.SelfServicePermissions {
+		if createdPerms[code] {
+			selfService = append(selfService, code)
+		}
+	}
+	if len(selfService) > 0 {
+		var perms []models.Permission
+		if err := db.Where("\"Code\" IN ?", selfService).Find(&perms).Error; err != nil {
+			return err
+		}
+		var roles []models.Role
+		if err := db.Find(&roles).Error; err != nil {
+			return err
+		}
+		for i := range roles {
+			if err := db.Model(&roles[i]).Association("Permissions").Append(perms); err != nil {
+				return err
+			}
+		}
+		log.Printf("Granted self-service permissions %v to all %d roles", selfService, len(roles))
+	}
+
 	log.Println("✅ RBAC seeded successfully")
 	return nil
 }
@@ -304,6 +365,8 @@ func SeedProjectTemplates(db *gorm.DB) error {
 			ResponsibleRole: def.ResponsibleRole,
 			TaskType:        def.TaskType,
 			Order:           i, // Сохраняем порядок из базы
+			ProjectStatus:   def.ProjectStatus,
+			StatusOrder:     def.StatusOrder,
 		}
 		template.Tasks = append(template.Tasks, templateTask)
 	}
@@ -317,3 +380,189 @@ func SeedProjectTemplates(db *gorm.DB) error {
 	log.Printf("✅ Successfully created default project template with %d tasks", len(template.Tasks))
 	return nil
 }
+
+// SeedProjectStatuses создает встроенные наборы статусов для типов проектов, у которых их еще нет
+func SeedProjectStatuses(db *gorm.DB) error {
+	for _, projectType := range models.ValidProjectTypes() {
+		var count int64
+		if err := db.Model(&models.ProjectStatusDefinition{}).
+			Where("\"ProjectType\" = ?", string(projectType)).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			// Наборы, созданные до появления этапов (NULL), получают этап встроенного статуса
+			if err := db.Model(&models.ProjectStatusDefinition{}).
+				Where("\"ProjectType\" = ? AND \"Status\" = ? AND \"Stage\" IS NULL", string(projectType), string(models.ProjectStatusRSR)).
+				Update("Stage", models.StageRSR).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Printf("🌱 Seeding project statuses for type %s...", projectType)
+		statuses := models.DefaultProjectStatusSet(projectType)
+		if err := db.Create(&statuses).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeedDocumentTypes добавляет в справочник недостающие встроенные типы документов
+// и проставляет код типа документам, загруженным до появления справочника (по названию типа)
+func SeedDocumentTypes(db *gorm.DB) error {
+	for _, docType := range models.DefaultDocumentTypes() {
+		var count int64
+		if err := db.Model(&models.DocumentType{}).Where("\"Code\" = ?", docType.Code).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := db.Create(&docType).Error; err != nil {
+			return err
+		}
+	}
+
+	var types []models.DocumentType
+	if err := db.Find(&types).Error; err != nil {
+		return err
+	}
+	for _, t := range types {
+		if err := db.Model(&models.ProjectDocument{}).
+			Where("(\"TypeCode\" IS NULL OR \"TypeCode\" = '') AND \"Type\" = ?", t.Name).
+			UpdateColumn("TypeCode", t.Code).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeedExtractionRules добавляет встроенные правила извлечения бюджета, только если правил еще нет:
+// измененные администратором правила не перезаписываются
+func SeedExtractionRules(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.DocumentExtractionRule{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	rules := models.DefaultExtractionRules()
+	return db.Create(&rules).Error
+}
+
+// MigrateProjectTeams переносит имена из устаревших колонок MP/NOR/StMRiZ/RNR в команду проекта.
+// Имена сопоставляются с пользователями по ФИО; колонки остаются в таблице для истории
+func MigrateProjectTeams(db *gorm.DB) error {
+	legacyColumns := map[string]string{
+		"MP":     models.ProjectRoleMP,
+		"NOR":    models.ProjectRoleNOR,
+		"StMRiZ": models.ProjectRoleStMRiZ,
+		"RNR":    models.ProjectRoleRNR,
+	}
+
+	var members int64
+	if err := db.Model(&models.ProjectMember{}).Count(&members).Error; err != nil {
+		return err
+	}
+	if members > 0 {
+		return nil
+	}
+
+	var users []models.User
+	if err := db.Find(&users).Error; err != nil {
+		return err
+	}
+	usersByName := make(map[string]uint, len(users))
+	for _, u := range users {
+		usersByName[strings.ToLower(strings.TrimSpace(u.Name))] = u.ID
+	}
+
+	for column, role := range legacyColumns {
+		if !db.Migrator().HasColumn(&models.Project{}, column) {
+			continue
+		}
+
+		var rows []struct {
+			ID   uint
+			Name string
+		}
+		if err := db.Table("Projects").
+			Select("\"Id\" AS id, \"" + column + "\" AS name").
+			Where("\"" + column + "\" IS NOT NULL AND \"" + column + "\" <> ''").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			userID, ok := usersByName[strings.ToLower(strings.TrimSpace(row.Name))]
+			if !ok {
+				log.Printf("⚠️ Project %d: user %q (%s) not found, skipping", row.ID, row.Name, role)
+				continue
+			}
+			member := models.ProjectMember{ProjectID: row.ID, UserID: userID, Role: role}
+			if err := db.Where(member).FirstOrCreate(&member).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MigrateUserRoles назначает пользователям без назначений их основную роль без ограничения области
+func MigrateUserRoles(db *gorm.DB) error {
+	assigned := db.Model(&models.UserRole{}).Select("\"UserId\"")
+	var users []models.User
+	if err := db.Where("\"ID\" NOT IN (?)", assigned).Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if u.Role == "" {
+			continue
+		}
+		if err := db.Create(&models.UserRole{UserID: u.ID, RoleCode: u.Role}).Error; err != nil {
+			return err
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("👥 Assigned primary roles to %d users", len(users))
+	}
+	return nil
+}
+
+// MigrateDocumentRevisions создает первую версию для документов, загруженных до появления версий.
+// Прежний номер версии (порядковый номер среди документов того же типа) сбрасывается на 1
+func MigrateDocumentRevisions(db *gorm.DB) error {
+	withRevisions := db.Model(&models.DocumentRevision{}).Select("\"DocumentId\"")
+	var docs []models.ProjectDocument
+	if err := db.Where("\"Id\" NOT IN (?)", withRevisions).Find(&docs).Error; err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			revision := models.DocumentRevision{
+				DocumentID:  doc.ID,
+				Number:      1,
+				Name:        doc.Name,
+				FileName:    doc.FileName,
+				FilePath:    doc.FilePath,
+				StorageKey:  doc.StorageKey,
+				ContentType: doc.ContentType,
+				Size:        doc.Size,
+				UploadedBy:  doc.Author,
+				CreatedAt:   doc.UploadDate,
+			}
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+			return tx.Model(&doc).UpdateColumn("Version", 1).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(docs) > 0 {
+		log.Printf("📄 Created first revisions for %d documents", len(docs))
+	}
+	return nil
+}
@@ -9,11 +9,12 @@ const (
 	TaskStatusChanged = "task.status_changed"
 	TaskDeleted       = "task.deleted"
 
-	ProjectCreated        = "project.created"
-	ProjectDeleted        = "project.deleted"
-	ProjectTasksGenerated = "project.tasks_generated"
-	ProjectUpdated        = "project.updated"
-	ProjectStatusChanged  = "project.status_changed"
+	ProjectCreated          = "project.created"
+	ProjectDeleted          = "project.deleted"
+	ProjectTasksGenerated   = "project.tasks_generated"
+	ProjectUpdated          = "project.updated"
+	ProjectStatusChanged    = "project.status_changed"
+	ProjectTemplateMigrated = "project.template_migrated"
 
 	RequestCreated  = "request.created"
 	RequestTaken    = "request.taken"
@@ -97,11 +98,21 @@ type ProjectStatusChangedEvent struct {
 	ProjectName string
 	OldStatus   string
 	NewStatus   string
+	Reason      string // Причина ручной смены статуса
 	ActorID     uint
 }
 
 func (e ProjectStatusChangedEvent) Name() string { return ProjectStatusChanged }
 
+type ProjectTemplateMigratedEvent struct {
+	ProjectID   uint
+	ProjectName string
+	Version     int
+	ActorID     uint
+}
+
+func (e ProjectTemplateMigratedEvent) Name() string { return ProjectTemplateMigrated }
+
 // --- Request Events ---
 
 type RequestCreatedEvent struct {
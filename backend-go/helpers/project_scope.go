@@ -0,0 +1,36 @@
+package helpers
+
+import (
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProjectScope строит скоуп видимости проектов для текущего пользователя
+func ProjectScope(ctx *gin.Context) repositories.ProjectScope {
+	scope := repositories.ProjectScope{}
+	if user, ok := ctx.Get("user"); ok {
+		scope.UserID = user.(*models.User).ID
+	}
+	access := Access(ctx)
+	scope.ActingFor = access.ActingFor
+	scope.ViewAll, scope.Areas = access.Areas(models.PermProjectViewAll)
+	return scope
+}
+
+// Permissions возвращает права текущего пользователя хотя бы в одной области, загруженные AuthMiddleware
+func Permissions(ctx *gin.Context) []string {
+	if perms, ok := ctx.Get("permissions"); ok {
+		return perms.([]string)
+	}
+	return nil
+}
+
+// Access возвращает права текущего пользователя по областям, загруженные AuthMiddleware
+func Access(ctx *gin.Context) *models.UserAccess {
+	if access, ok := ctx.Get("access"); ok {
+		return access.(*models.UserAccess)
+	}
+	return &models.UserAccess{}
+}
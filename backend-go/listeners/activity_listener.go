@@ -17,6 +17,7 @@ func NewActivityListener(service *services.ActivityService) *ActivityListener {
 
 func (l *ActivityListener) Register(bus events.EventBus) {
 	bus.Subscribe(events.TaskCreated, l.OnTaskCreated)
+	bus.Subscribe(events.ProjectTasksGenerated, l.OnProjectTasksGenerated)
 	bus.Subscribe(events.TaskStatusChanged, l.OnTaskStatusChanged)
 	bus.Subscribe(events.TaskUpdated, l.OnTaskUpdated)
 	bus.Subscribe(events.TaskDeleted, l.OnTaskDeleted)
@@ -24,6 +25,7 @@ func (l *ActivityListener) Register(bus events.EventBus) {
 	bus.Subscribe(events.ProjectDeleted, l.OnProjectDeleted)
 	bus.Subscribe(events.ProjectUpdated, l.OnProjectUpdated)
 	bus.Subscribe(events.ProjectStatusChanged, l.OnProjectStatusChanged)
+	bus.Subscribe(events.ProjectTemplateMigrated, l.OnProjectTemplateMigrated)
 	bus.Subscribe(events.RequestCreated, l.OnRequestCreated)
 }
 
@@ -32,7 +34,32 @@ func (l *ActivityListener) OnTaskCreated(event events.Event) error {
 	if !ok {
 		return nil
 	}
-	return l.activityService.LogActivity(e.ActorID, "создал задачу", models.EntityTask, e.Task.ID, e.Task.Name, &e.Task.ProjectID)
+	if err := l.activityService.LogActivity(e.ActorID, "создал задачу", models.EntityTask, e.Task.ID, e.Task.Name, &e.Task.ProjectID); err != nil {
+		return err
+	}
+	return l.logAssignment(e.ActorID, e.Task)
+}
+
+// OnProjectTasksGenerated записывает в историю задач, как были выбраны их исполнители
+func (l *ActivityListener) OnProjectTasksGenerated(event events.Event) error {
+	e, ok := event.(events.ProjectTasksGeneratedEvent)
+	if !ok {
+		return nil
+	}
+	for i := range e.Tasks {
+		if err := l.logAssignment(e.ActorID, &e.Tasks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logAssignment записывает стратегию и причину автоматического назначения исполнителя
+func (l *ActivityListener) logAssignment(actorID uint, task *models.ProjectTask) error {
+	if task.AssignmentNote == "" {
+		return nil
+	}
+	return l.activityService.LogActivity(actorID, task.AssignmentNote, models.EntityTask, task.ID, task.Name, &task.ProjectID)
 }
 
 func (l *ActivityListener) OnTaskStatusChanged(event events.Event) error {
@@ -108,6 +135,18 @@ func (l *ActivityListener) OnProjectStatusChanged(event events.Event) error {
 		return nil
 	}
 	action := fmt.Sprintf("изменил статус на '%s'", e.NewStatus)
+	if e.Reason != "" {
+		action += fmt.Sprintf(" (причина: %s)", e.Reason)
+	}
+	return l.activityService.LogActivity(e.ActorID, action, models.EntityProject, e.ProjectID, e.ProjectName, &e.ProjectID)
+}
+
+func (l *ActivityListener) OnProjectTemplateMigrated(event events.Event) error {
+	e, ok := event.(events.ProjectTemplateMigratedEvent)
+	if !ok {
+		return nil
+	}
+	action := fmt.Sprintf("перевел проект на версию шаблона %d", e.Version)
 	return l.activityService.LogActivity(e.ActorID, action, models.EntityProject, e.ProjectID, e.ProjectName, &e.ProjectID)
 }
 
@@ -49,7 +49,12 @@ func (l *NotificationListener) checkAndNotifyAssignment(task *models.ProjectTask
 		message := "Вам назначена задача: " + task.Name + " в " + projectName
 		projectIdUint := uint(task.ProjectID)
 		taskIdUint := uint(task.ID)
-		return l.notifService.SendNotification(uint(*task.ResponsibleUserID), "Новая задача", message, "TASK_ASSIGNED", "", &projectIdUint, &taskIdUint)
+		var delegatedFrom *uint
+		if task.DelegatedFromUserID != nil {
+			from := uint(*task.DelegatedFromUserID)
+			delegatedFrom = &from
+		}
+		return l.notifService.SendAssignmentNotification(uint(*task.ResponsibleUserID), delegatedFrom, "Новая задача", message, "TASK_ASSIGNED", "", &projectIdUint, &taskIdUint)
 	}
 	return nil
 }
@@ -13,6 +13,7 @@ import (
 	"portal-razvitie/database"
 	"portal-razvitie/logger"
 	"portal-razvitie/routes"
+	"portal-razvitie/storage"
 	"portal-razvitie/websocket"
 
 	"github.com/gin-contrib/cors"
@@ -58,10 +59,41 @@ func main() {
 		logger.Warn().Err(err).Msg("Failed to seed users")
 	}
 
+	if err := database.MigrateUserRoles(db); err != nil {
+		logger.Warn().Err(err).Msg("Failed to migrate user roles")
+	}
+
 	if err := database.SeedProjectTemplates(db); err != nil {
 		logger.Warn().Err(err).Msg("Failed to seed project templates")
 	}
 
+	if err := database.SeedProjectStatuses(db); err != nil {
+		logger.Warn().Err(err).Msg("Failed to seed project statuses")
+	}
+
+	if err := database.MigrateProjectTeams(db); err != nil {
+		logger.Warn().Err(err).Msg("Failed to migrate project teams")
+	}
+
+	if err := database.SeedDocumentTypes(db); err != nil {
+		logger.Warn().Err(err).Msg("Failed to seed document types")
+	}
+
+	if err := database.SeedExtractionRules(db); err != nil {
+		logger.Warn().Err(err).Msg("Failed to seed document extraction rules")
+	}
+
+	if err := database.MigrateDocumentRevisions(db); err != nil {
+		logger.Warn().Err(err).Msg("Failed to migrate document revisions")
+	}
+
+	// Хранилище файлов документов
+	files, err := storage.New(cfg.Storage())
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to initialize file storage")
+	}
+	logger.Info().Str("backend", cfg.StorageBackend).Msg("✅ File storage ready")
+
 	// Initialize and run WebSocket Hub
 	hub := websocket.NewHub()
 	go hub.Run()
@@ -77,13 +109,13 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{cfg.CORSOrigin, "http://localhost:5173", "http://localhost:5174"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Upload-Offset", "Upload-Checksum"},
+		ExposeHeaders:    []string{"Content-Length", "Upload-Offset"},
 		AllowCredentials: true,
 	}))
 
 	// Setup routes (включая middleware)
-	routes.SetupRoutes(router, cfg, db, hub)
+	routes.SetupRoutes(router, cfg, db, hub, files)
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -1,16 +1,38 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"portal-razvitie/helpers"
+	"portal-razvitie/models"
 	"portal-razvitie/services"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// AuthMiddleware extracts the user ID from the X-User-ID header and loads user & permissions from DB
-func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+// AuthMiddleware authenticates the request by a session or a personal API token (Authorization: Bearer)
+// and loads the user and the role permissions. The X-User-ID header (or ?userId) identifies the user
+// without any credential, so it is accepted only when allowUserHeader is set (demo user switcher in development)
+func AuthMiddleware(authService *services.AuthService, allowUserHeader bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if header := c.GetHeader("Authorization"); header != "" {
+			if strings.HasPrefix(header, "Bearer "+services.SessionTokenPrefix) {
+				authenticateSession(c, authService, header)
+				return
+			}
+			authenticateAPIToken(c, authService, header)
+			return
+		}
+
+		if !allowUserHeader {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: sign in and pass the session token (Authorization: Bearer)"})
+			c.Abort()
+			return
+		}
+
 		uidStr := c.GetHeader("X-User-ID")
 		if uidStr == "" {
 			uidStr = c.Query("userId")
@@ -29,50 +51,109 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 			return
 		}
 
-		// Попытка получить данные из кэша
-		// Note: We might want to move caching logic into AuthService completely?
-		// For now, let's just use AuthService to fetch if cache miss.
-
-		// Optimization: Check authService has cached fetch?
-		// Current AuthService implementation does database fetch.
-		// Let's keep cache logic here OR move it to service.
-		// Moving to service is cleaner but bigger change.
-		// Let's try to cache user object separately if we want, but permissions are cached.
-
-		user, perms, err := authService.GetUserByIdWithPerms(uid)
+		// Права ролей AuthService берет из кэша RBACService
+		user, access, err := authService.GetUserByIdWithAccess(uid)
+		if errors.Is(err, services.ErrUserInactive) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User is deactivated"})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
-		// Cache logic for permissions was:
-		// perms, found := permCache.Get(user.Role)
-		// But GetUserByIdWithPerms already fetches permissions from DB.
-		// If we want to use cache efficiently, we should check cache BEFORE fetch.
-		// But we need User role first.
+		c.Set("user", user)
+		c.Set("access", access)
+		c.Set("permissions", access.Permissions())
+		c.Next()
+	}
+}
 
-		// Let's rely on AuthService for now, or adapt cache.
-		// The previous code cached permissions by ROLE code.
-		// So we fetched user, got role, checked cache.
+// authenticateSession loads the user of a session issued at login (full permissions of the user)
+func authenticateSession(c *gin.Context, authService *services.AuthService, header string) {
+	user, access, err := authService.GetUserBySession(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	if errors.Is(err, services.ErrSessionExpired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+		c.Abort()
+		return
+	}
+	if errors.Is(err, services.ErrUserInactive) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is deactivated"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		c.Abort()
+		return
+	}
 
-		// Let's simplify and assume GetUserByIdWithPerms is efficient enough or we delegate caching to it later.
-		// Or we can just use the perms returned by AuthService.
+	c.Set("user", user)
+	c.Set("access", access)
+	c.Set("permissions", access.Permissions())
+	c.Next()
+}
 
-		// If we really want to keep the cache optimization:
-		// We would need GetUserById without Preload, then check Cache, then fetch perms if needed.
-		// But GetUserByIdWithPerms does preloading.
-		// Let's just use the returned perms and ignore middleware caching for now to reduce complexity.
-		// It's a "Clean Up", simpler is better.
+// authenticateAPIToken loads the token owner with the permissions narrowed down to the token scope
+func authenticateAPIToken(c *gin.Context, authService *services.AuthService, header string) {
+	raw, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: expected Bearer token"})
+		c.Abort()
+		return
+	}
 
-		c.Set("user", user)
-		c.Set("permissions", perms)
+	user, access, token, err := authService.GetUserByAPIToken(strings.TrimSpace(raw))
+	if errors.Is(err, services.ErrAPITokenExpired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+		c.Abort()
+		return
+	}
+	if errors.Is(err, services.ErrUserInactive) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is deactivated"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	c.Set("user", user)
+	c.Set("access", access)
+	c.Set("permissions", access.Permissions())
+	c.Set("apiToken", token)
+	c.Next()
+}
+
+// RequireSession rejects requests authenticated by an API token, so a token cannot issue new tokens
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, viaToken := c.Get("apiToken"); viaToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: not available for API tokens"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
-// RequirePermission checks if the authenticated user has the specified permission (from Context)
+// RequirePermission checks if the authenticated user has the specified permission in at least one area (from Context).
+// Regional limits are applied by RequireProjectPermission and by the project scope in repositories
 func RequirePermission(perm string) gin.HandlerFunc {
+	return requirePermissions([]string{perm}, "Forbidden: missing permission "+perm)
+}
+
+// RequireAnyPermission checks that the user has at least one of the permissions (e.g. task:edit or task:edit_own);
+// the exact rule is checked by the handler
+func RequireAnyPermission(perms ...string) gin.HandlerFunc {
+	return requirePermissions(perms, "Forbidden: one of permissions required: "+strings.Join(perms, ", "))
+}
+
+func requirePermissions(perms []string, message string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		_, exists := c.Get("user")
 		if !exists {
@@ -90,14 +171,15 @@ func RequirePermission(perm string) gin.HandlerFunc {
 		userPerms := permsInterface.([]string)
 		hasPermission := false
 		for _, p := range userPerms {
-			if p == perm {
-				hasPermission = true
-				break
+			for _, perm := range perms {
+				if p == perm {
+					hasPermission = true
+				}
 			}
 		}
 
 		if !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: missing permission " + perm})
+			c.JSON(http.StatusForbidden, gin.H{"error": message})
 			c.Abort()
 			return
 		}
@@ -106,34 +188,98 @@ func RequirePermission(perm string) gin.HandlerFunc {
 	}
 }
 
-// RequireTaskEditPermission checks if user has task:edit OR task:edit_own permission
-func RequireTaskEditPermission() gin.HandlerFunc {
+// RequireTaskEditPermission checks that the user may edit the task (or the document) from the URL param:
+// task:edit allows any task, task:edit_own only tasks the user owns (see ProjectTeamService.CanEditTask)
+func RequireTaskEditPermission(teamService *services.ProjectTeamService, entityType string, param string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, exists := c.Get("user")
+		userInterface, exists := c.Get("user")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
 
-		permsInterface, exists := c.Get("permissions")
-		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: No permissions loaded"})
+		id, err := helpers.ParseIDParam(c, param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
 			c.Abort()
 			return
 		}
 
-		userPerms := permsInterface.([]string)
-		hasPermission := false
-		for _, p := range userPerms {
-			if p == "task:edit" || p == "task:edit_own" {
-				hasPermission = true
-				break
-			}
+		user := userInterface.(*models.User)
+		allowed, err := teamService.CanEditEntity(user.ID, helpers.Access(c), entityType, id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
 		}
 
-		if !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: missing permission task:edit or task:edit_own"})
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: task:edit required, or task:edit_own for own tasks"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireProjectAccess checks that the project of the entity from the URL param is visible to the user.
+// Hidden projects are reported as not found
+func RequireProjectAccess(teamService *services.ProjectTeamService, entityType string, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := helpers.ParseIDParam(c, param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			c.Abort()
+			return
+		}
+
+		allowed, err := teamService.CanViewEntity(helpers.ProjectScope(c), entityType, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireProjectPermission checks that the user has the permission in the region/CFO of the project
+// the entity from the URL param belongs to
+func RequireProjectPermission(teamService *services.ProjectTeamService, perm string, entityType string, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := helpers.ParseIDParam(c, param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+			c.Abort()
+			return
+		}
+
+		allowed, err := teamService.HasPermissionFor(helpers.Access(c), perm, entityType, id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: missing permission " + perm + " for the project region"})
 			c.Abort()
 			return
 		}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitRequestBody ограничивает размер тела запроса: заведомо большие запросы отклоняются
+// по Content-Length, не дожидаясь загрузки, остальные обрываются при превышении лимита
+func LimitRequestBody(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("Размер запроса превышает %d МБ", maxBytes>>20),
+			})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// ExtendDeadlines продлевает таймауты чтения и записи сервера (ReadTimeout/WriteTimeout в main.go)
+// для долгих запросов: передачи частей больших файлов и выдачи архивов
+func ExtendDeadlines(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deadline := time.Now().Add(timeout)
+		controller := http.NewResponseController(c.Writer)
+		// Ошибку ErrNotSupported дают только тестовые ResponseWriter: таймаутов у них нет
+		controller.SetReadDeadline(deadline)
+		controller.SetWriteDeadline(deadline)
+		c.Next()
+	}
+}
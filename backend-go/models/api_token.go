@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APITokenPrefix начало каждого персонального токена; по нему токен легко найти в логах и секретах
+const APITokenPrefix = "prt_"
+
+// APIToken персональный токен для скриптов и интеграций. Хранится только SHA-256 от токена,
+// права токена — подмножество прав владельца на момент запроса
+type APIToken struct {
+	ID          uint           `gorm:"column:Id;primaryKey" json:"id"`
+	UserID      uint           `gorm:"column:UserId;not null;index" json:"userId"`
+	Name        string         `gorm:"column:Name;type:varchar(100);not null" json:"name"`
+	TokenHash   string         `gorm:"column:TokenHash;type:varchar(64);not null;uniqueIndex" json:"-"`
+	Hint        string         `gorm:"column:Hint;type:varchar(16)" json:"hint"` // Первые символы токена для узнавания в списке
+	Permissions pq.StringArray `gorm:"column:Permissions;type:text[]" json:"permissions"`
+	ExpiresAt   *time.Time     `gorm:"column:ExpiresAt" json:"expiresAt"` // nil — бессрочный
+	LastUsedAt  *time.Time     `gorm:"column:LastUsedAt" json:"lastUsedAt"`
+	CreatedAt   time.Time      `gorm:"column:CreatedAt" json:"createdAt"`
+}
+
+// TableName для GORM
+func (APIToken) TableName() string {
+	return "ApiTokens"
+}
+
+// IsExpiredAt проверяет, истек ли срок действия токена
+func (t APIToken) IsExpiredAt(at time.Time) bool {
+	return t.ExpiresAt != nil && !at.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Стратегии автоматического назначения исполнителя по роли
+const (
+	AssignmentRoundRobin     = "round_robin"      // По очереди среди пользователей роли
+	AssignmentLeastOpenTasks = "least_open_tasks" // Пользователь с наименьшим числом открытых задач
+	AssignmentRegionAffinity = "region_affinity"  // Пользователь, чья роль действует в регионе магазина
+	AssignmentProjectTeam    = "project_team"     // Участник команды проекта с соответствующей ролью
+)
+
+// DefaultAssignmentStrategy используется для ролей без правила и когда выбранная стратегия не нашла исполнителя
+const DefaultAssignmentStrategy = AssignmentLeastOpenTasks
+
+// AssignmentRule задает стратегию назначения задач для роли
+type AssignmentRule struct {
+	ID        uint      `gorm:"column:Id;primaryKey" json:"id"`
+	Role      string    `gorm:"column:Role;type:varchar(50);not null;uniqueIndex" json:"role"`
+	Strategy  string    `gorm:"column:Strategy;type:varchar(50);not null" json:"strategy" binding:"required"`
+	UpdatedAt time.Time `gorm:"column:UpdatedAt" json:"updatedAt"`
+}
+
+// TableName для GORM
+func (AssignmentRule) TableName() string {
+	return "AssignmentRules"
+}
+
+// projectRoleByUserRole сопоставляет системные роли ролям в команде проекта
+var projectRoleByUserRole = map[string]string{
+	RoleMP:   ProjectRoleMP,
+	RoleNOR:  ProjectRoleNOR,
+	RoleRNR:  ProjectRoleRNR,
+	RoleMRiZ: ProjectRoleStMRiZ,
+}
+
+// ProjectRoleForUserRole возвращает роль в команде проекта, соответствующую системной роли
+func ProjectRoleForUserRole(role string) (string, bool) {
+	projectRole, ok := projectRoleByUserRole[role]
+	return projectRole, ok
+}
@@ -31,6 +31,11 @@ const (
 	ProjectStatusFailed         ProjectStatus = "Слетел"
 	ProjectStatusClosed         ProjectStatus = "Закрыт"
 	ProjectStatusArchived       ProjectStatus = "Архив"
+
+	// Статусы проектов закрытия
+	ProjectStatusClosurePrep      ProjectStatus = "Подготовка к закрытию"
+	ProjectStatusEquipmentRemoval ProjectStatus = "Вывоз оборудования"
+	ProjectStatusPremisesReturn   ProjectStatus = "Возврат помещения"
 )
 
 // Task Statuses - все возможные статусы задач
@@ -41,8 +46,14 @@ const (
 	TaskStatusReview     TaskStatus = "На проверке"
 	TaskStatusCompleted  TaskStatus = "Завершена"
 	TaskStatusExpired    TaskStatus = "Просрочена"
+	TaskStatusRetired    TaskStatus = "Исключена" // Задача удалена из шаблона при миграции проекта
 )
 
+// ClosedTaskStatuses статусы задач, которые больше не требуют работы исполнителя
+func ClosedTaskStatuses() []string {
+	return []string{string(TaskStatusCompleted), string(TaskStatusRetired)}
+}
+
 // Project Types - все возможные типы проектов
 const (
 	ProjectTypeOpening        ProjectType = "Открытие"
@@ -62,9 +73,11 @@ const (
 
 // Entity Types for Activity
 const (
-	EntityTask    = "task"
-	EntityProject = "project"
-	EntityStore   = "store"
+	EntityTask     = "task"
+	EntityProject  = "project"
+	EntityStore    = "store"
+	EntityDocument = "document"
+	EntityRequest  = "request"
 )
 
 // ValidProjectStatuses возвращает список всех валидных статусов проектов
@@ -89,6 +102,9 @@ func ValidProjectStatuses() []ProjectStatus {
 		ProjectStatusFailed,
 		ProjectStatusClosed,
 		ProjectStatusArchived,
+		ProjectStatusClosurePrep,
+		ProjectStatusEquipmentRemoval,
+		ProjectStatusPremisesReturn,
 	}
 }
 
@@ -101,6 +117,7 @@ func ValidTaskStatuses() []TaskStatus {
 		TaskStatusReview,
 		TaskStatusCompleted,
 		TaskStatusExpired,
+		TaskStatusRetired,
 	}
 }
 
@@ -9,17 +9,45 @@ type ProjectDocument struct {
 	ProjectID   uint      `gorm:"column:ProjectId;not null" json:"projectId" binding:"required"`
 	TaskID      *int      `gorm:"column:TaskId" json:"taskId"`
 	Name        string    `gorm:"column:Name;type:varchar(255);not null" json:"name" binding:"required"`
-	Type        string    `gorm:"column:Type;type:varchar(100);not null" json:"type" binding:"required"`
+	Type        string    `gorm:"column:Type;type:varchar(100);not null" json:"type" binding:"required"` // Название типа
+	TypeCode    string    `gorm:"column:TypeCode;type:varchar(50);index" json:"typeCode"`                // Код в справочнике DocumentTypes
 	UploadDate  time.Time `gorm:"column:UploadDate;not null" json:"uploadDate"`
 	Version     int       `gorm:"column:Version;default:1" json:"version"`
 	Author      string    `gorm:"column:Author;type:varchar(255);default:'Системный Администратор'" json:"author"`
 	Status      string    `gorm:"column:Status;type:varchar(50);default:'Доступен'" json:"status"`
 	FilePath    string    `gorm:"column:FilePath;type:text;not null" json:"filePath"`
+	StorageKey  string    `gorm:"column:StorageKey;type:text" json:"-"` // Ключ в хранилище; пусто — файл загружен до хранилища и лежит по FilePath
 	FileName    string    `gorm:"column:FileName;type:varchar(255);not null" json:"fileName"`
 	ContentType string    `gorm:"column:ContentType;type:varchar(100)" json:"contentType"`
 	Size        int64     `gorm:"column:Size" json:"size"`
+	SHA256      string    `gorm:"column:Sha256;type:varchar(64)" json:"sha256"` // Хэш текущей версии
 }
 
 func (ProjectDocument) TableName() string {
 	return "ProjectDocuments"
 }
+
+// DocumentRevision неизменяемая версия файла документа. Документ (ProjectDocument)
+// повторяет поля последней версии, чтобы списки и проверки не читали историю
+type DocumentRevision struct {
+	ID           uint      `gorm:"column:Id;primaryKey" json:"id"`
+	DocumentID   uint      `gorm:"column:DocumentId;not null;uniqueIndex:idx_document_revision" json:"documentId"`
+	Number       int       `gorm:"column:Number;not null;uniqueIndex:idx_document_revision" json:"number"`
+	Name         string    `gorm:"column:Name;type:varchar(255);not null" json:"name"` // Исходное имя файла
+	FileName     string    `gorm:"column:FileName;type:varchar(255);not null" json:"fileName"`
+	FilePath     string    `gorm:"column:FilePath;type:text;not null" json:"-"`
+	StorageKey   string    `gorm:"column:StorageKey;type:text" json:"-"`
+	ContentType  string    `gorm:"column:ContentType;type:varchar(100)" json:"contentType"`
+	Size         int64     `gorm:"column:Size" json:"size"`
+	SHA256       string    `gorm:"column:Sha256;type:varchar(64)" json:"sha256"`
+	Comment      string    `gorm:"column:Comment;type:text" json:"comment"`
+	UploadedByID *uint     `gorm:"column:UploadedById" json:"uploadedById"`
+	UploadedBy   string    `gorm:"column:UploadedBy;type:varchar(255)" json:"uploadedBy"`
+	RestoredFrom *int      `gorm:"column:RestoredFrom" json:"restoredFrom,omitempty"` // Номер восстановленной версии
+	CreatedAt    time.Time `gorm:"column:CreatedAt" json:"createdAt"`
+}
+
+// TableName для GORM
+func (DocumentRevision) TableName() string {
+	return "DocumentRevisions"
+}
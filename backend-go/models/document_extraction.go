@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Результаты извлечения значения из документа
+const (
+	ExtractionFound       = "found"
+	ExtractionNotFound    = "not_found"   // Ни одно правило не нашло числа
+	ExtractionUnsupported = "unsupported" // Формат файла не читается (например, .xls)
+	ExtractionFailed      = "failed"
+)
+
+// DocumentExtractionRule правило извлечения числа из книги Excel типа документа в поле задачи.
+// Значение ищется по ячейке листа (Sheet + Cell), по именованной ячейке (DefinedName) или по
+// подписи (Label): берется первое число справа от подписи, а если его нет — под ней.
+// Правила одного поля проверяются по порядку Order до первого найденного значения
+type DocumentExtractionRule struct {
+	ID               uint   `gorm:"column:Id;primaryKey" json:"id"`
+	DocumentTypeCode string `gorm:"column:DocumentTypeCode;type:varchar(50);not null;index" json:"documentTypeCode"`
+	TaskCode         string `gorm:"column:TaskCode;type:varchar(50);not null" json:"taskCode"` // Задача проекта, поле которой заполняется
+	Field            string `gorm:"column:Field;type:varchar(50);not null" json:"field"`       // Поле задачи в JSON: equipmentCostNoVat
+	Sheet            string `gorm:"column:Sheet;type:varchar(255)" json:"sheet"`               // Пусто — все листы по порядку
+	Cell             string `gorm:"column:Cell;type:varchar(20)" json:"cell"`
+	DefinedName      string `gorm:"column:DefinedName;type:varchar(255)" json:"definedName"`
+	Label            string `gorm:"column:Label;type:varchar(255)" json:"label"`
+	Order            int    `gorm:"column:Order;not null;default:0" json:"order"`
+	AutoFill         bool   `gorm:"column:AutoFill;not null;default:true" json:"autoFill"` // Заполнять пустое поле задачи без подтверждения
+	IsActive         bool   `gorm:"column:IsActive;not null;default:true" json:"isActive"`
+}
+
+// TableName для GORM
+func (DocumentExtractionRule) TableName() string {
+	return "DocumentExtractionRules"
+}
+
+// DocumentExtraction значение, извлеченное из версии документа для поля задачи
+type DocumentExtraction struct {
+	ID         uint      `gorm:"column:Id;primaryKey" json:"id"`
+	DocumentID uint      `gorm:"column:DocumentId;not null;index" json:"documentId"`
+	RevisionID uint      `gorm:"column:RevisionId;not null" json:"revisionId"`
+	Version    int       `gorm:"column:Version;not null" json:"version"`
+	TaskID     *uint     `gorm:"column:TaskId;index" json:"taskId"` // nil — в проекте нет задачи правила
+	RuleID     *uint     `gorm:"column:RuleId" json:"ruleId"`
+	Field      string    `gorm:"column:Field;type:varchar(50);not null" json:"field"`
+	Status     string    `gorm:"column:Status;type:varchar(20);not null" json:"status"`
+	Value      *float64  `gorm:"column:Value" json:"value"`
+	Location   string    `gorm:"column:Location;type:varchar(300)" json:"location"` // Где найдено: "Смета!F40"
+	Error      string    `gorm:"column:Error;type:text" json:"error,omitempty"`
+	AutoFilled bool      `gorm:"column:AutoFilled;not null;default:false" json:"autoFilled"`
+	CreatedAt  time.Time `gorm:"column:CreatedAt" json:"createdAt"`
+
+	// Сверка с полем задачи на момент запроса
+	TaskValue *float64 `gorm:"-" json:"taskValue"`
+	Mismatch  bool     `gorm:"-" json:"mismatch"`
+}
+
+// TableName для GORM
+func (DocumentExtraction) TableName() string {
+	return "DocumentExtractions"
+}
+
+// DefaultExtractionRules встроенные правила: итог без НДС из расчетов бюджета оборудования и СБ
+func DefaultExtractionRules() []DocumentExtractionRule {
+	return []DocumentExtractionRule{
+		{DocumentTypeCode: "equipment-budget", TaskCode: "TASK-BUDGET-EQUIP", Field: "equipmentCostNoVat", Label: "Итого без НДС", AutoFill: true, IsActive: true},
+		{DocumentTypeCode: "security-budget", TaskCode: "TASK-BUDGET-SECURITY", Field: "securityBudgetNoVat", Label: "Итого без НДС", AutoFill: true, IsActive: true},
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Результаты обращения по подписанной ссылке
+const (
+	DocumentLinkServed  = "served"
+	DocumentLinkInvalid = "invalid" // Ссылка или документ удалены; токены с неверной подписью в журнал не пишутся
+	DocumentLinkExpired = "expired"
+	DocumentLinkUsed    = "used" // Одноразовая ссылка уже открыта
+	DocumentLinkRevoked = "revoked"
+)
+
+// DocumentLink подписанная ссылка на скачивание версии документа без входа в портал
+type DocumentLink struct {
+	ID          uint       `gorm:"column:Id;primaryKey" json:"id"`
+	DocumentID  uint       `gorm:"column:DocumentId;not null;index" json:"documentId"`
+	Version     int        `gorm:"column:Version;not null" json:"version"`
+	SingleUse   bool       `gorm:"column:SingleUse;not null;default:false" json:"singleUse"`
+	Recipient   string     `gorm:"column:Recipient;type:varchar(255)" json:"recipient"` // Кому выдана: для журнала
+	ExpiresAt   time.Time  `gorm:"column:ExpiresAt;not null" json:"expiresAt"`
+	UsedAt      *time.Time `gorm:"column:UsedAt" json:"usedAt"`
+	RevokedAt   *time.Time `gorm:"column:RevokedAt" json:"revokedAt"`
+	CreatedByID uint       `gorm:"column:CreatedById;not null" json:"createdById"`
+	CreatedBy   string     `gorm:"column:CreatedBy;type:varchar(255)" json:"createdBy"`
+	CreatedAt   time.Time  `gorm:"column:CreatedAt" json:"createdAt"`
+
+	Accesses []DocumentLinkAccess `gorm:"foreignKey:LinkID" json:"accesses,omitempty"`
+}
+
+// TableName для GORM
+func (DocumentLink) TableName() string {
+	return "DocumentLinks"
+}
+
+// DocumentLinkAccess обращение по ссылке, включая отклоненные
+type DocumentLinkAccess struct {
+	ID         uint      `gorm:"column:Id;primaryKey" json:"id"`
+	LinkID     *uint     `gorm:"column:LinkId;index" json:"linkId"` // nil — ссылка удалена
+	Result     string    `gorm:"column:Result;type:varchar(20);not null" json:"result"`
+	IP         string    `gorm:"column:Ip;type:varchar(64)" json:"ip"`
+	UserAgent  string    `gorm:"column:UserAgent;type:text" json:"userAgent"`
+	AccessedAt time.Time `gorm:"column:AccessedAt;not null" json:"accessedAt"`
+}
+
+// TableName для GORM
+func (DocumentLinkAccess) TableName() string {
+	return "DocumentLinkAccesses"
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Состояния предпросмотра документа
+const (
+	PreviewPending     = "pending"
+	PreviewProcessing  = "processing"
+	PreviewReady       = "ready"
+	PreviewFailed      = "failed"
+	PreviewUnsupported = "unsupported" // Для формата файла предпросмотр не строится
+)
+
+// Виды предпросмотра
+const (
+	PreviewThumbnail = "thumbnail" // Миниатюра изображения или первой страницы PDF (PNG)
+	PreviewTable     = "table"     // Листы книги Excel (JSON)
+	PreviewText      = "text"      // Текст документа Word
+)
+
+// DocumentPreview предпросмотр версии документа. Строится в фоне после загрузки,
+// файл предпросмотра лежит в хранилище рядом с файлом версии
+type DocumentPreview struct {
+	ID          uint      `gorm:"column:Id;primaryKey" json:"id"`
+	DocumentID  uint      `gorm:"column:DocumentId;not null;index" json:"documentId"`
+	RevisionID  uint      `gorm:"column:RevisionId;not null;uniqueIndex" json:"revisionId"`
+	Version     int       `gorm:"column:Version;not null" json:"version"`
+	Status      string    `gorm:"column:Status;type:varchar(20);not null;index" json:"status"`
+	Kind        string    `gorm:"column:Kind;type:varchar(20)" json:"kind"`
+	StorageKey  string    `gorm:"column:StorageKey;type:text" json:"-"`
+	ContentType string    `gorm:"column:ContentType;type:varchar(100)" json:"contentType"`
+	Size        int64     `gorm:"column:Size" json:"size"`
+	Truncated   bool      `gorm:"column:Truncated;not null;default:false" json:"truncated"` // В предпросмотр попала только часть файла
+	Error       string    `gorm:"column:Error;type:text" json:"error,omitempty"`
+	Text        string    `gorm:"column:Text;type:text" json:"-"` // Текст версии для полнотекстового поиска: Word, ячейки книги, текстовый слой PDF
+	Attempts    int       `gorm:"column:Attempts;not null;default:0" json:"-"`
+	CreatedAt   time.Time `gorm:"column:CreatedAt" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"column:UpdatedAt" json:"updatedAt"`
+}
+
+// TableName для GORM
+func (DocumentPreview) TableName() string {
+	return "DocumentPreviews"
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// DocumentTypeOther тип для документов, которые не требуются ни одной задачей
+const DocumentTypeOther = "other"
+
+// DocumentType тип документа из справочника: допустимые форматы файла и задачи,
+// для завершения которых документ обязателен
+type DocumentType struct {
+	ID         uint           `gorm:"column:Id;primaryKey" json:"id"`
+	Code       string         `gorm:"column:Code;type:varchar(50);not null;uniqueIndex" json:"code"`
+	Name       string         `gorm:"column:Name;type:varchar(255);not null" json:"name"`
+	Extensions pq.StringArray `gorm:"column:Extensions;type:text[]" json:"extensions"`  // ".pdf", ".dwg"; пусто — любые
+	MimeTypes  pq.StringArray `gorm:"column:MimeTypes;type:text[]" json:"mimeTypes"`    // Пусто — любые
+	MaxSize    int64          `gorm:"column:MaxSize;not null;default:0" json:"maxSize"` // Байт; 0 — без ограничения
+	TaskCodes  pq.StringArray `gorm:"column:TaskCodes;type:text[]" json:"taskCodes"`    // Задачи, которым документ обязателен
+	IsActive   bool           `gorm:"column:IsActive;not null;default:true" json:"isActive"`
+}
+
+// TableName для GORM
+func (DocumentType) TableName() string {
+	return "DocumentTypes"
+}
+
+// AllowsFile проверяет расширение имени файла
+func (t DocumentType) AllowsFile(fileName string) bool {
+	if len(t.Extensions) == 0 {
+		return true
+	}
+	return containsString(t.Extensions, strings.ToLower(filepath.Ext(fileName)))
+}
+
+// AllowsMIME проверяет MIME-тип без параметров (charset и т.п.)
+func (t DocumentType) AllowsMIME(contentType string) bool {
+	if len(t.MimeTypes) == 0 {
+		return true
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return containsString(t.MimeTypes, strings.ToLower(strings.TrimSpace(mediaType)))
+}
+
+// RequiredFor сообщает, обязателен ли документ для завершения задачи
+func (t DocumentType) RequiredFor(taskCode string) bool {
+	return containsString(t.TaskCodes, taskCode)
+}
+
+// DefaultDocumentTypes встроенные типы документов: обязательные документы задач шаблона открытия
+func DefaultDocumentTypes() []DocumentType {
+	xls := pq.StringArray{".xls", ".xlsx"}
+	return []DocumentType{
+		{Code: "technical-plan", Name: "Технический план", TaskCodes: pq.StringArray{"TASK-PREP-AUDIT"}},
+		{Code: "site-photos", Name: "Фотографии объекта", TaskCodes: pq.StringArray{"TASK-CONTOUR"}},
+		{Code: "measured-plan", Name: "Обмерный план", Extensions: pq.StringArray{".dwg"}, TaskCodes: pq.StringArray{"TASK-CONTOUR"}},
+		{Code: "draft-contour", Name: "Предварительный контур", Extensions: pq.StringArray{".dwg"}, TaskCodes: pq.StringArray{"TASK-CONTOUR"}},
+		{Code: "visualization-concept", Name: "Концепт визуализации", TaskCodes: pq.StringArray{"TASK-VISUALIZATION"}},
+		{Code: "egrn-extract", Name: "Выписка ЕГРН", TaskCodes: pq.StringArray{"TASK-VISUALIZATION"}},
+		{Code: "store-visualization", Name: "Визуализация внешнего вида магазина", TaskCodes: pq.StringArray{"TASK-VISUALIZATION"}},
+		{Code: "access-roads", Name: "Схема подъездных путей", TaskCodes: pq.StringArray{"TASK-LOGISTICS"}},
+		{Code: "logistics-assessment", Name: "Оценка логистики и подъездных путей", Extensions: pq.StringArray{".pdf"}, TaskCodes: pq.StringArray{"TASK-LOGISTICS"}},
+		{Code: "nbkp-assessment", Name: "Оценка возможности НБКП", Extensions: pq.StringArray{".pdf"}, TaskCodes: pq.StringArray{"TASK-LOGISTICS"}},
+		{Code: "layout-dwg", Name: "Технологическая планировка (DWG)", Extensions: pq.StringArray{".dwg"}, TaskCodes: pq.StringArray{"TASK-LAYOUT"}},
+		{Code: "layout-pdf", Name: "Технологическая планировка (PDF)", Extensions: pq.StringArray{".pdf"}, TaskCodes: pq.StringArray{"TASK-LAYOUT"}},
+		{Code: "equipment-budget", Name: "Расчет затрат на оборудование", Extensions: xls, TaskCodes: pq.StringArray{"TASK-BUDGET-EQUIP"}},
+		{Code: "security-form", Name: "Анкета СБ", TaskCodes: pq.StringArray{"TASK-BUDGET-SECURITY"}},
+		{Code: "security-budget", Name: "Расчет затрат на оборудование СБ", Extensions: xls, TaskCodes: pq.StringArray{"TASK-BUDGET-SECURITY"}},
+		{Code: "distribution-sheet", Name: "Распределительная ведомость", TaskCodes: pq.StringArray{"TASK-BUDGET-RSR"}},
+		{Code: "rsr-budget", Name: "Расчет бюджета РСР", Extensions: xls, TaskCodes: pq.StringArray{"TASK-BUDGET-RSR"}},
+		{Code: DocumentTypeOther, Name: "Прочее"},
+	}
+}
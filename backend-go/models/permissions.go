@@ -2,10 +2,11 @@ package models
 
 // Permissions constants
 const (
-	PermProjectCreate = "project:create"
-	PermProjectView   = "project:view"
-	PermProjectEdit   = "project:edit"
-	PermProjectDelete = "project:delete"
+	PermProjectCreate  = "project:create"
+	PermProjectView    = "project:view"
+	PermProjectEdit    = "project:edit"
+	PermProjectDelete  = "project:delete"
+	PermProjectViewAll = "project:view_all" // View every project, not only own team's
 
 	PermTaskView    = "task:view"
 	PermTaskCreate  = "task:create"
@@ -15,48 +16,68 @@ const (
 	PermUserView   = "user:view"
 	PermUserManage = "user:manage"
 
+	PermWorkloadView = "workload:view" // Team workload and capacity report
+
 	PermStoreView   = "store:view"
 	PermStoreManage = "store:manage" // Create/Edit stores
 	PermRoleManage  = "role:manage"  // Manage Roles & Permissions
+
+	PermDocumentTypeManage = "document_type:manage" // Document type registry
+
+	// Own records of the user: narrowed API tokens without them can only read
+	PermCommentCreate      = "comment:create"
+	PermRequestManage      = "request:manage"      // Create and process requests
+	PermAbsenceManage      = "absence:manage"      // Register own absences
+	PermNotificationManage = "notification:manage" // Mark read and delete own notifications
 )
 
-// RolePermissions maps roles to their allowed permissions
-var RolePermissions = map[string][]string{
-	RoleAdmin: {
-		PermProjectCreate, PermProjectView, PermProjectEdit, PermProjectDelete,
-		PermTaskView, PermTaskCreate, PermTaskEdit, PermTaskEditOwn,
-		PermUserView, PermUserManage,
-		PermStoreView, PermStoreManage,
-		PermRoleManage,
-	},
-	RoleMP: {
-		PermProjectCreate, PermProjectView, PermProjectEdit,
-		PermTaskView, PermTaskCreate, PermTaskEditOwn,
-		PermStoreView,
-		PermUserView,
-	},
-	RoleMRiZ: {
-		PermProjectCreate, PermProjectView,
-		PermTaskView, PermTaskEditOwn,
-		PermStoreView, PermStoreManage,
-		PermUserView,
-	},
-	RoleBA: {
-		PermProjectCreate, PermProjectView,
-		PermTaskView,
-		PermStoreView,
-		PermUserView,
-	},
+// PermissionDefinition describes a permission in the catalogue
+type PermissionDefinition struct {
+	Code         string
+	Description  string
+	DefaultRoles []string // Built-in roles that get the permission when the role or the permission is new
 }
 
-// Helper to check permission
-func HasPermission(role string, permission string) bool {
-	perms, ok := RolePermissions[role]
-	if !ok {
-		return false
-	}
-	for _, p := range perms {
-		if p == permission {
+// PermissionCatalog is the single declaration of all permissions.
+// It is synced to the Permission table at startup; at runtime permissions are read from the DB only
+var PermissionCatalog = []PermissionDefinition{
+	{PermProjectCreate, "Создание проектов", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermProjectView, "Просмотр проектов", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermProjectEdit, "Редактирование проектов", []string{RoleAdmin, RoleMP, RoleNOR, RoleRNR}},
+	{PermProjectDelete, "Удаление проектов", []string{RoleAdmin}},
+	{PermProjectViewAll, "Просмотр всех проектов", []string{RoleAdmin, RoleBA, RoleNOR, RoleRNR}},
+
+	{PermTaskView, "Просмотр задач", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermTaskCreate, "Создание задач", []string{RoleAdmin, RoleMP, RoleNOR, RoleRNR}},
+	{PermTaskEdit, "Редактирование любых задач", []string{RoleAdmin, RoleNOR, RoleRNR}},
+	{PermTaskEditOwn, "Редактирование своих задач", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleNOR, RoleRNR}},
+
+	{PermUserView, "Просмотр пользователей", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermUserManage, "Управление пользователями", []string{RoleAdmin}},
+
+	{PermWorkloadView, "Просмотр загрузки сотрудников", []string{RoleAdmin, RoleNOR, RoleRNR}},
+
+	{PermStoreView, "Просмотр магазинов", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermStoreManage, "Управление магазинами", []string{RoleAdmin, RoleMRiZ}},
+	{PermRoleManage, "Управление ролями и правами", []string{RoleAdmin}},
+
+	{PermDocumentTypeManage, "Управление справочником типов документов", []string{RoleAdmin}},
+
+	{PermCommentCreate, "Комментирование задач", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermRequestManage, "Создание и обработка заявок", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermAbsenceManage, "Регистрация своих отсутствий", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+	{PermNotificationManage, "Управление своими уведомлениями", []string{RoleAdmin, RoleMP, RoleMRiZ, RoleBA, RoleNOR, RoleRNR}},
+}
+
+// SelfServicePermissions guard routes that used to be open to every authenticated user.
+// When such a permission is first created, every existing role (custom ones included) receives it,
+// so upgrading does not take away commenting, requests, own absences and notifications
+var SelfServicePermissions = []string{PermCommentCreate, PermRequestManage, PermAbsenceManage, PermNotificationManage}
+
+// IsKnownPermission checks that the code is declared in the catalogue
+func IsKnownPermission(code string) bool {
+	for _, p := range PermissionCatalog {
+		if p.Code == code {
 			return true
 		}
 	}
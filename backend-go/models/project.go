@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
 )
 
@@ -16,10 +17,6 @@ type Project struct {
 	TradeArea   *float64   `gorm:"column:TradeArea" json:"tradeArea" binding:"omitempty,gt=0,ltfield=TotalArea"`
 	Region      string     `gorm:"column:Region;type:varchar(100)" json:"region" binding:"omitempty,min=2,max=100"`
 	CFO         string     `gorm:"column:CFO;type:varchar(100)" json:"cfo"`
-	MP          string     `gorm:"column:MP;type:varchar(255)" json:"mp"`
-	NOR         string     `gorm:"column:NOR;type:varchar(255)" json:"nor"`
-	StMRiZ      string     `gorm:"column:StMRiZ;type:varchar(255)" json:"stMRiZ"`
-	RNR         string     `gorm:"column:RNR;type:varchar(255)" json:"rnr"`
 	CreatedAt   time.Time  `gorm:"column:CreatedAt" json:"createdAt"`
 	UpdatedAt   *time.Time `gorm:"column:UpdatedAt" json:"updatedAt"`
 	Store       *Store     `gorm:"foreignKey:StoreId;references:Id" json:"store,omitempty"`
@@ -27,6 +24,23 @@ type Project struct {
 	// Поля для BPMN и шаблонов
 	CurrentStage string `gorm:"column:CurrentStage" json:"currentStage"`
 	TemplateID   *uint  `gorm:"column:TemplateID" json:"templateId"`
+	// Опубликованная версия шаблона, по которой сгенерированы задачи
+	TemplateVersionID *uint `gorm:"column:TemplateVersionID" json:"templateVersionId"`
+
+	// Ручная установка статуса: закрепленный статус не пересчитывается по задачам
+	StatusPinned    bool       `gorm:"column:StatusPinned;default:false" json:"statusPinned"`
+	StatusReason    string     `gorm:"column:StatusReason;type:text" json:"statusReason"`
+	StatusChangedBy *uint      `gorm:"column:StatusChangedBy" json:"statusChangedBy"`
+	StatusChangedAt *time.Time `gorm:"column:StatusChangedAt" json:"statusChangedAt"`
+
+	// Команда проекта
+	Members []ProjectMember `gorm:"foreignKey:ProjectID;references:ID" json:"members,omitempty"`
+
+	// Имена участников по ролям, заполняются из команды (только для чтения)
+	MP     string `gorm:"-" json:"mp"`
+	NOR    string `gorm:"-" json:"nor"`
+	StMRiZ string `gorm:"-" json:"stMRiZ"`
+	RNR    string `gorm:"-" json:"rnr"`
 
 	// Вычисляемые поля для прогресс-бара
 	TotalTasks     int64 `gorm:"-" json:"totalTasks"`
@@ -58,6 +72,12 @@ func (p *Project) Validate() error {
 		return errors.New("недопустимый статус проекта")
 	}
 
+	for _, m := range p.Members {
+		if m.UserID == 0 || !IsValidProjectRole(m.Role) {
+			return errors.New("недопустимый участник команды проекта")
+		}
+	}
+
 	// Проверка GIS кода если указан
 	if p.GISCode != "" && (len(p.GISCode) < 3 || len(p.GISCode) > 50) {
 		return errors.New("код ГИС должен быть от 3 до 50 символов")
@@ -86,3 +106,27 @@ func (p *Project) SetDefaultValues() {
 		p.Status = string(ProjectStatusCreated)
 	}
 }
+
+// Area возвращает область проекта: регион магазина (или проекта, если у магазина он не указан) и ЦФО проекта.
+// Store должен быть загружен
+func (p *Project) Area() AccessArea {
+	area := AccessArea{Region: p.Region, CFO: p.CFO}
+	if p.Store != nil && p.Store.Region != "" {
+		area.Region = p.Store.Region
+	}
+	return area
+}
+
+// FillTeamNames заполняет имена участников по ролям из загруженной команды
+func (p *Project) FillTeamNames() {
+	names := make(map[string][]string)
+	for _, m := range p.Members {
+		if m.User != nil {
+			names[m.Role] = append(names[m.Role], m.User.Name)
+		}
+	}
+	p.MP = strings.Join(names[ProjectRoleMP], ", ")
+	p.NOR = strings.Join(names[ProjectRoleNOR], ", ")
+	p.StMRiZ = strings.Join(names[ProjectRoleStMRiZ], ", ")
+	p.RNR = strings.Join(names[ProjectRoleRNR], ", ")
+}
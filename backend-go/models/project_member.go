@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Роли участников в команде проекта
+const (
+	ProjectRoleMP     = "МП"     // Менеджер проекта
+	ProjectRoleNOR    = "НОР"    // Начальник отдела развития
+	ProjectRoleStMRiZ = "СтМРиЗ" // Старший менеджер развития и закупок
+	ProjectRoleRNR    = "РНР"    // Руководитель направления развития
+)
+
+// ProjectMember участник команды проекта
+type ProjectMember struct {
+	ID        uint      `gorm:"column:Id;primaryKey" json:"id"`
+	ProjectID uint      `gorm:"column:ProjectId;not null;uniqueIndex:idx_project_member" json:"projectId"`
+	UserID    uint      `gorm:"column:UserId;not null;uniqueIndex:idx_project_member;index" json:"userId" binding:"required"`
+	Role      string    `gorm:"column:Role;type:varchar(50);not null;uniqueIndex:idx_project_member" json:"role" binding:"required"`
+	CreatedAt time.Time `gorm:"column:CreatedAt" json:"createdAt"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName для GORM
+func (ProjectMember) TableName() string {
+	return "ProjectMembers"
+}
+
+// ProjectRolesEditingTasks роли команды, которым с правом task:edit_own
+// доступны все задачи проекта, а не только назначенные им
+var ProjectRolesEditingTasks = []string{ProjectRoleMP, ProjectRoleNOR, ProjectRoleRNR}
+
+// ValidProjectRoles возвращает роли, доступные в команде проекта
+func ValidProjectRoles() []string {
+	return []string{ProjectRoleMP, ProjectRoleNOR, ProjectRoleStMRiZ, ProjectRoleRNR}
+}
+
+// IsValidProjectRole проверяет роль участника команды
+func IsValidProjectRole(role string) bool {
+	for _, r := range ValidProjectRoles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
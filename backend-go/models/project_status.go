@@ -0,0 +1,104 @@
+package models
+
+// ProjectStatusDefinition статус из набора статусов для типа проекта
+type ProjectStatusDefinition struct {
+	ID           uint   `gorm:"primaryKey;column:ID" json:"id"`
+	ProjectType  string `gorm:"column:ProjectType;type:varchar(50);not null;uniqueIndex:idx_project_type_status" json:"projectType"`
+	Status       string `gorm:"column:Status;type:varchar(100);not null;uniqueIndex:idx_project_type_status" json:"status"`
+	Order        int    `gorm:"column:Order;default:0" json:"order"`
+	IsInitial    bool   `gorm:"column:IsInitial;default:false" json:"isInitial"`       // Статус нового проекта
+	IsCompletion bool   `gorm:"column:IsCompletion;default:false" json:"isCompletion"` // Присваивается, когда все задачи завершены
+	IsFinal      bool   `gorm:"column:IsFinal;default:false" json:"isFinal"`           // Не перезаписывается автоматически
+	Stage        string `gorm:"column:Stage;type:varchar(100)" json:"stage"`           // Этап workflow, задачи которого в работе или завершены переводят проект в статус
+}
+
+// StageRSR этап workflow с задачами ремонтно-строительных работ; задает статус ProjectStatusRSR
+const StageRSR = "РСР"
+
+// TableName для GORM
+func (ProjectStatusDefinition) TableName() string {
+	return "ProjectStatusDefinition"
+}
+
+// DefaultProjectStatusSet возвращает встроенный набор статусов для типа проекта
+func DefaultProjectStatusSet(projectType ProjectType) []ProjectStatusDefinition {
+	var statuses []ProjectStatus
+	completion := ProjectStatusOpened
+
+	switch projectType {
+	case ProjectTypeReconstruction:
+		statuses = []ProjectStatus{
+			ProjectStatusCreated,
+			ProjectStatusAuditObject,
+			ProjectStatusLayout,
+			ProjectStatusTotalBudget,
+			ProjectStatusContractSigned,
+			ProjectStatusRSR,
+			ProjectStatusOpened,
+		}
+	case ProjectTypeClosure:
+		statuses = []ProjectStatus{
+			ProjectStatusCreated,
+			ProjectStatusClosurePrep,
+			ProjectStatusEquipmentRemoval,
+			ProjectStatusPremisesReturn,
+		}
+		completion = ProjectStatusClosed
+	default:
+		statuses = []ProjectStatus{
+			ProjectStatusCreated,
+			ProjectStatusPrepAudit,
+			ProjectStatusAuditObject,
+			ProjectStatusAlcoholLicense,
+			ProjectStatusWaste,
+			ProjectStatusContour,
+			ProjectStatusVisualization,
+			ProjectStatusLogistics,
+			ProjectStatusLayout,
+			ProjectStatusBudgetEquip,
+			ProjectStatusBudgetSecurity,
+			ProjectStatusBudgetRSR,
+			ProjectStatusBudgetPIS,
+			ProjectStatusTotalBudget,
+			ProjectStatusContractSigned,
+			ProjectStatusRSR,
+			ProjectStatusOpened,
+		}
+	}
+
+	// Финальные статусы есть у каждого типа
+	for _, final := range []ProjectStatus{ProjectStatusFailed, ProjectStatusClosed, ProjectStatusArchived} {
+		found := false
+		for _, s := range statuses {
+			if s == final {
+				found = true
+				break
+			}
+		}
+		if !found {
+			statuses = append(statuses, final)
+		}
+	}
+
+	set := make([]ProjectStatusDefinition, 0, len(statuses))
+	for i, s := range statuses {
+		set = append(set, ProjectStatusDefinition{
+			ProjectType:  string(projectType),
+			Status:       string(s),
+			Order:        i,
+			IsInitial:    s == ProjectStatusCreated,
+			IsCompletion: s == completion,
+			IsFinal:      s == completion || s == ProjectStatusFailed || s == ProjectStatusClosed || s == ProjectStatusArchived,
+			Stage:        DefaultStatusStage(s),
+		})
+	}
+	return set
+}
+
+// DefaultStatusStage этап workflow, который задает встроенный статус; пусто, если статус задают сами задачи
+func DefaultStatusStage(status ProjectStatus) string {
+	if status == ProjectStatusRSR {
+		return StageRSR
+	}
+	return ""
+}
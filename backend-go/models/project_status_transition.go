@@ -0,0 +1,63 @@
+package models
+
+// Классы статусов набора. В правилах переходов вместо конкретного статуса
+// можно указать класс — он разрешается по флагам набора статусов типа проекта
+const (
+	StatusClassInitial    = "@initial"    // Начальный статус набора
+	StatusClassWorking    = "@working"    // Нефинальные статусы (включая начальный)
+	StatusClassCompletion = "@completion" // Статус завершения набора
+	StatusClassFinal      = "@final"      // Финальные статусы, кроме статуса завершения
+)
+
+// Проверки, выполняемые перед переходом
+const (
+	StatusGuardAllTasksCompleted = "all_tasks_completed"
+)
+
+// ProjectStatusTransitionRule правило ручного перехода между статусами проекта
+type ProjectStatusTransitionRule struct {
+	From          []string // Статусы или классы статусов, из которых разрешен переход
+	To            string   // Статус или класс статусов, в который выполняется переход
+	Roles         []string // Роли, которым разрешен переход
+	RequireReason bool     // Переход требует указания причины
+	Guard         string   // Дополнительное условие перехода
+}
+
+// ProjectStatusTransitions описывает машину состояний статусов проекта.
+// Правила проверяются по порядку, применяется первое подходящее
+var ProjectStatusTransitions = []ProjectStatusTransitionRule{
+	{
+		From:  []string{StatusClassWorking},
+		To:    StatusClassCompletion,
+		Roles: []string{RoleAdmin, RoleMP, RoleNOR, RoleRNR},
+		Guard: StatusGuardAllTasksCompleted,
+	},
+	{
+		From:  []string{StatusClassWorking},
+		To:    StatusClassWorking,
+		Roles: []string{RoleAdmin, RoleMP, RoleNOR, RoleRNR},
+	},
+	{
+		From:          []string{StatusClassWorking},
+		To:            string(ProjectStatusFailed),
+		Roles:         []string{RoleAdmin, RoleNOR, RoleRNR},
+		RequireReason: true,
+	},
+	{
+		From:          []string{StatusClassWorking, StatusClassCompletion},
+		To:            string(ProjectStatusClosed),
+		Roles:         []string{RoleAdmin, RoleNOR, RoleRNR},
+		RequireReason: true,
+	},
+	{
+		From:          []string{string(ProjectStatusFailed)},
+		To:            StatusClassInitial,
+		Roles:         []string{RoleAdmin, RoleNOR, RoleRNR},
+		RequireReason: true,
+	},
+	{
+		From:  []string{StatusClassFinal, StatusClassCompletion},
+		To:    string(ProjectStatusArchived),
+		Roles: []string{RoleAdmin, RoleRNR},
+	},
+}
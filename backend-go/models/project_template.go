@@ -17,6 +17,11 @@ type ProjectTemplate struct {
 	CreatedAt   time.Time `gorm:"column:CreatedAt" json:"createdAt"`
 	UpdatedAt   time.Time `gorm:"column:UpdatedAt" json:"updatedAt"`
 
+	// Версионирование: задачи шаблона (Tasks) — это черновик,
+	// проекты создаются по опубликованным неизменяемым версиям
+	LatestVersion   int  `gorm:"column:LatestVersion;default:0" json:"latestVersion"`         // 0 — ни одной опубликованной версии
+	HasDraftChanges bool `gorm:"column:HasDraftChanges;default:false" json:"hasDraftChanges"` // Черновик отличается от последней версии
+
 	// Связь с задачами шаблона
 	Tasks []TemplateTask `gorm:"foreignKey:ProjectTemplateID" json:"tasks"`
 }
@@ -34,6 +39,11 @@ type TemplateTask struct {
 	TaskType          string         `gorm:"column:TaskType;default:UserTask" json:"taskType"`
 	Order             int            `gorm:"column:Order;default:0" json:"order"` // Порядок задачи
 
+	// Статус проекта, который задает задача в работе или после завершения ("" — не влияет),
+	// и ее место в последовательности статусов
+	ProjectStatus string `gorm:"column:ProjectStatus;type:varchar(100)" json:"projectStatus"`
+	StatusOrder   int    `gorm:"column:StatusOrder;default:0" json:"statusOrder"`
+
 	// Optional link to master TaskTemplate
 	TaskTemplateID *uint         `gorm:"column:TaskTemplateID" json:"taskTemplateId"`
 	TaskTemplate   *TaskTemplate `gorm:"foreignKey:TaskTemplateID" json:"taskTemplate,omitempty"`
@@ -51,3 +61,44 @@ func (ProjectTemplate) TableName() string {
 func (TemplateTask) TableName() string {
 	return "TemplateTask"
 }
+
+// ProjectTemplateVersion опубликованная (неизменяемая) версия шаблона проекта
+type ProjectTemplateVersion struct {
+	ID                uint      `gorm:"primaryKey;column:ID" json:"id"`
+	ProjectTemplateID uint      `gorm:"column:ProjectTemplateID;not null;uniqueIndex:idx_template_version" json:"projectTemplateId"`
+	Version           int       `gorm:"column:Version;not null;uniqueIndex:idx_template_version" json:"version"`
+	Name              string    `gorm:"column:Name;not null" json:"name"`
+	Category          string    `gorm:"column:Category" json:"category"`
+	Comment           string    `gorm:"column:Comment;type:text" json:"comment"`
+	PublishedByUserID *uint     `gorm:"column:PublishedByUserID" json:"publishedByUserId"`
+	PublishedAt       time.Time `gorm:"column:PublishedAt" json:"publishedAt"`
+
+	Tasks []TemplateVersionTask `gorm:"foreignKey:TemplateVersionID" json:"tasks"`
+}
+
+// TemplateVersionTask снимок задачи шаблона в конкретной версии
+type TemplateVersionTask struct {
+	ID                uint           `gorm:"primaryKey;column:ID" json:"id"`
+	TemplateVersionID uint           `gorm:"column:TemplateVersionID;not null;index" json:"templateVersionId"`
+	Code              string         `gorm:"column:Code;not null" json:"code"`
+	Name              string         `gorm:"column:Name;not null" json:"name"`
+	Duration          int            `gorm:"column:Duration;not null" json:"duration"`
+	Stage             string         `gorm:"column:Stage" json:"stage"`
+	DependsOn         pq.StringArray `gorm:"column:DependsOn;type:text[]" json:"dependsOn"`
+	ResponsibleRole   string         `gorm:"column:ResponsibleRole" json:"responsibleRole"`
+	TaskType          string         `gorm:"column:TaskType;default:UserTask" json:"taskType"`
+	Order             int            `gorm:"column:Order;default:0" json:"order"`
+	TaskTemplateID    *uint          `gorm:"column:TaskTemplateID" json:"taskTemplateId"`
+	ProjectStatus     string         `gorm:"column:ProjectStatus;type:varchar(100)" json:"projectStatus"`
+	StatusOrder       int            `gorm:"column:StatusOrder;default:0" json:"statusOrder"`
+}
+
+// TableName для GORM
+func (ProjectTemplateVersion) TableName() string {
+	return "ProjectTemplateVersion"
+}
+
+// TableName для GORM
+func (TemplateVersionTask) TableName() string {
+	return "TemplateVersionTask"
+}
@@ -41,6 +41,8 @@ type Request struct {
 	// Ответственный за выполнение заявки
 	AssignedToUserID uint  `gorm:"column:AssignedToUserId;not null" json:"assignedToUserId" binding:"required"`
 	AssignedToUser   *User `gorm:"foreignKey:AssignedToUserId" json:"assignedToUser,omitempty"`
+	// Заявка назначена заместителю вместо отсутствующего ответственного
+	DelegatedFromUserID *uint `gorm:"column:DelegatedFromUserId" json:"delegatedFromUserId"`
 
 	// Ответ на заявку
 	Response string `gorm:"column:Response;type:text" json:"response"`
@@ -12,6 +12,7 @@ type ProjectTask struct {
 	TaskType                     string     `gorm:"column:TaskType;type:varchar(100)" json:"taskType"`
 	Responsible                  string     `gorm:"column:Responsible;type:varchar(255)" json:"responsible"`
 	ResponsibleUserID            *int       `gorm:"column:ResponsibleUserId" json:"responsibleUserId"`
+	DelegatedFromUserID          *int       `gorm:"column:DelegatedFromUserId" json:"delegatedFromUserId"` // Задача назначена заместителю вместо отсутствующего
 	NormativeDeadline            time.Time  `gorm:"column:NormativeDeadline;not null" json:"normativeDeadline" binding:"required"`
 	PlannedStartDate             *time.Time `gorm:"column:PlannedStartDate" json:"plannedStartDate"`
 	ActualDate                   *time.Time `gorm:"column:ActualDate" json:"actualDate"`
@@ -42,6 +43,8 @@ type ProjectTask struct {
 	Days                         *int       `gorm:"column:Days" json:"days"`
 	DependsOn                    *string    `gorm:"column:DependsOn;type:text" json:"dependsOn"`
 	Order                        int        `gorm:"column:Order;default:0" json:"order"`
+	ProjectStatus                *string    `gorm:"column:ProjectStatus;type:varchar(100)" json:"projectStatus"` // Статус проекта, который задает задача
+	StatusOrder                  int        `gorm:"column:StatusOrder;default:0" json:"statusOrder"`
 	// Approval fields
 	IsApproved *bool      `gorm:"column:IsApproved;default:false" json:"isApproved"`
 	ApprovedBy *string    `gorm:"column:ApprovedBy;type:varchar(255)" json:"approvedBy"`
@@ -53,6 +56,9 @@ type ProjectTask struct {
 	TaskTemplate       *TaskTemplate `gorm:"foreignKey:TaskTemplateID" json:"taskTemplate,omitempty"`
 
 	Project *Project `gorm:"foreignKey:ProjectId;references:Id" json:"project,omitempty"`
+
+	// Как был выбран исполнитель при автоматическом назначении (пишется в историю, не хранится)
+	AssignmentNote string `gorm:"-" json:"-"`
 }
 
 func (ProjectTask) TableName() string {
@@ -13,4 +13,6 @@ type TaskDefinition struct {
 	ResponsibleUserID *int           `json:"responsibleUserId"` // Optional fixed user ID
 	TaskType          string         `gorm:"type:varchar(50)" json:"taskType"`
 	Stage             string         `gorm:"type:varchar(100)" json:"stage"`
+	ProjectStatus     string         `gorm:"type:varchar(100)" json:"projectStatus"` // Project status driven by this task
+	StatusOrder       int            `gorm:"default:0" json:"statusOrder"`
 }
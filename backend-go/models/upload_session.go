@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Статусы сеанса докачиваемой загрузки
+const (
+	UploadSessionActive     = "uploading"
+	UploadSessionCompleting = "completing" // Файл собирается в документ: сборку занял один из запросов
+	UploadSessionCompleted  = "completed"
+)
+
+// UploadSession сеанс докачиваемой загрузки: файл приходит частями, собирается на сервере
+// и после проверки становится документом или новой версией документа
+type UploadSession struct {
+	ID         string    `gorm:"column:Id;type:varchar(36);primaryKey" json:"id"`
+	UserID     uint      `gorm:"column:UserId;not null;index" json:"userId"`
+	ProjectID  uint      `gorm:"column:ProjectId;not null" json:"projectId"`
+	TaskID     *int      `gorm:"column:TaskId" json:"taskId"`
+	DocumentID *uint     `gorm:"column:DocumentId" json:"documentId"` // Документ, в который добавляется версия, или созданный документ
+	TypeCode   string    `gorm:"column:TypeCode;type:varchar(50)" json:"typeCode"`
+	FileName   string    `gorm:"column:FileName;type:varchar(255);not null" json:"fileName"`
+	Size       int64     `gorm:"column:Size;not null" json:"size"`
+	SHA256     string    `gorm:"column:Sha256;type:varchar(64)" json:"sha256"` // Хэш файла от клиента; пусто — не сверяется
+	Comment    string    `gorm:"column:Comment;type:text" json:"comment"`
+	Received   int64     `gorm:"column:Received;not null;default:0" json:"offset"` // Принято байт: с этого места продолжается загрузка
+	Status     string    `gorm:"column:Status;type:varchar(20);not null;default:'uploading'" json:"status"`
+	ExpiresAt  time.Time `gorm:"column:ExpiresAt;not null;index" json:"expiresAt"`
+	CreatedAt  time.Time `gorm:"column:CreatedAt" json:"createdAt"`
+	UpdatedAt  time.Time `gorm:"column:UpdatedAt" json:"updatedAt"`
+
+	ChunkSize int64 `gorm:"-" json:"chunkSize"` // Рекомендуемый размер части
+}
+
+// TableName для GORM
+func (UploadSession) TableName() string {
+	return "UploadSessions"
+}
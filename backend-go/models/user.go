@@ -3,11 +3,21 @@ package models
 import "time"
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
-	Login     string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"login"`
-	Role      string    `gorm:"type:varchar(50);not null" json:"role"` // "МП", "МРиЗ", "БА", "admin"
-	Avatar    string    `gorm:"type:varchar(100)" json:"avatar"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Name     string `gorm:"type:varchar(255);not null" json:"name"`
+	Login    string `gorm:"type:varchar(100);uniqueIndex;not null" json:"login"`
+	Role     string `gorm:"type:varchar(50);not null" json:"role"` // Основная роль: "МП", "МРиЗ", "БА", "admin"
+	Avatar   string `gorm:"type:varchar(100)" json:"avatar"`
+	IsActive bool   `gorm:"default:true" json:"isActive"` // Деактивированный пользователь не может войти и не получает задачи
+	// Сколько дней работы по задачам пользователь успевает за неделю (для отчета о загрузке)
+	WeeklyCapacity float64   `gorm:"default:5" json:"weeklyCapacity"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+
+	// Идентификатор пользователя у провайдера SSO (sub); пусто — только локальный вход
+	ExternalSubject *string `gorm:"type:varchar(255);uniqueIndex" json:"-"`
+
+	Roles []UserRole `gorm:"foreignKey:UserID" json:"roles,omitempty"` // Все роли пользователя; Role — основная
 }
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// UserAbsence период отсутствия пользователя. На время отсутствия новые задачи и заявки
+// назначаются заместителю, а заместитель может работать с задачами и заявками отсутствующего
+type UserAbsence struct {
+	ID         uint      `gorm:"column:Id;primaryKey" json:"id"`
+	UserID     uint      `gorm:"column:UserId;not null;index" json:"userId"`
+	DelegateID uint      `gorm:"column:DelegateId;not null;index" json:"delegateId" binding:"required"`
+	StartDate  time.Time `gorm:"column:StartDate;not null" json:"startDate" binding:"required"`
+	EndDate    time.Time `gorm:"column:EndDate;not null" json:"endDate" binding:"required"` // Включительно, до конца дня
+	Reason     string    `gorm:"column:Reason;type:varchar(255)" json:"reason"`
+	CreatedAt  time.Time `gorm:"column:CreatedAt" json:"createdAt"`
+
+	User     *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Delegate *User `gorm:"foreignKey:DelegateID" json:"delegate,omitempty"`
+}
+
+// TableName для GORM
+func (UserAbsence) TableName() string {
+	return "UserAbsences"
+}
+
+// IsActiveAt проверяет, действует ли отсутствие в момент времени
+func (a UserAbsence) IsActiveAt(t time.Time) bool {
+	return !t.Before(a.StartDate) && !t.After(a.EndDate)
+}
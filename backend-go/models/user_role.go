@@ -0,0 +1,167 @@
+package models
+
+// UserRole роль пользователя. Роль действует во всех регионах
+// либо только в регионе и/или ЦФО, указанных в назначении
+type UserRole struct {
+	ID       uint   `gorm:"column:Id;primaryKey" json:"id"`
+	UserID   uint   `gorm:"column:UserId;not null;uniqueIndex:idx_user_role" json:"userId"`
+	RoleCode string `gorm:"column:RoleCode;type:varchar(50);not null;uniqueIndex:idx_user_role" json:"roleCode"`
+	Region   string `gorm:"column:Region;type:varchar(100);not null;default:'';uniqueIndex:idx_user_role" json:"region"` // Пусто — все регионы
+	CFO      string `gorm:"column:CFO;type:varchar(100);not null;default:'';uniqueIndex:idx_user_role" json:"cfo"`       // Пусто — все ЦФО
+}
+
+// TableName для GORM
+func (UserRole) TableName() string {
+	return "UserRoles"
+}
+
+// Area возвращает область действия назначения
+func (r UserRole) Area() AccessArea {
+	return AccessArea{Region: r.Region, CFO: r.CFO}
+}
+
+// AccessArea область действия роли. Пустое поле не ограничивает доступ
+type AccessArea struct {
+	Region string `json:"region,omitempty"`
+	CFO    string `json:"cfo,omitempty"`
+}
+
+// IsGlobal сообщает, что область не ограничена
+func (a AccessArea) IsGlobal() bool {
+	return a.Region == "" && a.CFO == ""
+}
+
+// Covers проверяет, попадает ли ресурс с регионом и ЦФО в область
+func (a AccessArea) Covers(region, cfo string) bool {
+	return (a.Region == "" || a.Region == region) && (a.CFO == "" || a.CFO == cfo)
+}
+
+// RoleGrant роль пользователя в области вместе с правами роли
+type RoleGrant struct {
+	Role        string     `json:"role"`
+	Area        AccessArea `json:"area"`
+	Permissions []string   `json:"permissions"`
+}
+
+// UserAccess действующие права пользователя: объединение прав ролей,
+// область которых покрывает регион ресурса
+type UserAccess struct {
+	Grants []RoleGrant `json:"grants"`
+	// Пользователи, которых текущий пользователь сейчас замещает
+	ActingFor []uint `json:"actingFor,omitempty"`
+}
+
+// NewGlobalAccess создает доступ из одной неограниченной роли
+func NewGlobalAccess(role string, permissions []string) *UserAccess {
+	return &UserAccess{Grants: []RoleGrant{{Role: role, Permissions: permissions}}}
+}
+
+// Permissions возвращает права, которые есть у пользователя хотя бы в одной области
+func (a *UserAccess) Permissions() []string {
+	return a.collect(func(RoleGrant) bool { return true })
+}
+
+// PermissionsIn возвращает права, действующие для ресурса в регионе и ЦФО
+func (a *UserAccess) PermissionsIn(region, cfo string) []string {
+	return a.collect(func(g RoleGrant) bool { return g.Area.Covers(region, cfo) })
+}
+
+// RolesIn возвращает роли, действующие для ресурса в регионе и ЦФО
+func (a *UserAccess) RolesIn(region, cfo string) []string {
+	roles := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, g := range a.grants() {
+		if g.Area.Covers(region, cfo) && !seen[g.Role] {
+			seen[g.Role] = true
+			roles = append(roles, g.Role)
+		}
+	}
+	return roles
+}
+
+// HasPermissionIn проверяет право для ресурса в регионе и ЦФО
+func (a *UserAccess) HasPermissionIn(perm, region, cfo string) bool {
+	for _, g := range a.grants() {
+		if g.Area.Covers(region, cfo) && containsString(g.Permissions, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Areas возвращает области, в которых у пользователя есть право.
+// global = true, если право действует без ограничений
+func (a *UserAccess) Areas(perm string) (global bool, areas []AccessArea) {
+	for _, g := range a.grants() {
+		if !containsString(g.Permissions, perm) {
+			continue
+		}
+		if g.Area.IsGlobal() {
+			return true, nil
+		}
+		areas = append(areas, g.Area)
+	}
+	return false, areas
+}
+
+func (a *UserAccess) grants() []RoleGrant {
+	if a == nil {
+		return nil
+	}
+	return a.Grants
+}
+
+func (a *UserAccess) collect(match func(RoleGrant) bool) []string {
+	perms := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, g := range a.grants() {
+		if !match(g) {
+			continue
+		}
+		for _, p := range g.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				perms = append(perms, p)
+			}
+		}
+	}
+	return perms
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CanActFor проверяет, может ли пользователь действовать за владельца работы
+func (a *UserAccess) CanActFor(userID, ownerID uint) bool {
+	if userID == ownerID {
+		return true
+	}
+	for _, id := range a.ActingFor {
+		if id == ownerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Restrict возвращает доступ, в котором у каждой роли оставлены только разрешенные права
+// (например, права персонального токена). Области ролей и замещения сохраняются
+func (a *UserAccess) Restrict(allowed []string) *UserAccess {
+	restricted := &UserAccess{ActingFor: a.ActingFor}
+	for _, g := range a.grants() {
+		perms := make([]string, 0, len(g.Permissions))
+		for _, p := range g.Permissions {
+			if containsString(allowed, p) {
+				perms = append(perms, p)
+			}
+		}
+		restricted.Grants = append(restricted.Grants, RoleGrant{Role: g.Role, Area: g.Area, Permissions: perms})
+	}
+	return restricted
+}
@@ -0,0 +1,100 @@
+package office
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DocumentText извлекает текст документа .docx: абзацы разделяются переводом строки,
+// ячейки таблиц — табуляцией. maxLen ограничивает длину результата в байтах (0 — без ограничения);
+// truncated сообщает, что текст обрезан. Распаковывается не больше DefaultMaxUnzippedSize байт,
+// иначе — ErrTooLarge
+func DocumentText(r io.ReaderAt, size int64, maxLen int) (text string, truncated bool, err error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", false, ErrInvalidFile
+	}
+	var body *zip.File
+	for _, f := range archive.File {
+		if strings.TrimPrefix(f.Name, "/") == "word/document.xml" {
+			body = f
+		}
+	}
+	if body == nil {
+		return "", false, fmt.Errorf("%w: нет части word/document.xml", ErrInvalidFile)
+	}
+	budget := &unzipBudget{remaining: DefaultMaxUnzippedSize}
+	rc, err := budget.open(body)
+	if err != nil {
+		return "", false, err
+	}
+	defer rc.Close()
+
+	var out strings.Builder
+	write := func(s string) bool {
+		if maxLen > 0 && out.Len()+len(s) > maxLen {
+			out.WriteString(truncateUTF8(s, maxLen-out.Len()))
+			return false
+		}
+		out.WriteString(s)
+		return true
+	}
+
+	inText := false
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false, partError("document.xml", err)
+		}
+		ok := true
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				ok = write("\t")
+			case "br", "cr":
+				ok = write("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				ok = write("\n")
+			case "tc":
+				ok = write("\t")
+			}
+		case xml.CharData:
+			if inText {
+				ok = write(string(t))
+			}
+		}
+		if !ok {
+			return strings.TrimSpace(out.String()), true, nil
+		}
+	}
+	return strings.TrimSpace(out.String()), false, nil
+}
+
+// truncateUTF8 обрезает строку до n байт, не разрывая символ
+func truncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && (s[n]&0xC0) == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,484 @@
+// Package office читает содержимое документов Office Open XML (.xlsx, .docx) без сторонних библиотек:
+// значения ячеек книги и текст документа Word
+package office
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFile файл не является книгой или документом Office Open XML
+var ErrInvalidFile = errors.New("office: файл поврежден или не является документом Office Open XML")
+
+// ErrTooLarge распакованное содержимое файла превышает ограничения чтения (например, ZIP-бомба)
+var ErrTooLarge = errors.New("office: распакованное содержимое файла слишком велико")
+
+// Ограничения чтения по умолчанию: защищают от листов с ячейкой на краю таблицы (XFD1048576)
+// и от архивов, которые распаковываются в гигабайты
+const (
+	DefaultMaxRows              = 10000
+	DefaultMaxCols              = 256
+	DefaultMaxUnzippedSize      = 64 << 20
+	DefaultMaxSharedStrings     = 500000
+	DefaultMaxSharedStringsSize = 16 << 20
+)
+
+// ReadOptions какая часть листов читается и сколько данных можно распаковать; 0 — ограничения по умолчанию.
+// MaxUnzippedSize — общий объем всех прочитанных частей архива, MaxSharedStrings и
+// MaxSharedStringsSize — число строк общей таблицы и их суммарная длина в байтах
+type ReadOptions struct {
+	MaxRows              int
+	MaxCols              int
+	MaxUnzippedSize      int64
+	MaxSharedStrings     int
+	MaxSharedStringsSize int
+}
+
+func (o *ReadOptions) setDefaults() {
+	if o.MaxRows <= 0 {
+		o.MaxRows = DefaultMaxRows
+	}
+	if o.MaxCols <= 0 {
+		o.MaxCols = DefaultMaxCols
+	}
+	if o.MaxUnzippedSize <= 0 {
+		o.MaxUnzippedSize = DefaultMaxUnzippedSize
+	}
+	if o.MaxSharedStrings <= 0 {
+		o.MaxSharedStrings = DefaultMaxSharedStrings
+	}
+	if o.MaxSharedStringsSize <= 0 {
+		o.MaxSharedStringsSize = DefaultMaxSharedStringsSize
+	}
+}
+
+// Workbook книга Excel: листы по порядку и именованные диапазоны
+type Workbook struct {
+	Sheets []*Sheet
+	Names  map[string]string // Имя диапазона → ссылка вида "Смета!$F$40"
+}
+
+// Sheet лист книги. Rows — прочитанная часть листа, значения как в файле: числа без
+// форматирования, даты — порядковым номером дня. TotalRows/TotalCols — размер всего листа
+type Sheet struct {
+	Name      string
+	Hidden    bool
+	Rows      [][]string
+	TotalRows int
+	TotalCols int
+}
+
+// ReadWorkbook читает книгу .xlsx
+func ReadWorkbook(r io.ReaderAt, size int64, opts ReadOptions) (*Workbook, error) {
+	opts.setDefaults()
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	budget := &unzipBudget{remaining: opts.MaxUnzippedSize}
+
+	var workbook workbookXML
+	if err := decodePart(files, budget, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var rels relationshipsXML
+	if err := decodePart(files, budget, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(rels.Items))
+	for _, rel := range rels.Items {
+		targets[rel.ID] = partPath("xl", rel.Target)
+	}
+	shared, err := readSharedStrings(files, budget, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Workbook{Names: make(map[string]string)}
+	for _, name := range workbook.Names {
+		// Имена уровня листа (localSheetId) и служебные (_xlnm.Print_Area) не нужны
+		if name.LocalSheet == "" && !strings.HasPrefix(name.Name, "_xlnm.") {
+			result.Names[name.Name] = strings.TrimSpace(name.Ref)
+		}
+	}
+	for _, s := range workbook.Sheets {
+		target, ok := targets[s.relationID()]
+		if !ok {
+			return nil, fmt.Errorf("%w: нет листа %q", ErrInvalidFile, s.Name)
+		}
+		sheet := &Sheet{Name: s.Name, Hidden: s.State != "" && s.State != "visible"}
+		if err := readSheet(files[target], budget, shared, sheet, opts); err != nil {
+			return nil, err
+		}
+		result.Sheets = append(result.Sheets, sheet)
+	}
+	return result, nil
+}
+
+// Sheet лист по имени без учета регистра; nil, если листа нет
+func (w *Workbook) Sheet(name string) *Sheet {
+	name = strings.TrimSpace(name)
+	for _, s := range w.Sheets {
+		if strings.EqualFold(s.Name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Name находит лист и ячейку именованного диапазона. Для диапазона из нескольких ячеек
+// возвращается левая верхняя
+func (w *Workbook) Name(name string) (*Sheet, string, bool) {
+	ref, ok := w.Names[name]
+	if !ok {
+		for n, r := range w.Names {
+			if strings.EqualFold(n, name) {
+				ref, ok = r, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, "", false
+	}
+	sheetName, cell, found := strings.Cut(ref, "!")
+	if !found {
+		return nil, "", false
+	}
+	sheetName = strings.ReplaceAll(strings.Trim(sheetName, "'"), "''", "'")
+	cell, _, _ = strings.Cut(strings.ReplaceAll(cell, "$", ""), ":")
+	sheet := w.Sheet(sheetName)
+	if sheet == nil {
+		return nil, "", false
+	}
+	return sheet, cell, true
+}
+
+// Value значение ячейки по номеру строки и столбца (с нуля); пусто вне прочитанной части
+func (s *Sheet) Value(row, col int) string {
+	if row < 0 || row >= len(s.Rows) || col < 0 || col >= len(s.Rows[row]) {
+		return ""
+	}
+	return s.Rows[row][col]
+}
+
+// Cell значение ячейки по ссылке вида "B12"
+func (s *Sheet) Cell(ref string) (string, error) {
+	row, col, err := ParseCellRef(ref)
+	if err != nil {
+		return "", err
+	}
+	return s.Value(row, col), nil
+}
+
+// ParseCellRef разбирает ссылку "B12" (допускается "$B$12") в номера строки и столбца с нуля
+func ParseCellRef(ref string) (row, col int, err error) {
+	ref = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(ref), "$", ""))
+	i := 0
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		col = col*26 + int(ref[i]-'A'+1)
+		i++
+	}
+	if i == 0 || i > 3 || i == len(ref) {
+		return 0, 0, fmt.Errorf("office: неверная ссылка на ячейку %q", ref)
+	}
+	number, err := strconv.Atoi(ref[i:])
+	if err != nil || number < 1 {
+		return 0, 0, fmt.Errorf("office: неверная ссылка на ячейку %q", ref)
+	}
+	return number - 1, col - 1, nil
+}
+
+// CellRef ссылка на ячейку по номерам строки и столбца с нуля: (11, 1) → "B12"
+func CellRef(row, col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row+1)
+}
+
+type workbookXML struct {
+	Sheets []sheetXML `xml:"sheets>sheet"`
+	Names  []struct {
+		Name       string `xml:"name,attr"`
+		LocalSheet string `xml:"localSheetId,attr"`
+		Ref        string `xml:",chardata"`
+	} `xml:"definedNames>definedName"`
+}
+
+type sheetXML struct {
+	Name  string     `xml:"name,attr"`
+	State string     `xml:"state,attr"`
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+// relationID атрибут r:id; пространство имен отличается в Transitional и Strict OOXML
+func (s sheetXML) relationID() string {
+	for _, attr := range s.Attrs {
+		if attr.Name.Local == "id" && attr.Name.Space != "" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+type relationshipsXML struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// partPath путь части архива по ссылке из связей: относительно base или от корня
+func partPath(base, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Clean(path.Join(base, target))
+}
+
+// unzipBudget сколько байт еще можно распаковать из архива; общий для всех частей файла
+type unzipBudget struct {
+	remaining int64
+}
+
+// open открывает часть архива; чтение сверх бюджета завершается ошибкой ErrTooLarge
+func (b *unzipBudget) open(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &limitedPart{ReadCloser: rc, budget: b}, nil
+}
+
+type limitedPart struct {
+	io.ReadCloser
+	budget *unzipBudget
+}
+
+func (p *limitedPart) Read(buf []byte) (int, error) {
+	// Читается на байт больше остатка, чтобы отличить часть ровно по бюджету от превышения
+	if int64(len(buf)) > p.budget.remaining+1 {
+		buf = buf[:p.budget.remaining+1]
+	}
+	n, err := p.ReadCloser.Read(buf)
+	if int64(n) > p.budget.remaining {
+		p.budget.remaining = 0
+		return 0, ErrTooLarge
+	}
+	p.budget.remaining -= int64(n)
+	return n, err
+}
+
+// partError ошибка разбора части архива: превышение ограничений возвращается как есть
+func partError(name string, err error) error {
+	if errors.Is(err, ErrTooLarge) {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %v", ErrInvalidFile, name, err)
+}
+
+func decodePart(files map[string]*zip.File, budget *unzipBudget, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%w: нет части %s", ErrInvalidFile, name)
+	}
+	rc, err := budget.open(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return partError(name, err)
+	}
+	return nil
+}
+
+// readSharedStrings читает общую таблицу строк. Строка с форматированием состоит из
+// нескольких фрагментов <r><t>; фонетические подсказки <rPh> пропускаются
+func readSharedStrings(files map[string]*zip.File, budget *unzipBudget, opts ReadOptions) ([]string, error) {
+	f, ok := files["xl/sharedStrings.xml"]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := budget.open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var result []string
+	var current strings.Builder
+	inText, skip, total := false, 0, 0
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, partError("sharedStrings.xml", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				skip++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				if len(result) >= opts.MaxSharedStrings {
+					return nil, fmt.Errorf("%w: больше %d общих строк", ErrTooLarge, opts.MaxSharedStrings)
+				}
+				result = append(result, current.String())
+			case "t":
+				inText = false
+			case "rPh":
+				skip--
+			}
+		case xml.CharData:
+			if inText && skip == 0 {
+				if total += len(t); total > opts.MaxSharedStringsSize {
+					return nil, fmt.Errorf("%w: общие строки больше %d байт", ErrTooLarge, opts.MaxSharedStringsSize)
+				}
+				current.Write(t)
+			}
+		}
+	}
+}
+
+// readSheet читает ячейки листа в плотную таблицу в пределах opts
+func readSheet(f *zip.File, budget *unzipBudget, shared []string, sheet *Sheet, opts ReadOptions) error {
+	if f == nil {
+		return fmt.Errorf("%w: нет листа %q", ErrInvalidFile, sheet.Name)
+	}
+	rc, err := budget.open(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var (
+		row, col  = -1, -1
+		cellType  string
+		value     strings.Builder
+		inValue   bool
+		haveValue bool
+	)
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return partError(fmt.Sprintf("лист %q", sheet.Name), err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row++
+				if r := attr(t, "r"); r != "" {
+					if n, err := strconv.Atoi(r); err == nil && n > 0 {
+						row = n - 1
+					}
+				}
+				col = -1
+			case "c":
+				col++
+				if ref := attr(t, "r"); ref != "" {
+					if r, c, err := ParseCellRef(ref); err == nil {
+						row, col = r, c
+					}
+				}
+				cellType = attr(t, "t")
+				value.Reset()
+				haveValue = false
+			case "v", "t":
+				// <t> — текст встроенной строки (inlineStr) внутри <is>
+				inValue = true
+				haveValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				if haveValue {
+					sheet.set(row, col, cellValue(cellType, value.String(), shared), opts)
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+}
+
+func (s *Sheet) set(row, col int, value string, opts ReadOptions) {
+	if value == "" {
+		return
+	}
+	if row+1 > s.TotalRows {
+		s.TotalRows = row + 1
+	}
+	if col+1 > s.TotalCols {
+		s.TotalCols = col + 1
+	}
+	if row >= opts.MaxRows || col >= opts.MaxCols {
+		return
+	}
+	for len(s.Rows) <= row {
+		s.Rows = append(s.Rows, nil)
+	}
+	if len(s.Rows[row]) <= col {
+		cells := make([]string, col+1)
+		copy(cells, s.Rows[row])
+		s.Rows[row] = cells
+	}
+	s.Rows[row][col] = value
+}
+
+func cellValue(cellType, raw string, shared []string) string {
+	switch cellType {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return shared[i]
+	case "b":
+		if strings.TrimSpace(raw) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return raw
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name && a.Name.Space == "" {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package oidc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidState state не выдан этим сервером, поврежден или просрочен
+var ErrInvalidState = errors.New("oidc: invalid or expired state")
+
+// StateTTL сколько живет незавершенный вход
+const StateTTL = 10 * time.Minute
+
+// Flow данные незавершенного входа, которые нужно дождаться после возврата от провайдера.
+// Binding — хеш случайного значения из cookie браузера, начавшего вход: без него чужой
+// code+state, подброшенный в браузер жертвы, выполнил бы вход под учетной записью атакующего
+type Flow struct {
+	CodeVerifier string    `json:"v"`
+	Nonce        string    `json:"n"`
+	Binding      string    `json:"b"`
+	ExpiresAt    time.Time `json:"e"`
+}
+
+// StateSealer шифрует данные входа в параметр state (AES-GCM).
+// Так вход не зависит от реплики, а code_verifier не виден в адресной строке
+type StateSealer struct {
+	aead cipher.AEAD
+}
+
+func NewStateSealer(secret string) (*StateSealer, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &StateSealer{aead: aead}, nil
+}
+
+// NewBinding генерирует значение, которое браузер, начавший вход, хранит в cookie до возврата от провайдера
+func NewBinding() string {
+	return randomString(32)
+}
+
+// NewFlow начинает вход для браузера со значением binding: генерирует code_verifier и nonce
+func NewFlow(binding string) Flow {
+	return Flow{
+		CodeVerifier: randomString(32),
+		Nonce:        randomString(16),
+		Binding:      bindingHash(binding),
+		ExpiresAt:    time.Now().Add(StateTTL),
+	}
+}
+
+// BoundTo проверяет, что вход завершает тот же браузер, который его начал
+func (f Flow) BoundTo(binding string) bool {
+	return binding != "" && subtle.ConstantTimeCompare([]byte(f.Binding), []byte(bindingHash(binding))) == 1
+}
+
+func bindingHash(binding string) string {
+	sum := sha256.Sum256([]byte(binding))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CodeChallenge возвращает S256-вызов PKCE для code_verifier
+func (f Flow) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(f.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Seal упаковывает данные входа в state
+func (s *StateSealer) Seal(flow Flow) (string, error) {
+	plain, err := json.Marshal(flow)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open распаковывает state и проверяет срок действия
+func (s *StateSealer) Open(state string) (Flow, error) {
+	var flow Flow
+	sealed, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return flow, ErrInvalidState
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return flow, ErrInvalidState
+	}
+	if err := json.Unmarshal(plain, &flow); err != nil || time.Now().After(flow.ExpiresAt) {
+		return flow, ErrInvalidState
+	}
+	return flow, nil
+}
+
+func randomString(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,149 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PDFRenderer отрисовывает первую страницу PDF
+type PDFRenderer interface {
+	RenderFirstPage(ctx context.Context, pdf io.Reader, size int) (image.Image, error)
+}
+
+// Pdftoppm отрисовывает страницы утилитой pdftoppm из Poppler (пакет poppler-utils)
+type Pdftoppm struct {
+	path    string
+	timeout time.Duration
+}
+
+// NewPdftoppm находит pdftoppm по пути или в PATH; nil, если утилиты нет
+func NewPdftoppm(path string, timeout time.Duration) *Pdftoppm {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil
+	}
+	return &Pdftoppm{path: resolved, timeout: timeout}
+}
+
+// RenderFirstPage сохраняет PDF во временный каталог (pdftoppm читает файл, а не поток)
+// и отрисовывает первую страницу с длинной стороной size
+func (p *Pdftoppm) RenderFirstPage(ctx context.Context, pdf io.Reader, size int) (image.Image, error) {
+	dir, input, err := writeTempPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	output := filepath.Join(dir, "page")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.path, "-png", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to", strconv.Itoa(size), input, output)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pdftoppm: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	page, err := os.Open(output + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+	return png.Decode(page)
+}
+
+// PDFTextExtractor извлекает текстовый слой PDF
+type PDFTextExtractor interface {
+	ExtractText(ctx context.Context, pdf io.Reader, maxLen int) (string, bool, error)
+}
+
+// Pdftotext извлекает текст утилитой pdftotext из Poppler. Сканы без текстового слоя дают пустой текст
+type Pdftotext struct {
+	path    string
+	timeout time.Duration
+}
+
+// NewPdftotext находит pdftotext по пути или в PATH; nil, если утилиты нет
+func NewPdftotext(path string, timeout time.Duration) *Pdftotext {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil
+	}
+	return &Pdftotext{path: resolved, timeout: timeout}
+}
+
+// ExtractText возвращает не больше maxLen байт текста; truncated — текст длиннее
+func (p *Pdftotext) ExtractText(ctx context.Context, pdf io.Reader, maxLen int) (string, bool, error) {
+	dir, input, err := writeTempPDF(pdf)
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(dir)
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	output := filepath.Join(dir, "document.txt")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.path, "-enc", "UTF-8", "-nopgbrk", input, output)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", false, fmt.Errorf("pdftotext: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+	text, err := io.ReadAll(io.LimitReader(file, int64(maxLen)+1))
+	if err != nil {
+		return "", false, err
+	}
+	if len(text) <= maxLen {
+		return strings.TrimSpace(string(text)), false, nil
+	}
+	// Обрезка не должна разрывать символ UTF-8
+	n := maxLen
+	for n > 0 && (text[n]&0xC0) == 0x80 {
+		n--
+	}
+	return strings.TrimSpace(string(text[:n])), true, nil
+}
+
+// writeTempPDF сохраняет PDF во временный каталог: утилиты Poppler читают файл, а не поток
+func writeTempPDF(pdf io.Reader) (string, string, error) {
+	dir, err := os.MkdirTemp("", "preview-*")
+	if err != nil {
+		return "", "", err
+	}
+	input := filepath.Join(dir, "document.pdf")
+	file, err := os.Create(input)
+	if err == nil {
+		_, err = io.Copy(file, pdf)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, input, nil
+}
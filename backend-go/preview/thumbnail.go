@@ -0,0 +1,89 @@
+// Package preview строит миниатюры документов: изображений и первой страницы PDF
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif" // Декодеры форматов для image.Decode
+	_ "image/jpeg"
+	"image/png"
+	"io"
+)
+
+// ErrUnsupported формат не поддерживается или нет внешнего инструмента для него
+var ErrUnsupported = errors.New("preview: формат не поддерживается")
+
+// DefaultSize длинная сторона миниатюры в пикселях
+const DefaultSize = 320
+
+// maxPixels изображения больше этого не декодируются: 50 Мп — около 200 МБ в памяти
+const maxPixels = 50_000_000
+
+// ImageThumbnail уменьшает изображение (JPEG, PNG, GIF) так, чтобы длинная сторона была
+// не больше size, и кодирует миниатюру в PNG
+func ImageThumbnail(r io.ReadSeeker, size int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(r)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrUnsupported
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeThumbnail(img, size)
+}
+
+// EncodeThumbnail уменьшает img и кодирует в PNG
+func EncodeThumbnail(img image.Image, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, Scale(img, size)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Scale уменьшает изображение усреднением пикселей, сохраняя пропорции.
+// Изображение меньше size возвращается без изменений
+func Scale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if size <= 0 || (w <= size && h <= size) {
+		return img
+	}
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
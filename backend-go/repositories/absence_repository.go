@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"errors"
+	"portal-razvitie/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AbsenceRepository interface {
+	FindByID(id uint) (*models.UserAbsence, error)
+	FindByUser(userID uint) ([]models.UserAbsence, error)
+	FindActive(userID uint, at time.Time) (*models.UserAbsence, error)
+	FindActingFor(delegateID uint, at time.Time) ([]uint, error)
+	HasOverlap(userID uint, start, end time.Time) (bool, error)
+	Create(absence *models.UserAbsence) error
+	Delete(id uint) error
+}
+
+type absenceRepository struct {
+	db *gorm.DB
+}
+
+func NewAbsenceRepository(db *gorm.DB) AbsenceRepository {
+	return &absenceRepository{db: db}
+}
+
+func (r *absenceRepository) FindByID(id uint) (*models.UserAbsence, error) {
+	var absence models.UserAbsence
+	err := r.db.Preload("Delegate").First(&absence, id).Error
+	return &absence, err
+}
+
+// FindByUser возвращает отсутствия пользователя, начиная с последних
+func (r *absenceRepository) FindByUser(userID uint) ([]models.UserAbsence, error) {
+	absences := make([]models.UserAbsence, 0)
+	err := r.db.Preload("Delegate").Where("\"UserId\" = ?", userID).
+		Order("\"StartDate\" DESC").Find(&absences).Error
+	return absences, err
+}
+
+// FindActive возвращает отсутствие, действующее в момент времени, или nil
+func (r *absenceRepository) FindActive(userID uint, at time.Time) (*models.UserAbsence, error) {
+	var absence models.UserAbsence
+	err := r.db.Preload("User").Preload("Delegate").
+		Where("\"UserId\" = ? AND \"StartDate\" <= ? AND \"EndDate\" >= ?", userID, at, at).
+		Order("\"StartDate\" DESC").First(&absence).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &absence, nil
+}
+
+// FindActingFor возвращает ID пользователей, которых заместитель замещает в момент времени
+func (r *absenceRepository) FindActingFor(delegateID uint, at time.Time) ([]uint, error) {
+	ids := make([]uint, 0)
+	err := r.db.Model(&models.UserAbsence{}).
+		Where("\"DelegateId\" = ? AND \"StartDate\" <= ? AND \"EndDate\" >= ?", delegateID, at, at).
+		Distinct().Pluck("UserId", &ids).Error
+	return ids, err
+}
+
+// HasOverlap проверяет, пересекается ли период с другими отсутствиями пользователя
+func (r *absenceRepository) HasOverlap(userID uint, start, end time.Time) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.UserAbsence{}).
+		Where("\"UserId\" = ? AND \"StartDate\" <= ? AND \"EndDate\" >= ?", userID, end, start).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *absenceRepository) Create(absence *models.UserAbsence) error {
+	return r.db.Create(absence).Error
+}
+
+func (r *absenceRepository) Delete(id uint) error {
+	result := r.db.Delete(&models.UserAbsence{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"portal-razvitie/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APITokenRepository interface {
+	FindByUser(userID uint) ([]models.APIToken, error)
+	FindByHash(hash string) (*models.APIToken, error)
+	Create(token *models.APIToken) error
+	Touch(id uint, at time.Time) error
+	DeleteForUser(userID, id uint) error
+}
+
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepository(db *gorm.DB) APITokenRepository {
+	return &apiTokenRepository{db: db}
+}
+
+// FindByUser возвращает токены пользователя, начиная с последних
+func (r *apiTokenRepository) FindByUser(userID uint) ([]models.APIToken, error) {
+	tokens := make([]models.APIToken, 0)
+	err := r.db.Where("\"UserId\" = ?", userID).Order("\"CreatedAt\" DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *apiTokenRepository) FindByHash(hash string) (*models.APIToken, error) {
+	var token models.APIToken
+	err := r.db.Where("\"TokenHash\" = ?", hash).First(&token).Error
+	return &token, err
+}
+
+func (r *apiTokenRepository) Create(token *models.APIToken) error {
+	return r.db.Create(token).Error
+}
+
+// Touch отмечает время последнего использования токена
+func (r *apiTokenRepository) Touch(id uint, at time.Time) error {
+	return r.db.Model(&models.APIToken{}).Where("\"Id\" = ?", id).UpdateColumn("LastUsedAt", at).Error
+}
+
+// DeleteForUser отзывает токен, если он принадлежит пользователю
+func (r *apiTokenRepository) DeleteForUser(userID, id uint) error {
+	result := r.db.Where("\"Id\" = ? AND \"UserId\" = ?", id, userID).Delete(&models.APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"portal-razvitie/models"
+
+	"gorm.io/gorm"
+)
+
+type ProjectMemberRepository interface {
+	FindByProject(projectID uint) ([]models.ProjectMember, error)
+	Create(member *models.ProjectMember) error
+	CreateWithTx(tx *gorm.DB, member *models.ProjectMember) error
+	Delete(projectID uint, memberID uint) error
+	CanView(scope ProjectScope, projectID uint) (bool, error)
+	HasRole(projectID uint, userID uint, roles []string) (bool, error)
+}
+
+type projectMemberRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectMemberRepository(db *gorm.DB) ProjectMemberRepository {
+	return &projectMemberRepository{db: db}
+}
+
+func (r *projectMemberRepository) FindByProject(projectID uint) ([]models.ProjectMember, error) {
+	members := make([]models.ProjectMember, 0)
+	err := r.db.Preload("User").Where("\"ProjectId\" = ?", projectID).
+		Order("\"Role\" ASC, \"Id\" ASC").Find(&members).Error
+	return members, err
+}
+
+func (r *projectMemberRepository) Create(member *models.ProjectMember) error {
+	return r.db.Create(member).Error
+}
+
+func (r *projectMemberRepository) CreateWithTx(tx *gorm.DB, member *models.ProjectMember) error {
+	return tx.Create(member).Error
+}
+
+func (r *projectMemberRepository) Delete(projectID uint, memberID uint) error {
+	result := r.db.Where("\"ProjectId\" = ? AND \"Id\" = ?", projectID, memberID).Delete(&models.ProjectMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CanView проверяет, виден ли проект в рамках скоупа
+func (r *projectMemberRepository) CanView(scope ProjectScope, projectID uint) (bool, error) {
+	if scope.ViewAll {
+		return true, nil
+	}
+	var count int64
+	err := scope.Apply(r.db.Model(&models.Project{}), "\"Id\"").
+		Where("\"Id\" = ?", projectID).Count(&count).Error
+	return count > 0, err
+}
+
+// HasRole проверяет, состоит ли пользователь в команде проекта с одной из ролей
+func (r *projectMemberRepository) HasRole(projectID uint, userID uint, roles []string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ProjectMember{}).
+		Where("\"ProjectId\" = ? AND \"UserId\" = ? AND \"Role\" IN ?", projectID, userID, roles).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"log"
 	"portal-razvitie/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -10,10 +11,12 @@ import (
 type ProjectRepository interface {
 	Create(project *models.Project) error
 	CreateWithTx(tx *gorm.DB, project *models.Project) error
-	FindAll() ([]models.Project, error)
+	FindAll(scope ProjectScope) ([]models.Project, error)
 	FindByID(id uint) (*models.Project, error)
 	Update(project *models.Project) error
-	UpdateStatus(id uint, status string) error
+	UpdateStatus(id uint, from string, status string) error
+	SetManualStatus(id uint, from string, status string, reason string, userID uint) error
+	UnpinStatus(id uint) error
 	Delete(id uint) error
 }
 
@@ -33,11 +36,11 @@ func (r *projectRepository) CreateWithTx(tx *gorm.DB, project *models.Project) e
 	return tx.Create(project).Error
 }
 
-func (r *projectRepository) FindAll() ([]models.Project, error) {
+func (r *projectRepository) FindAll(scope ProjectScope) ([]models.Project, error) {
 	var projects []models.Project
 
-	// Прелоадим Store для всех проектов сразу (избегаем N+1)
-	err := r.db.Preload("Store").Find(&projects).Error
+	// Прелоадим Store и команду для всех проектов сразу (избегаем N+1)
+	err := scope.Apply(r.db, "\"Id\"").Preload("Store").Preload("Members.User").Find(&projects).Error
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +60,7 @@ func (r *projectRepository) FindAll() ([]models.Project, error) {
 	// Используем Model для правильного определения имени таблицы
 	result := r.db.Model(&models.ProjectTask{}).
 		Select("\"ProjectId\", count(*) as Total, sum(case when \"Status\" = 'Завершена' then 1 else 0 end) as Completed").
+		Where("\"Status\" <> ?", models.TaskStatusRetired).
 		Group("\"ProjectId\"").
 		Scan(&stats)
 
@@ -72,6 +76,7 @@ func (r *projectRepository) FindAll() ([]models.Project, error) {
 
 	// Заполняем проекты
 	for i := range projects {
+		projects[i].FillTeamNames()
 		if s, ok := statsMap[projects[i].ID]; ok {
 			projects[i].TotalTasks = s.Total
 			projects[i].CompletedTasks = s.Completed
@@ -83,10 +88,11 @@ func (r *projectRepository) FindAll() ([]models.Project, error) {
 
 func (r *projectRepository) FindByID(id uint) (*models.Project, error) {
 	var project models.Project
-	err := r.db.Preload("Store").First(&project, id).Error
+	err := r.db.Preload("Store").Preload("Members.User").First(&project, id).Error
 	if err != nil {
 		return nil, err
 	}
+	project.FillTeamNames()
 
 	// Загружаем статистику задач
 	var stat struct {
@@ -95,7 +101,7 @@ func (r *projectRepository) FindByID(id uint) (*models.Project, error) {
 	}
 	err = r.db.Model(&models.ProjectTask{}).
 		Select("count(*) as Total, sum(case when \"Status\" = 'Завершена' then 1 else 0 end) as Completed").
-		Where("\"ProjectId\" = ?", id).
+		Where("\"ProjectId\" = ? AND \"Status\" <> ?", id, models.TaskStatusRetired).
 		Scan(&stat).Error
 	if err != nil {
 		return nil, err
@@ -111,8 +117,12 @@ func (r *projectRepository) Update(project *models.Project) error {
 	return r.db.Save(project).Error
 }
 
-func (r *projectRepository) UpdateStatus(id uint, status string) error {
-	result := r.db.Model(&models.Project{}).Where("\"Id\" = ?", id).Update("\"Status\"", status)
+// UpdateStatus меняет рассчитанный статус, если проект все еще в статусе from и статус не закреплен вручную.
+// Иначе (статус успел измениться) возвращает gorm.ErrRecordNotFound
+func (r *projectRepository) UpdateStatus(id uint, from string, status string) error {
+	result := r.db.Model(&models.Project{}).
+		Where("\"Id\" = ? AND \"Status\" = ? AND \"StatusPinned\" = ?", id, from, false).
+		Update("Status", status)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -122,6 +132,32 @@ func (r *projectRepository) UpdateStatus(id uint, status string) error {
 	return nil
 }
 
+// SetManualStatus устанавливает статус вручную и закрепляет его, если проект все еще в статусе from,
+// из которого проверялся переход. Иначе возвращает gorm.ErrRecordNotFound
+func (r *projectRepository) SetManualStatus(id uint, from string, status string, reason string, userID uint) error {
+	now := time.Now()
+	result := r.db.Model(&models.Project{}).Where("\"Id\" = ? AND \"Status\" = ?", id, from).Updates(map[string]interface{}{
+		"Status":          status,
+		"StatusPinned":    true,
+		"StatusReason":    reason,
+		"StatusChangedBy": userID,
+		"StatusChangedAt": now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UnpinStatus снимает закрепление, статус снова пересчитывается по задачам
+func (r *projectRepository) UnpinStatus(id uint) error {
+	return r.db.Model(&models.Project{}).Where("\"Id\" = ?", id).
+		Update("StatusPinned", false).Error
+}
+
 func (r *projectRepository) Delete(id uint) error {
 	// Используем транзакцию для атомарного удаления
 	return r.db.Transaction(func(tx *gorm.DB) error {
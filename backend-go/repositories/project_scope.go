@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"strings"
+
+	"portal-razvitie/models"
+
+	"gorm.io/gorm"
+)
+
+// ProjectScope ограничивает выборки проектами, которые видит пользователь.
+// Пользователь видит проект, если он (или замещаемый им сотрудник) состоит в его команде,
+// отвечает за одну из его задач или имеет project:view_all в области проекта (регион магазина и ЦФО проекта)
+type ProjectScope struct {
+	UserID    uint
+	ActingFor []uint              // Замещаемые сотрудники: их проекты видны заместителю
+	ViewAll   bool                // Право project:view_all без ограничения области — ограничений нет
+	Areas     []models.AccessArea // Области, в которых действует project:view_all
+}
+
+// AllProjectsScope возвращает скоуп без ограничений (для фоновых процессов)
+func AllProjectsScope() ProjectScope {
+	return ProjectScope{ViewAll: true}
+}
+
+// Apply добавляет к запросу условие по колонке с ID проекта
+func (s ProjectScope) Apply(db *gorm.DB, projectColumn string) *gorm.DB {
+	if s.ViewAll {
+		return db
+	}
+	tx := db.Session(&gorm.Session{NewDB: true})
+	users := append([]uint{s.UserID}, s.ActingFor...)
+	members := tx.Model(&models.ProjectMember{}).Select("\"ProjectId\"").Where("\"UserId\" IN ?", users)
+	assigned := tx.Model(&models.ProjectTask{}).Select("\"ProjectId\"").Where("\"ResponsibleUserId\" IN ?", users)
+
+	areaSQL, areaArgs := areaCondition(s.Areas)
+	if areaSQL == "" {
+		return db.Where("("+projectColumn+" IN (?) OR "+projectColumn+" IN (?))", members, assigned)
+	}
+	regional := tx.Model(&models.Project{}).Select("\"Projects\".\"Id\"").
+		Joins("LEFT JOIN \"Stores\" ON \"Stores\".\"Id\" = \"Projects\".\"StoreId\"").
+		Where(areaSQL, areaArgs...)
+	return db.Where("("+projectColumn+" IN (?) OR "+projectColumn+" IN (?) OR "+projectColumn+" IN (?))", members, assigned, regional)
+}
+
+// ApplyToRequests ограничивает заявки доступными пользователю: свои и замещаемых сотрудников
+// (создал или исполняет) и заявки по видимым проектам
+func (s ProjectScope) ApplyToRequests(db *gorm.DB) *gorm.DB {
+	if s.ViewAll {
+		return db
+	}
+	users := append([]uint{s.UserID}, s.ActingFor...)
+	visible := s.Apply(db.Session(&gorm.Session{NewDB: true}).Model(&models.Project{}).Select("\"Id\""), "\"Id\"")
+	return db.Where("(\"Requests\".\"CreatedByUserId\" IN ? OR \"Requests\".\"AssignedToUserId\" IN ? OR \"Requests\".\"ProjectId\" IN (?))",
+		users, users, visible)
+}
+
+// areaCondition строит условие на проекты, попадающие в одну из областей.
+// Регион берется из магазина, а если он не указан — из проекта
+func areaCondition(areas []models.AccessArea) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	for _, area := range areas {
+		var conds []string
+		if area.Region != "" {
+			conds = append(conds, "COALESCE(NULLIF(\"Stores\".\"Region\", ''), \"Projects\".\"Region\") = ?")
+			args = append(args, area.Region)
+		}
+		if area.CFO != "" {
+			conds = append(conds, "\"Projects\".\"CFO\" = ?")
+			args = append(args, area.CFO)
+		}
+		if len(conds) > 0 {
+			parts = append(parts, "("+strings.Join(conds, " AND ")+")")
+		}
+	}
+	return strings.Join(parts, " OR "), args
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"portal-razvitie/models"
+
+	"gorm.io/gorm"
+)
+
+type ProjectStatusRepository interface {
+	FindAll() ([]models.ProjectStatusDefinition, error)
+	FindByProjectType(projectType string) ([]models.ProjectStatusDefinition, error)
+	ReplaceForProjectType(projectType string, statuses []models.ProjectStatusDefinition) error
+}
+
+type projectStatusRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectStatusRepository(db *gorm.DB) ProjectStatusRepository {
+	return &projectStatusRepository{db: db}
+}
+
+func (r *projectStatusRepository) FindAll() ([]models.ProjectStatusDefinition, error) {
+	statuses := make([]models.ProjectStatusDefinition, 0)
+	err := r.db.Order("\"ProjectType\" ASC, \"Order\" ASC").Find(&statuses).Error
+	return statuses, err
+}
+
+func (r *projectStatusRepository) FindByProjectType(projectType string) ([]models.ProjectStatusDefinition, error) {
+	statuses := make([]models.ProjectStatusDefinition, 0)
+	err := r.db.Where("\"ProjectType\" = ?", projectType).
+		Order("\"Order\" ASC").Find(&statuses).Error
+	return statuses, err
+}
+
+// ReplaceForProjectType заменяет набор статусов типа проекта целиком
+func (r *projectStatusRepository) ReplaceForProjectType(projectType string, statuses []models.ProjectStatusDefinition) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("\"ProjectType\" = ?", projectType).
+			Delete(&models.ProjectStatusDefinition{}).Error; err != nil {
+			return err
+		}
+		if len(statuses) == 0 {
+			return nil
+		}
+		return tx.Create(&statuses).Error
+	})
+}
@@ -17,6 +17,14 @@ type ProjectTemplateRepository interface {
 	SetDefault(id uint) error
 	CreateTask(task *models.TemplateTask) error
 	DeleteTask(templateID uint, taskID uint) error
+	MarkDraftChanged(templateID uint) error
+
+	// Версии шаблона
+	CreateVersion(template *models.ProjectTemplate, version *models.ProjectTemplateVersion) error
+	FindVersions(templateID uint) ([]models.ProjectTemplateVersion, error)
+	FindVersion(templateID uint, version int) (*models.ProjectTemplateVersion, error)
+	FindVersionByID(id uint) (*models.ProjectTemplateVersion, error)
+	FindLatestVersion(templateID uint) (*models.ProjectTemplateVersion, error)
 }
 
 type projectTemplateRepository struct {
@@ -71,6 +79,7 @@ func (r *projectTemplateRepository) Update(template *models.ProjectTemplate) err
 }
 
 func (r *projectTemplateRepository) Delete(id uint) error {
+	// Опубликованные версии остаются: на них могут ссылаться проекты
 	// Сначала удаляем задачи
 	if err := r.db.Where("\"ProjectTemplateID\" = ?", id).Delete(&models.TemplateTask{}).Error; err != nil {
 		return err
@@ -102,3 +111,64 @@ func (r *projectTemplateRepository) DeleteTask(templateID uint, taskID uint) err
 	return r.db.Where("\"ProjectTemplateID\" = ? AND \"ID\" = ?", templateID, taskID).
 		Delete(&models.TemplateTask{}).Error
 }
+
+// MarkDraftChanged помечает, что черновик шаблона отличается от опубликованной версии
+func (r *projectTemplateRepository) MarkDraftChanged(templateID uint) error {
+	return r.db.Model(&models.ProjectTemplate{}).Where("\"ID\" = ?", templateID).
+		Update("HasDraftChanges", true).Error
+}
+
+// CreateVersion сохраняет снимок версии и обновляет счетчик версий шаблона
+func (r *projectTemplateRepository) CreateVersion(template *models.ProjectTemplate, version *models.ProjectTemplateVersion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ProjectTemplate{}).Where("\"ID\" = ?", template.ID).
+			Updates(map[string]interface{}{
+				"LatestVersion":   version.Version,
+				"HasDraftChanges": false,
+			}).Error
+	})
+}
+
+// FindVersions возвращает все версии шаблона (без задач), от новых к старым
+func (r *projectTemplateRepository) FindVersions(templateID uint) ([]models.ProjectTemplateVersion, error) {
+	versions := make([]models.ProjectTemplateVersion, 0)
+	err := r.db.Where("\"ProjectTemplateID\" = ?", templateID).
+		Order("\"Version\" DESC").Find(&versions).Error
+	return versions, err
+}
+
+func (r *projectTemplateRepository) FindVersion(templateID uint, version int) (*models.ProjectTemplateVersion, error) {
+	var v models.ProjectTemplateVersion
+	err := r.db.Preload("Tasks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"Order\" ASC, \"ID\" ASC")
+	}).Where("\"ProjectTemplateID\" = ? AND \"Version\" = ?", templateID, version).First(&v).Error
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *projectTemplateRepository) FindVersionByID(id uint) (*models.ProjectTemplateVersion, error) {
+	var v models.ProjectTemplateVersion
+	err := r.db.Preload("Tasks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"Order\" ASC, \"ID\" ASC")
+	}).First(&v, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *projectTemplateRepository) FindLatestVersion(templateID uint) (*models.ProjectTemplateVersion, error) {
+	var v models.ProjectTemplateVersion
+	err := r.db.Preload("Tasks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"Order\" ASC, \"ID\" ASC")
+	}).Where("\"ProjectTemplateID\" = ?", templateID).Order("\"Version\" DESC").First(&v).Error
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
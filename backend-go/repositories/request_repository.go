@@ -34,10 +34,15 @@ func (r *RequestRepository) FindByID(id uint) (*models.Request, error) {
 	return &request, nil
 }
 
-// FindAll возвращает все заявки с предзагрузкой
-func (r *RequestRepository) FindAll() ([]models.Request, error) {
+// scoped ограничивает заявки доступными пользователю (см. ProjectScope.ApplyToRequests)
+func (r *RequestRepository) scoped(scope ProjectScope) *gorm.DB {
+	return scope.ApplyToRequests(r.db)
+}
+
+// FindAll возвращает доступные заявки с предзагрузкой
+func (r *RequestRepository) FindAll(scope ProjectScope) ([]models.Request, error) {
 	var requests []models.Request
-	err := r.db.
+	err := r.scoped(scope).
 		Preload("CreatedByUser").
 		Preload("AssignedToUser").
 		Preload("Project").
@@ -48,9 +53,9 @@ func (r *RequestRepository) FindAll() ([]models.Request, error) {
 }
 
 // FindByCreatedByUser возвращает заявки, созданные пользователем
-func (r *RequestRepository) FindByCreatedByUser(userID uint) ([]models.Request, error) {
+func (r *RequestRepository) FindByCreatedByUser(scope ProjectScope, userID uint) ([]models.Request, error) {
 	var requests []models.Request
-	err := r.db.
+	err := r.scoped(scope).
 		Where("\"CreatedByUserId\" = ?", userID).
 		Preload("CreatedByUser").
 		Preload("AssignedToUser").
@@ -62,9 +67,9 @@ func (r *RequestRepository) FindByCreatedByUser(userID uint) ([]models.Request,
 }
 
 // FindByAssignedToUser возвращает заявки, назначенные пользователю
-func (r *RequestRepository) FindByAssignedToUser(userID uint) ([]models.Request, error) {
+func (r *RequestRepository) FindByAssignedToUser(scope ProjectScope, userID uint) ([]models.Request, error) {
 	var requests []models.Request
-	err := r.db.
+	err := r.scoped(scope).
 		Where("\"AssignedToUserId\" = ?", userID).
 		Preload("CreatedByUser").
 		Preload("AssignedToUser").
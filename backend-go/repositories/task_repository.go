@@ -7,14 +7,13 @@ import (
 )
 
 type TaskRepository interface {
-	FindAll() ([]models.ProjectTask, error)
+	FindAll(scope ProjectScope) ([]models.ProjectTask, error)
 	FindByProjectID(projectID uint) ([]models.ProjectTask, error)
 	FindByResponsibleUserID(userID uint) ([]models.ProjectTask, error)
 	FindByID(id uint) (*models.ProjectTask, error)
 	Create(task *models.ProjectTask) error
 	Update(task *models.ProjectTask) error
 	DeleteOld() (int64, error)
-	FindRecent(limit int) ([]models.ProjectTask, error)
 	Delete(id uint) error
 	GetMaxOrderByProject(projectID uint) (int, error)
 }
@@ -27,9 +26,9 @@ func NewTaskRepository(db *gorm.DB) TaskRepository {
 	return &taskRepository{db: db}
 }
 
-func (r *taskRepository) FindAll() ([]models.ProjectTask, error) {
+func (r *taskRepository) FindAll(scope ProjectScope) ([]models.ProjectTask, error) {
 	var tasks []models.ProjectTask
-	err := r.db.Order("\"CreatedAt\" DESC").Find(&tasks).Error
+	err := scope.Apply(r.db, "\"ProjectId\"").Order("\"CreatedAt\" DESC").Find(&tasks).Error
 	return tasks, err
 }
 
@@ -64,12 +63,6 @@ func (r *taskRepository) DeleteOld() (int64, error) {
 	return result.RowsAffected, result.Error
 }
 
-func (r *taskRepository) FindRecent(limit int) ([]models.ProjectTask, error) {
-	var tasks []models.ProjectTask
-	err := r.db.Order("id DESC").Limit(limit).Find(&tasks).Error
-	return tasks, err
-}
-
 func (r *taskRepository) Delete(id uint) error {
 	return r.db.Delete(&models.ProjectTask{}, id).Error
 }
@@ -18,10 +18,11 @@ func (r *UserActivityRepository) Create(activity *models.UserActivity) error {
 	return r.DB.Create(activity).Error
 }
 
-func (r *UserActivityRepository) GetRecent(limit int) ([]models.UserActivity, error) {
+// GetRecent возвращает последние действия по проектам из скоупа; действия без проекта видны только без ограничений
+func (r *UserActivityRepository) GetRecent(scope ProjectScope, limit int) ([]models.UserActivity, error) {
 	var activities []models.UserActivity
 
-	err := r.DB.Model(&models.UserActivity{}).
+	err := scope.Apply(r.DB.Model(&models.UserActivity{}), "\"ProjectId\"").
 		Preload("User").
 		Preload("Project").
 		Preload("Project.Store").
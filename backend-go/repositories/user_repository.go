@@ -7,9 +7,15 @@ import (
 )
 
 type UserRepository interface {
+	FindByID(id uint) (*models.User, error)
 	FindByRole(role string) ([]models.User, error)
 	FindByName(name string) (*models.User, error)
-	FindAll() ([]models.User, error)
+	FindByLogin(login string) (*models.User, error)
+	FindAll(includeInactive bool) ([]models.User, error)
+	Create(user *models.User) error
+	Update(user *models.User) error
+	FindRoles(userID uint) ([]models.UserRole, error)
+	ReplaceRoles(userID uint, roles []models.UserRole) error
 }
 
 type userRepository struct {
@@ -20,20 +26,70 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
+func (r *userRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	err := r.db.First(&user, id).Error
+	return &user, err
+}
+
+// FindByRole возвращает активных пользователей роли (используется для назначения задач)
 func (r *userRepository) FindByRole(role string) ([]models.User, error) {
 	var users []models.User
-	err := r.db.Where("\"Role\" = ?", role).Find(&users).Error
+	err := r.db.Where("\"Role\" = ? AND \"IsActive\" = ?", role, true).Order("\"ID\"").Find(&users).Error
 	return users, err
 }
 
+// FindByName ищет активного пользователя по имени
 func (r *userRepository) FindByName(name string) (*models.User, error) {
 	var user models.User
-	err := r.db.Where("\"Name\" = ?", name).First(&user).Error
+	err := r.db.Where("\"Name\" = ? AND \"IsActive\" = ?", name, true).First(&user).Error
+	return &user, err
+}
+
+func (r *userRepository) FindByLogin(login string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("\"Login\" = ?", login).First(&user).Error
 	return &user, err
 }
 
-func (r *userRepository) FindAll() ([]models.User, error) {
+func (r *userRepository) FindAll(includeInactive bool) ([]models.User, error) {
 	var users []models.User
-	err := r.db.Find(&users).Error
+	query := r.db.Order("\"Name\"")
+	if !includeInactive {
+		query = query.Where("\"IsActive\" = ?", true)
+	}
+	err := query.Find(&users).Error
 	return users, err
 }
+
+func (r *userRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *userRepository) Update(user *models.User) error {
+	return r.db.Save(user).Error
+}
+
+// FindRoles возвращает назначения ролей пользователя
+func (r *userRepository) FindRoles(userID uint) ([]models.UserRole, error) {
+	roles := make([]models.UserRole, 0)
+	err := r.db.Where("\"UserId\" = ?", userID).Order("\"Id\"").Find(&roles).Error
+	return roles, err
+}
+
+// ReplaceRoles заменяет назначения ролей пользователя
+func (r *userRepository) ReplaceRoles(userID uint, roles []models.UserRole) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("\"UserId\" = ?", userID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		for i := range roles {
+			roles[i].ID = 0
+			roles[i].UserID = userID
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+		return tx.Create(&roles).Error
+	})
+}
@@ -1,33 +1,36 @@
 package routes
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"portal-razvitie/antivirus"
+	"portal-razvitie/cache"
 	"portal-razvitie/config"
 	"portal-razvitie/controllers"
 	"portal-razvitie/events"
 	"portal-razvitie/listeners"
+	"portal-razvitie/logger"
 	"portal-razvitie/middleware"
 	"portal-razvitie/models"
+	"portal-razvitie/oidc"
+	"portal-razvitie/preview"
 	"portal-razvitie/repositories"
 	"portal-razvitie/services"
+	"portal-razvitie/storage"
 	"portal-razvitie/websocket"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *websocket.Hub) {
+func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *websocket.Hub, files storage.Storage) {
 	// Глобальные middleware
 	router.Use(middleware.RecoveryMiddleware())
 	router.Use(middleware.ErrorHandler())
 
-	// WS endpoint
-	router.GET("/ws", func(c *gin.Context) {
-		userIdStr := c.Query("userId")
-		uid, _ := strconv.Atoi(userIdStr)
-		hub.ServeWs(c, uint(uid))
-	})
-
 	// Initialize Repositories
 	projectRepo := repositories.NewProjectRepository(db)
 	taskRepo := repositories.NewTaskRepository(db)
@@ -38,6 +41,10 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *webso
 	commentRepo := repositories.NewCommentRepository(db)
 	taskTemplateRepo := repositories.NewTaskTemplateRepository(db)
 	projectTemplateRepo := repositories.NewProjectTemplateRepository(db)
+	projectStatusRepo := repositories.NewProjectStatusRepository(db)
+	absenceRepo := repositories.NewAbsenceRepository(db)
+	apiTokenRepo := repositories.NewAPITokenRepository(db)
+	projectMemberRepo := repositories.NewProjectMemberRepository(db)
 
 	// Services
 	notifService := services.NewNotificationService(notifRepo, hub)
@@ -57,33 +64,128 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *webso
 	webSocketListener.Register(eventBus)
 
 	// Project Status Service для автоматического управления статусами
-	projectStatusService := services.NewProjectStatusService(projectRepo, taskRepo, activityRepo)
+	projectStatusService := services.NewProjectStatusService(projectRepo, taskRepo, activityRepo, projectStatusRepo)
+
+	// Отсутствия: новые назначения уходят заместителям, уведомления дублируются им же
+	absenceService := services.NewAbsenceService(absenceRepo, userRepo)
+	notifService.SetAbsenceService(absenceService)
+
+	// Исполнителей задач по роли выбирают стратегии назначения (AssignmentRules)
+	assignmentService := services.NewAssignmentService(db)
 
 	workflowService := services.NewWorkflowService(userRepo, projectRepo, notifService, db)
-	taskService := services.NewTaskService(taskRepo, projectRepo, userRepo, workflowService, eventBus, projectStatusService)
+	workflowService.SetAbsenceService(absenceService)
+	workflowService.SetAssignmentService(assignmentService)
+	taskService := services.NewTaskService(taskRepo, projectRepo, userRepo, workflowService, eventBus, projectStatusService, absenceService, assignmentService)
 	projectService := services.NewProjectService(projectRepo, workflowService, db, eventBus)
 	storeService := services.NewStoreService(storeRepo)
-	authService := services.NewAuthService(db)
-	rbacService := services.NewRBACService(db)
 
-	docService := services.NewDocumentService(db)
+	// Права ролей кэшируются в каждой реплике; изменения рассылаются через LISTEN/NOTIFY
+	permCache := cache.GetCache()
+	permBroadcaster := newPermissionsBroadcaster(cfg, db, permCache)
+	rbacService := services.NewRBACService(db, permCache, permBroadcaster)
+	authService := services.NewAuthService(db, rbacService)
+	// Вход (локальный и SSO) выдает подписанный токен сеанса
+	authService.SetSessionService(services.NewSessionService(sharedSecret(cfg.SessionSecret, "SESSION_SECRET", "sessions will fail across replicas and restarts"), cfg.SessionTTL))
+	userService := services.NewUserService(db, userRepo)
+	workloadService := services.NewWorkloadService(db)
+	searchService := services.NewSearchService(db)
+	if err := searchService.CreateIndexes(); err != nil {
+		logger.Warn().Err(err).Msg("Failed to create search indexes: search works without them, but slower")
+	}
+	apiTokenService := services.NewAPITokenService(apiTokenRepo)
+
+	// WS endpoint: браузер не передает заголовки в WebSocket, поэтому токен сеанса приходит в ?token=;
+	// ?userId= принимается только там же, где X-User-ID
+	router.GET("/ws", func(c *gin.Context) {
+		if token := c.Query("token"); token != "" {
+			user, _, err := authService.GetUserBySession(token)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+				return
+			}
+			hub.ServeWs(c, user.ID)
+			return
+		}
+		if !cfg.UserHeaderAuthEnabled() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: pass the session token in ?token="})
+			return
+		}
+		userIdStr := c.Query("userId")
+		uid, _ := strconv.Atoi(userIdStr)
+		hub.ServeWs(c, uint(uid))
+	})
+
+	docService := services.NewDocumentService(db, files)
+	docTypeService := services.NewDocumentTypeService(db)
+	// Загрузки проверяются по справочнику типов, сигнатуре содержимого и антивирусом clamd
+	var scanner antivirus.Scanner
+	if cfg.ClamdAddress != "" {
+		scanner = antivirus.NewClamd(cfg.ClamdAddress, cfg.ClamdTimeout)
+	}
+	uploadPolicy := services.NewUploadPolicy(docTypeService, cfg.UploadMaxSize, scanner)
+	uploadPolicy.SetScanLimit(cfg.ClamdMaxSize)
+	// Большие файлы загружаются частями; брошенные сеансы удаляются в фоне
+	uploadSessionService := services.NewUploadSessionService(db, docService, docTypeService, uploadPolicy, cfg.UploadSessionDir)
+	uploadSessionService.StartCleanup(time.Hour)
+	// Предпросмотры версий строятся в фоне; миниатюры PDF — утилитой pdftoppm, если она установлена
+	var pdfRenderer preview.PDFRenderer
+	if renderer := preview.NewPdftoppm(cfg.PreviewPDFRenderer, 30*time.Second); renderer != nil {
+		pdfRenderer = renderer
+	} else {
+		logger.Warn().Str("path", cfg.PreviewPDFRenderer).Msg("pdftoppm not found: PDF thumbnails are disabled")
+	}
+	documentPreviewService := services.NewDocumentPreviewService(db, docService, pdfRenderer)
+	if extractor := preview.NewPdftotext(cfg.PreviewPDFText, 30*time.Second); extractor != nil {
+		documentPreviewService.SetPDFTextExtractor(extractor)
+	} else {
+		logger.Warn().Str("path", cfg.PreviewPDFText).Msg("pdftotext not found: PDF text is not searchable")
+	}
+	docService.SetPreviewService(documentPreviewService)
+	documentPreviewService.Start(time.Minute)
+	// Суммы из расчетов Excel переносятся в поля задач по правилам типов документов
+	documentExtractionService := services.NewDocumentExtractionService(db, docService)
+	docService.SetExtractionService(documentExtractionService)
+	// Ссылки на скачивание без входа подписываются ключом, общим для всех реплик
+	if cfg.PublicURL == "" {
+		logger.Warn().Msg("PUBLIC_URL is not set: document links are returned as relative paths")
+	}
+	documentLinkService := services.NewDocumentLinkService(db, docService, sharedSecret(cfg.DocumentLinkSecret, "DOCUMENT_LINK_SECRET", "document links will fail across replicas and restarts"))
+	projectTeamService := services.NewProjectTeamService(db, projectMemberRepo, userRepo)
 	taskTemplateService := services.NewTaskTemplateService(taskTemplateRepo)
-	projectTemplateService := services.NewProjectTemplateService(projectTemplateRepo)
-	requestService := services.NewRequestService(db, notifService, eventBus)
+	projectTemplateService := services.NewProjectTemplateService(projectTemplateRepo, projectStatusService)
+	templateMigrationService := services.NewTemplateMigrationService(db, projectTemplateRepo, projectRepo, workflowService, eventBus)
+	templateMigrationService.SetAssignmentService(assignmentService)
+	templateMigrationService.SetAbsenceService(absenceService)
+	templateExchangeService := services.NewTemplateExchangeService(db, projectTemplateRepo, taskTemplateRepo)
+	templateSimulationService := services.NewTemplateSimulationService(projectTemplateRepo, workflowService, projectStatusService)
+	requestService := services.NewRequestService(db, notifService, eventBus, absenceService)
 
 	// Initialize controllers
 	storesController := controllers.NewStoresController(storeService)
-	tasksController := controllers.NewTasksController(taskService, activityService)
-	projectsController := controllers.NewProjectsController(projectService)
-	documentsController := controllers.NewDocumentsController(cfg, docService)
+	tasksController := controllers.NewTasksController(taskService, activityService, projectTeamService)
+	projectsController := controllers.NewProjectsController(projectService, projectStatusService, storeService)
+	documentsController := controllers.NewDocumentsController(docService, projectTeamService, docTypeService, uploadPolicy, uploadSessionService)
+	docTypeController := controllers.NewDocumentTypeController(docTypeService)
+	documentLinkController := controllers.NewDocumentLinkController(documentLinkService, docService, cfg.PublicURL)
+	documentPreviewController := controllers.NewDocumentPreviewController(documentPreviewService, docService)
+	documentExtractionController := controllers.NewDocumentExtractionController(documentExtractionService, docService)
 	notifController := controllers.NewNotificationController(notifService)
 	rbacController := controllers.NewRBACController(rbacService)
 	authController := controllers.NewAuthController(authService)
 	dashboardController := controllers.NewDashboardController(activityService, taskService, projectService)
-	commentsController := controllers.NewCommentsController(commentService)
+	workloadController := controllers.NewWorkloadController(workloadService)
+	searchController := controllers.NewSearchController(searchService)
+	commentsController := controllers.NewCommentsController(commentService, projectTeamService)
 	taskTemplateController := controllers.NewTaskTemplateController(taskTemplateService)
-	projectTemplateController := controllers.NewProjectTemplateController(projectTemplateService, db)
-	requestController := controllers.NewRequestController(requestService)
+	projectTemplateController := controllers.NewProjectTemplateController(projectTemplateService, templateMigrationService, templateExchangeService, templateSimulationService, db)
+	projectStatusController := controllers.NewProjectStatusController(projectStatusService)
+	projectTeamController := controllers.NewProjectTeamController(projectTeamService)
+	usersController := controllers.NewUsersController(userService)
+	absenceController := controllers.NewAbsenceController(absenceService)
+	apiTokenController := controllers.NewAPITokenController(apiTokenService)
+	assignmentController := controllers.NewAssignmentController(assignmentService)
+	requestController := controllers.NewRequestController(requestService, projectTeamService)
 
 	// API group
 	api := router.Group("/api")
@@ -91,69 +193,156 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *webso
 		// Auth routes (Public)
 		auth := api.Group("/auth")
 		{
-			auth.POST("/login", authController.Login)
-			auth.GET("/users", authController.GetUsers) // For demo switcher
+			// Вход по логину без пароля и публичный список пользователей нужны только
+			// переключателю пользователей в разработке; в остальных средах вход только через SSO
+			if cfg.Environment == "development" && !cfg.OIDCEnabled() {
+				auth.POST("/login", authController.Login)
+				auth.GET("/users", authController.GetUsers)
+			}
+			if ssoService := newSSOService(cfg, db, authService); ssoService != nil {
+				ssoController := controllers.NewSSOController(ssoService, authService)
+				auth.GET("/oidc/authorize", ssoController.Authorize)
+				auth.POST("/oidc/callback", ssoController.Callback)
+			}
+		}
+
+		// Скачивание по подписанной ссылке: доступ определяет сама ссылка
+		public := api.Group("/public")
+		{
+			public.GET("/document-links/:token", middleware.ExtendDeadlines(30*time.Minute), documentLinkController.Download)
 		}
 
 		// Apply global authentication middleware for all subsequent routes
-		api.Use(middleware.AuthMiddleware(authService))
+		api.Use(middleware.AuthMiddleware(authService, cfg.UserHeaderAuthEnabled()))
 
 		// Stores routes
 		stores := api.Group("/stores")
 		{
 			stores.GET("", storesController.GetStores)
 			stores.GET("/:id", storesController.GetStore)
-			stores.POST("", storesController.CreateStore)
-			stores.PUT("/:id", storesController.UpdateStore)
-			stores.DELETE("/:id", storesController.DeleteStore)
+			storeManage := middleware.RequirePermission(models.PermStoreManage)
+			stores.POST("", storeManage, storesController.CreateStore)
+			stores.PUT("/:id", storeManage, storesController.UpdateStore)
+			stores.DELETE("/:id", storeManage, storesController.DeleteStore)
 		}
 
+		// Доступ к сущностям проекта только для его команды (или при project:view_all)
+		projectAccess := middleware.RequireProjectAccess(projectTeamService, models.EntityProject, "id")
+		taskAccess := middleware.RequireProjectAccess(projectTeamService, models.EntityTask, "id")
+		documentAccess := middleware.RequireProjectAccess(projectTeamService, models.EntityDocument, "id")
+		taskEdit := middleware.RequireTaskEditPermission(projectTeamService, models.EntityTask, "id")
+		documentEdit := middleware.RequireTaskEditPermission(projectTeamService, models.EntityDocument, "id")
+		// Права на изменение проекта проверяются в его регионе/ЦФО
+		projectEdit := middleware.RequireProjectPermission(projectTeamService, models.PermProjectEdit, models.EntityProject, "id")
+		projectDelete := middleware.RequireProjectPermission(projectTeamService, models.PermProjectDelete, models.EntityProject, "id")
+
 		// Projects routes
 		projects := api.Group("/projects")
 		{
 			projects.GET("", projectsController.GetProjects)
-			projects.GET("/:id", projectsController.GetProject)
+			projects.GET("/:id", projectAccess, projectsController.GetProject)
 			projects.POST("", middleware.RequirePermission(models.PermProjectCreate), projectsController.CreateProject)
-			projects.PUT("/:id", middleware.RequirePermission(models.PermProjectEdit), projectsController.UpdateProject)
-			projects.PATCH("/:id/status", middleware.RequirePermission(models.PermProjectEdit), projectsController.UpdateProjectStatus)
-			projects.DELETE("/:id", middleware.RequirePermission(models.PermProjectDelete), projectsController.DeleteProject)
+			projects.PUT("/:id", projectAccess, projectEdit, projectsController.UpdateProject)
+			projects.PATCH("/:id/status", projectAccess, projectEdit, projectsController.UpdateProjectStatus)
+			projects.GET("/:id/status/transitions", projectAccess, projectsController.GetStatusTransitions)
+			projects.DELETE("/:id/status/pin", projectAccess, projectEdit, projectsController.UnpinProjectStatus)
+			projects.POST("/:id/migrate-template", projectAccess, projectEdit, projectTemplateController.MigrateProject)
+			projects.DELETE("/:id", projectAccess, projectDelete, projectsController.DeleteProject)
+			projects.GET("/:id/members", projectAccess, projectTeamController.GetMembers)
+			projects.POST("/:id/members", projectAccess, projectEdit, projectTeamController.AddMember)
+			projects.DELETE("/:id/members/:memberId", projectAccess, projectEdit, projectTeamController.RemoveMember)
+			projects.GET("/:id/missing-documents", projectAccess, docTypeController.GetProjectMissing)
 		}
 
 		// Tasks routes
 		tasks := api.Group("/tasks")
 		{
 			tasks.GET("", tasksController.GetAllTasks)
-			tasks.GET("/project/:projectId", tasksController.GetProjectTasks)
-			tasks.GET("/debug-assignments", tasksController.DebugAssignments)
+			tasks.GET("/project/:projectId", middleware.RequireProjectAccess(projectTeamService, models.EntityProject, "projectId"), tasksController.GetProjectTasks)
 			tasks.POST("", middleware.RequirePermission(models.PermTaskCreate), tasksController.CreateTask)
-			tasks.PUT("/:id", middleware.RequireTaskEditPermission(), tasksController.UpdateTask)
-			tasks.PATCH("/:id/status", middleware.RequireTaskEditPermission(), tasksController.UpdateTaskStatus)
-			tasks.DELETE("/:id", middleware.RequireTaskEditPermission(), tasksController.DeleteTask)
-			tasks.GET("/:id/history", tasksController.GetHistory)
-			tasks.DELETE("/cleanup-old", tasksController.CleanupOldTasks)
+			tasks.PUT("/:id", taskAccess, taskEdit, tasksController.UpdateTask)
+			tasks.PATCH("/:id/status", taskAccess, taskEdit, tasksController.UpdateTaskStatus)
+			tasks.DELETE("/:id", taskAccess, taskEdit, tasksController.DeleteTask)
+			tasks.GET("/:id/history", taskAccess, tasksController.GetHistory)
+			tasks.GET("/:id/extractions", taskAccess, documentExtractionController.GetForTask)
+			tasks.POST("/:id/extractions/:extractionId/apply", taskAccess, taskEdit, documentExtractionController.Apply)
+			tasks.DELETE("/cleanup-old", middleware.RequirePermission(models.PermRoleManage), tasksController.CleanupOldTasks)
 		}
 
 		// Documents routes
 		documents := api.Group("/documents")
 		{
-			documents.POST("/upload", documentsController.Upload)
-			documents.GET("/:id", documentsController.GetById)
-			documents.GET("/project/:projectId", documentsController.GetByProject)
-			documents.GET("/task/:taskId", documentsController.GetByTask)
-			documents.GET("/download/:id", documentsController.Download)
-			documents.DELETE("/:id", documentsController.Delete)
+			// Лимит тела с запасом на поля формы; точный лимит файла проверяет политика загрузки.
+			// Передача файлов дольше общих таймаутов сервера
+			uploadLimit := middleware.LimitRequestBody(uploadPolicy.MaxSize() + 1<<20)
+			longTransfer := middleware.ExtendDeadlines(30 * time.Minute)
+			// Загрузка доступна только с правом редактирования задач; точное правило проверяет обработчик
+			uploadEdit := middleware.RequireAnyPermission(models.PermTaskEdit, models.PermTaskEditOwn)
+			documents.POST("/upload", longTransfer, uploadLimit, uploadEdit, documentsController.Upload)
+			documents.GET("/:id", documentAccess, documentsController.GetById)
+			documents.GET("/project/:projectId", middleware.RequireProjectAccess(projectTeamService, models.EntityProject, "projectId"), documentsController.GetByProject)
+			documents.GET("/task/:taskId", middleware.RequireProjectAccess(projectTeamService, models.EntityTask, "taskId"), documentsController.GetByTask)
+			documents.GET("/project/:projectId/archive", middleware.RequireProjectAccess(projectTeamService, models.EntityProject, "projectId"), longTransfer, documentsController.GetProjectArchive)
+			documents.GET("/task/:taskId/archive", middleware.RequireProjectAccess(projectTeamService, models.EntityTask, "taskId"), longTransfer, documentsController.GetTaskArchive)
+			documents.GET("/download/:id", documentAccess, longTransfer, documentsController.Download)
+			documents.DELETE("/:id", documentAccess, documentEdit, documentsController.Delete)
+
+			// Версии документа
+			documents.GET("/:id/versions", documentAccess, documentsController.GetVersions)
+			documents.POST("/:id/versions", longTransfer, uploadLimit, documentAccess, documentEdit, documentsController.UploadVersion)
+			documents.GET("/:id/versions/:number/download", documentAccess, longTransfer, documentsController.DownloadVersion)
+			documents.POST("/:id/versions/:number/restore", documentAccess, documentEdit, documentsController.RestoreVersion)
+
+			// Предпросмотр: миниатюра, листы книги или текст документа
+			documents.GET("/:id/preview", documentAccess, documentPreviewController.GetPreview)
+			documents.GET("/:id/preview/image", documentAccess, documentPreviewController.GetPreviewImage)
+
+			// Повторное извлечение сумм из текущей версии по правилам типа
+			documents.POST("/:id/extract", documentAccess, documentEdit, documentExtractionController.Extract)
+
+			// Подписанные ссылки на скачивание для внешних получателей
+			documents.GET("/:id/links", documentAccess, documentLinkController.GetLinks)
+			documents.POST("/:id/links", documentAccess, documentEdit, documentLinkController.CreateLink)
+			documents.DELETE("/:id/links/:linkId", documentAccess, documentEdit, documentLinkController.RevokeLink)
+
+			// Докачиваемая загрузка: сеанс, части по смещению (PATCH), завершение
+			documents.POST("/uploads", uploadEdit, documentsController.CreateUploadSession)
+			documents.GET("/uploads/:uploadId", documentsController.GetUploadSession)
+			documents.PATCH("/uploads/:uploadId", longTransfer, middleware.LimitRequestBody(4*services.DefaultUploadChunkSize), uploadEdit, documentsController.UploadChunk)
+			documents.POST("/uploads/:uploadId/complete", longTransfer, uploadEdit, documentsController.CompleteUploadSession)
+			documents.DELETE("/uploads/:uploadId", uploadEdit, documentsController.AbortUploadSession)
+		}
+
+		// Document types routes: справочник читают все, изменяет администратор
+		documentTypes := api.Group("/document-types")
+		{
+			documentTypes.GET("", docTypeController.GetTypes)
+			documentTypes.POST("", middleware.RequirePermission(models.PermDocumentTypeManage), docTypeController.CreateType)
+			documentTypes.PUT("/:code", middleware.RequirePermission(models.PermDocumentTypeManage), docTypeController.UpdateType)
+			documentTypes.DELETE("/:code", middleware.RequirePermission(models.PermDocumentTypeManage), docTypeController.DeleteType)
+			documentTypes.GET("/:code/extraction-rules", documentExtractionController.GetRules)
+			documentTypes.POST("/:code/extraction-rules", middleware.RequirePermission(models.PermDocumentTypeManage), documentExtractionController.CreateRule)
+			documentTypes.PUT("/:code/extraction-rules/:ruleId", middleware.RequirePermission(models.PermDocumentTypeManage), documentExtractionController.UpdateRule)
+			documentTypes.DELETE("/:code/extraction-rules/:ruleId", middleware.RequirePermission(models.PermDocumentTypeManage), documentExtractionController.DeleteRule)
 		}
 
 		// Notification routes
 		notifications := api.Group("/notifications")
 		{
+			notificationManage := middleware.RequirePermission(models.PermNotificationManage)
 			notifications.GET("", notifController.GetNotifications)
-			notifications.POST("/:id/read", notifController.MarkRead)
-			notifications.POST("/read-all", notifController.MarkAllRead)
-			notifications.DELETE("/:id", notifController.Delete)
-			notifications.DELETE("/delete-all", notifController.DeleteAll)
+			notifications.POST("/:id/read", notificationManage, notifController.MarkRead)
+			notifications.POST("/read-all", notificationManage, notifController.MarkAllRead)
+			notifications.DELETE("/:id", notificationManage, notifController.Delete)
+			notifications.DELETE("/delete-all", notificationManage, notifController.DeleteAll)
 		}
 
+		// Workload report: загрузка сотрудников по задачам и заявкам
+		api.GET("/workload", middleware.RequirePermission(models.PermWorkloadView), workloadController.GetWorkload)
+
+		// Глобальный поиск по видимым пользователю сущностям
+		api.GET("/search", searchController.Search)
+
 		// Dashboard routes
 		dashboard := api.Group("/dashboard")
 		{
@@ -163,8 +352,8 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *webso
 		// Comments routes
 		comments := api.Group("/comments")
 		{
-			comments.GET("/task/:taskId", commentsController.GetTaskComments)
-			comments.POST("", commentsController.CreateComment)
+			comments.GET("/task/:taskId", middleware.RequireProjectAccess(projectTeamService, models.EntityTask, "taskId"), commentsController.GetTaskComments)
+			comments.POST("", middleware.RequirePermission(models.PermCommentCreate), commentsController.CreateComment)
 		}
 
 		// RBAC routes (Admin only)
@@ -177,6 +366,51 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *webso
 			rbac.GET("/permissions", rbacController.GetPermissions)
 		}
 
+		// Users routes
+		users := api.Group("/users")
+		{
+			users.GET("", middleware.RequirePermission(models.PermUserView), usersController.GetUsers)
+			users.GET("/:id", middleware.RequirePermission(models.PermUserView), usersController.GetUser)
+
+			manageUsers := users.Group("")
+			manageUsers.Use(middleware.RequirePermission(models.PermUserManage))
+			{
+				manageUsers.POST("", usersController.CreateUser)
+				manageUsers.PUT("/:id", usersController.UpdateUser)
+				manageUsers.POST("/:id/deactivate", usersController.DeactivateUser)
+				manageUsers.POST("/:id/activate", usersController.ActivateUser)
+				manageUsers.GET("/:id/absences", absenceController.GetUserAbsences)
+				manageUsers.POST("/:id/absences", absenceController.CreateUserAbsence)
+				manageUsers.DELETE("/:id/absences/:absenceId", absenceController.DeleteUserAbsence)
+			}
+		}
+
+		// Assignment rules routes: стратегии назначения задач по ролям
+		assignmentRules := api.Group("/assignment-rules")
+		{
+			assignmentRules.Use(middleware.RequirePermission(models.PermUserManage))
+			assignmentRules.GET("", assignmentController.GetRules)
+			assignmentRules.PUT("/:role", assignmentController.SetRule)
+			assignmentRules.DELETE("/:role", assignmentController.DeleteRule)
+		}
+
+		// Absences routes: отсутствия текущего пользователя
+		absences := api.Group("/absences")
+		{
+			absences.GET("", absenceController.GetMyAbsences)
+			absences.POST("", middleware.RequirePermission(models.PermAbsenceManage), absenceController.CreateMyAbsence)
+			absences.DELETE("/:absenceId", middleware.RequirePermission(models.PermAbsenceManage), absenceController.DeleteMyAbsence)
+		}
+
+		// Personal API tokens: управлять токенами можно только из сеанса пользователя
+		meTokens := api.Group("/me/tokens")
+		{
+			meTokens.Use(middleware.RequireSession())
+			meTokens.GET("", apiTokenController.GetMyTokens)
+			meTokens.POST("", apiTokenController.CreateMyToken)
+			meTokens.DELETE("/:tokenId", apiTokenController.RevokeMyToken)
+		}
+
 		// Task Templates routes
 		taskTemplates := api.Group("/task-templates")
 		{
@@ -207,16 +441,23 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *webso
 			projectTemplates.GET("/known-tasks", projectTemplateController.GetKnownTasks)
 			projectTemplates.GET("/default", projectTemplateController.GetDefault)
 			projectTemplates.GET("/:id", projectTemplateController.GetByID)
+			projectTemplates.GET("/:id/versions", projectTemplateController.GetVersions)
+			projectTemplates.GET("/:id/versions/:version", projectTemplateController.GetVersion)
 
 			// Write routes - restricted to admin
 			manage := projectTemplates.Group("")
 			manage.Use(middleware.RequirePermission(models.PermRoleManage))
 			{
 				manage.POST("", projectTemplateController.Create)
+				manage.POST("/import", projectTemplateController.Import)
+				manage.POST("/simulate", projectTemplateController.Simulate)
+				manage.POST("/:id/simulate", projectTemplateController.Simulate)
+				manage.GET("/:id/export", projectTemplateController.Export)
 				manage.PUT("/:id", projectTemplateController.Update)
 				manage.DELETE("/:id", projectTemplateController.Delete)
 				manage.POST("/:id/set-default", projectTemplateController.SetDefault)
 				manage.POST("/:id/clone", projectTemplateController.Clone)
+				manage.POST("/:id/publish", projectTemplateController.Publish)
 				manage.PUT("/:id/tasks/:taskId", projectTemplateController.UpdateTask)
 				manage.POST("/:id/tasks", projectTemplateController.AddTask)
 				manage.POST("/:id/tasks/custom", projectTemplateController.AddCustomTask)
@@ -224,19 +465,78 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, hub *webso
 			}
 		}
 
+		// Project status sets routes
+		projectStatuses := api.Group("/project-statuses")
+		{
+			projectStatuses.GET("", projectStatusController.GetStatusSets)
+			projectStatuses.PUT("/:projectType", middleware.RequirePermission(models.PermRoleManage), projectStatusController.ReplaceStatusSet)
+		}
+
 		// Requests routes
 		requests := api.Group("/requests")
 		{
+			requestManage := middleware.RequirePermission(models.PermRequestManage)
 			requests.GET("", requestController.GetAllRequests)
 			requests.GET("/:id", requestController.GetRequest)
-			requests.POST("", requestController.CreateRequest)
-			requests.PUT("/:id", requestController.UpdateRequest)
-			requests.DELETE("/:id", requestController.DeleteRequest)
-			requests.PUT("/:id/take", requestController.TakeInWork)
-			requests.PUT("/:id/answer", requestController.AnswerRequest)
-			requests.PUT("/:id/close", requestController.CloseRequest)
-			requests.PUT("/:id/reject", requestController.RejectRequest)
+			requests.POST("", requestManage, requestController.CreateRequest)
+			requests.PUT("/:id", requestManage, requestController.UpdateRequest)
+			requests.DELETE("/:id", requestManage, requestController.DeleteRequest)
+			requests.PUT("/:id/take", requestManage, requestController.TakeInWork)
+			requests.PUT("/:id/answer", requestManage, requestController.AnswerRequest)
+			requests.PUT("/:id/close", requestManage, requestController.CloseRequest)
+			requests.PUT("/:id/reject", requestManage, requestController.RejectRequest)
 			requests.GET("/stats/:userId", requestController.GetUserRequestsStats)
 		}
 	}
 }
+
+// newPermissionsBroadcaster включает рассылку инвалидации прав, если база — Postgres и LISTEN
+// не выключен в настройках; иначе реплики узнают об изменениях по истечении TTL кэша
+func newPermissionsBroadcaster(cfg *config.Config, db *gorm.DB, permCache *cache.PermissionCache) cache.InvalidationBroadcaster {
+	if db.Dialector.Name() != "postgres" || !cfg.PermissionsListen {
+		logger.Info().Msg("Permissions invalidation broadcast disabled, role changes reach other replicas after cache TTL")
+		return cache.NoopBroadcaster{}
+	}
+	broadcaster := cache.NewPgBroadcaster(db, cfg.GetDSN())
+	if err := broadcaster.Listen(permCache); err != nil {
+		logger.Warn().Err(err).Msg("Failed to subscribe to permissions invalidation")
+	}
+	return broadcaster
+}
+
+// newSSOService настраивает вход через OpenID Connect; nil, если провайдер не задан
+func newSSOService(cfg *config.Config, db *gorm.DB, authService *services.AuthService) *services.SSOService {
+	if !cfg.OIDCEnabled() {
+		return nil
+	}
+	secret := sharedSecret(cfg.OIDCStateSecret, "OIDC_STATE_SECRET", "SSO logins will fail across replicas and restarts")
+	sealer, err := oidc.NewStateSealer(secret)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to initialize OIDC state sealer, SSO disabled")
+		return nil
+	}
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       cfg.OIDCIssuer,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  cfg.OIDCRedirectURL,
+	}, nil)
+	return services.NewSSOService(db, authService, provider, sealer, services.SSOConfig{
+		GroupsClaim: cfg.OIDCGroupsClaim,
+		GroupRoles:  cfg.OIDCGroupRoles,
+	})
+}
+
+// sharedSecret возвращает ключ из настроек, а если он не задан — случайный ключ этого процесса
+// с предупреждением: consequence описывает, что перестанет работать между репликами
+func sharedSecret(secret, envName, consequence string) string {
+	if secret != "" {
+		return secret
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic("failed to generate " + envName + ": " + err.Error())
+	}
+	logger.Warn().Msgf("%s is not set: using a random key, %s", envName, consequence)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ошибки регистрации отсутствия
+var (
+	ErrAbsenceInvalidPeriod = errors.New("дата окончания отсутствия раньше даты начала")
+	ErrAbsenceOverlap       = errors.New("период пересекается с другим отсутствием")
+	ErrAbsenceDelegate      = errors.New("заместителем может быть только другой активный пользователь")
+)
+
+// maxDelegationHops ограничивает цепочку заместителей (заместитель тоже может отсутствовать)
+const maxDelegationHops = 5
+
+// AbsenceService ведет периоды отсутствия и маршрутизирует назначения заместителям
+type AbsenceService struct {
+	repo     repositories.AbsenceRepository
+	userRepo repositories.UserRepository
+	now      func() time.Time
+}
+
+func NewAbsenceService(repo repositories.AbsenceRepository, userRepo repositories.UserRepository) *AbsenceService {
+	return &AbsenceService{repo: repo, userRepo: userRepo, now: time.Now}
+}
+
+// GetAbsences возвращает отсутствия пользователя
+func (s *AbsenceService) GetAbsences(userID uint) ([]models.UserAbsence, error) {
+	return s.repo.FindByUser(userID)
+}
+
+// CreateAbsence регистрирует отсутствие пользователя.
+// Период задается по дням: начало — с начала дня, окончание — до конца дня
+func (s *AbsenceService) CreateAbsence(userID uint, absence *models.UserAbsence) error {
+	absence.ID = 0
+	absence.UserID = userID
+	absence.StartDate = startOfDay(absence.StartDate)
+	absence.EndDate = startOfDay(absence.EndDate).Add(24*time.Hour - time.Nanosecond)
+	if absence.EndDate.Before(absence.StartDate) {
+		return ErrAbsenceInvalidPeriod
+	}
+
+	delegate, err := s.userRepo.FindByID(absence.DelegateID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && (!delegate.IsActive || delegate.ID == userID)) {
+		return ErrAbsenceDelegate
+	}
+	if err != nil {
+		return err
+	}
+
+	overlap, err := s.repo.HasOverlap(userID, absence.StartDate, absence.EndDate)
+	if err != nil {
+		return err
+	}
+	if overlap {
+		return ErrAbsenceOverlap
+	}
+
+	if err := s.repo.Create(absence); err != nil {
+		return err
+	}
+	absence.Delegate = delegate
+	return nil
+}
+
+// DeleteAbsence удаляет отсутствие пользователя
+func (s *AbsenceService) DeleteAbsence(userID uint, id uint) error {
+	absence, err := s.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if absence.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+	return s.repo.Delete(id)
+}
+
+// ActiveAbsence возвращает текущее отсутствие пользователя или nil
+func (s *AbsenceService) ActiveAbsence(userID uint) (*models.UserAbsence, error) {
+	return s.repo.FindActive(userID, s.now())
+}
+
+// ResolveAssignee возвращает того, кому назначать работу пользователя сейчас.
+// Если пользователь отсутствует, работа уходит заместителю (по цепочке), delegatedFrom — исходный пользователь.
+// Деактивированный заместитель работу не получает: цепочка останавливается на последнем активном пользователе
+func (s *AbsenceService) ResolveAssignee(userID uint) (assignee uint, delegatedFrom *uint) {
+	if s == nil || userID == 0 {
+		return userID, nil
+	}
+
+	now := s.now()
+	assignee = userID
+	visited := map[uint]bool{userID: true}
+	for i := 0; i < maxDelegationHops; i++ {
+		absence, err := s.repo.FindActive(assignee, now)
+		if err != nil {
+			log.Printf("⚠️ Failed to check absence of user %d: %v", assignee, err)
+			break
+		}
+		if absence == nil || visited[absence.DelegateID] {
+			break
+		}
+		if absence.Delegate == nil || !absence.Delegate.IsActive {
+			break
+		}
+		assignee = absence.DelegateID
+		visited[assignee] = true
+	}
+
+	if assignee == userID {
+		return userID, nil
+	}
+	from := userID
+	return assignee, &from
+}
+
+// ActingFor возвращает пользователей, которых пользователь замещает сейчас
+func (s *AbsenceService) ActingFor(delegateID uint) ([]uint, error) {
+	return s.repo.FindActingFor(delegateID, s.now())
+}
+
+// CanActFor проверяет, может ли пользователь действовать за владельца: это он сам или его заместитель
+func (s *AbsenceService) CanActFor(userID uint, ownerID uint) bool {
+	if userID == ownerID {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	ids, err := s.ActingFor(userID)
+	if err != nil {
+		log.Printf("⚠️ Failed to load delegations of user %d: %v", userID, err)
+		return false
+	}
+	for _, id := range ids {
+		if id == ownerID {
+			return true
+		}
+	}
+	return false
+}
+
+// routeToDelegate назначает задачу заместителю, если ответственный сейчас отсутствует
+func routeToDelegate(absences *AbsenceService, task *models.ProjectTask) {
+	if task.ResponsibleUserID == nil {
+		return
+	}
+	assignee, from := absences.ResolveAssignee(uint(*task.ResponsibleUserID))
+	if from == nil {
+		return
+	}
+	assigneeID, fromID := int(assignee), int(*from)
+	task.ResponsibleUserID = &assigneeID
+	task.DelegatedFromUserID = &fromID
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/events"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbsenceService_RoutesAssignmentsToDelegate(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	absences := services.NewAbsenceService(repositories.NewAbsenceRepository(db), userRepo)
+
+	author := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMP, IsActive: true}
+	absent := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	delegate := models.User{Name: "Сидоров С.С.", Login: "sidorov", Role: models.RoleMP, IsActive: true}
+	backup := models.User{Name: "Смирнов С.С.", Login: "smirnov", Role: models.RoleMP, IsActive: true}
+	for _, u := range []*models.User{&author, &absent, &delegate, &backup} {
+		require.NoError(t, db.Create(u).Error)
+	}
+
+	today := time.Now()
+	require.NoError(t, absences.CreateAbsence(absent.ID, &models.UserAbsence{DelegateID: delegate.ID, StartDate: today, EndDate: today.AddDate(0, 0, 7)}))
+
+	// Пересекающийся период и замещение самим собой не допускаются
+	err := absences.CreateAbsence(absent.ID, &models.UserAbsence{DelegateID: delegate.ID, StartDate: today.AddDate(0, 0, 3), EndDate: today.AddDate(0, 0, 10)})
+	assert.ErrorIs(t, err, services.ErrAbsenceOverlap)
+	err = absences.CreateAbsence(delegate.ID, &models.UserAbsence{DelegateID: delegate.ID, StartDate: today, EndDate: today})
+	assert.ErrorIs(t, err, services.ErrAbsenceDelegate)
+
+	assignee, from := absences.ResolveAssignee(absent.ID)
+	assert.Equal(t, delegate.ID, assignee)
+	require.NotNil(t, from)
+	assert.Equal(t, absent.ID, *from)
+	assert.True(t, absences.CanActFor(delegate.ID, absent.ID))
+	assert.False(t, absences.CanActFor(absent.ID, delegate.ID))
+
+	// Отсутствующий заместитель передает работу дальше по цепочке
+	require.NoError(t, absences.CreateAbsence(delegate.ID, &models.UserAbsence{DelegateID: backup.ID, StartDate: today, EndDate: today}))
+	assignee, _ = absences.ResolveAssignee(absent.ID)
+	assert.Equal(t, backup.ID, assignee)
+
+	// Деактивированный заместитель работу не получает: она остается у последнего активного в цепочке
+	require.NoError(t, db.Model(&backup).Update("IsActive", false).Error)
+	assignee, _ = absences.ResolveAssignee(absent.ID)
+	assert.Equal(t, delegate.ID, assignee)
+	require.NoError(t, db.Model(&delegate).Update("IsActive", false).Error)
+	assignee, from = absences.ResolveAssignee(absent.ID)
+	assert.Equal(t, absent.ID, assignee)
+	assert.Nil(t, from)
+	require.NoError(t, db.Model(&models.User{}).Where("\"Id\" IN ?", []uint{delegate.ID, backup.ID}).Update("IsActive", true).Error)
+
+	requestService := services.NewRequestService(db, nil, events.NewEventBus(), absences)
+	request := models.Request{Title: "Планировка", CreatedByUserID: author.ID, AssignedToUserID: delegate.ID}
+	require.NoError(t, requestService.CreateRequest(&request))
+	assert.Equal(t, backup.ID, request.AssignedToUserID)
+	require.NotNil(t, request.DelegatedFromUserID)
+	assert.Equal(t, delegate.ID, *request.DelegatedFromUserID)
+
+	// Заместитель может взять в работу заявку отсутствующего
+	require.NoError(t, db.Model(&request).Update("AssignedToUserID", delegate.ID).Error)
+	require.NoError(t, requestService.TakeInWork(request.ID, backup.ID))
+	assert.Error(t, requestService.TakeInWork(request.ID, author.ID))
+
+	// Заявки замещаемого видны заместителю в списке так же, как при открытии по ID
+	actingFor, err := absences.ActingFor(backup.ID)
+	require.NoError(t, err)
+	scope := repositories.ProjectScope{UserID: backup.ID, ActingFor: actingFor}
+	list, err := requestService.GetAllRequests(scope)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, request.ID, list[0].ID)
+	list, err = requestService.GetAllRequests(repositories.ProjectScope{UserID: absent.ID})
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
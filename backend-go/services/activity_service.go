@@ -25,8 +25,8 @@ func (s *ActivityService) LogActivity(userId uint, action, entityType string, en
 	return s.Repo.Create(activity)
 }
 
-func (s *ActivityService) GetRecentActivities(limit int) ([]models.UserActivity, error) {
-	return s.Repo.GetRecent(limit)
+func (s *ActivityService) GetRecentActivities(scope repositories.ProjectScope, limit int) ([]models.UserActivity, error) {
+	return s.Repo.GetRecent(scope, limit)
 }
 
 func (s *ActivityService) GetTaskHistory(taskId uint) ([]models.UserActivity, error) {
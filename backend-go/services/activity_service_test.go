@@ -0,0 +1,39 @@
+package services_test
+
+import (
+	"testing"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityService_RecentActivitiesInScope(t *testing.T) {
+	db := setupTestDB(t)
+	service := services.NewActivityService(repositories.NewUserActivityRepository(db))
+
+	mp := models.User{Name: "МП", Login: "mp", Role: models.RoleMP, IsActive: true}
+	require.NoError(t, db.Create(&mp).Error)
+	mine := models.Project{StoreID: 1, Status: string(models.ProjectStatusCreated)}
+	other := models.Project{StoreID: 2, Status: string(models.ProjectStatusCreated)}
+	require.NoError(t, db.Create(&mine).Error)
+	require.NoError(t, db.Create(&other).Error)
+	require.NoError(t, db.Create(&models.ProjectMember{ProjectID: mine.ID, UserID: mp.ID}).Error)
+
+	require.NoError(t, service.LogActivity(mp.ID, "создал задачу", models.EntityTask, 1, "Аудит", &mine.ID))
+	require.NoError(t, service.LogActivity(mp.ID, "создал задачу", models.EntityTask, 2, "Закрытие", &other.ID))
+	require.NoError(t, service.LogActivity(mp.ID, "создал магазин", models.EntityStore, 3, "Магазин", nil))
+
+	// Пользователь видит только действия по проектам своей команды
+	activities, err := service.GetRecentActivities(repositories.ProjectScope{UserID: mp.ID}, 20)
+	require.NoError(t, err)
+	require.Len(t, activities, 1)
+	assert.Equal(t, "Аудит", activities[0].EntityName)
+
+	activities, err = service.GetRecentActivities(repositories.AllProjectsScope(), 20)
+	require.NoError(t, err)
+	assert.Len(t, activities, 3)
+}
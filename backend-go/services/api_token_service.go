@@ -0,0 +1,138 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+
+	"github.com/lib/pq"
+)
+
+// Ошибки персональных токенов
+var (
+	ErrAPITokenInvalid     = errors.New("токен недействителен или отозван")
+	ErrAPITokenExpired     = errors.New("срок действия токена истек")
+	ErrAPITokenName        = errors.New("укажите название токена")
+	ErrAPITokenNoScope     = errors.New("укажите хотя бы одно право токена")
+	ErrAPITokenPermission  = errors.New("токену можно выдать только права, которые есть у пользователя")
+	ErrAPITokenExpiryValue = errors.New("срок действия токена должен быть в будущем")
+)
+
+// apiTokenTouchInterval как часто обновляется время последнего использования,
+// чтобы частые запросы скриптов не писали в БД на каждый вызов
+const apiTokenTouchInterval = time.Minute
+
+// APITokenInput данные для выпуска токена
+type APITokenInput struct {
+	Name        string     `json:"name"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+// IssuedAPIToken выпущенный токен; значение возвращается только один раз
+type IssuedAPIToken struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+// APITokenService выпускает и отзывает персональные токены пользователя
+type APITokenService struct {
+	repo repositories.APITokenRepository
+	now  func() time.Time
+}
+
+func NewAPITokenService(repo repositories.APITokenRepository) *APITokenService {
+	return &APITokenService{repo: repo, now: time.Now}
+}
+
+// GetTokens возвращает токены пользователя (без значений)
+func (s *APITokenService) GetTokens(userID uint) ([]models.APIToken, error) {
+	return s.repo.FindByUser(userID)
+}
+
+// CreateToken выпускает токен с правами из available (текущие права пользователя)
+func (s *APITokenService) CreateToken(userID uint, input APITokenInput, available []string) (*IssuedAPIToken, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, ErrAPITokenName
+	}
+	if len(input.Permissions) == 0 {
+		return nil, ErrAPITokenNoScope
+	}
+	perms := make(pq.StringArray, 0, len(input.Permissions))
+	for _, p := range input.Permissions {
+		if !containsString(available, p) {
+			return nil, ErrAPITokenPermission
+		}
+		if !containsString(perms, p) {
+			perms = append(perms, p)
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(s.now()) {
+		return nil, ErrAPITokenExpiryValue
+	}
+
+	raw, err := generateAPIToken()
+	if err != nil {
+		return nil, err
+	}
+	token := models.APIToken{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   hashAPIToken(raw),
+		Hint:        raw[:len(models.APITokenPrefix)+4],
+		Permissions: perms,
+		ExpiresAt:   input.ExpiresAt,
+	}
+	if err := s.repo.Create(&token); err != nil {
+		return nil, err
+	}
+	return &IssuedAPIToken{APIToken: token, Token: raw}, nil
+}
+
+// RevokeToken отзывает токен пользователя
+func (s *APITokenService) RevokeToken(userID, id uint) error {
+	return s.repo.DeleteForUser(userID, id)
+}
+
+// Authenticate находит действующий токен по значению и отмечает его использование
+func (s *APITokenService) Authenticate(raw string) (*models.APIToken, error) {
+	if !strings.HasPrefix(raw, models.APITokenPrefix) {
+		return nil, ErrAPITokenInvalid
+	}
+	token, err := s.repo.FindByHash(hashAPIToken(raw))
+	if err != nil {
+		return nil, ErrAPITokenInvalid
+	}
+	now := s.now()
+	if token.IsExpiredAt(now) {
+		return nil, ErrAPITokenExpired
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		if err := s.repo.Touch(token.ID, now); err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = &now
+	}
+	return token, nil
+}
+
+func generateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return models.APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashAPIToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
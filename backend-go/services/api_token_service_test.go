@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/cache"
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokenService_ScopedTokens(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, database.SeedRBAC(db))
+	rbac := services.NewRBACService(db, cache.NewPermissionCache(time.Minute), &recordingBroadcaster{})
+	auth := services.NewAuthService(db, rbac)
+	service := services.NewAPITokenService(repositories.NewAPITokenRepository(db))
+
+	user := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+	access, err := auth.GetUserAccess(&user)
+	require.NoError(t, err)
+	available := access.Permissions()
+	require.Contains(t, available, models.PermTaskEditOwn)
+
+	// Токену нельзя выдать право, которого нет у пользователя
+	_, err = service.CreateToken(user.ID, services.APITokenInput{Name: "BI", Permissions: []string{models.PermUserManage}}, available)
+	assert.ErrorIs(t, err, services.ErrAPITokenPermission)
+
+	issued, err := service.CreateToken(user.ID, services.APITokenInput{Name: "BI", Permissions: []string{models.PermTaskEditOwn}}, available)
+	require.NoError(t, err)
+	assert.NotEqual(t, issued.Token, issued.TokenHash)
+	assert.Contains(t, issued.Token, issued.Hint)
+
+	// Запрос по токену получает только права токена и отмечает использование
+	owner, tokenAccess, token, err := auth.GetUserByAPIToken(issued.Token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, owner.ID)
+	assert.Equal(t, []string{models.PermTaskEditOwn}, tokenAccess.Permissions())
+	assert.NotNil(t, token.LastUsedAt)
+
+	_, _, _, err = auth.GetUserByAPIToken(issued.Token + "x")
+	assert.ErrorIs(t, err, services.ErrAPITokenInvalid)
+
+	// Просроченный токен не принимается
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, db.Model(&models.APIToken{}).Where("\"Id\" = ?", issued.ID).UpdateColumn("ExpiresAt", past).Error)
+	_, _, _, err = auth.GetUserByAPIToken(issued.Token)
+	assert.ErrorIs(t, err, services.ErrAPITokenExpired)
+
+	// Отозвать можно только свой токен
+	assert.Error(t, service.RevokeToken(user.ID+1, issued.ID))
+	require.NoError(t, service.RevokeToken(user.ID, issued.ID))
+	tokens, err := service.GetTokens(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"portal-razvitie/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownAssignmentStrategy стратегия назначения не зарегистрирована
+var ErrUnknownAssignmentStrategy = errors.New("неизвестная стратегия назначения")
+
+// AssignmentStrategy выбирает исполнителя роли среди активных пользователей с этой ролью.
+// Pick возвращает nil, если стратегия не смогла выбрать — тогда используется стратегия по умолчанию
+type AssignmentStrategy interface {
+	Name() string
+	Title() string
+	Pick(db *gorm.DB, project *models.Project, role string, candidates []models.User) (*models.User, string, error)
+}
+
+// AssignmentDecision результат автоматического назначения
+type AssignmentDecision struct {
+	UserID   uint
+	UserName string
+	Strategy string
+	Reason   string
+}
+
+// Note возвращает описание назначения для истории задачи
+func (d *AssignmentDecision) Note() string {
+	return fmt.Sprintf("автоматически назначил исполнителя %s: %s", d.UserName, d.Reason)
+}
+
+// AssignmentService назначает исполнителей задач по роли согласно правилам AssignmentRules
+type AssignmentService struct {
+	db         *gorm.DB
+	strategies map[string]AssignmentStrategy
+}
+
+func NewAssignmentService(db *gorm.DB) *AssignmentService {
+	s := &AssignmentService{db: db, strategies: make(map[string]AssignmentStrategy)}
+	s.RegisterStrategy(roundRobinStrategy{})
+	s.RegisterStrategy(leastOpenTasksStrategy{})
+	s.RegisterStrategy(regionAffinityStrategy{})
+	s.RegisterStrategy(projectTeamStrategy{})
+	return s
+}
+
+// RegisterStrategy добавляет или заменяет стратегию назначения
+func (s *AssignmentService) RegisterStrategy(strategy AssignmentStrategy) {
+	s.strategies[strategy.Name()] = strategy
+}
+
+// WithTx возвращает сервис, читающий данные в транзакции (учитывает задачи, созданные в ней ранее)
+func (s *AssignmentService) WithTx(tx *gorm.DB) *AssignmentService {
+	if s == nil {
+		return nil
+	}
+	return &AssignmentService{db: tx, strategies: s.strategies}
+}
+
+// Strategies возвращает зарегистрированные стратегии: код → название
+func (s *AssignmentService) Strategies() map[string]string {
+	result := make(map[string]string, len(s.strategies))
+	for name, strategy := range s.strategies {
+		result[name] = strategy.Title()
+	}
+	return result
+}
+
+// GetRules возвращает правила назначения по ролям
+func (s *AssignmentService) GetRules() ([]models.AssignmentRule, error) {
+	rules := make([]models.AssignmentRule, 0)
+	err := s.db.Order("\"Role\"").Find(&rules).Error
+	return rules, err
+}
+
+// SetRule задает стратегию назначения для роли
+func (s *AssignmentService) SetRule(role string, strategy string) (*models.AssignmentRule, error) {
+	if _, ok := s.strategies[strategy]; !ok {
+		return nil, ErrUnknownAssignmentStrategy
+	}
+	if err := s.db.Where("\"Code\" = ?", role).First(&models.Role{}).Error; err != nil {
+		return nil, err
+	}
+
+	var rule models.AssignmentRule
+	err := s.db.Where("\"Role\" = ?", role).First(&rule).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	rule.Role = role
+	rule.Strategy = strategy
+	if err := s.db.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// DeleteRule возвращает роль к стратегии по умолчанию
+func (s *AssignmentService) DeleteRule(role string) error {
+	return s.db.Where("\"Role\" = ?", role).Delete(&models.AssignmentRule{}).Error
+}
+
+// Assign выбирает исполнителя роли для задачи проекта. Возвращает nil, если пользователей с ролью нет
+func (s *AssignmentService) Assign(role string, project *models.Project) (*AssignmentDecision, error) {
+	if s == nil || s.db == nil || role == "" {
+		return nil, nil
+	}
+
+	candidates, err := s.candidates(role)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+
+	name := models.DefaultAssignmentStrategy
+	var rule models.AssignmentRule
+	if err := s.db.Where("\"Role\" = ?", role).Limit(1).Find(&rule).Error; err != nil {
+		return nil, err
+	}
+	if _, ok := s.strategies[rule.Strategy]; ok {
+		name = rule.Strategy
+	}
+
+	strategy := s.strategies[name]
+	user, reason, err := strategy.Pick(s.db, project, role, candidates)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil && name != models.DefaultAssignmentStrategy {
+		fallback := s.strategies[models.DefaultAssignmentStrategy]
+		user, reason, err = fallback.Pick(s.db, project, role, candidates)
+		if err != nil {
+			return nil, err
+		}
+		reason = fmt.Sprintf("стратегия «%s» не нашла исполнителя, %s", strategy.Title(), reason)
+		strategy = fallback
+	}
+	if user == nil {
+		user, reason = &candidates[0], "первый пользователь роли"
+	}
+
+	return &AssignmentDecision{
+		UserID:   user.ID,
+		UserName: user.Name,
+		Strategy: strategy.Name(),
+		Reason:   fmt.Sprintf("стратегия «%s» — %s", strategy.Title(), reason),
+	}, nil
+}
+
+// AssignTask назначает исполнителя задаче без исполнителя по ее роли (Responsible)
+func (s *AssignmentService) AssignTask(task *models.ProjectTask, project *models.Project) error {
+	if task.ResponsibleUserID != nil || task.Responsible == "" {
+		return nil
+	}
+	decision, err := s.Assign(task.Responsible, project)
+	if err != nil || decision == nil {
+		return err
+	}
+	uid := int(decision.UserID)
+	task.ResponsibleUserID = &uid
+	task.AssignmentNote = decision.Note()
+	return nil
+}
+
+// candidates возвращает активных пользователей с ролью (основной или назначенной в любой области)
+func (s *AssignmentService) candidates(role string) ([]models.User, error) {
+	var users []models.User
+	assigned := s.db.Session(&gorm.Session{NewDB: true}).Model(&models.UserRole{}).Select("\"UserId\"").Where("\"RoleCode\" = ?", role)
+	err := s.db.Where("\"IsActive\" = ? AND (\"Role\" = ? OR \"ID\" IN (?))", true, role, assigned).
+		Order("\"ID\"").Find(&users).Error
+	return users, err
+}
+
+// openTaskCounts считает незавершенные задачи пользователей
+func openTaskCounts(db *gorm.DB, users []models.User) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(users))
+	for _, u := range users {
+		var count int64
+		if err := db.Model(&models.ProjectTask{}).
+			Where("\"ResponsibleUserId\" = ? AND \"Status\" NOT IN ?", u.ID, models.ClosedTaskStatuses()).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		counts[u.ID] = count
+	}
+	return counts, nil
+}
+
+// leastLoaded возвращает пользователя с наименьшим числом открытых задач (при равенстве — первого)
+func leastLoaded(db *gorm.DB, users []models.User) (*models.User, int64, error) {
+	counts, err := openTaskCounts(db, users)
+	if err != nil {
+		return nil, 0, err
+	}
+	sorted := append([]models.User(nil), users...)
+	sort.SliceStable(sorted, func(i, j int) bool { return counts[sorted[i].ID] < counts[sorted[j].ID] })
+	return &sorted[0], counts[sorted[0].ID], nil
+}
+
+type roundRobinStrategy struct{}
+
+func (roundRobinStrategy) Name() string  { return models.AssignmentRoundRobin }
+func (roundRobinStrategy) Title() string { return "по очереди" }
+
+// Pick берет следующего пользователя после того, кому последней назначена задача этой роли
+func (roundRobinStrategy) Pick(db *gorm.DB, _ *models.Project, role string, candidates []models.User) (*models.User, string, error) {
+	var last models.ProjectTask
+	err := db.Select("Id", "ResponsibleUserId").
+		Where("\"Responsible\" = ? AND \"ResponsibleUserId\" IS NOT NULL", role).
+		Order("\"Id\" DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if last.ID != 0 {
+		for i, u := range candidates {
+			if int(u.ID) == *last.ResponsibleUserID {
+				next := &candidates[(i+1)%len(candidates)]
+				return next, fmt.Sprintf("следующий после %s", u.Name), nil
+			}
+		}
+	}
+	return &candidates[0], "первый в очереди", nil
+}
+
+type leastOpenTasksStrategy struct{}
+
+func (leastOpenTasksStrategy) Name() string  { return models.AssignmentLeastOpenTasks }
+func (leastOpenTasksStrategy) Title() string { return "наименьшая загрузка" }
+
+func (leastOpenTasksStrategy) Pick(db *gorm.DB, _ *models.Project, _ string, candidates []models.User) (*models.User, string, error) {
+	user, open, err := leastLoaded(db, candidates)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, fmt.Sprintf("открытых задач: %d", open), nil
+}
+
+type regionAffinityStrategy struct{}
+
+func (regionAffinityStrategy) Name() string  { return models.AssignmentRegionAffinity }
+func (regionAffinityStrategy) Title() string { return "по региону" }
+
+// Pick выбирает среди пользователей, чья роль назначена в регионе магазина, наименее загруженного
+func (regionAffinityStrategy) Pick(db *gorm.DB, project *models.Project, role string, candidates []models.User) (*models.User, string, error) {
+	if project == nil {
+		return nil, "", nil
+	}
+	region := project.Area().Region
+	if region == "" {
+		return nil, "", nil
+	}
+
+	var userIDs []uint
+	if err := db.Model(&models.UserRole{}).Where("\"RoleCode\" = ? AND \"Region\" = ?", role, region).
+		Pluck("UserId", &userIDs).Error; err != nil {
+		return nil, "", err
+	}
+	var regional []models.User
+	for _, u := range candidates {
+		for _, id := range userIDs {
+			if u.ID == id {
+				regional = append(regional, u)
+				break
+			}
+		}
+	}
+	if len(regional) == 0 {
+		return nil, "", nil
+	}
+
+	user, open, err := leastLoaded(db, regional)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, fmt.Sprintf("регион %s, открытых задач: %d", region, open), nil
+}
+
+type projectTeamStrategy struct{}
+
+func (projectTeamStrategy) Name() string  { return models.AssignmentProjectTeam }
+func (projectTeamStrategy) Title() string { return "команда проекта" }
+
+// Pick выбирает участника команды проекта с ролью, соответствующей роли задачи
+func (projectTeamStrategy) Pick(db *gorm.DB, project *models.Project, role string, candidates []models.User) (*models.User, string, error) {
+	projectRole, ok := models.ProjectRoleForUserRole(role)
+	if project == nil || project.ID == 0 || !ok {
+		return nil, "", nil
+	}
+
+	var members []models.ProjectMember
+	if err := db.Where("\"ProjectId\" = ? AND \"Role\" = ?", project.ID, projectRole).
+		Order("\"Id\"").Find(&members).Error; err != nil {
+		return nil, "", err
+	}
+	for _, m := range members {
+		for i := range candidates {
+			if candidates[i].ID == m.UserID {
+				return &candidates[i], fmt.Sprintf("участник команды проекта (%s)", projectRole), nil
+			}
+		}
+	}
+	return nil, "", nil
+}
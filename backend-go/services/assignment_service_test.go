@@ -0,0 +1,76 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignmentService_Strategies(t *testing.T) {
+	db := setupTestDB(t)
+	service := services.NewAssignmentService(db)
+	require.NoError(t, db.Create(&models.Role{Code: models.RoleMP, Name: "Менеджер проектов"}).Error)
+
+	busy := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	free := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMP, IsActive: true}
+	regional := models.User{Name: "Сидоров С.С.", Login: "sidorov", Role: models.RoleBA, IsActive: true}
+	for _, u := range []*models.User{&busy, &free, &regional} {
+		require.NoError(t, db.Create(u).Error)
+	}
+	// Роль МП у Сидорова действует только в его регионе
+	require.NoError(t, db.Create(&models.UserRole{UserID: regional.ID, RoleCode: models.RoleMP, Region: "Урал"}).Error)
+
+	store := models.Store{Code: "S-1", Name: "Магазин", Region: "Урал"}
+	require.NoError(t, db.Create(&store).Error)
+	project := models.Project{StoreID: store.ID, ProjectType: string(models.ProjectTypeOpening)}
+	require.NoError(t, db.Create(&project).Error)
+	project.Store = &store
+
+	busyID := int(busy.ID)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.Create(&models.ProjectTask{ProjectID: project.ID, Name: "Аудит", NormativeDeadline: time.Now(),
+			Responsible: models.RoleMP, ResponsibleUserID: &busyID, Status: string(models.TaskStatusInProgress)}).Error)
+	}
+
+	// По умолчанию — наименее загруженный
+	decision, err := service.Assign(models.RoleMP, &project)
+	require.NoError(t, err)
+	assert.Equal(t, free.ID, decision.UserID)
+	assert.Equal(t, models.AssignmentLeastOpenTasks, decision.Strategy)
+
+	// По очереди: следующий после последнего назначенного
+	_, err = service.SetRule(models.RoleMP, models.AssignmentRoundRobin)
+	require.NoError(t, err)
+	decision, err = service.Assign(models.RoleMP, &project)
+	require.NoError(t, err)
+	assert.Equal(t, free.ID, decision.UserID)
+	assert.Equal(t, models.AssignmentRoundRobin, decision.Strategy)
+
+	// По региону магазина
+	_, err = service.SetRule(models.RoleMP, models.AssignmentRegionAffinity)
+	require.NoError(t, err)
+	decision, err = service.Assign(models.RoleMP, &project)
+	require.NoError(t, err)
+	assert.Equal(t, regional.ID, decision.UserID)
+
+	// Команда проекта без МП — назначение по стратегии по умолчанию
+	_, err = service.SetRule(models.RoleMP, models.AssignmentProjectTeam)
+	require.NoError(t, err)
+	decision, err = service.Assign(models.RoleMP, &project)
+	require.NoError(t, err)
+	assert.Equal(t, models.AssignmentLeastOpenTasks, decision.Strategy)
+
+	require.NoError(t, db.Create(&models.ProjectMember{ProjectID: project.ID, UserID: busy.ID, Role: models.ProjectRoleMP}).Error)
+	task := models.ProjectTask{ProjectID: project.ID, Name: "Обмер", Responsible: models.RoleMP}
+	require.NoError(t, service.AssignTask(&task, &project))
+	assert.Equal(t, busyID, *task.ResponsibleUserID)
+	assert.Contains(t, task.AssignmentNote, "команда проекта")
+
+	_, err = service.SetRule(models.RoleMP, "random")
+	assert.ErrorIs(t, err, services.ErrUnknownAssignmentStrategy)
+}
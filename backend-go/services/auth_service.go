@@ -1,31 +1,53 @@
 package services
 
 import (
+	"time"
+
 	"portal-razvitie/models"
+	"portal-razvitie/repositories"
 
 	"gorm.io/gorm"
 )
 
 type AuthService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	rbac     *RBACService
+	sessions *SessionService
+}
+
+func NewAuthService(db *gorm.DB, rbac *RBACService) *AuthService {
+	return &AuthService{db: db, rbac: rbac}
 }
 
-func NewAuthService(db *gorm.DB) *AuthService {
-	return &AuthService{db: db}
+// SetSessionService включает выдачу токенов сеанса при входе
+func (s *AuthService) SetSessionService(sessions *SessionService) {
+	s.sessions = sessions
+}
+
+// IssueSession выдает токен сеанса вошедшему пользователю; nil, если сеансы не настроены
+func (s *AuthService) IssueSession(user *models.User) *Session {
+	if s.sessions == nil {
+		return nil
+	}
+	session := s.sessions.Issue(user.ID)
+	return &session
 }
 
 func (s *AuthService) Login(login string) (*models.User, []string, error) {
 	var user models.User
-	if err := s.db.Where("login = ?", login).First(&user).Error; err != nil {
+	if err := s.db.Where("\"Login\" = ?", login).First(&user).Error; err != nil {
 		return nil, nil, err
 	}
+	if !user.IsActive {
+		return nil, nil, ErrUserInactive
+	}
 
-	perms, err := s.getRolePermissions(user.Role)
+	access, err := s.GetUserAccess(&user)
 	if err != nil {
 		return &user, []string{}, nil // Ignore role error, return user
 	}
 
-	return &user, perms, nil
+	return &user, access.Permissions(), nil
 }
 
 func (s *AuthService) GetAllUsersWithPerms() ([]struct {
@@ -33,7 +55,7 @@ func (s *AuthService) GetAllUsersWithPerms() ([]struct {
 	Permissions []string
 }, error) {
 	var users []models.User
-	if err := s.db.Find(&users).Error; err != nil {
+	if err := s.db.Where("\"IsActive\" = ?", true).Find(&users).Error; err != nil {
 		return nil, err
 	}
 
@@ -43,7 +65,10 @@ func (s *AuthService) GetAllUsersWithPerms() ([]struct {
 	}
 
 	for _, u := range users {
-		perms, _ := s.getRolePermissions(u.Role)
+		perms := []string{}
+		if access, err := s.GetUserAccess(&u); err == nil {
+			perms = access.Permissions()
+		}
 		result = append(result, struct {
 			User        models.User
 			Permissions []string
@@ -53,31 +78,74 @@ func (s *AuthService) GetAllUsersWithPerms() ([]struct {
 	return result, nil
 }
 
-func (s *AuthService) GetUserByIdWithPerms(id int) (*models.User, []string, error) {
+// GetUserByIdWithAccess возвращает активного пользователя и его права по областям
+func (s *AuthService) GetUserByIdWithAccess(id int) (*models.User, *models.UserAccess, error) {
 	var user models.User
 	if err := s.db.First(&user, id).Error; err != nil {
 		return nil, nil, err
 	}
+	if !user.IsActive {
+		return nil, nil, ErrUserInactive
+	}
 
-	perms, err := s.getRolePermissions(user.Role)
-	// If permissions fetch fails, we still return user but empty perms? Or log warning?
-	// For now, consistent with Login behaviour.
+	access, err := s.GetUserAccess(&user)
 	if err != nil {
-		return &user, []string{}, nil
+		return &user, &models.UserAccess{}, nil
 	}
 
-	return &user, perms, nil
+	return &user, access, nil
 }
 
-func (s *AuthService) getRolePermissions(roleCode string) ([]string, error) {
-	var role models.Role
-	if err := s.db.Preload("Permissions").Where(&models.Role{Code: roleCode}).First(&role).Error; err != nil {
+// GetUserByAPIToken возвращает владельца персонального токена и его права, ограниченные правами токена
+func (s *AuthService) GetUserByAPIToken(raw string) (*models.User, *models.UserAccess, *models.APIToken, error) {
+	token, err := NewAPITokenService(repositories.NewAPITokenRepository(s.db)).Authenticate(raw)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	user, access, err := s.GetUserByIdWithAccess(int(token.UserID))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return user, access.Restrict(token.Permissions), token, nil
+}
+
+// GetUserBySession возвращает пользователя по токену сеанса, выданному при входе
+func (s *AuthService) GetUserBySession(raw string) (*models.User, *models.UserAccess, error) {
+	if s.sessions == nil {
+		return nil, nil, ErrSessionInvalid
+	}
+	userID, err := s.sessions.Verify(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.GetUserByIdWithAccess(int(userID))
+}
+
+// GetUserAccess собирает права всех ролей пользователя и список замещаемых сотрудников.
+// Права ролей берутся из кэша RBACService, БД читается только при промахе.
+// Пользователь без назначений получает основную роль без ограничения области
+func (s *AuthService) GetUserAccess(user *models.User) (*models.UserAccess, error) {
+	var roles []models.UserRole
+	if err := s.db.Where("\"UserId\" = ?", user.ID).Order("\"Id\"").Find(&roles).Error; err != nil {
 		return nil, err
 	}
+	if len(roles) == 0 {
+		roles = []models.UserRole{{UserID: user.ID, RoleCode: user.Role}}
+	}
+
+	access := &models.UserAccess{}
+	for _, r := range roles {
+		perms, err := s.rbac.GetRolePermissions(r.RoleCode)
+		if err != nil {
+			return nil, err
+		}
+		access.Grants = append(access.Grants, models.RoleGrant{Role: r.RoleCode, Area: r.Area(), Permissions: perms})
+	}
 
-	var perms []string
-	for _, p := range role.Permissions {
-		perms = append(perms, p.Code)
+	actingFor, err := repositories.NewAbsenceRepository(s.db).FindActingFor(user.ID, time.Now())
+	if err != nil {
+		return nil, err
 	}
-	return perms, nil
+	access.ActingFor = actingFor
+	return access, nil
 }
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/storage"
+)
+
+// ArchiveManifestName имя файла с описанием документов в корне архива
+const ArchiveManifestName = "manifest.csv"
+
+// Папки архива для документов без задачи, без этапа и без типа
+const (
+	archiveProjectFolder = "Документы проекта"
+	archiveNoStageFolder = "Без этапа"
+	archiveNoTypeFolder  = "Без типа"
+)
+
+// ArchiveOptions какие документы попадают в архив: проекта или одной задачи
+type ArchiveOptions struct {
+	ProjectID   uint // 0 — не ограничивать проектом (архив задачи)
+	TaskID      *int
+	AllVersions bool // Все версии файлов; по умолчанию только текущие
+}
+
+// DocumentArchive подготовленный архив: список файлов собран заранее, чтобы ошибки базы
+// вернулись до начала ответа, а сами файлы читаются из хранилища при записи
+type DocumentArchive struct {
+	service *DocumentService
+	entries []archiveEntry
+}
+
+type archiveEntry struct {
+	path     string
+	doc      models.ProjectDocument
+	revision models.DocumentRevision
+	task     *models.ProjectTask
+	current  bool
+}
+
+// BuildArchive собирает документы проекта (или задачи) и раскладывает их по папкам "этап/тип документа"
+func (s *DocumentService) BuildArchive(opts ArchiveOptions) (*DocumentArchive, error) {
+	var docs []models.ProjectDocument
+	query := s.db.Model(&models.ProjectDocument{})
+	if opts.ProjectID != 0 {
+		query = query.Where("\"ProjectId\" = ?", opts.ProjectID)
+	}
+	if opts.TaskID != nil {
+		query = query.Where("\"TaskId\" = ?", *opts.TaskID)
+	}
+	if err := query.Order("\"Name\"").Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return &DocumentArchive{service: s}, nil
+	}
+
+	docIDs := make([]uint, 0, len(docs))
+	taskIDs := make([]int, 0)
+	for _, doc := range docs {
+		docIDs = append(docIDs, doc.ID)
+		if doc.TaskID != nil {
+			taskIDs = append(taskIDs, *doc.TaskID)
+		}
+	}
+
+	tasks := make(map[int]*models.ProjectTask)
+	if len(taskIDs) > 0 {
+		var list []models.ProjectTask
+		if err := s.db.Select("Id", "Name", "Code", "Stage", "Order").Where("\"Id\" IN ?", taskIDs).Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for i := range list {
+			tasks[int(list[i].ID)] = &list[i]
+		}
+	}
+
+	var revisions []models.DocumentRevision
+	if err := s.db.Where("\"DocumentId\" IN ?", docIDs).Order("\"Number\" DESC").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	byDocument := make(map[uint][]models.DocumentRevision)
+	for _, r := range revisions {
+		byDocument[r.DocumentID] = append(byDocument[r.DocumentID], r)
+	}
+
+	// Документы задач идут в порядке задач проекта, документы без задачи — в конце
+	sort.SliceStable(docs, func(i, j int) bool {
+		return archiveTaskOrder(docs[i], tasks) < archiveTaskOrder(docs[j], tasks)
+	})
+
+	archive := &DocumentArchive{service: s}
+	used := make(map[string]bool)
+	for _, doc := range docs {
+		var task *models.ProjectTask
+		if doc.TaskID != nil {
+			task = tasks[*doc.TaskID]
+		}
+		folder := archiveFolder(doc, task)
+
+		docRevisions := byDocument[doc.ID]
+		if len(docRevisions) == 0 {
+			// Документ без истории версий: описание файла берется из самого документа
+			docRevisions = []models.DocumentRevision{{
+				Number: doc.Version, Name: doc.Name, FileName: doc.FileName, FilePath: doc.FilePath,
+				StorageKey: doc.StorageKey, ContentType: doc.ContentType, Size: doc.Size, SHA256: doc.SHA256,
+				UploadedBy: doc.Author, CreatedAt: doc.UploadDate,
+			}}
+		}
+		for _, r := range docRevisions {
+			current := r.Number == doc.Version
+			if !opts.AllVersions && !current {
+				continue
+			}
+			name := archiveFileName(r.Name)
+			if opts.AllVersions {
+				ext := filepath.Ext(name)
+				name = fmt.Sprintf("%s (v%d)%s", strings.TrimSuffix(name, ext), r.Number, ext)
+			}
+			archive.entries = append(archive.entries, archiveEntry{
+				path:     uniqueArchivePath(used, path.Join(folder, name)),
+				doc:      doc,
+				revision: r,
+				task:     task,
+				current:  current,
+			})
+		}
+	}
+	return archive, nil
+}
+
+// Len число файлов в архиве
+func (a *DocumentArchive) Len() int {
+	return len(a.entries)
+}
+
+// Write пишет ZIP в w. Файл, которого нет в хранилище, пропускается и отмечается в манифесте:
+// ответ к этому моменту уже начат, и прерывать его из-за одного файла хуже
+func (a *DocumentArchive) Write(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	statuses := make([]string, len(a.entries))
+	for i, entry := range a.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		status, err := a.writeFile(ctx, zw, entry)
+		if err != nil {
+			return err
+		}
+		statuses[i] = status
+	}
+
+	manifest, err := zw.CreateHeader(&zip.FileHeader{Name: ArchiveManifestName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := a.writeManifest(manifest, statuses); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (a *DocumentArchive) writeFile(ctx context.Context, zw *zip.Writer, entry archiveEntry) (string, error) {
+	content, err := a.service.openFile(ctx, entry.revision.StorageKey, entry.revision.FilePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "файл не найден", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	method := zip.Deflate
+	if !compressible(entry.revision.ContentType) {
+		method = zip.Store
+	}
+	header := &zip.FileHeader{Name: entry.path, Method: method, Modified: entry.revision.CreatedAt}
+	if header.Modified.IsZero() {
+		header.Modified = entry.doc.UploadDate
+	}
+	file, err := zw.CreateHeader(header)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// writeManifest пишет описание файлов архива. Разделитель ";" и BOM — чтобы CSV открывался в Excel
+func (a *DocumentArchive) writeManifest(w io.Writer, statuses []string) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	cw.Write([]string{
+		"Файл", "Документ", "Тип", "Задача", "Этап", "Версия", "Текущая версия",
+		"Размер", "SHA-256", "Загрузил", "Дата загрузки", "Комментарий", "Примечание",
+	})
+	for i, entry := range a.entries {
+		taskName, stage := "", ""
+		if entry.task != nil {
+			taskName = entry.task.Name
+			if entry.task.Stage != nil {
+				stage = *entry.task.Stage
+			}
+		}
+		uploadedAt := entry.revision.CreatedAt
+		if uploadedAt.IsZero() {
+			uploadedAt = entry.doc.UploadDate
+		}
+		current := "нет"
+		if entry.current {
+			current = "да"
+		}
+		cw.Write(csvSafeRow(
+			entry.path,
+			entry.revision.Name,
+			entry.doc.Type,
+			taskName,
+			stage,
+			strconv.Itoa(entry.revision.Number),
+			current,
+			strconv.FormatInt(entry.revision.Size, 10),
+			entry.revision.SHA256,
+			entry.revision.UploadedBy,
+			uploadedAt.Local().Format("02.01.2006 15:04"),
+			entry.revision.Comment,
+			statuses[i],
+		))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSafeRow защищает ячейки от CSV-инъекции: Excel выполняет значение, начинающееся с =, +, -, @
+// (а также табуляции и перевода строки), как формулу, поэтому перед ним ставится апостроф
+func csvSafeRow(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+func archiveTaskOrder(doc models.ProjectDocument, tasks map[int]*models.ProjectTask) int {
+	if doc.TaskID == nil {
+		return math.MaxInt
+	}
+	if task, ok := tasks[*doc.TaskID]; ok {
+		return task.Order
+	}
+	return math.MaxInt - 1
+}
+
+// archiveFolder папка документа: этап задачи и тип документа
+func archiveFolder(doc models.ProjectDocument, task *models.ProjectTask) string {
+	stage := archiveProjectFolder
+	if doc.TaskID != nil {
+		stage = archiveNoStageFolder
+		if task != nil && task.Stage != nil && strings.TrimSpace(*task.Stage) != "" {
+			stage = *task.Stage
+		}
+	}
+	docType := doc.Type
+	if strings.TrimSpace(docType) == "" {
+		docType = archiveNoTypeFolder
+	}
+	return path.Join(archiveFileName(stage), archiveFileName(docType))
+}
+
+// archiveFileName убирает из имени символы, недопустимые в путях Windows и ZIP
+func archiveFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// uniqueArchivePath добавляет к имени номер, если такой путь в архиве уже есть
+func uniqueArchivePath(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// precompressedTypes форматы, которые уже сжаты: повторное сжатие только тратит время
+var precompressedTypes = []string{
+	"application/pdf", "image/jpeg", "image/png", "image/gif", "image/webp",
+	contentTypeZIP, contentTypeDOCX, contentTypeXLSX, contentTypePPTX,
+	"application/x-7z-compressed", "application/x-rar-compressed",
+}
+
+func compressible(contentType string) bool {
+	return !containsString(precompressedTypes, baseContentType(contentType))
+}
@@ -0,0 +1,490 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"portal-razvitie/models"
+	"portal-razvitie/office"
+
+	"gorm.io/gorm"
+)
+
+// Ошибки правил извлечения и применения извлеченных значений
+var (
+	ErrExtractionRuleInvalid  = errors.New("укажите задачу, поле задачи и ровно один способ поиска: ячейку, имя или подпись")
+	ErrExtractionRuleNotFound = errors.New("правило извлечения не найдено")
+	ErrExtractionNotFound     = errors.New("извлеченное значение не найдено")
+	ErrExtractionNoValue      = errors.New("в документе не найдено значение для поля")
+)
+
+// ExtractionMaxSourceSize книги больше не разбираются
+const ExtractionMaxSourceSize = 50 << 20
+
+// extractionReadOptions ограничения распаковки книги: сжатый файл в пределах
+// ExtractionMaxSourceSize может распаковываться в гигабайты
+var extractionReadOptions = office.ReadOptions{
+	MaxUnzippedSize:      128 << 20,
+	MaxSharedStrings:     200000,
+	MaxSharedStringsSize: 16 << 20,
+}
+
+// extractionTolerance расхождение меньше копейки — округление, а не ошибка
+const extractionTolerance = 0.01
+
+// extractionFields поля задачи, которые можно заполнять из документов: имя в JSON → колонка
+var extractionFields = map[string]string{
+	"equipmentCostNoVat":  "EquipmentCostNoVat",
+	"securityBudgetNoVat": "SecurityBudgetNoVat",
+	"rsrBudgetNoVat":      "RsrBudgetNoVat",
+	"pisBudgetNoVat":      "PisBudgetNoVat",
+	"totalBudgetNoVat":    "TotalBudgetNoVat",
+}
+
+// DocumentExtractionService извлекает суммы из загруженных расчетов Excel по правилам типа
+// документа и сверяет их с полями задачи: пустое поле заполняется, введенное вручную значение
+// с расхождением помечается
+type DocumentExtractionService struct {
+	db   *gorm.DB
+	docs *DocumentService
+}
+
+func NewDocumentExtractionService(db *gorm.DB, docs *DocumentService) *DocumentExtractionService {
+	return &DocumentExtractionService{db: db, docs: docs}
+}
+
+// GetRules возвращает правила типа документа в порядке применения
+func (s *DocumentExtractionService) GetRules(typeCode string) ([]models.DocumentExtractionRule, error) {
+	rules := make([]models.DocumentExtractionRule, 0)
+	err := s.db.Where("\"DocumentTypeCode\" = ?", typeCode).Order("\"Order\", \"Id\"").Find(&rules).Error
+	return rules, err
+}
+
+// CreateRule добавляет правило типу документа
+func (s *DocumentExtractionService) CreateRule(typeCode string, rule *models.DocumentExtractionRule) error {
+	var types int64
+	if err := s.db.Model(&models.DocumentType{}).Where("\"Code\" = ?", typeCode).Count(&types).Error; err != nil {
+		return err
+	}
+	if types == 0 {
+		return ErrUnknownDocumentType
+	}
+	rule.ID = 0
+	rule.DocumentTypeCode = typeCode
+	if err := normalizeExtractionRule(rule); err != nil {
+		return err
+	}
+	autoFill, isActive := rule.AutoFill, rule.IsActive
+	if err := s.db.Create(rule).Error; err != nil {
+		return err
+	}
+	// У флагов значение по умолчанию true: false при создании записывается отдельно
+	if !autoFill || !isActive {
+		rule.AutoFill, rule.IsActive = autoFill, isActive
+		return s.db.Model(rule).UpdateColumns(map[string]interface{}{"AutoFill": autoFill, "IsActive": isActive}).Error
+	}
+	return nil
+}
+
+// UpdateRule изменяет правило типа документа
+func (s *DocumentExtractionService) UpdateRule(typeCode string, id uint, input models.DocumentExtractionRule) (*models.DocumentExtractionRule, error) {
+	rule, err := s.getRule(typeCode, id)
+	if err != nil {
+		return nil, err
+	}
+	input.ID = rule.ID
+	input.DocumentTypeCode = rule.DocumentTypeCode
+	if err := normalizeExtractionRule(&input); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(&input).Error; err != nil {
+		return nil, err
+	}
+	return &input, nil
+}
+
+// DeleteRule удаляет правило; извлеченные по нему значения остаются
+func (s *DocumentExtractionService) DeleteRule(typeCode string, id uint) error {
+	rule, err := s.getRule(typeCode, id)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(rule).Error
+}
+
+// Extract извлекает значения из версии документа по активным правилам его типа.
+// Пустые поля задач заполняются значениями правил с AutoFill. Документы без правил пропускаются
+func (s *DocumentExtractionService) Extract(ctx context.Context, doc *models.ProjectDocument, revision *models.DocumentRevision) ([]models.DocumentExtraction, error) {
+	var rules []models.DocumentExtractionRule
+	if doc.TypeCode != "" {
+		if err := s.db.Where("\"DocumentTypeCode\" = ? AND \"IsActive\" = ?", doc.TypeCode, true).
+			Order("\"Order\", \"Id\"").Find(&rules).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	workbook, readErr := s.readWorkbook(ctx, revision)
+	var extractions []models.DocumentExtraction
+	for _, group := range groupRulesByField(rules) {
+		extraction := models.DocumentExtraction{
+			DocumentID: doc.ID,
+			RevisionID: revision.ID,
+			Version:    revision.Number,
+			Field:      group[0].Field,
+			Status:     models.ExtractionNotFound,
+		}
+		task, err := s.targetTask(doc, group[0].TaskCode)
+		if err != nil {
+			return nil, err
+		}
+		if task != nil {
+			extraction.TaskID = &task.ID
+		}
+
+		switch {
+		case errors.Is(readErr, errExtractionUnsupported):
+			extraction.Status = models.ExtractionUnsupported
+			extraction.Error = "значение читается только из книг .xlsx"
+		case readErr != nil:
+			extraction.Status = models.ExtractionFailed
+			extraction.Error = readErr.Error()
+		default:
+			for i := range group {
+				if value, location, ok := findRuleValue(workbook, group[i]); ok {
+					ruleID := group[i].ID
+					extraction.RuleID = &ruleID
+					extraction.Value = &value
+					extraction.Location = location
+					extraction.Status = models.ExtractionFound
+					if task != nil && group[i].AutoFill {
+						if extraction.AutoFilled, err = s.fillEmpty(task.ID, extraction.Field, value); err != nil {
+							return nil, err
+						}
+					}
+					break
+				}
+			}
+		}
+		if err := s.db.Create(&extraction).Error; err != nil {
+			return nil, err
+		}
+		extractions = append(extractions, extraction)
+	}
+	if err := s.compare(extractions); err != nil {
+		return nil, err
+	}
+	return extractions, nil
+}
+
+// ExtractCurrent повторно извлекает значения из текущей версии документа (например, после изменения правил)
+func (s *DocumentExtractionService) ExtractCurrent(ctx context.Context, doc *models.ProjectDocument) ([]models.DocumentExtraction, error) {
+	revision, err := s.docs.GetRevision(doc.ID, doc.Version)
+	if err != nil {
+		return nil, err
+	}
+	return s.Extract(ctx, doc, revision)
+}
+
+// GetForTask последние извлеченные значения для полей задачи со сверкой с текущими значениями полей
+func (s *DocumentExtractionService) GetForTask(taskID uint) ([]models.DocumentExtraction, error) {
+	var all []models.DocumentExtraction
+	if err := s.db.Where("\"TaskId\" = ?", taskID).Order("\"Id\" DESC").Find(&all).Error; err != nil {
+		return nil, err
+	}
+	latest := make([]models.DocumentExtraction, 0)
+	seen := make(map[string]bool)
+	for _, e := range all {
+		if !seen[e.Field] {
+			seen[e.Field] = true
+			latest = append(latest, e)
+		}
+	}
+	if err := s.compare(latest); err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// Apply записывает извлеченное значение в поле задачи (пользователь принял предложенную сумму)
+func (s *DocumentExtractionService) Apply(taskID, extractionID uint) (*models.DocumentExtraction, error) {
+	var extraction models.DocumentExtraction
+	err := s.db.Where("\"Id\" = ? AND \"TaskId\" = ?", extractionID, taskID).First(&extraction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExtractionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if extraction.Value == nil {
+		return nil, ErrExtractionNoValue
+	}
+	if err := s.db.Model(&models.ProjectTask{}).Where("\"Id\" = ?", taskID).
+		UpdateColumn(extractionFields[extraction.Field], *extraction.Value).Error; err != nil {
+		return nil, err
+	}
+	list := []models.DocumentExtraction{extraction}
+	if err := s.compare(list); err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+func (s *DocumentExtractionService) getRule(typeCode string, id uint) (*models.DocumentExtractionRule, error) {
+	var rule models.DocumentExtractionRule
+	err := s.db.Where("\"Id\" = ? AND \"DocumentTypeCode\" = ?", id, typeCode).First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExtractionRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+var errExtractionUnsupported = errors.New("формат не поддерживается")
+
+// readWorkbook читает книгу версии; старые книги .xls (не ZIP) не поддерживаются
+func (s *DocumentExtractionService) readWorkbook(ctx context.Context, revision *models.DocumentRevision) (*office.Workbook, error) {
+	if baseContentType(revision.ContentType) != contentTypeXLSX && strings.ToLower(filepath.Ext(revision.Name)) != ".xlsx" {
+		return nil, errExtractionUnsupported
+	}
+	if revision.Size > ExtractionMaxSourceSize {
+		return nil, fmt.Errorf("книга больше %d МБ", ExtractionMaxSourceSize>>20)
+	}
+	source, err := s.docs.openTemp(ctx, revision, ExtractionMaxSourceSize)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(source.Name())
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return office.ReadWorkbook(source, info.Size(), extractionReadOptions)
+}
+
+// targetTask задача проекта, поле которой заполняет правило: задача документа, если это она,
+// иначе задача проекта с кодом правила
+func (s *DocumentExtractionService) targetTask(doc *models.ProjectDocument, taskCode string) (*models.ProjectTask, error) {
+	var task models.ProjectTask
+	query := s.db.Where("\"ProjectId\" = ? AND \"Code\" = ?", doc.ProjectID, taskCode)
+	if doc.TaskID != nil {
+		query = query.Order(gorm.Expr("CASE WHEN \"Id\" = ? THEN 0 ELSE 1 END", *doc.TaskID))
+	}
+	err := query.Order("\"Id\"").First(&task).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// fillEmpty заполняет поле задачи, только если оно пустое: введенное вручную значение не перезаписывается
+func (s *DocumentExtractionService) fillEmpty(taskID uint, field string, value float64) (bool, error) {
+	column := extractionFields[field]
+	result := s.db.Model(&models.ProjectTask{}).
+		Where(fmt.Sprintf("\"Id\" = ? AND %q IS NULL", column), taskID).
+		UpdateColumn(column, value)
+	return result.RowsAffected > 0, result.Error
+}
+
+// compare заполняет TaskValue и Mismatch по текущим значениям полей задач
+func (s *DocumentExtractionService) compare(extractions []models.DocumentExtraction) error {
+	taskIDs := make([]uint, 0)
+	for _, e := range extractions {
+		if e.TaskID != nil {
+			taskIDs = append(taskIDs, *e.TaskID)
+		}
+	}
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	var tasks []models.ProjectTask
+	if err := s.db.Where("\"Id\" IN ?", taskIDs).Find(&tasks).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*models.ProjectTask, len(tasks))
+	for i := range tasks {
+		byID[tasks[i].ID] = &tasks[i]
+	}
+	for i := range extractions {
+		e := &extractions[i]
+		if e.TaskID == nil || byID[*e.TaskID] == nil {
+			continue
+		}
+		e.TaskValue = taskFieldValue(byID[*e.TaskID], e.Field)
+		e.Mismatch = e.Value != nil && e.TaskValue != nil && math.Abs(*e.Value-*e.TaskValue) >= extractionTolerance
+	}
+	return nil
+}
+
+func taskFieldValue(task *models.ProjectTask, field string) *float64 {
+	switch field {
+	case "equipmentCostNoVat":
+		return task.EquipmentCostNoVat
+	case "securityBudgetNoVat":
+		return task.SecurityBudgetNoVat
+	case "rsrBudgetNoVat":
+		return task.RsrBudgetNoVat
+	case "pisBudgetNoVat":
+		return task.PisBudgetNoVat
+	case "totalBudgetNoVat":
+		return task.TotalBudgetNoVat
+	}
+	return nil
+}
+
+func normalizeExtractionRule(rule *models.DocumentExtractionRule) error {
+	rule.TaskCode = strings.TrimSpace(rule.TaskCode)
+	rule.Field = strings.TrimSpace(rule.Field)
+	rule.Sheet = strings.TrimSpace(rule.Sheet)
+	rule.Cell = strings.ToUpper(strings.TrimSpace(rule.Cell))
+	rule.DefinedName = strings.TrimSpace(rule.DefinedName)
+	rule.Label = strings.TrimSpace(rule.Label)
+
+	locators := 0
+	for _, value := range []string{rule.Cell, rule.DefinedName, rule.Label} {
+		if value != "" {
+			locators++
+		}
+	}
+	if _, ok := extractionFields[rule.Field]; !ok || rule.TaskCode == "" || locators != 1 {
+		return ErrExtractionRuleInvalid
+	}
+	if rule.Cell != "" {
+		if _, _, err := office.ParseCellRef(rule.Cell); err != nil {
+			return fmt.Errorf("%w: %v", ErrExtractionRuleInvalid, err)
+		}
+	}
+	return nil
+}
+
+// groupRulesByField правила, сгруппированные по полю задачи, в порядке первого правила
+func groupRulesByField(rules []models.DocumentExtractionRule) [][]models.DocumentExtractionRule {
+	var groups [][]models.DocumentExtractionRule
+	index := make(map[string]int)
+	for _, rule := range rules {
+		key := rule.TaskCode + "|" + rule.Field
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], rule)
+	}
+	return groups
+}
+
+// findRuleValue ищет число по правилу; location — лист и ячейка найденного значения
+func findRuleValue(workbook *office.Workbook, rule models.DocumentExtractionRule) (float64, string, bool) {
+	switch {
+	case rule.DefinedName != "":
+		sheet, ref, ok := workbook.Name(rule.DefinedName)
+		if !ok {
+			return 0, "", false
+		}
+		return cellNumber(sheet, ref)
+	case rule.Cell != "":
+		for _, sheet := range ruleSheets(workbook, rule.Sheet) {
+			if value, location, ok := cellNumber(sheet, rule.Cell); ok {
+				return value, location, true
+			}
+		}
+	case rule.Label != "":
+		label := normalizeLabel(rule.Label)
+		for _, sheet := range ruleSheets(workbook, rule.Sheet) {
+			if value, location, ok := labelNumber(sheet, label); ok {
+				return value, location, true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// ruleSheets лист правила или все листы книги, если лист не указан
+func ruleSheets(workbook *office.Workbook, name string) []*office.Sheet {
+	if name == "" {
+		return workbook.Sheets
+	}
+	if sheet := workbook.Sheet(name); sheet != nil {
+		return []*office.Sheet{sheet}
+	}
+	return nil
+}
+
+func cellNumber(sheet *office.Sheet, ref string) (float64, string, bool) {
+	value, err := sheet.Cell(ref)
+	if err != nil {
+		return 0, "", false
+	}
+	number, ok := parseAmount(value)
+	return number, sheet.Name + "!" + strings.ToUpper(ref), ok
+}
+
+// labelNumber находит ячейку с подписью и берет первое число справа от нее в той же строке,
+// а если там чисел нет — первое число под ней
+func labelNumber(sheet *office.Sheet, label string) (float64, string, bool) {
+	for r, row := range sheet.Rows {
+		for c, text := range row {
+			if text == "" || !strings.Contains(normalizeLabel(text), label) {
+				continue
+			}
+			for right := c + 1; right < len(row); right++ {
+				if number, ok := parseAmount(row[right]); ok {
+					return number, sheet.Name + "!" + office.CellRef(r, right), true
+				}
+			}
+			for below := r + 1; below < len(sheet.Rows); below++ {
+				if number, ok := parseAmount(sheet.Value(below, c)); ok {
+					return number, sheet.Name + "!" + office.CellRef(below, c), true
+				}
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// normalizeLabel приводит подпись к виду для сравнения: нижний регистр, одиночные пробелы
+func normalizeLabel(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// parseAmount разбирает сумму: число из ячейки ("1250000.5") или текст ("1 250 000,50 руб.").
+// Текст с другими словами — не сумма: "Итого 2 позиции" не читается как 2
+func parseAmount(text string) (float64, bool) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, currency := range []string{"₽", "руб.", "руб", "р."} {
+		if trimmed := strings.TrimSuffix(text, currency); trimmed != text {
+			text = trimmed
+			break
+		}
+	}
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return -1
+		case r == ',':
+			return '.'
+		}
+		return r
+	}, text)
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,145 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentExtractionService(t *testing.T) {
+	db := setupTestDB(t)
+	files, _ := newTestS3(t)
+	docs := services.NewDocumentService(db, files)
+	extractions := services.NewDocumentExtractionService(db, docs)
+	docs.SetExtractionService(extractions)
+	require.NoError(t, database.SeedDocumentTypes(db))
+	require.NoError(t, database.SeedExtractionRules(db))
+	ctx := context.Background()
+
+	equipCode, securityCode := "TASK-BUDGET-EQUIP", "TASK-BUDGET-SECURITY"
+	typed := 900000.0
+	equip := models.ProjectTask{ProjectID: 1, Name: "Расчет бюджета оборудования", Code: &equipCode}
+	security := models.ProjectTask{ProjectID: 1, Name: "Расчет бюджета СБ", Code: &securityCode, SecurityBudgetNoVat: &typed}
+	require.NoError(t, db.Create(&equip).Error)
+	require.NoError(t, db.Create(&security).Error)
+
+	upload := func(typeCode, name string, data []byte) *models.ProjectDocument {
+		doc := &models.ProjectDocument{ProjectID: 1, Type: typeCode, TypeCode: typeCode}
+		require.NoError(t, docs.Upload(ctx, doc, services.DocumentUpload{Name: name, Size: int64(len(data))}, bytes.NewReader(data)))
+		return doc
+	}
+	calculation := func(total string) []byte {
+		return testWorkbook(t, []string{"Позиция", "Итого  без НДС:", "Итого 2 позиции"}, nil,
+			[2]string{"Расчет", `<row r="1"><c r="A1" t="s"><v>0</v></c></row>` +
+				`<row r="5"><c r="A5" t="s"><v>2</v></c><c r="B5"><v>7</v></c></row>` +
+				`<row r="10"><c r="A10" t="s"><v>1</v></c><c r="B10" t="inlineStr"><is><t>—</t></is></c>` +
+				`<c r="C10" t="inlineStr"><is><t>` + total + `</t></is></c></row>`})
+	}
+
+	// Пустое поле задачи заполняется суммой, найденной справа от подписи
+	upload("equipment-budget", "equipment.xlsx", calculation("1 250 000,50 руб."))
+	require.NoError(t, db.First(&equip, equip.ID).Error)
+	require.NotNil(t, equip.EquipmentCostNoVat)
+	assert.Equal(t, 1250000.5, *equip.EquipmentCostNoVat)
+
+	list, err := extractions.GetForTask(equip.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, models.ExtractionFound, list[0].Status)
+	assert.Equal(t, "Расчет!C10", list[0].Location)
+	assert.True(t, list[0].AutoFilled)
+	assert.False(t, list[0].Mismatch)
+
+	// Введенное вручную значение не перезаписывается, расхождение помечается
+	securityDoc := upload("security-budget", "security.xlsx", calculation("950000"))
+	require.NoError(t, db.First(&security, security.ID).Error)
+	assert.Equal(t, typed, *security.SecurityBudgetNoVat)
+	list, err = extractions.GetForTask(security.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.False(t, list[0].AutoFilled)
+	assert.True(t, list[0].Mismatch)
+	assert.Equal(t, typed, *list[0].TaskValue)
+
+	// Пользователь принимает значение из документа
+	applied, err := extractions.Apply(security.ID, list[0].ID)
+	require.NoError(t, err)
+	assert.False(t, applied.Mismatch)
+	require.NoError(t, db.First(&security, security.ID).Error)
+	assert.Equal(t, 950000.0, *security.SecurityBudgetNoVat)
+	_, err = extractions.Apply(equip.ID, list[0].ID)
+	assert.ErrorIs(t, err, services.ErrExtractionNotFound)
+
+	// Правило по именованной ячейке проверяется раньше поиска по подписи
+	rule := models.DocumentExtractionRule{TaskCode: securityCode, Field: "securityBudgetNoVat", DefinedName: "Total", Order: -1, AutoFill: true, IsActive: true}
+	require.NoError(t, extractions.CreateRule("security-budget", &rule))
+	named := testWorkbook(t, nil, map[string]string{"Total": "'Свод'!$D$4"},
+		[2]string{"Свод", `<row r="4"><c r="D4"><v>1000000</v></c></row>`})
+	_, err = docs.AddRevision(ctx, securityDoc, services.DocumentUpload{Name: "security-v2.xlsx", Size: int64(len(named))}, bytes.NewReader(named))
+	require.NoError(t, err)
+	list, err = extractions.GetForTask(security.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 2, list[0].Version)
+	assert.Equal(t, rule.ID, *list[0].RuleID)
+	assert.Equal(t, "Свод!D4", list[0].Location)
+	assert.True(t, list[0].Mismatch)
+
+	// Ячейка листа; без автозаполнения значение только предлагается
+	cell := models.DocumentExtractionRule{TaskCode: securityCode, Field: "rsrBudgetNoVat", Sheet: "свод", Cell: "d4", AutoFill: true, IsActive: true}
+	require.NoError(t, extractions.CreateRule("security-budget", &cell))
+	cell.AutoFill = false
+	updated, err := extractions.UpdateRule("security-budget", cell.ID, cell)
+	require.NoError(t, err)
+	assert.Equal(t, "D4", updated.Cell)
+	extracted, err := extractions.ExtractCurrent(ctx, securityDoc)
+	require.NoError(t, err)
+	require.Len(t, extracted, 2)
+	assert.Equal(t, "rsrBudgetNoVat", extracted[1].Field)
+	assert.Equal(t, 1000000.0, *extracted[1].Value)
+	assert.False(t, extracted[1].AutoFilled)
+	require.NoError(t, db.First(&security, security.ID).Error)
+	assert.Nil(t, security.RsrBudgetNoVat)
+
+	// Старые книги .xls не читаются: нужно пересохранить в .xlsx
+	legacy := upload("equipment-budget", "equipment.xls", []byte("\xd0\xcf\x11\xe0"))
+	rows, err := extractions.ExtractCurrent(ctx, legacy)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, models.ExtractionUnsupported, rows[0].Status)
+
+	// Книга без подписи: значение не найдено
+	blank := upload("equipment-budget", "blank.xlsx", testWorkbook(t, nil, nil, [2]string{"Лист1", ``}))
+	rows, err = extractions.ExtractCurrent(ctx, blank)
+	require.NoError(t, err)
+	assert.Equal(t, models.ExtractionNotFound, rows[0].Status)
+	assert.Nil(t, rows[0].Value)
+
+	// Книга сверх ограничений чтения не разбирается: здесь — больше 200 000 общих строк
+	parts := workbookParts(t, testWorkbook(t, nil, nil, [2]string{"Лист1", ``}))
+	bomb := upload("equipment-budget", "bomb.xlsx", zipBomb(t, parts, "xl/sharedStrings.xml", `<sst>`, `<si/>`, `</sst>`, 1<<20))
+	rows, err = extractions.ExtractCurrent(ctx, bomb)
+	require.NoError(t, err)
+	assert.Equal(t, models.ExtractionFailed, rows[0].Status)
+	assert.Contains(t, rows[0].Error, "общих строк")
+
+	// Проверка правил
+	assert.ErrorIs(t, extractions.CreateRule("security-budget", &models.DocumentExtractionRule{TaskCode: securityCode, Field: "name", Cell: "A1"}), services.ErrExtractionRuleInvalid)
+	assert.ErrorIs(t, extractions.CreateRule("security-budget", &models.DocumentExtractionRule{TaskCode: securityCode, Field: "rsrBudgetNoVat", Cell: "A1", Label: "Итого"}), services.ErrExtractionRuleInvalid)
+	assert.ErrorIs(t, extractions.CreateRule("security-budget", &models.DocumentExtractionRule{TaskCode: securityCode, Field: "rsrBudgetNoVat", Cell: "1A"}), services.ErrExtractionRuleInvalid)
+	assert.ErrorIs(t, extractions.CreateRule("no-such-type", &models.DocumentExtractionRule{TaskCode: securityCode, Field: "rsrBudgetNoVat", Cell: "A1"}), services.ErrUnknownDocumentType)
+	assert.ErrorIs(t, extractions.DeleteRule("equipment-budget", rule.ID), services.ErrExtractionRuleNotFound)
+
+	// Извлеченные значения удаляются вместе с документом
+	require.NoError(t, docs.Remove(ctx, securityDoc))
+	list, err = extractions.GetForTask(security.ID)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
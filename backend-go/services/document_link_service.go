@@ -0,0 +1,320 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"portal-razvitie/models"
+
+	"gorm.io/gorm"
+)
+
+// Ошибки подписанных ссылок на документы
+var (
+	ErrDocumentLinkInvalid  = errors.New("ссылка недействительна")
+	ErrDocumentLinkExpired  = errors.New("срок действия ссылки истек")
+	ErrDocumentLinkUsed     = errors.New("одноразовая ссылка уже использована")
+	ErrDocumentLinkRevoked  = errors.New("ссылка отозвана")
+	ErrDocumentLinkNotFound = errors.New("ссылка не найдена")
+	ErrDocumentLinkTTL      = errors.New("срок действия ссылки — от минуты до 7 дней")
+)
+
+// Срок действия ссылок
+const (
+	DefaultDocumentLinkTTL = 24 * time.Hour
+	MinDocumentLinkTTL     = time.Minute
+	MaxDocumentLinkTTL     = 7 * 24 * time.Hour
+)
+
+// DocumentLinkInput параметры ссылки; Version 0 — текущая версия документа
+type DocumentLinkInput struct {
+	Version   int    `json:"version"`
+	ExpiresIn int    `json:"expiresIn"` // Секунд; 0 — сутки
+	SingleUse bool   `json:"singleUse"`
+	Recipient string `json:"recipient"`
+}
+
+// IssuedDocumentLink выпущенная ссылка; токен возвращается только один раз
+type IssuedDocumentLink struct {
+	models.DocumentLink
+	Token string `json:"token"`
+}
+
+// DocumentLinkClient кто обращается по ссылке, для журнала
+type DocumentLinkClient struct {
+	IP        string
+	UserAgent string
+}
+
+// RedeemedDocumentLink проверенная ссылка и версия документа, которую она открывает
+type RedeemedDocumentLink struct {
+	Link     models.DocumentLink
+	Revision models.DocumentRevision
+}
+
+// documentLinkClaims содержимое токена: версия документа, срок и одноразовость подписаны,
+// поэтому подделку и истекшую ссылку можно отклонить без обращения к БД
+type documentLinkClaims struct {
+	LinkID     uint
+	DocumentID uint
+	Version    int
+	ExpiresAt  int64
+	SingleUse  bool
+}
+
+// DocumentLinkService выпускает подписанные ссылки на скачивание документа без входа в портал
+// (подрядчику, в письмо) и проверяет их. Каждое обращение, в том числе отклоненное, пишется
+// в журнал DocumentLinkAccesses. Ключ подписи должен быть одинаковым на всех репликах
+type DocumentLinkService struct {
+	db   *gorm.DB
+	docs *DocumentService
+	key  []byte
+	now  func() time.Time
+}
+
+func NewDocumentLinkService(db *gorm.DB, docs *DocumentService, secret string) *DocumentLinkService {
+	key := sha256.Sum256([]byte(secret))
+	return &DocumentLinkService{db: db, docs: docs, key: key[:], now: time.Now}
+}
+
+// Issue выпускает ссылку на версию документа
+func (s *DocumentLinkService) Issue(doc *models.ProjectDocument, user *models.User, input DocumentLinkInput) (*IssuedDocumentLink, error) {
+	ttl := DefaultDocumentLinkTTL
+	if input.ExpiresIn != 0 {
+		ttl = time.Duration(input.ExpiresIn) * time.Second
+	}
+	if ttl < MinDocumentLinkTTL || ttl > MaxDocumentLinkTTL {
+		return nil, ErrDocumentLinkTTL
+	}
+	version := input.Version
+	if version == 0 {
+		version = doc.Version
+	}
+	if _, err := s.revisionOf(doc, version); err != nil {
+		return nil, err
+	}
+
+	link := models.DocumentLink{
+		DocumentID:  doc.ID,
+		Version:     version,
+		SingleUse:   input.SingleUse,
+		Recipient:   strings.TrimSpace(input.Recipient),
+		ExpiresAt:   s.now().Add(ttl).Truncate(time.Second),
+		CreatedByID: user.ID,
+		CreatedBy:   user.Name,
+		CreatedAt:   s.now(),
+	}
+	if err := s.db.Create(&link).Error; err != nil {
+		return nil, err
+	}
+	return &IssuedDocumentLink{DocumentLink: link, Token: s.sign(claimsOf(&link))}, nil
+}
+
+// GetLinks возвращает ссылки документа с журналом обращений, начиная с последней
+func (s *DocumentLinkService) GetLinks(documentID uint) ([]models.DocumentLink, error) {
+	links := make([]models.DocumentLink, 0)
+	err := s.db.Where("\"DocumentId\" = ?", documentID).
+		Preload("Accesses", func(db *gorm.DB) *gorm.DB { return db.Order("\"AccessedAt\" DESC") }).
+		Order("\"CreatedAt\" DESC").Find(&links).Error
+	return links, err
+}
+
+// Revoke отзывает ссылку документа; повторный отзыв не меняет время отзыва
+func (s *DocumentLinkService) Revoke(documentID, linkID uint) error {
+	result := s.db.Model(&models.DocumentLink{}).
+		Where("\"Id\" = ? AND \"DocumentId\" = ?", linkID, documentID).
+		Update("RevokedAt", gorm.Expr("COALESCE(\"RevokedAt\", ?)", s.now()))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDocumentLinkNotFound
+	}
+	return nil
+}
+
+// Redeem проверяет токен и возвращает версию документа для скачивания. Одноразовая ссылка
+// отмечается использованной до отдачи файла, чтобы два одновременных запроса не получили его оба.
+// Результат проверки пишется в журнал. Токены с неверной подписью только попадают в лог сервера:
+// адрес открыт без авторизации, и журнал не должен расти от подобранных токенов
+func (s *DocumentLinkService) Redeem(token string, client DocumentLinkClient) (*RedeemedDocumentLink, error) {
+	claims, err := s.verify(token)
+	if err != nil {
+		log.Printf("⚠️ Document link rejected: invalid token from %s", client.IP)
+		return nil, err
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		s.logAccess(&claims.LinkID, models.DocumentLinkExpired, client)
+		return nil, ErrDocumentLinkExpired
+	}
+
+	redeemed, result, err := s.redeem(claims)
+	if err != nil && result == "" {
+		return nil, err
+	}
+	linkID := &claims.LinkID
+	if result == models.DocumentLinkInvalid {
+		linkID = nil // Ссылки уже нет: журнал не может на нее ссылаться
+	}
+	s.logAccess(linkID, result, client)
+	return redeemed, err
+}
+
+// Release снова открывает одноразовую ссылку, если файл по ней не удалось отдать.
+// Отметку об использовании ставит только один запрос (Redeem), поэтому снимает ее тот же запрос
+func (s *DocumentLinkService) Release(link *models.DocumentLink) error {
+	if !link.SingleUse || link.UsedAt == nil {
+		return nil
+	}
+	err := s.db.Model(&models.DocumentLink{}).
+		Where("\"Id\" = ?", link.ID).
+		Update("UsedAt", nil).Error
+	if err != nil {
+		return err
+	}
+	link.UsedAt = nil
+	return nil
+}
+
+// redeem проверяет ссылку по БД; result — итог для журнала, пусто при сбое БД
+func (s *DocumentLinkService) redeem(claims *documentLinkClaims) (*RedeemedDocumentLink, string, error) {
+	var link models.DocumentLink
+	err := s.db.Where("\"Id\" = ? AND \"DocumentId\" = ?", claims.LinkID, claims.DocumentID).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.DocumentLinkInvalid, ErrDocumentLinkInvalid
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if link.RevokedAt != nil {
+		return nil, models.DocumentLinkRevoked, ErrDocumentLinkRevoked
+	}
+
+	doc, err := s.docs.GetByID(int(link.DocumentID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.DocumentLinkInvalid, ErrDocumentLinkInvalid
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	revision, err := s.revisionOf(doc, link.Version)
+	if errors.Is(err, ErrRevisionNotFound) {
+		return nil, models.DocumentLinkInvalid, ErrDocumentLinkInvalid
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if link.SingleUse {
+		now := s.now()
+		result := s.db.Model(&models.DocumentLink{}).
+			Where("\"Id\" = ? AND \"UsedAt\" IS NULL", link.ID).
+			Update("UsedAt", now)
+		if result.Error != nil {
+			return nil, "", result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, models.DocumentLinkUsed, ErrDocumentLinkUsed
+		}
+		link.UsedAt = &now
+	}
+	return &RedeemedDocumentLink{Link: link, Revision: *revision}, models.DocumentLinkServed, nil
+}
+
+// revisionOf версия документа; документ без истории версий описывает свой файл сам
+func (s *DocumentLinkService) revisionOf(doc *models.ProjectDocument, version int) (*models.DocumentRevision, error) {
+	revision, err := s.docs.GetRevision(doc.ID, version)
+	if errors.Is(err, ErrRevisionNotFound) && version == doc.Version {
+		var count int64
+		if err := s.db.Model(&models.DocumentRevision{}).Where("\"DocumentId\" = ?", doc.ID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return &models.DocumentRevision{
+				DocumentID: doc.ID, Number: doc.Version, Name: doc.Name, FileName: doc.FileName,
+				FilePath: doc.FilePath, StorageKey: doc.StorageKey, ContentType: doc.ContentType,
+				Size: doc.Size, SHA256: doc.SHA256, UploadedBy: doc.Author, CreatedAt: doc.UploadDate,
+			}, nil
+		}
+	}
+	return revision, err
+}
+
+func (s *DocumentLinkService) logAccess(linkID *uint, result string, client DocumentLinkClient) {
+	access := models.DocumentLinkAccess{
+		LinkID:     linkID,
+		Result:     result,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		AccessedAt: s.now(),
+	}
+	if err := s.db.Create(&access).Error; err != nil {
+		log.Printf("⚠️ Failed to log document link access: %v", err)
+	}
+}
+
+func claimsOf(link *models.DocumentLink) *documentLinkClaims {
+	return &documentLinkClaims{
+		LinkID:     link.ID,
+		DocumentID: link.DocumentID,
+		Version:    link.Version,
+		ExpiresAt:  link.ExpiresAt.Unix(),
+		SingleUse:  link.SingleUse,
+	}
+}
+
+// sign кодирует токен: "<данные>.<HMAC-SHA256>", обе части в base64url
+func (s *DocumentLinkService) sign(claims *documentLinkClaims) string {
+	single := "0"
+	if claims.SingleUse {
+		single = "1"
+	}
+	payload := fmt.Sprintf("%d:%d:%d:%d:%s", claims.LinkID, claims.DocumentID, claims.Version, claims.ExpiresAt, single)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded))
+}
+
+func (s *DocumentLinkService) verify(token string) (*documentLinkClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrDocumentLinkInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return nil, ErrDocumentLinkInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrDocumentLinkInvalid
+	}
+	parts := strings.Split(string(payload), ":")
+	if len(parts) != 5 {
+		return nil, ErrDocumentLinkInvalid
+	}
+	var numbers [4]int64
+	for i := range numbers {
+		if numbers[i], err = strconv.ParseInt(parts[i], 10, 64); err != nil {
+			return nil, ErrDocumentLinkInvalid
+		}
+	}
+	return &documentLinkClaims{
+		LinkID:     uint(numbers[0]),
+		DocumentID: uint(numbers[1]),
+		Version:    int(numbers[2]),
+		ExpiresAt:  numbers[3],
+		SingleUse:  parts[4] == "1",
+	}, nil
+}
+
+func (s *DocumentLinkService) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
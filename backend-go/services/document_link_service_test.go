@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentLinkService(t *testing.T) {
+	db := setupTestDB(t)
+	files, _ := newTestS3(t)
+	docs := services.NewDocumentService(db, files)
+	links := services.NewDocumentLinkService(db, docs, "secret")
+	ctx := context.Background()
+	user := &models.User{ID: 5, Name: "Иванов"}
+	client := services.DocumentLinkClient{IP: "10.0.0.7", UserAgent: "curl/8"}
+
+	doc := models.ProjectDocument{ProjectID: 1, Type: "Чертеж"}
+	require.NoError(t, docs.Upload(ctx, &doc, services.DocumentUpload{Name: "plan.pdf", Size: 2}, strings.NewReader("v1")))
+	_, err := docs.AddRevision(ctx, &doc, services.DocumentUpload{Name: "plan.pdf", Size: 2}, strings.NewReader("v2"))
+	require.NoError(t, err)
+
+	// Срок действия ограничен, версия должна существовать
+	_, err = links.Issue(&doc, user, services.DocumentLinkInput{ExpiresIn: 8 * 24 * 3600})
+	assert.ErrorIs(t, err, services.ErrDocumentLinkTTL)
+	_, err = links.Issue(&doc, user, services.DocumentLinkInput{Version: 7})
+	assert.ErrorIs(t, err, services.ErrRevisionNotFound)
+
+	// Ссылка без версии открывает текущую; многоразовую можно открыть несколько раз
+	current, err := links.Issue(&doc, user, services.DocumentLinkInput{Recipient: "Подрядчик"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, current.Version)
+	for i := 0; i < 2; i++ {
+		redeemed, err := links.Redeem(current.Token, client)
+		require.NoError(t, err)
+		assert.Equal(t, 2, redeemed.Revision.Number)
+	}
+
+	// Одноразовая ссылка на первую версию
+	once, err := links.Issue(&doc, user, services.DocumentLinkInput{Version: 1, SingleUse: true, ExpiresIn: 600})
+	require.NoError(t, err)
+	redeemed, err := links.Redeem(once.Token, client)
+	require.NoError(t, err)
+	assert.Equal(t, 1, redeemed.Revision.Number)
+	content, err := docs.OpenRevision(ctx, &redeemed.Revision)
+	require.NoError(t, err)
+	content.Close()
+	_, err = links.Redeem(once.Token, client)
+	assert.ErrorIs(t, err, services.ErrDocumentLinkUsed)
+
+	// Подпись защищает версию и срок; чужой ключ не подходит
+	payload, signature, _ := strings.Cut(current.Token, ".")
+	raw, _ := base64.RawURLEncoding.DecodeString(payload)
+	forged := strings.Replace(string(raw), ":2:", ":1:", 1)
+	_, err = links.Redeem(base64.RawURLEncoding.EncodeToString([]byte(forged))+"."+signature, client)
+	assert.ErrorIs(t, err, services.ErrDocumentLinkInvalid)
+	_, err = services.NewDocumentLinkService(db, docs, "other").Redeem(current.Token, client)
+	assert.ErrorIs(t, err, services.ErrDocumentLinkInvalid)
+	_, err = links.Redeem("garbage", client)
+	assert.ErrorIs(t, err, services.ErrDocumentLinkInvalid)
+
+	// Отозванная ссылка больше не открывается; отозвать можно только ссылку этого документа
+	assert.ErrorIs(t, links.Revoke(doc.ID+1, current.ID), services.ErrDocumentLinkNotFound)
+	require.NoError(t, links.Revoke(doc.ID, current.ID))
+	_, err = links.Redeem(current.Token, client)
+	assert.ErrorIs(t, err, services.ErrDocumentLinkRevoked)
+
+	// Каждое обращение по действительной ссылке в журнале, включая отклоненные
+	list, err := links.GetLinks(doc.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	results := func(link models.DocumentLink) []string {
+		var out []string
+		for _, access := range link.Accesses {
+			out = append(out, access.Result)
+			assert.Equal(t, "10.0.0.7", access.IP)
+		}
+		return out
+	}
+	byID := map[uint]models.DocumentLink{list[0].ID: list[0], list[1].ID: list[1]}
+	assert.ElementsMatch(t, []string{models.DocumentLinkServed, models.DocumentLinkServed, models.DocumentLinkRevoked}, results(byID[current.ID]))
+	assert.ElementsMatch(t, []string{models.DocumentLinkServed, models.DocumentLinkUsed}, results(byID[once.ID]))
+	assert.NotNil(t, byID[once.ID].UsedAt)
+	assert.NotNil(t, byID[current.ID].RevokedAt)
+
+	// Поддельные токены в журнал не попадают
+	var rejected int64
+	require.NoError(t, db.Model(&models.DocumentLinkAccess{}).Where("\"LinkId\" IS NULL").Count(&rejected).Error)
+	assert.Zero(t, rejected)
+
+	// Если файл не удалось отдать, одноразовая ссылка снова открывается
+	retry, err := links.Issue(&doc, user, services.DocumentLinkInput{SingleUse: true, ExpiresIn: 600})
+	require.NoError(t, err)
+	redeemed, err = links.Redeem(retry.Token, client)
+	require.NoError(t, err)
+	require.NoError(t, links.Release(&redeemed.Link))
+	_, err = links.Redeem(retry.Token, client)
+	require.NoError(t, err)
+}
@@ -0,0 +1,442 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/office"
+	"portal-razvitie/preview"
+	"portal-razvitie/storage"
+
+	"gorm.io/gorm"
+)
+
+// Ограничения предпросмотра
+const (
+	PreviewMaxSourceSize = 200 << 20 // Файлы больше не обрабатываются
+	PreviewTableRows     = 100       // Строк каждого листа в предпросмотре книги
+	PreviewTableCols     = 30
+	PreviewTextLength    = 1 << 20 // Байт текста документа для предпросмотра и поиска
+)
+
+const (
+	previewMaxAttempts = 3
+	// previewStaleAfter обработка дольше этого считается прерванной (перезапуск реплики)
+	previewStaleAfter = 10 * time.Minute
+	previewTimeout    = 2 * time.Minute
+)
+
+// PreviewSheet лист книги в предпросмотре
+type PreviewSheet struct {
+	Name      string     `json:"name"`
+	Hidden    bool       `json:"hidden"`
+	Rows      [][]string `json:"rows"`
+	TotalRows int        `json:"totalRows"`
+	TotalCols int        `json:"totalCols"`
+}
+
+// PreviewTableData содержимое предпросмотра книги Excel
+type PreviewTableData struct {
+	Sheets []PreviewSheet `json:"sheets"`
+}
+
+// DocumentPreviewService строит предпросмотры версий документов в фоне: миниатюры изображений
+// и первой страницы PDF, таблицу листов .xlsx и текст .docx. Заодно сохраняется текст версии
+// для поиска. Очередь — строки DocumentPreviews в состоянии pending, поэтому задания
+// переживают перезапуск и разбираются любой репликой
+type DocumentPreviewService struct {
+	db      *gorm.DB
+	docs    *DocumentService
+	pdf     preview.PDFRenderer
+	pdfText preview.PDFTextExtractor
+	wakeup  chan struct{}
+}
+
+// NewDocumentPreviewService создает сервис; pdf nil — миниатюры PDF не строятся
+func NewDocumentPreviewService(db *gorm.DB, docs *DocumentService, pdf preview.PDFRenderer) *DocumentPreviewService {
+	return &DocumentPreviewService{db: db, docs: docs, pdf: pdf, wakeup: make(chan struct{}, 1)}
+}
+
+// SetPDFTextExtractor включает извлечение текстового слоя PDF для поиска
+func (s *DocumentPreviewService) SetPDFTextExtractor(extractor preview.PDFTextExtractor) {
+	s.pdfText = extractor
+}
+
+// Enqueue ставит версию в очередь на построение предпросмотра
+func (s *DocumentPreviewService) Enqueue(revision *models.DocumentRevision) error {
+	var existing models.DocumentPreview
+	err := s.db.Where("\"RevisionId\" = ?", revision.ID).First(&existing).Error
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	p := models.DocumentPreview{
+		DocumentID: revision.DocumentID,
+		RevisionID: revision.ID,
+		Version:    revision.Number,
+		Status:     models.PreviewPending,
+	}
+	if err := s.db.Create(&p).Error; err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Get возвращает предпросмотр версии документа. Для версий, загруженных до появления
+// предпросмотров, построение ставится в очередь при первом запросе
+func (s *DocumentPreviewService) Get(documentID uint, version int) (*models.DocumentPreview, error) {
+	revision, err := s.docs.GetRevision(documentID, version)
+	if err != nil {
+		return nil, err
+	}
+	var p models.DocumentPreview
+	err = s.db.Where("\"RevisionId\" = ?", revision.ID).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := s.Enqueue(revision); err != nil {
+			return nil, err
+		}
+		err = s.db.Where("\"RevisionId\" = ?", revision.ID).First(&p).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Open открывает файл готового предпросмотра. Если файла нет (например, после переноса
+// хранилища), предпросмотр ставится в очередь заново и возвращается storage.ErrNotFound
+func (s *DocumentPreviewService) Open(ctx context.Context, p *models.DocumentPreview) (io.ReadCloser, error) {
+	content, _, err := s.docs.files.Get(ctx, p.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		if resetErr := s.reset(p); resetErr != nil {
+			log.Printf("⚠️ Failed to requeue preview %d: %v", p.ID, resetErr)
+		}
+	}
+	return content, err
+}
+
+// ProcessPending строит все ожидающие предпросмотры и возвращает их число
+func (s *DocumentPreviewService) ProcessPending(ctx context.Context) (int, error) {
+	processed := 0
+	var lastID uint // Неудачная попытка повторяется в следующем проходе, а не сразу
+	for {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+		var p models.DocumentPreview
+		err := s.db.Where("\"Status\" = ? AND \"Id\" > ?", models.PreviewPending, lastID).Order("\"Id\"").First(&p).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return processed, nil
+		}
+		if err != nil {
+			return processed, err
+		}
+		lastID = p.ID
+		// Запись захватывает тот, кто первым сменил состояние: другие реплики ее пропустят
+		claim := s.db.Model(&models.DocumentPreview{}).
+			Where("\"Id\" = ? AND \"Status\" = ?", p.ID, models.PreviewPending).
+			Updates(map[string]interface{}{"Status": models.PreviewProcessing, "UpdatedAt": time.Now()})
+		if claim.Error != nil {
+			return processed, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		s.process(ctx, &p)
+		processed++
+	}
+}
+
+// Start запускает фоновую обработку: сразу после постановки в очередь и раз в interval —
+// для заданий других реплик и прерванных обработок
+func (s *DocumentPreviewService) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.wakeup:
+			case <-ticker.C:
+				if err := s.requeueStale(); err != nil {
+					log.Printf("⚠️ Failed to requeue stale previews: %v", err)
+				}
+			}
+			if _, err := s.ProcessPending(context.Background()); err != nil {
+				log.Printf("⚠️ Document previews processing failed: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *DocumentPreviewService) notify() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (s *DocumentPreviewService) process(ctx context.Context, p *models.DocumentPreview) {
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	updates := map[string]interface{}{"UpdatedAt": time.Now()}
+	var revision models.DocumentRevision
+	err := s.db.First(&revision, p.RevisionID).Error
+	if err == nil {
+		var result *previewResult
+		result, err = s.generate(ctx, &revision)
+		if err == nil {
+			updates["Status"] = result.status
+			updates["Kind"] = result.kind
+			updates["StorageKey"] = result.key
+			updates["ContentType"] = result.contentType
+			updates["Size"] = result.size
+			updates["Truncated"] = result.truncated
+			updates["Text"] = result.text
+			updates["Error"] = ""
+		}
+	}
+	if err != nil {
+		// Версию могли удалить вместе с документом, пока предпросмотр ждал очереди
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.db.Delete(&models.DocumentPreview{}, p.ID)
+			return
+		}
+		updates["Attempts"] = p.Attempts + 1
+		updates["Error"] = err.Error()
+		updates["Status"] = models.PreviewPending
+		if p.Attempts+1 >= previewMaxAttempts {
+			updates["Status"] = models.PreviewFailed
+		}
+		log.Printf("⚠️ Failed to build preview of document %d version %d: %v", p.DocumentID, p.Version, err)
+	}
+	if err := s.db.Model(&models.DocumentPreview{}).Where("\"Id\" = ?", p.ID).Updates(updates).Error; err != nil {
+		log.Printf("⚠️ Failed to save preview %d: %v", p.ID, err)
+	}
+}
+
+type previewResult struct {
+	status      string
+	kind        string
+	key         string
+	contentType string
+	size        int64
+	truncated   bool
+	text        string
+}
+
+// generate строит предпросмотр по типу содержимого версии и сохраняет его рядом с файлом версии
+func (s *DocumentPreviewService) generate(ctx context.Context, revision *models.DocumentRevision) (*previewResult, error) {
+	format := previewFormat(revision)
+	if format == "" || revision.Size > PreviewMaxSourceSize || (format == previewPDF && s.pdf == nil && s.pdfText == nil) {
+		return &previewResult{status: models.PreviewUnsupported}, nil
+	}
+
+	source, err := s.docs.openTemp(ctx, revision, PreviewMaxSourceSize)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(source.Name())
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &previewResult{status: models.PreviewReady, kind: previewKinds[format]}
+	var data []byte
+	switch format {
+	case previewPDF:
+		if s.pdfText != nil {
+			// Без текста документ ищется только по названию: это не повод оставлять его без миниатюры
+			if result.text, _, err = s.pdfText.ExtractText(ctx, source, PreviewTextLength); err != nil {
+				log.Printf("⚠️ Failed to extract text of document %d version %d: %v", revision.DocumentID, revision.Number, err)
+			}
+			if _, err := source.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		if s.pdf == nil {
+			return &previewResult{status: models.PreviewUnsupported, text: result.text}, nil
+		}
+		page, err := s.pdf.RenderFirstPage(ctx, source, preview.DefaultSize)
+		if err != nil {
+			return nil, err
+		}
+		data, err = preview.EncodeThumbnail(page, preview.DefaultSize)
+		if err != nil {
+			return nil, err
+		}
+		result.contentType = "image/png"
+	case previewImage:
+		data, err = preview.ImageThumbnail(source, preview.DefaultSize)
+		if errors.Is(err, preview.ErrUnsupported) {
+			return &previewResult{status: models.PreviewUnsupported}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.contentType = "image/png"
+	case previewXLSX:
+		data, result.truncated, err = tablePreview(source, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		if result.text, err = workbookText(source, info.Size()); err != nil {
+			return nil, err
+		}
+		result.contentType = "application/json"
+	case previewDOCX:
+		var text string
+		text, result.truncated, err = office.DocumentText(source, info.Size(), PreviewTextLength)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(text)
+		result.text = text
+		result.contentType = "text/plain; charset=utf-8"
+	}
+
+	result.key = s.previewKey(revision, previewExtensions[result.kind])
+	result.size = int64(len(data))
+	if err := s.docs.files.Put(ctx, result.key, bytes.NewReader(data), result.size, result.contentType); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// previewKey ключ файла предпросмотра рядом с файлом версии
+func (s *DocumentPreviewService) previewKey(revision *models.DocumentRevision, ext string) string {
+	if revision.StorageKey != "" {
+		return revision.StorageKey + ".preview" + ext
+	}
+	// Файл загружен до перехода на хранилище: предпросмотр кладется в каталог проекта
+	return fmt.Sprintf("projects/%d/%s.preview%s", s.docs.projectOf(revision.DocumentID), revision.FileName, ext)
+}
+
+func (s *DocumentPreviewService) reset(p *models.DocumentPreview) error {
+	err := s.db.Model(&models.DocumentPreview{}).Where("\"Id\" = ?", p.ID).
+		Updates(map[string]interface{}{"Status": models.PreviewPending, "Attempts": 0, "UpdatedAt": time.Now()}).Error
+	if err == nil {
+		p.Status = models.PreviewPending
+		s.notify()
+	}
+	return err
+}
+
+func (s *DocumentPreviewService) requeueStale() error {
+	return s.db.Model(&models.DocumentPreview{}).
+		Where("\"Status\" = ? AND \"UpdatedAt\" < ?", models.PreviewProcessing, time.Now().Add(-previewStaleAfter)).
+		Updates(map[string]interface{}{"Status": models.PreviewPending, "UpdatedAt": time.Now()}).Error
+}
+
+var previewExtensions = map[string]string{
+	models.PreviewThumbnail: ".png",
+	models.PreviewTable:     ".json",
+	models.PreviewText:      ".txt",
+}
+
+// Форматы файлов, для которых строится предпросмотр
+const (
+	previewImage = "image"
+	previewPDF   = "pdf"
+	previewXLSX  = "xlsx"
+	previewDOCX  = "docx"
+)
+
+var previewKinds = map[string]string{
+	previewImage: models.PreviewThumbnail,
+	previewPDF:   models.PreviewThumbnail,
+	previewXLSX:  models.PreviewTable,
+	previewDOCX:  models.PreviewText,
+}
+
+// previewFormat формат версии по типу содержимого, а для файлов без типа — по расширению;
+// пусто — предпросмотр не строится
+func previewFormat(revision *models.DocumentRevision) string {
+	switch baseContentType(revision.ContentType) {
+	case "image/jpeg", "image/png", "image/gif":
+		return previewImage
+	case "application/pdf":
+		return previewPDF
+	case contentTypeXLSX:
+		return previewXLSX
+	case contentTypeDOCX:
+		return previewDOCX
+	}
+	switch strings.ToLower(filepath.Ext(revision.Name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return previewImage
+	case ".pdf":
+		return previewPDF
+	case ".xlsx":
+		return previewXLSX
+	case ".docx":
+		return previewDOCX
+	}
+	return ""
+}
+
+// tablePreview первые строки и столбцы каждого листа книги
+func tablePreview(source io.ReaderAt, size int64) ([]byte, bool, error) {
+	workbook, err := office.ReadWorkbook(source, size, office.ReadOptions{MaxRows: PreviewTableRows, MaxCols: PreviewTableCols})
+	if err != nil {
+		return nil, false, err
+	}
+	data := PreviewTableData{Sheets: make([]PreviewSheet, 0, len(workbook.Sheets))}
+	truncated := false
+	for _, sheet := range workbook.Sheets {
+		rows := sheet.Rows
+		if rows == nil {
+			rows = [][]string{}
+		}
+		data.Sheets = append(data.Sheets, PreviewSheet{
+			Name:      sheet.Name,
+			Hidden:    sheet.Hidden,
+			Rows:      rows,
+			TotalRows: sheet.TotalRows,
+			TotalCols: sheet.TotalCols,
+		})
+		if sheet.TotalRows > PreviewTableRows || sheet.TotalCols > PreviewTableCols {
+			truncated = true
+		}
+	}
+	encoded, err := json.Marshal(data)
+	return encoded, truncated, err
+}
+
+// workbookText текст ячеек книги для поиска: листы и строки целиком, не больше PreviewTextLength байт
+func workbookText(source io.ReaderAt, size int64) (string, error) {
+	workbook, err := office.ReadWorkbook(source, size, office.ReadOptions{})
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, sheet := range workbook.Sheets {
+		for _, row := range sheet.Rows {
+			line := strings.Join(strings.Fields(strings.Join(row, " ")), " ")
+			if line == "" {
+				continue
+			}
+			if text.Len()+len(line)+1 > PreviewTextLength {
+				return strings.TrimSpace(text.String()), nil
+			}
+			text.WriteString(line)
+			text.WriteByte('\n')
+		}
+	}
+	return strings.TrimSpace(text.String()), nil
+}
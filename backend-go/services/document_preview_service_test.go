@@ -0,0 +1,331 @@
+package services_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"portal-razvitie/models"
+	"portal-razvitie/office"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zipFile собирает архив из частей: имя → содержимое (в порядке имен)
+func zipFile(t *testing.T, parts map[string]string) []byte {
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(parts[name]))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// testWorkbook книга .xlsx: листы (имя → XML данных листа) и именованные диапазоны
+func testWorkbook(t *testing.T, sharedStrings []string, names map[string]string, sheets ...[2]string) []byte {
+	parts := map[string]string{"[Content_Types].xml": "<Types/>"}
+	var workbook, rels strings.Builder
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sheet := range sheets {
+		id := string(rune('1' + i))
+		workbook.WriteString(`<sheet name="` + sheet[0] + `" sheetId="` + id + `" r:id="rId` + id + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + id + `" Target="worksheets/sheet` + id + `.xml"/>`)
+		parts["xl/worksheets/sheet"+id+".xml"] = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + sheet[1] + `</sheetData></worksheet>`
+	}
+	workbook.WriteString(`</sheets><definedNames>`)
+	for name, ref := range names {
+		workbook.WriteString(`<definedName name="` + name + `">` + ref + `</definedName>`)
+	}
+	workbook.WriteString(`</definedNames></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	parts["xl/workbook.xml"] = workbook.String()
+	parts["xl/_rels/workbook.xml.rels"] = rels.String()
+
+	var shared strings.Builder
+	shared.WriteString(`<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	for _, s := range sharedStrings {
+		shared.WriteString(`<si><t>` + s + `</t></si>`)
+	}
+	shared.WriteString(`</sst>`)
+	parts["xl/sharedStrings.xml"] = shared.String()
+	return zipFile(t, parts)
+}
+
+type fakePDFRenderer struct {
+	err error
+}
+
+func (r fakePDFRenderer) RenderFirstPage(ctx context.Context, pdf io.Reader, size int) (image.Image, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	page := image.NewGray(image.Rect(0, 0, 1240, 1754)) // A4, 150 dpi
+	for i := range page.Pix {
+		page.Pix[i] = 0xff
+	}
+	return page, nil
+}
+
+func TestDocumentPreviewService(t *testing.T) {
+	db := setupTestDB(t)
+	files, fake := newTestS3(t)
+	docs := services.NewDocumentService(db, files)
+	ctx := context.Background()
+
+	// Документ, загруженный до включения предпросмотров
+	old := models.ProjectDocument{ProjectID: 1, Type: "Фото"}
+	require.NoError(t, docs.Upload(ctx, &old, services.DocumentUpload{Name: "old.txt", Size: 3}, strings.NewReader("old")))
+
+	previews := services.NewDocumentPreviewService(db, docs, fakePDFRenderer{})
+	docs.SetPreviewService(previews)
+
+	upload := func(name, contentType string, data []byte) *models.ProjectDocument {
+		doc := &models.ProjectDocument{ProjectID: 1, Type: "Документ"}
+		require.NoError(t, docs.Upload(ctx, doc, services.DocumentUpload{Name: name, ContentType: contentType, Size: int64(len(data))}, bytes.NewReader(data)))
+		return doc
+	}
+	read := func(p *models.DocumentPreview) []byte {
+		content, err := previews.Open(ctx, p)
+		require.NoError(t, err)
+		defer content.Close()
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		return data
+	}
+
+	var photo bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	img.Set(0, 0, color.RGBA{R: 0xff, A: 0xff})
+	require.NoError(t, png.Encode(&photo, img))
+	photoDoc := upload("facade.png", "image/png", photo.Bytes())
+
+	pdfDoc := upload("plan.pdf", "application/pdf", []byte("%PDF-1.7\n..."))
+
+	workbook := testWorkbook(t, []string{"Статья", "Итого"}, nil,
+		[2]string{"Смета", `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>Сумма</t></is></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3"><f>SUM(B1:B2)</f><v>1250000.5</v></c></row>` +
+			`<row r="150"><c r="AZ150"><v>1</v></c></row>`},
+		[2]string{"Пустой", ``})
+	sheetDoc := upload("budget.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", workbook)
+
+	docx := zipFile(t, map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			`<w:p><w:r><w:t>Договор </w:t></w:r><w:r><w:t>аренды</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>Арендатор:</w:t><w:tab/><w:t>ООО «Ромашка»</w:t></w:r></w:p></w:body></w:document>`,
+	})
+	textDoc := upload("lease.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", docx)
+
+	dwgDoc := upload("plan.dwg", "image/vnd.dwg", []byte("AC1032"))
+	brokenDoc := upload("broken.xlsx", "", []byte("not a zip"))
+
+	// Построение идет после загрузки; до обработки предпросмотр ожидает очереди
+	pending, err := previews.Get(photoDoc.ID, photoDoc.Version)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewPending, pending.Status)
+
+	processed, err := previews.ProcessPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, processed)
+
+	p, err := previews.Get(photoDoc.ID, photoDoc.Version)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewReady, p.Status)
+	assert.Equal(t, models.PreviewThumbnail, p.Kind)
+	thumbnail, err := png.Decode(bytes.NewReader(read(p)))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 320, 160), thumbnail.Bounds())
+
+	p, err = previews.Get(pdfDoc.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewReady, p.Status)
+	page, err := png.Decode(bytes.NewReader(read(p)))
+	require.NoError(t, err)
+	assert.Equal(t, 320, page.Bounds().Dy())
+
+	p, err = previews.Get(sheetDoc.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewTable, p.Kind)
+	assert.True(t, p.Truncated)
+	var table services.PreviewTableData
+	require.NoError(t, json.Unmarshal(read(p), &table))
+	require.Len(t, table.Sheets, 2)
+	assert.Equal(t, "Смета", table.Sheets[0].Name)
+	assert.Equal(t, [][]string{{"Статья", "Сумма"}, nil, {"Итого", "1250000.5"}}, table.Sheets[0].Rows)
+	assert.Equal(t, 150, table.Sheets[0].TotalRows)
+	assert.Equal(t, 52, table.Sheets[0].TotalCols)
+	assert.Empty(t, table.Sheets[1].Rows)
+	assert.Equal(t, "Статья Сумма\nИтого 1250000.5\n1", p.Text)
+
+	p, err = previews.Get(textDoc.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewText, p.Kind)
+	assert.Equal(t, "Договор аренды\nАрендатор:\tООО «Ромашка»", string(read(p)))
+
+	p, err = previews.Get(dwgDoc.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewUnsupported, p.Status)
+
+	// Поврежденный файл: несколько попыток, затем ошибка
+	for i := 0; i < 2; i++ {
+		p, err = previews.Get(brokenDoc.ID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, models.PreviewPending, p.Status)
+		_, err = previews.ProcessPending(ctx)
+		require.NoError(t, err)
+	}
+	p, err = previews.Get(brokenDoc.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewFailed, p.Status)
+	assert.NotEmpty(t, p.Error)
+
+	// Старые версии получают предпросмотр при первом запросе
+	p, err = previews.Get(old.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewPending, p.Status)
+	_, err = previews.Get(old.ID, 5)
+	assert.ErrorIs(t, err, services.ErrRevisionNotFound)
+
+	// Файлы предпросмотров лежат рядом с файлами версий и удаляются вместе с документом
+	assert.Contains(t, fake.Keys("documents"), "projects/1/"+photoDoc.FileName+".preview.png")
+	require.NoError(t, docs.Remove(ctx, photoDoc))
+	for _, key := range fake.Keys("documents") {
+		assert.NotContains(t, key, photoDoc.FileName)
+	}
+	var count int64
+	require.NoError(t, db.Model(&models.DocumentPreview{}).Where("\"DocumentId\" = ?", photoDoc.ID).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestDocumentPreviewService_WithoutPDFRenderer(t *testing.T) {
+	db := setupTestDB(t)
+	files, _ := newTestS3(t)
+	docs := services.NewDocumentService(db, files)
+	previews := services.NewDocumentPreviewService(db, docs, nil)
+	docs.SetPreviewService(previews)
+	ctx := context.Background()
+
+	doc := models.ProjectDocument{ProjectID: 1, Type: "Документ"}
+	require.NoError(t, docs.Upload(ctx, &doc, services.DocumentUpload{Name: "plan.pdf", ContentType: "application/pdf", Size: 4}, strings.NewReader("%PDF")))
+	_, err := previews.ProcessPending(ctx)
+	require.NoError(t, err)
+
+	p, err := previews.Get(doc.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewUnsupported, p.Status)
+
+	// Ошибка отрисовщика — повод повторить попытку
+	failing := services.NewDocumentPreviewService(db, docs, fakePDFRenderer{err: errors.New("boom")})
+	docs.SetPreviewService(failing)
+	second, err := docs.AddRevision(ctx, &doc, services.DocumentUpload{Name: "plan.pdf", ContentType: "application/pdf", Size: 4}, strings.NewReader("%PDF"))
+	require.NoError(t, err)
+	_, err = failing.ProcessPending(ctx)
+	require.NoError(t, err)
+	p, err = failing.Get(doc.ID, second.Number)
+	require.NoError(t, err)
+	assert.Equal(t, models.PreviewPending, p.Status)
+	assert.Contains(t, p.Error, "boom")
+}
+
+// zipBomb архив с частью name, которая распаковывается в size байт повторяющегося fill
+func zipBomb(t *testing.T, parts map[string]string, name, prefix, fill, suffix string, size int) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestSpeed)
+	})
+	for part, content := range parts {
+		f, err := w.Create(part)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	f, err := w.Create(name)
+	require.NoError(t, err)
+	f.Write([]byte(prefix))
+	chunk := []byte(strings.Repeat(fill, 64<<10/len(fill)))
+	for written := 0; written < size; written += len(chunk) {
+		_, err := f.Write(chunk)
+		require.NoError(t, err)
+	}
+	f.Write([]byte(suffix))
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// workbookParts части книги без общей таблицы строк
+func workbookParts(t *testing.T, workbook []byte) map[string]string {
+	archive, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	require.NoError(t, err)
+	parts := make(map[string]string)
+	for _, f := range archive.File {
+		if f.Name == "xl/sharedStrings.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		parts[f.Name] = string(data)
+	}
+	return parts
+}
+
+// workbookBomb книга с общей таблицей строк из size байт пробелов
+func workbookBomb(t *testing.T, size int) []byte {
+	parts := workbookParts(t, testWorkbook(t, nil, nil, [2]string{"Лист1", ``}))
+	return zipBomb(t, parts, "xl/sharedStrings.xml", `<sst><si><t>`, "          ", `</t></si></sst>`, size)
+}
+
+func TestOfficeReadLimits(t *testing.T) {
+	workbook := testWorkbook(t, nil, nil, [2]string{"Лист1", ``})
+	parts := workbookParts(t, workbook)
+	read := func(data []byte, opts office.ReadOptions) error {
+		_, err := office.ReadWorkbook(bytes.NewReader(data), int64(len(data)), opts)
+		return err
+	}
+
+	// Таблица строк из 65 МБ пробелов сжимается в несколько сотен килобайт
+	bomb := workbookBomb(t, office.DefaultMaxUnzippedSize+1<<20)
+	assert.Less(t, len(bomb), 1<<20)
+	assert.ErrorIs(t, read(bomb, office.ReadOptions{}), office.ErrTooLarge)
+
+	// Число и суммарная длина общих строк ограничены отдельно от объема архива
+	many := zipBomb(t, parts, "xl/sharedStrings.xml", `<sst>`, `<si/>`, `</sst>`, 1000)
+	assert.ErrorIs(t, read(many, office.ReadOptions{MaxSharedStrings: 100}), office.ErrTooLarge)
+	long := zipBomb(t, parts, "xl/sharedStrings.xml", `<sst><si><t>`, `строка`, `</t></si></sst>`, 1<<20)
+	assert.ErrorIs(t, read(long, office.ReadOptions{MaxSharedStringsSize: 1 << 10}), office.ErrTooLarge)
+	assert.NoError(t, read(long, office.ReadOptions{}))
+
+	// Общий бюджет распространяется на все части книги
+	assert.ErrorIs(t, read(workbook, office.ReadOptions{MaxUnzippedSize: 100}), office.ErrTooLarge)
+	assert.NoError(t, read(workbook, office.ReadOptions{MaxUnzippedSize: int64(len(parts["xl/workbook.xml"])) + 4<<10}))
+
+	// Документ Word: то же ограничение по умолчанию
+	docx := zipBomb(t, nil, "word/document.xml", `<w:document><w:body><w:p><w:r><w:t>`, "          ", `</w:t></w:r></w:p></w:body></w:document>`, office.DefaultMaxUnzippedSize+1<<20)
+	_, _, err := office.DocumentText(bytes.NewReader(docx), int64(len(docx)), 0)
+	assert.ErrorIs(t, err, office.ErrTooLarge)
+}
@@ -1,21 +1,203 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
 	"portal-razvitie/models"
+	"portal-razvitie/storage"
+	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrRevisionNotFound версии документа с таким номером нет
+var ErrRevisionNotFound = errors.New("версия документа не найдена")
+
+// DocumentUpload загружаемый файл документа
+type DocumentUpload struct {
+	Name        string // Исходное имя файла
+	ContentType string
+	Size        int64
+	Comment     string
+	UploadedBy  *models.User
+}
+
 type DocumentService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	files       storage.Storage
+	previews    *DocumentPreviewService
+	extractions *DocumentExtractionService
+}
+
+func NewDocumentService(db *gorm.DB, files storage.Storage) *DocumentService {
+	return &DocumentService{db: db, files: files}
+}
+
+// SetPreviewService включает построение предпросмотра каждой загруженной версии
+func (s *DocumentService) SetPreviewService(previews *DocumentPreviewService) {
+	s.previews = previews
+}
+
+// SetExtractionService включает извлечение сумм из каждой загруженной версии по правилам типа документа
+func (s *DocumentService) SetExtractionService(extractions *DocumentExtractionService) {
+	s.extractions = extractions
+}
+
+// Upload создает документ с первой версией файла. В doc заполняются ProjectID, TaskID и Type
+func (s *DocumentService) Upload(ctx context.Context, doc *models.ProjectDocument, file DocumentUpload, content io.Reader) error {
+	revision, err := s.storeRevision(ctx, doc.ProjectID, file, content)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		applyRevision(doc, revision)
+		if err := tx.Create(doc).Error; err != nil {
+			return err
+		}
+		revision.DocumentID = doc.ID
+		return tx.Create(revision).Error
+	})
+	if err != nil {
+		s.removeOrphan(ctx, revision.StorageKey)
+		return err
+	}
+	s.enqueuePreview(revision)
+	s.extract(ctx, doc, revision)
+	return nil
+}
+
+// AddRevision загружает новую версию файла документа
+func (s *DocumentService) AddRevision(ctx context.Context, doc *models.ProjectDocument, file DocumentUpload, content io.Reader) (*models.DocumentRevision, error) {
+	revision, err := s.storeRevision(ctx, doc.ProjectID, file, content)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.appendRevision(doc, revision); err != nil {
+		s.removeOrphan(ctx, revision.StorageKey)
+		return nil, err
+	}
+	s.enqueuePreview(revision)
+	s.extract(ctx, doc, revision)
+	return revision, nil
+}
+
+// RestoreRevision делает версию number текущей: создается новая версия с тем же файлом,
+// история не переписывается
+func (s *DocumentService) RestoreRevision(doc *models.ProjectDocument, number int, user *models.User) (*models.DocumentRevision, error) {
+	source, err := s.GetRevision(doc.ID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := *source
+	revision.ID = 0
+	revision.CreatedAt = time.Time{}
+	revision.Comment = fmt.Sprintf("Восстановлена версия %d", number)
+	revision.RestoredFrom = &number
+	setUploader(&revision, user)
+	if err := s.appendRevision(doc, &revision); err != nil {
+		return nil, err
+	}
+	s.enqueuePreview(&revision)
+	s.extract(context.Background(), doc, &revision)
+	return &revision, nil
 }
 
-func NewDocumentService(db *gorm.DB) *DocumentService {
-	return &DocumentService{db: db}
+// GetRevisions возвращает версии документа, начиная с последней
+func (s *DocumentService) GetRevisions(documentID uint) ([]models.DocumentRevision, error) {
+	revisions := make([]models.DocumentRevision, 0)
+	err := s.db.Where("\"DocumentId\" = ?", documentID).Order("\"Number\" DESC").Find(&revisions).Error
+	return revisions, err
 }
 
-func (s *DocumentService) Create(doc *models.ProjectDocument) error {
-	return s.db.Create(doc).Error
+func (s *DocumentService) GetRevision(documentID uint, number int) (*models.DocumentRevision, error) {
+	var revision models.DocumentRevision
+	err := s.db.Where("\"DocumentId\" = ? AND \"Number\" = ?", documentID, number).First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// Open открывает файл текущей версии документа
+func (s *DocumentService) Open(ctx context.Context, doc *models.ProjectDocument) (io.ReadCloser, error) {
+	return s.openFile(ctx, doc.StorageKey, doc.FilePath)
+}
+
+// OpenRevision открывает файл версии документа
+func (s *DocumentService) OpenRevision(ctx context.Context, revision *models.DocumentRevision) (io.ReadCloser, error) {
+	return s.openFile(ctx, revision.StorageKey, revision.FilePath)
+}
+
+// openFile читает файл из хранилища. Файлы, загруженные до перехода на хранилище, читаются с диска
+func (s *DocumentService) openFile(ctx context.Context, key, legacyPath string) (io.ReadCloser, error) {
+	if key == "" {
+		file, err := os.Open(legacyPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, storage.ErrNotFound
+		}
+		return file, err
+	}
+	content, _, err := s.files.Get(ctx, key)
+	return content, err
+}
+
+// Remove удаляет документ со всеми версиями и их файлами. Файлы удаляются после записей:
+// лишний файл в хранилище безопаснее записи без файла
+func (s *DocumentService) Remove(ctx context.Context, doc *models.ProjectDocument) error {
+	revisions, err := s.GetRevisions(doc.ID)
+	if err != nil {
+		return err
+	}
+	var previews []models.DocumentPreview
+	if err := s.db.Where("\"DocumentId\" = ? AND \"StorageKey\" <> ''", doc.ID).Find(&previews).Error; err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("\"DocumentId\" = ?", doc.ID).Delete(&models.DocumentPreview{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("\"DocumentId\" = ?", doc.ID).Delete(&models.DocumentExtraction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("\"DocumentId\" = ?", doc.ID).Delete(&models.DocumentRevision{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(doc).Error
+	})
+	if err != nil {
+		return err
+	}
+	// Файлы предпросмотров удаляются вместе с файлами версий
+	for _, p := range previews {
+		revisions = append(revisions, models.DocumentRevision{StorageKey: p.StorageKey})
+	}
+
+	// Восстановленные версии ссылаются на тот же файл
+	removed := make(map[string]bool)
+	for _, r := range append(revisions, models.DocumentRevision{StorageKey: doc.StorageKey, FilePath: doc.FilePath}) {
+		location := r.StorageKey + "|" + r.FilePath
+		if removed[location] {
+			continue
+		}
+		removed[location] = true
+		if err := s.removeFile(ctx, r.StorageKey, r.FilePath); err != nil {
+			log.Printf("⚠️ Document %d deleted, but its file was not: %v", doc.ID, err)
+		}
+	}
+	return nil
 }
 
 func (s *DocumentService) GetByID(id int) (*models.ProjectDocument, error) {
@@ -42,14 +224,268 @@ func (s *DocumentService) GetByTaskID(taskID int) ([]models.ProjectDocument, err
 	return docs, nil
 }
 
-func (s *DocumentService) Count(projectID uint, docType string) (int64, error) {
-	var count int64
-	err := s.db.Model(&models.ProjectDocument{}).
-		Where("project_id = ? AND type = ?", projectID, docType).
-		Count(&count).Error
-	return count, err
+// storeRevision сохраняет файл в хранилище под уникальным ключом и считает SHA-256
+func (s *DocumentService) storeRevision(ctx context.Context, projectID uint, file DocumentUpload, content io.Reader) (*models.DocumentRevision, error) {
+	fileName := fmt.Sprintf("%s_%s", uuid.New().String(), filepath.Base(file.Name))
+	key := fmt.Sprintf("projects/%d/%s", projectID, fileName)
+
+	hash := sha256.New()
+	if err := s.files.Put(ctx, key, io.TeeReader(content, hash), file.Size, file.ContentType); err != nil {
+		return nil, err
+	}
+
+	revision := &models.DocumentRevision{
+		Name:        file.Name,
+		FileName:    fileName,
+		FilePath:    key,
+		StorageKey:  key,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		Comment:     file.Comment,
+	}
+	setUploader(revision, file.UploadedBy)
+	return revision, nil
+}
+
+// appendRevision добавляет версию со следующим номером и делает ее текущей
+func (s *DocumentService) appendRevision(doc *models.ProjectDocument, revision *models.DocumentRevision) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		if err := tx.Model(&models.DocumentRevision{}).Where("\"DocumentId\" = ?", doc.ID).
+			Select("COALESCE(MAX(\"Number\"), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		revision.DocumentID = doc.ID
+		revision.Number = last + 1
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+		applyRevision(doc, revision)
+		return tx.Save(doc).Error
+	})
+}
+
+// applyRevision переносит в документ поля текущей версии
+func applyRevision(doc *models.ProjectDocument, revision *models.DocumentRevision) {
+	if revision.Number == 0 {
+		revision.Number = 1
+	}
+	doc.Name = revision.Name
+	doc.FileName = revision.FileName
+	doc.FilePath = revision.FilePath
+	doc.StorageKey = revision.StorageKey
+	doc.ContentType = revision.ContentType
+	doc.Size = revision.Size
+	doc.SHA256 = revision.SHA256
+	doc.Version = revision.Number
+	doc.UploadDate = time.Now().UTC()
+	if revision.UploadedBy != "" {
+		doc.Author = revision.UploadedBy
+	}
+}
+
+// openTemp копирует не больше limit байт файла версии во временный файл: книги и документы Office
+// читаются с произвольных смещений, а хранилище отдает поток. Файл удаляет вызывающий
+func (s *DocumentService) openTemp(ctx context.Context, revision *models.DocumentRevision, limit int64) (*os.File, error) {
+	content, err := s.OpenRevision(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	file, err := os.CreateTemp("", "document-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, io.LimitReader(content, limit)); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// enqueuePreview ставит новую версию в очередь предпросмотра; сбой не мешает загрузке
+func (s *DocumentService) enqueuePreview(revision *models.DocumentRevision) {
+	if s.previews == nil {
+		return
+	}
+	if err := s.previews.Enqueue(revision); err != nil {
+		log.Printf("⚠️ Failed to queue preview of document %d: %v", revision.DocumentID, err)
+	}
+}
+
+// extract извлекает суммы из новой версии в поля задач; сбой не мешает загрузке
+func (s *DocumentService) extract(ctx context.Context, doc *models.ProjectDocument, revision *models.DocumentRevision) {
+	if s.extractions == nil {
+		return
+	}
+	if _, err := s.extractions.Extract(ctx, doc, revision); err != nil {
+		log.Printf("⚠️ Failed to extract values from document %d: %v", doc.ID, err)
+	}
+}
+
+func setUploader(revision *models.DocumentRevision, user *models.User) {
+	if user == nil {
+		return
+	}
+	id := user.ID
+	revision.UploadedByID = &id
+	revision.UploadedBy = user.Name
+}
+
+func (s *DocumentService) removeFile(ctx context.Context, key, legacyPath string) error {
+	if key != "" {
+		return s.files.Delete(ctx, key)
+	}
+	if legacyPath == "" {
+		return nil
+	}
+	if err := os.Remove(legacyPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *DocumentService) removeOrphan(ctx context.Context, key string) {
+	if err := s.files.Delete(ctx, key); err != nil {
+		log.Printf("⚠️ Failed to remove orphaned file %s: %v", key, err)
+	}
+}
+
+// FileMigrationResult итог переноса файлов документов в хранилище
+type FileMigrationResult struct {
+	Moved   int
+	Skipped int // Уже в хранилище
+	Missing []uint
+	Failed  map[uint]string
+}
+
+// MigrateFiles переносит файлы версий документов в текущее хранилище: файлы, загруженные до хранилища, —
+// с диска по FilePath, остальные — из source (например, из локального каталога в S3).
+// deleteSource удаляет исходный файл после успешного переноса. В Missing и Failed — ID версий
+func (s *DocumentService) MigrateFiles(ctx context.Context, source storage.Storage, deleteSource bool) (*FileMigrationResult, error) {
+	var revisions []models.DocumentRevision
+	if err := s.db.Order("\"Id\"").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+
+	result := &FileMigrationResult{Failed: map[uint]string{}}
+	migrated := make(map[string]string) // Прежнее расположение → ключ (восстановленные версии делят файл)
+	for i := range revisions {
+		revision := &revisions[i]
+		if key, ok := migrated[revision.StorageKey+"|"+revision.FilePath]; ok {
+			if err := s.relocate(revision, key); err != nil {
+				result.Failed[revision.ID] = err.Error()
+			}
+			continue
+		}
+		if revision.StorageKey != "" && source == nil {
+			result.Skipped++
+			continue
+		}
+		if revision.StorageKey != "" {
+			if _, err := s.files.Stat(ctx, revision.StorageKey); err == nil {
+				result.Skipped++
+				continue
+			}
+		}
+
+		location := revision.StorageKey + "|" + revision.FilePath
+		key, err := s.migrateFile(ctx, revision, source, deleteSource)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			result.Missing = append(result.Missing, revision.ID)
+		case err != nil:
+			result.Failed[revision.ID] = err.Error()
+		default:
+			migrated[location] = key
+			result.Moved++
+		}
+	}
+	return result, nil
+}
+
+func (s *DocumentService) migrateFile(ctx context.Context, revision *models.DocumentRevision, source storage.Storage, deleteSource bool) (string, error) {
+	legacyPath := ""
+	if revision.StorageKey == "" {
+		legacyPath = revision.FilePath
+	}
+
+	var content io.ReadCloser
+	size := int64(-1)
+	key := revision.StorageKey
+	if legacyPath != "" {
+		file, err := os.Open(legacyPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return "", storage.ErrNotFound
+		}
+		if err != nil {
+			return "", err
+		}
+		if info, err := file.Stat(); err == nil {
+			size = info.Size()
+		}
+		content = file
+		key = fmt.Sprintf("projects/%d/%s", s.projectOf(revision.DocumentID), revision.FileName)
+	} else {
+		var obj *storage.Object
+		var err error
+		content, obj, err = source.Get(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		size = obj.Size
+	}
+	defer content.Close()
+
+	if err := s.files.Put(ctx, key, content, size, revision.ContentType); err != nil {
+		return "", err
+	}
+	if legacyPath != "" {
+		if err := s.relocate(revision, key); err != nil {
+			return "", err
+		}
+	}
+
+	if deleteSource {
+		var err error
+		if legacyPath != "" {
+			err = os.Remove(legacyPath)
+		} else {
+			err = source.Delete(ctx, key)
+		}
+		if err != nil {
+			log.Printf("⚠️ Revision %d migrated, but the source file was not removed: %v", revision.ID, err)
+		}
+	}
+	return key, nil
+}
+
+// relocate записывает новое расположение файла версии (и документа, если версия текущая)
+func (s *DocumentService) relocate(revision *models.DocumentRevision, key string) error {
+	if revision.StorageKey == key {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.ProjectDocument{}).
+			Where("\"Id\" = ? AND \"Version\" = ?", revision.DocumentID, revision.Number).
+			Updates(map[string]interface{}{"StorageKey": key, "FilePath": key}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(revision).Updates(map[string]interface{}{"StorageKey": key, "FilePath": key}).Error
+	})
 }
 
-func (s *DocumentService) Delete(doc *models.ProjectDocument) error {
-	return s.db.Delete(doc).Error
+func (s *DocumentService) projectOf(documentID uint) uint {
+	var projectID uint
+	s.db.Model(&models.ProjectDocument{}).Select("\"ProjectId\"").Where("\"Id\" = ?", documentID).Scan(&projectID)
+	return projectID
 }
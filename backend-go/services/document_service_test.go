@@ -0,0 +1,232 @@
+package services_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+	"portal-razvitie/storage"
+	"portal-razvitie/storage/s3test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestS3(t *testing.T) (storage.Storage, *s3test.Server) {
+	server, fake := s3test.NewServer("minio", "documents")
+	t.Cleanup(server.Close)
+	files, err := storage.New(storage.Config{
+		Backend: storage.BackendS3, S3Endpoint: server.URL, S3Bucket: "documents",
+		S3AccessKey: "minio", S3SecretKey: "minio-secret", S3PathStyle: true,
+	})
+	require.NoError(t, err)
+	return files, fake
+}
+
+func TestDocumentService_S3Storage(t *testing.T) {
+	db := setupTestDB(t)
+	files, fake := newTestS3(t)
+	service := services.NewDocumentService(db, files)
+	ctx := context.Background()
+
+	user := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+	doc := models.ProjectDocument{ProjectID: 7, Type: "Смета"}
+	upload := services.DocumentUpload{Name: "Смета.xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Size: 5, UploadedBy: &user}
+	require.NoError(t, service.Upload(ctx, &doc, upload, strings.NewReader("sheet")))
+	assert.True(t, strings.HasPrefix(doc.StorageKey, "projects/7/"))
+	assert.Equal(t, []string{doc.StorageKey}, fake.Keys("documents"))
+	assert.Equal(t, 1, doc.Version)
+	assert.Equal(t, user.Name, doc.Author)
+
+	content, err := service.Open(ctx, &doc)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "sheet", string(data))
+
+	// Подписанная ссылка открывается без заголовков авторизации
+	link, err := files.PresignGet(ctx, doc.StorageKey, time.Minute, doc.Name)
+	require.NoError(t, err)
+	resp, err := http.Get(link)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "attachment")
+
+	require.NoError(t, service.Remove(ctx, &doc))
+	assert.Empty(t, fake.Keys("documents"))
+	_, err = service.Open(ctx, &doc)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestDocumentService_MigrateFiles(t *testing.T) {
+	db := setupTestDB(t)
+	files, fake := newTestS3(t)
+	service := services.NewDocumentService(db, files)
+	ctx := context.Background()
+
+	// Файл, загруженный до хранилища, лежит на диске по FilePath
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "old_act.pdf")
+	require.NoError(t, os.WriteFile(legacyPath, []byte("act"), 0644))
+	legacy := models.ProjectDocument{ProjectID: 1, Name: "act.pdf", Type: "Акт", UploadDate: time.Now(), FileName: "old_act.pdf", FilePath: legacyPath}
+	missing := models.ProjectDocument{ProjectID: 1, Name: "lost.pdf", Type: "Акт", UploadDate: time.Now(), FileName: "lost.pdf", FilePath: filepath.Join(dir, "lost.pdf")}
+	require.NoError(t, db.Create(&legacy).Error)
+	require.NoError(t, db.Create(&missing).Error)
+
+	// Файл из локального хранилища переносится под тем же ключом
+	local, err := storage.NewLocal(filepath.Join(dir, "uploads"))
+	require.NoError(t, err)
+	require.NoError(t, local.Put(ctx, "projects/2/plan.dwg", strings.NewReader("plan"), 4, ""))
+	stored := models.ProjectDocument{ProjectID: 2, Name: "plan.dwg", Type: "План", UploadDate: time.Now(),
+		FileName: "plan.dwg", FilePath: "projects/2/plan.dwg", StorageKey: "projects/2/plan.dwg"}
+	require.NoError(t, db.Create(&stored).Error)
+	require.NoError(t, database.MigrateDocumentRevisions(db))
+
+	result, err := service.MigrateFiles(ctx, local, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Moved)
+	assert.Len(t, result.Missing, 1)
+	assert.Empty(t, result.Failed)
+	assert.ElementsMatch(t, []string{"projects/1/old_act.pdf", "projects/2/plan.dwg"}, fake.Keys("documents"))
+
+	var migrated models.ProjectDocument
+	require.NoError(t, db.First(&migrated, legacy.ID).Error)
+	assert.Equal(t, "projects/1/old_act.pdf", migrated.StorageKey)
+	content, err := service.Open(ctx, &migrated)
+	require.NoError(t, err)
+	content.Close()
+	_, err = os.Stat(legacyPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// Повторный запуск ничего не переносит
+	result, err = service.MigrateFiles(ctx, local, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Moved)
+	assert.Equal(t, 2, result.Skipped)
+}
+
+func TestDocumentService_Revisions(t *testing.T) {
+	db := setupTestDB(t)
+	files, fake := newTestS3(t)
+	service := services.NewDocumentService(db, files)
+	ctx := context.Background()
+
+	// Два разных файла одного типа — два документа, у каждого своя первая версия
+	form := models.ProjectDocument{ProjectID: 3, Type: "Анкета СБ"}
+	other := models.ProjectDocument{ProjectID: 3, Type: "Анкета СБ"}
+	require.NoError(t, service.Upload(ctx, &form, services.DocumentUpload{Name: "anketa.docx", Size: 2}, strings.NewReader("v1")))
+	require.NoError(t, service.Upload(ctx, &other, services.DocumentUpload{Name: "anketa-2.docx", Size: 2}, strings.NewReader("x1")))
+	assert.Equal(t, 1, form.Version)
+	assert.Equal(t, 1, other.Version)
+
+	second, err := service.AddRevision(ctx, &form, services.DocumentUpload{Name: "anketa.pdf", Size: 2, Comment: "Подписана"}, strings.NewReader("v2"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Number)
+	assert.Equal(t, "anketa.pdf", form.Name)
+	assert.NotEmpty(t, second.SHA256)
+
+	// Восстановление добавляет версию с файлом первой версии
+	restored, err := service.RestoreRevision(&form, 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, restored.Number)
+	assert.Equal(t, 1, *restored.RestoredFrom)
+	assert.Equal(t, "anketa.docx", form.Name)
+	content, err := service.Open(ctx, &form)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "v1", string(data))
+
+	revisions, err := service.GetRevisions(form.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, []int{3, 2, 1}, []int{revisions[0].Number, revisions[1].Number, revisions[2].Number})
+	_, err = service.GetRevision(form.ID, 9)
+	assert.ErrorIs(t, err, services.ErrRevisionNotFound)
+
+	// Удаление документа удаляет файлы всех его версий
+	require.NoError(t, service.Remove(ctx, &form))
+	assert.Len(t, fake.Keys("documents"), 1)
+	revisions, err = service.GetRevisions(form.ID)
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+}
+
+func TestDocumentService_Archive(t *testing.T) {
+	db := setupTestDB(t)
+	files, fake := newTestS3(t)
+	service := services.NewDocumentService(db, files)
+	ctx := context.Background()
+
+	stage := "Подготовка"
+	task := models.ProjectTask{ProjectID: 5, Name: "Аудит", Stage: &stage, NormativeDeadline: time.Now()}
+	require.NoError(t, db.Create(&task).Error)
+	taskID := int(task.ID)
+
+	plan := models.ProjectDocument{ProjectID: 5, TaskID: &taskID, Type: "Технический план"}
+	require.NoError(t, service.Upload(ctx, &plan, services.DocumentUpload{Name: "plan.pdf", Size: 2}, strings.NewReader("p1")))
+	_, err := service.AddRevision(ctx, &plan, services.DocumentUpload{Name: "plan.pdf", Size: 2, Comment: "=HYPERLINK(\"http://evil\")"}, strings.NewReader("p2"))
+	require.NoError(t, err)
+	lease := models.ProjectDocument{ProjectID: 5, Type: "Договор: аренда"}
+	require.NoError(t, service.Upload(ctx, &lease, services.DocumentUpload{Name: "lease.docx", Size: 1}, strings.NewReader("l")))
+	lost := models.ProjectDocument{ProjectID: 5, Type: "Договор: аренда"}
+	require.NoError(t, service.Upload(ctx, &lost, services.DocumentUpload{Name: "lease.docx", Size: 1}, strings.NewReader("x")))
+	require.NoError(t, files.Delete(ctx, lost.StorageKey))
+	require.Len(t, fake.Keys("documents"), 3)
+
+	readArchive := func(opts services.ArchiveOptions) map[string]string {
+		archive, err := service.BuildArchive(opts)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, archive.Write(ctx, &buf))
+		reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		result := map[string]string{}
+		for _, f := range reader.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			result[f.Name] = string(data)
+		}
+		return result
+	}
+
+	// Текущие версии по папкам "этап/тип"; одинаковые имена получают номер, потерянный файл — отметку
+	latest := readArchive(services.ArchiveOptions{ProjectID: 5})
+	assert.Equal(t, "p2", latest["Подготовка/Технический план/plan.pdf"])
+	assert.Equal(t, "l", latest["Документы проекта/Договор_ аренда/lease.docx"])
+	assert.NotContains(t, latest, "Документы проекта/Договор_ аренда/lease (2).docx")
+	assert.Len(t, latest, 3)
+
+	manifest := csv.NewReader(strings.NewReader(strings.TrimPrefix(latest[services.ArchiveManifestName], "\ufeff")))
+	manifest.Comma = ';'
+	records, err := manifest.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "Подготовка/Технический план/plan.pdf", records[1][0])
+	assert.Equal(t, "Аудит", records[1][3])
+	assert.Equal(t, "2", records[1][5])
+	// Значения, которые Excel принял бы за формулу, экранированы апострофом
+	assert.Equal(t, "'=HYPERLINK(\"http://evil\")", records[1][11])
+	assert.Equal(t, "файл не найден", records[3][12])
+
+	// Все версии документов задачи
+	all := readArchive(services.ArchiveOptions{TaskID: &taskID, AllVersions: true})
+	assert.Equal(t, "p1", all["Подготовка/Технический план/plan (v1).pdf"])
+	assert.Equal(t, "p2", all["Подготовка/Технический план/plan (v2).pdf"])
+	assert.Len(t, all, 3)
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"portal-razvitie/models"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Ошибки справочника типов документов и проверки файлов
+var (
+	ErrUnknownDocumentType   = errors.New("тип документа не найден в справочнике")
+	ErrDocumentTypeInvalid   = errors.New("код и название типа документа обязательны")
+	ErrDocumentTypeCodeTaken = errors.New("тип документа с таким кодом уже есть")
+	ErrDocumentTypeInUse     = errors.New("тип документа используется: деактивируйте его вместо удаления")
+	ErrDocumentFileRejected  = errors.New("файл не подходит для типа документа")
+)
+
+// Причины, по которым обязательный документ считается отсутствующим
+const (
+	MissingDocumentAbsent = "missing" // Документа нет
+	MissingDocumentFormat = "format"  // Последняя версия в недопустимом формате
+)
+
+// MissingDocument обязательный документ, которого не хватает для завершения задачи
+type MissingDocument struct {
+	TypeCode   string   `json:"typeCode"`
+	TypeName   string   `json:"typeName"`
+	Extensions []string `json:"extensions"`
+	Reason     string   `json:"reason"`
+}
+
+// Error текст ошибки для проверки завершения задачи
+func (m MissingDocument) Error() string {
+	if m.Reason == MissingDocumentFormat {
+		return fmt.Sprintf("Документ '%s' должен иметь формат: %s", m.TypeName, strings.Join(m.Extensions, ", "))
+	}
+	return fmt.Sprintf("Необходим документ: %s", m.TypeName)
+}
+
+// TaskMissingDocuments недостающие документы открытой задачи проекта
+type TaskMissingDocuments struct {
+	TaskID   uint              `json:"taskId"`
+	TaskCode string            `json:"taskCode"`
+	TaskName string            `json:"taskName"`
+	Missing  []MissingDocument `json:"missing"`
+}
+
+// DocumentTypeService ведет справочник типов документов и проверяет по нему файлы и обязательные документы задач
+type DocumentTypeService struct {
+	db *gorm.DB
+}
+
+func NewDocumentTypeService(db *gorm.DB) *DocumentTypeService {
+	return &DocumentTypeService{db: db}
+}
+
+// GetTypes возвращает типы документов; activeOnly — только доступные для загрузки
+func (s *DocumentTypeService) GetTypes(activeOnly bool) ([]models.DocumentType, error) {
+	types := make([]models.DocumentType, 0)
+	query := s.db.Order("\"Name\"")
+	if activeOnly {
+		query = query.Where("\"IsActive\" = ?", true)
+	}
+	err := query.Find(&types).Error
+	return types, err
+}
+
+// Resolve находит активный тип по коду или по названию (загрузки из старых форм передают название)
+func (s *DocumentTypeService) Resolve(codeOrName string) (*models.DocumentType, error) {
+	value := strings.TrimSpace(codeOrName)
+	var docType models.DocumentType
+	err := s.db.Where("\"IsActive\" = ? AND (\"Code\" = ? OR \"Name\" = ?)", true, value, value).
+		Order("\"Id\"").First(&docType).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownDocumentType
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &docType, nil
+}
+
+func (s *DocumentTypeService) GetByCode(code string) (*models.DocumentType, error) {
+	var docType models.DocumentType
+	err := s.db.Where("\"Code\" = ?", code).First(&docType).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownDocumentType
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &docType, nil
+}
+
+// CreateType добавляет тип в справочник
+func (s *DocumentTypeService) CreateType(docType *models.DocumentType) error {
+	docType.ID = 0
+	if err := normalizeDocumentType(docType); err != nil {
+		return err
+	}
+	if _, err := s.GetByCode(docType.Code); err == nil {
+		return ErrDocumentTypeCodeTaken
+	}
+	isActive := docType.IsActive
+	if err := s.db.Create(docType).Error; err != nil {
+		return err
+	}
+	// IsActive по умолчанию true: false при создании нужно записать отдельно
+	if !isActive {
+		docType.IsActive = false
+		return s.db.Model(docType).UpdateColumn("IsActive", false).Error
+	}
+	return nil
+}
+
+// UpdateType изменяет тип. Код не меняется: на него ссылаются документы
+func (s *DocumentTypeService) UpdateType(code string, input models.DocumentType) (*models.DocumentType, error) {
+	docType, err := s.GetByCode(code)
+	if err != nil {
+		return nil, err
+	}
+	input.ID = docType.ID
+	input.Code = docType.Code
+	if err := normalizeDocumentType(&input); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(&input).Error; err != nil {
+		return nil, err
+	}
+	// Название типа хранится и в документах
+	if input.Name != docType.Name {
+		if err := s.db.Model(&models.ProjectDocument{}).Where("\"TypeCode\" = ?", code).
+			UpdateColumn("Type", input.Name).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &input, nil
+}
+
+// DeleteType удаляет тип, которым не помечен ни один документ, вместе с его правилами извлечения
+func (s *DocumentTypeService) DeleteType(code string) error {
+	docType, err := s.GetByCode(code)
+	if err != nil {
+		return err
+	}
+	var used int64
+	if err := s.db.Model(&models.ProjectDocument{}).Where("\"TypeCode\" = ?", code).Count(&used).Error; err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrDocumentTypeInUse
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("\"DocumentTypeCode\" = ?", code).Delete(&models.DocumentExtractionRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(docType).Error
+	})
+}
+
+// ValidateFile проверяет расширение, MIME-тип и размер файла по справочнику.
+// Пустой contentType — содержимое еще не получено, тип не проверяется
+func (s *DocumentTypeService) ValidateFile(docType *models.DocumentType, fileName, contentType string, size int64) error {
+	if !docType.AllowsFile(fileName) {
+		return fmt.Errorf("%w: для «%s» допустимы %s", ErrDocumentFileRejected, docType.Name, strings.Join(docType.Extensions, ", "))
+	}
+	if contentType != "" && !docType.AllowsMIME(contentType) {
+		return fmt.Errorf("%w: для «%s» недопустим тип содержимого %s", ErrDocumentFileRejected, docType.Name, contentType)
+	}
+	if docType.MaxSize > 0 && size > docType.MaxSize {
+		return fmt.Errorf("%w: для «%s» размер файла не больше %d МБ", ErrDocumentFileRejected, docType.Name, docType.MaxSize>>20)
+	}
+	return nil
+}
+
+// MissingForTask возвращает обязательные документы задачи, которых нет в проекте.
+// Формат проверяется по последней версии каждого документа
+func (s *DocumentTypeService) MissingForTask(projectID uint, taskCode string) ([]MissingDocument, error) {
+	required, err := s.requiredTypes()
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.projectDocuments(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return missingDocuments(required, docs, taskCode), nil
+}
+
+// MissingForProject возвращает недостающие документы по открытым задачам проекта
+func (s *DocumentTypeService) MissingForProject(projectID uint) ([]TaskMissingDocuments, error) {
+	required, err := s.requiredTypes()
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.projectDocuments(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []models.ProjectTask
+	if err := s.db.Select("Id", "Code", "Name", "Order").
+		Where("\"ProjectId\" = ? AND \"Code\" IS NOT NULL AND \"Status\" NOT IN ?", projectID, models.ClosedTaskStatuses()).
+		Order("\"Order\"").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]TaskMissingDocuments, 0)
+	for _, task := range tasks {
+		missing := missingDocuments(required, docs, *task.Code)
+		if len(missing) == 0 {
+			continue
+		}
+		result = append(result, TaskMissingDocuments{TaskID: task.ID, TaskCode: *task.Code, TaskName: task.Name, Missing: missing})
+	}
+	return result, nil
+}
+
+// requiredTypes активные типы, обязательные хотя бы для одной задачи
+func (s *DocumentTypeService) requiredTypes() ([]models.DocumentType, error) {
+	types, err := s.GetTypes(true)
+	if err != nil {
+		return nil, err
+	}
+	required := make([]models.DocumentType, 0, len(types))
+	for _, t := range types {
+		if len(t.TaskCodes) > 0 {
+			required = append(required, t)
+		}
+	}
+	return required, nil
+}
+
+func (s *DocumentTypeService) projectDocuments(projectID uint) ([]models.ProjectDocument, error) {
+	var docs []models.ProjectDocument
+	err := s.db.Select("Id", "TypeCode", "Name", "FileName").Where("\"ProjectId\" = ?", projectID).Find(&docs).Error
+	return docs, err
+}
+
+func missingDocuments(required []models.DocumentType, docs []models.ProjectDocument, taskCode string) []MissingDocument {
+	missing := make([]MissingDocument, 0)
+	for _, t := range required {
+		if !t.RequiredFor(taskCode) {
+			continue
+		}
+		found, valid := false, false
+		for _, doc := range docs {
+			if doc.TypeCode != t.Code {
+				continue
+			}
+			found = true
+			if t.AllowsFile(doc.FileName) {
+				valid = true
+				break
+			}
+		}
+		if valid {
+			continue
+		}
+		reason := MissingDocumentAbsent
+		if found {
+			reason = MissingDocumentFormat
+		}
+		missing = append(missing, MissingDocument{TypeCode: t.Code, TypeName: t.Name, Extensions: t.Extensions, Reason: reason})
+	}
+	return missing
+}
+
+// normalizeDocumentType приводит расширения к виду ".pdf", MIME-типы к нижнему регистру
+func normalizeDocumentType(t *models.DocumentType) error {
+	t.Code = strings.TrimSpace(t.Code)
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Code == "" || t.Name == "" || t.MaxSize < 0 {
+		return ErrDocumentTypeInvalid
+	}
+	t.Extensions = normalizeList(t.Extensions, func(v string) string {
+		return "." + strings.TrimPrefix(strings.ToLower(v), ".")
+	})
+	t.MimeTypes = normalizeList(t.MimeTypes, strings.ToLower)
+	t.TaskCodes = normalizeList(t.TaskCodes, func(v string) string { return v })
+	return nil
+}
+
+func normalizeList(values pq.StringArray, normalize func(string) string) pq.StringArray {
+	result := make(pq.StringArray, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if v = normalize(v); !containsString(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package services_test
+
+import (
+	"testing"
+
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentTypeService_RegistryAndMissingDocuments(t *testing.T) {
+	db := setupTestDB(t)
+	// Старый документ со свободным типом получает код при заполнении справочника
+	legacy := models.ProjectDocument{ProjectID: 1, Type: "Фотографии объекта", FileName: "photo.jpg"}
+	require.NoError(t, db.Create(&legacy).Error)
+	require.NoError(t, database.SeedDocumentTypes(db))
+	service := services.NewDocumentTypeService(db)
+
+	require.NoError(t, db.First(&legacy, legacy.ID).Error)
+	assert.Equal(t, "site-photos", legacy.TypeCode)
+
+	// Тип находится и по коду, и по названию
+	byName, err := service.Resolve("Обмерный план")
+	require.NoError(t, err)
+	byCode, err := service.Resolve("measured-plan")
+	require.NoError(t, err)
+	assert.Equal(t, byName.ID, byCode.ID)
+	_, err = service.Resolve("Обмерный  план")
+	assert.ErrorIs(t, err, services.ErrUnknownDocumentType)
+
+	assert.ErrorIs(t, service.ValidateFile(byCode, "plan.pdf", "application/pdf", 10), services.ErrDocumentFileRejected)
+	assert.NoError(t, service.ValidateFile(byCode, "plan.DWG", "application/acad", 10))
+
+	limited := models.DocumentType{Code: "scan", Name: "Скан", Extensions: pq.StringArray{"PDF"}, MimeTypes: pq.StringArray{"application/pdf"}, MaxSize: 1 << 20}
+	require.NoError(t, service.CreateType(&limited))
+	assert.Equal(t, pq.StringArray{".pdf"}, limited.Extensions)
+	assert.ErrorIs(t, service.ValidateFile(&limited, "a.pdf", "image/png", 10), services.ErrDocumentFileRejected)
+	assert.ErrorIs(t, service.ValidateFile(&limited, "a.pdf", "application/pdf", 2<<20), services.ErrDocumentFileRejected)
+	assert.ErrorIs(t, service.CreateType(&models.DocumentType{Code: "scan", Name: "Дубль"}), services.ErrDocumentTypeCodeTaken)
+
+	// Обмерного плана нет, затем он в неверном формате, затем в нужном
+	missing, err := service.MissingForTask(1, "TASK-CONTOUR")
+	require.NoError(t, err)
+	require.NotEmpty(t, missing)
+	reasons := map[string]string{}
+	for _, m := range missing {
+		reasons[m.TypeCode] = m.Reason
+	}
+	assert.Equal(t, services.MissingDocumentAbsent, reasons["measured-plan"])
+	assert.NotContains(t, reasons, "site-photos")
+
+	plan := models.ProjectDocument{ProjectID: 1, Type: "Обмерный план", TypeCode: "measured-plan", FileName: "plan.pdf"}
+	require.NoError(t, db.Create(&plan).Error)
+	missing, err = service.MissingForTask(1, "TASK-CONTOUR")
+	require.NoError(t, err)
+	for _, m := range missing {
+		if m.TypeCode == "measured-plan" {
+			assert.Equal(t, services.MissingDocumentFormat, m.Reason)
+		}
+	}
+
+	require.NoError(t, db.Model(&plan).UpdateColumn("FileName", "plan.dwg").Error)
+	missing, err = service.MissingForTask(1, "TASK-CONTOUR")
+	require.NoError(t, err)
+	for _, m := range missing {
+		assert.NotEqual(t, "measured-plan", m.TypeCode)
+	}
+
+	// Переименование типа переносится в документы; используемый тип не удаляется
+	renamed, err := service.UpdateType("measured-plan", models.DocumentType{Name: "Обмерный план помещения", Extensions: pq.StringArray{".dwg"}, IsActive: true})
+	require.NoError(t, err)
+	assert.Equal(t, "measured-plan", renamed.Code)
+	require.NoError(t, db.First(&plan, plan.ID).Error)
+	assert.Equal(t, "Обмерный план помещения", plan.Type)
+	assert.ErrorIs(t, service.DeleteType("measured-plan"), services.ErrDocumentTypeInUse)
+	assert.NoError(t, service.DeleteType("scan"))
+}
@@ -8,8 +8,9 @@ import (
 )
 
 type NotificationService struct {
-	repo repositories.NotificationRepository
-	hub  *websocket.Hub
+	repo     repositories.NotificationRepository
+	hub      *websocket.Hub
+	absences *AbsenceService
 }
 
 func NewNotificationService(repo repositories.NotificationRepository, hub *websocket.Hub) *NotificationService {
@@ -19,8 +20,44 @@ func NewNotificationService(repo repositories.NotificationRepository, hub *webso
 	}
 }
 
-// SendNotification creates a notification and pushes it via WS
+// SetAbsenceService включает копирование уведомлений заместителям отсутствующих сотрудников
+func (s *NotificationService) SetAbsenceService(absences *AbsenceService) {
+	s.absences = absences
+}
+
+// SendNotification creates a notification and pushes it via WS.
+// If the user is absent, a copy goes to their delegate
 func (s *NotificationService) SendNotification(userID uint, title, message, notifType, link string, relatedProjectId, relatedTaskId *uint) error {
+	if err := s.deliver(userID, title, message, notifType, link, relatedProjectId, relatedTaskId); err != nil {
+		return err
+	}
+	if s.absences == nil {
+		return nil
+	}
+	absence, err := s.absences.ActiveAbsence(userID)
+	if err != nil {
+		log.Printf("⚠️ Failed to check absence of user %d: %v", userID, err)
+		return nil
+	}
+	if absence != nil {
+		return s.deliver(absence.DelegateID, title+" (замещение)", message, notifType, link, relatedProjectId, relatedTaskId)
+	}
+	return nil
+}
+
+// SendAssignmentNotification уведомляет о назначении исполнителя, а если работа передана ему
+// за отсутствующего сотрудника — и самого сотрудника
+func (s *NotificationService) SendAssignmentNotification(assigneeID uint, delegatedFrom *uint, title, message, notifType, link string, relatedProjectId, relatedTaskId *uint) error {
+	if delegatedFrom == nil {
+		return s.SendNotification(assigneeID, title, message, notifType, link, relatedProjectId, relatedTaskId)
+	}
+	if err := s.deliver(assigneeID, title+" (замещение)", message, notifType, link, relatedProjectId, relatedTaskId); err != nil {
+		return err
+	}
+	return s.deliver(*delegatedFrom, title, message+" (передано заместителю на время отсутствия)", notifType, link, relatedProjectId, relatedTaskId)
+}
+
+func (s *NotificationService) deliver(userID uint, title, message, notifType, link string, relatedProjectId, relatedTaskId *uint) error {
 	log.Printf("📧 Sending notification to user %d: title='%s' message='%s'", userID, title, message)
 
 	notif := &models.Notification{
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"portal-razvitie/events"
 	"portal-razvitie/models"
@@ -28,6 +29,11 @@ func NewProjectService(repo repositories.ProjectRepository, workflowService Work
 func (s *ProjectService) CreateProject(project *models.Project, actorId uint) error {
 	var createdTasks []models.ProjectTask
 
+	// Создатель входит в команду, если команда не указана явно
+	if len(project.Members) == 0 {
+		project.Members = []models.ProjectMember{{UserID: actorId, Role: models.ProjectRoleMP}}
+	}
+
 	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// Use repository with transaction
 		if err := s.repo.CreateWithTx(tx, project); err != nil {
@@ -63,8 +69,8 @@ func (s *ProjectService) CreateProject(project *models.Project, actorId uint) er
 	return err
 }
 
-func (s *ProjectService) FindAll() ([]models.Project, error) {
-	return s.repo.FindAll()
+func (s *ProjectService) FindAll(scope repositories.ProjectScope) ([]models.Project, error) {
+	return s.repo.FindAll(scope)
 }
 
 func (s *ProjectService) FindByID(id uint) (*models.Project, error) {
@@ -72,6 +78,18 @@ func (s *ProjectService) FindByID(id uint) (*models.Project, error) {
 }
 
 func (s *ProjectService) Update(project *models.Project, actorId uint) error {
+	// Команда меняется через отдельные эндпоинты
+	project.Members = nil
+
+	// Статус меняется только через переходы машины состояний
+	if existing, err := s.repo.FindByID(project.ID); err == nil {
+		project.Status = existing.Status
+		project.StatusPinned = existing.StatusPinned
+		project.StatusReason = existing.StatusReason
+		project.StatusChangedBy = existing.StatusChangedBy
+		project.StatusChangedAt = existing.StatusChangedAt
+	}
+
 	if err := s.repo.Update(project); err != nil {
 		return err
 	}
@@ -82,32 +100,39 @@ func (s *ProjectService) Update(project *models.Project, actorId uint) error {
 	return nil
 }
 
-func (s *ProjectService) UpdateStatus(id uint, status string, actorId uint) error {
+// UpdateStatus вручную меняет статус проекта и закрепляет его.
+// Допустимость перехода проверяется ProjectStatusService.CheckTransition для статуса from; если статус
+// с тех пор изменился, возвращается ErrStatusChanged
+func (s *ProjectService) UpdateStatus(id uint, from string, status string, reason string, actorId uint) error {
 	name := fmt.Sprintf("Проект #%d", id)
-	// Try to find project first to get existing status and name
-	p, err := s.repo.FindByID(id)
-	oldStatus := ""
-	if err == nil {
-		oldStatus = p.Status
-		if p.Store != nil {
-			name = p.Store.Name
-		}
+	// Try to find project first to get its name
+	if p, err := s.repo.FindByID(id); err == nil && p.Store != nil {
+		name = p.Store.Name
 	}
 
-	if err := s.repo.UpdateStatus(id, status); err != nil {
+	if err := s.repo.SetManualStatus(id, from, status, reason, actorId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrStatusChanged
+		}
 		return err
 	}
 
 	s.eventBus.Publish(events.ProjectStatusChangedEvent{
 		ProjectID:   id,
 		ProjectName: name,
-		OldStatus:   oldStatus,
+		OldStatus:   from,
 		NewStatus:   status,
+		Reason:      reason,
 		ActorID:     actorId,
 	})
 	return nil
 }
 
+// UnpinStatus снимает закрепление ручного статуса
+func (s *ProjectService) UnpinStatus(id uint) error {
+	return s.repo.UnpinStatus(id)
+}
+
 func (s *ProjectService) Delete(id uint, actorId uint) error {
 	project, err := s.repo.FindByID(id)
 	name := fmt.Sprintf("Проект #%d", id)
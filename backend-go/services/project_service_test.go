@@ -11,6 +11,7 @@ import (
 
 	"portal-razvitie/events"
 	"portal-razvitie/models"
+	"portal-razvitie/repositories"
 	"portal-razvitie/services"
 )
 
@@ -30,8 +31,8 @@ func (m *MockProjectRepository) CreateWithTx(tx *gorm.DB, project *models.Projec
 	return m.Called(tx, project).Error(0)
 }
 
-func (m *MockProjectRepository) FindAll() ([]models.Project, error) {
-	args := m.Called()
+func (m *MockProjectRepository) FindAll(scope repositories.ProjectScope) ([]models.Project, error) {
+	args := m.Called(scope)
 	return args.Get(0).([]models.Project), args.Error(1)
 }
 
@@ -47,8 +48,16 @@ func (m *MockProjectRepository) Update(project *models.Project) error {
 	return m.Called(project).Error(0)
 }
 
-func (m *MockProjectRepository) UpdateStatus(id uint, status string) error {
-	return m.Called(id, status).Error(0)
+func (m *MockProjectRepository) UpdateStatus(id uint, from string, status string) error {
+	return m.Called(id, from, status).Error(0)
+}
+
+func (m *MockProjectRepository) SetManualStatus(id uint, from string, status string, reason string, userID uint) error {
+	return m.Called(id, from, status, reason, userID).Error(0)
+}
+
+func (m *MockProjectRepository) UnpinStatus(id uint) error {
+	return m.Called(id).Error(0)
 }
 
 func (m *MockProjectRepository) Delete(id uint) error {
@@ -76,6 +85,10 @@ func (m *MockWorkflowService) ValidateTaskCompletion(task models.ProjectTask) er
 	return m.Called(task).Error(0)
 }
 
+func (m *MockWorkflowService) RecalculateProjectTimeline(projectID uint) error {
+	return m.Called(projectID).Error(0)
+}
+
 func (m *MockWorkflowService) GetTaskDefinitions() ([]models.TaskDefinition, error) {
 	args := m.Called()
 	return args.Get(0).([]models.TaskDefinition), args.Error(1)
@@ -194,17 +207,43 @@ func TestProjectService_UpdateStatus(t *testing.T) {
 	}
 	mockRepo.On("FindByID", projectID).Return(existingProject, nil)
 
-	// 2. UpdateStatus called on repo
-	mockRepo.On("UpdateStatus", projectID, newStatus).Return(nil)
+	// 2. Status is set manually and pinned
+	mockRepo.On("SetManualStatus", projectID, oldStatus, newStatus, "", actorID).Return(nil)
 
 	// 3. EventBus Publish called
 	mockEventBus.On("Publish", mock.MatchedBy(func(e events.ProjectStatusChangedEvent) bool {
-		return e.ProjectID == projectID && e.NewStatus == newStatus && e.ActorID == actorID
+		return e.ProjectID == projectID && e.OldStatus == oldStatus && e.NewStatus == newStatus && e.ActorID == actorID
 	})).Return()
 
-	err := service.UpdateStatus(projectID, newStatus, actorID)
+	err := service.UpdateStatus(projectID, oldStatus, newStatus, "", actorID)
 
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
 	mockEventBus.AssertExpectations(t)
 }
+
+func TestProjectService_UpdateStatus_StaleTransition(t *testing.T) {
+	db := setupTestDB(t)
+	repo := repositories.NewProjectRepository(db)
+	mockEventBus := new(MockEventBus)
+	service := services.NewProjectService(repo, new(MockWorkflowService), db, mockEventBus)
+
+	project := &models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening), Status: string(models.ProjectStatusLayout)}
+	assert.NoError(t, db.Create(project).Error)
+
+	// Переход проверялся для статуса "Создан", но проект уже перешел дальше: ручная смена не применяется
+	err := service.UpdateStatus(project.ID, string(models.ProjectStatusCreated), string(models.ProjectStatusFailed), "Отказ", 1)
+	assert.ErrorIs(t, err, services.ErrStatusChanged)
+	mockEventBus.AssertNotCalled(t, "Publish")
+
+	// Автоматический пересчет не перезаписывает статус, изменившийся после чтения, и закрепленный вручную
+	assert.ErrorIs(t, repo.UpdateStatus(project.ID, string(models.ProjectStatusCreated), string(models.ProjectStatusAuditObject)), gorm.ErrRecordNotFound)
+	mockEventBus.On("Publish", mock.AnythingOfType("events.ProjectStatusChangedEvent")).Return()
+	assert.NoError(t, service.UpdateStatus(project.ID, string(models.ProjectStatusLayout), string(models.ProjectStatusFailed), "Отказ", 1))
+	assert.ErrorIs(t, repo.UpdateStatus(project.ID, string(models.ProjectStatusFailed), string(models.ProjectStatusAuditObject)), gorm.ErrRecordNotFound)
+
+	reloaded, err := repo.FindByID(project.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, string(models.ProjectStatusFailed), reloaded.Status)
+	assert.True(t, reloaded.StatusPinned)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"portal-razvitie/models"
+)
+
+// Ошибки ручной смены статуса проекта
+var (
+	ErrStatusTransitionNotAllowed = errors.New("переход между статусами не предусмотрен")
+	ErrStatusTransitionForbidden  = errors.New("недостаточно прав для перехода")
+	ErrStatusReasonRequired       = errors.New("для перехода необходимо указать причину")
+	ErrStatusGuardFailed          = errors.New("условие перехода не выполнено")
+	ErrStatusChanged              = errors.New("статус проекта уже изменен, обновите страницу")
+)
+
+// StatusTransitionOption доступный из текущего статуса переход
+type StatusTransitionOption struct {
+	Status        string `json:"status"`
+	RequireReason bool   `json:"requireReason"`
+	Allowed       bool   `json:"allowed"`             // Роль пользователя позволяет выполнить переход
+	BlockedBy     string `json:"blockedBy,omitempty"` // Почему переход сейчас невозможен
+}
+
+// statusClasses возвращает классы, к которым относится статус в наборе.
+// Статус, которого нет в наборе (например, после смены набора), считается рабочим
+func statusClasses(set []models.ProjectStatusDefinition, status string) []string {
+	for _, st := range set {
+		if st.Status != status {
+			continue
+		}
+		var classes []string
+		if st.IsInitial {
+			classes = append(classes, models.StatusClassInitial)
+		}
+		switch {
+		case st.IsCompletion:
+			classes = append(classes, models.StatusClassCompletion)
+		case st.IsFinal:
+			classes = append(classes, models.StatusClassFinal)
+		default:
+			classes = append(classes, models.StatusClassWorking)
+		}
+		return classes
+	}
+	return []string{models.StatusClassWorking}
+}
+
+// statusMatches проверяет, подходит ли статус под статус или класс из правила
+func statusMatches(spec string, status string, classes []string) bool {
+	if spec == status {
+		return true
+	}
+	for _, class := range classes {
+		if spec == class {
+			return true
+		}
+	}
+	return false
+}
+
+// findTransitionRule находит первое правило, разрешающее переход from -> to
+func findTransitionRule(set []models.ProjectStatusDefinition, from, to string) *models.ProjectStatusTransitionRule {
+	if from == to {
+		return nil
+	}
+	fromClasses := statusClasses(set, from)
+	toClasses := statusClasses(set, to)
+
+	for i := range models.ProjectStatusTransitions {
+		rule := &models.ProjectStatusTransitions[i]
+		if !statusMatches(rule.To, to, toClasses) {
+			continue
+		}
+		for _, spec := range rule.From {
+			if statusMatches(spec, from, fromClasses) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// roleAllowed проверяет, разрешает ли правило переход хотя бы одной из ролей
+func roleAllowed(rule *models.ProjectStatusTransitionRule, roles []string) bool {
+	for _, r := range rule.Roles {
+		if hasPermission(roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGuard проверяет дополнительное условие перехода
+func (s *ProjectStatusService) checkGuard(guard string, projectID uint) error {
+	switch guard {
+	case "":
+		return nil
+	case models.StatusGuardAllTasksCompleted:
+		tasks, err := s.taskRepo.FindByProjectID(projectID)
+		if err != nil {
+			return err
+		}
+		if !s.allTasksCompleted(tasks) {
+			return fmt.Errorf("%w: не все задачи проекта завершены", ErrStatusGuardFailed)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестное условие перехода %s", guard)
+	}
+}
+
+// CheckTransition проверяет, может ли пользователь с ролями, действующими в области проекта, перевести его в статус
+func (s *ProjectStatusService) CheckTransition(project *models.Project, to string, reason string, roles []string) error {
+	set := s.GetStatusSet(project.ProjectType)
+	if !s.IsValidStatus(project.ProjectType, to) {
+		return fmt.Errorf("%w: статуса \"%s\" нет в наборе типа \"%s\"", ErrStatusTransitionNotAllowed, to, project.ProjectType)
+	}
+
+	rule := findTransitionRule(set, project.Status, to)
+	if rule == nil {
+		return fmt.Errorf("%w: \"%s\" -> \"%s\"", ErrStatusTransitionNotAllowed, project.Status, to)
+	}
+	if !roleAllowed(rule, roles) {
+		return fmt.Errorf("%w: роли %v не могут перевести проект в статус \"%s\"", ErrStatusTransitionForbidden, roles, to)
+	}
+	if rule.RequireReason && reason == "" {
+		return ErrStatusReasonRequired
+	}
+	return s.checkGuard(rule.Guard, project.ID)
+}
+
+// AvailableTransitions возвращает переходы из текущего статуса проекта
+func (s *ProjectStatusService) AvailableTransitions(project *models.Project, roles []string) ([]StatusTransitionOption, error) {
+	set := s.GetStatusSet(project.ProjectType)
+	options := make([]StatusTransitionOption, 0)
+
+	for _, st := range set {
+		rule := findTransitionRule(set, project.Status, st.Status)
+		if rule == nil {
+			continue
+		}
+		option := StatusTransitionOption{
+			Status:        st.Status,
+			RequireReason: rule.RequireReason,
+			Allowed:       roleAllowed(rule, roles),
+		}
+		if err := s.checkGuard(rule.Guard, project.ID); err != nil {
+			if !errors.Is(err, ErrStatusGuardFailed) {
+				return nil, err
+			}
+			option.Allowed = false
+			option.BlockedBy = err.Error()
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
@@ -1,10 +1,13 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"portal-razvitie/models"
 	"portal-razvitie/repositories"
-	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // ProjectStatusService управляет автоматическим обновлением статусов проектов
@@ -12,6 +15,7 @@ type ProjectStatusService struct {
 	projectRepo  repositories.ProjectRepository
 	taskRepo     repositories.TaskRepository
 	activityRepo *repositories.UserActivityRepository
+	statusRepo   repositories.ProjectStatusRepository
 }
 
 // NewProjectStatusService создает новый сервис управления статусами
@@ -19,30 +23,84 @@ func NewProjectStatusService(
 	projectRepo repositories.ProjectRepository,
 	taskRepo repositories.TaskRepository,
 	activityRepo *repositories.UserActivityRepository,
+	statusRepo repositories.ProjectStatusRepository,
 ) *ProjectStatusService {
 	return &ProjectStatusService{
 		projectRepo:  projectRepo,
 		taskRepo:     taskRepo,
 		activityRepo: activityRepo,
+		statusRepo:   statusRepo,
+	}
+}
+
+// GetStatusSet возвращает набор статусов для типа проекта.
+// Если набор не настроен, используется встроенный
+func (s *ProjectStatusService) GetStatusSet(projectType string) []models.ProjectStatusDefinition {
+	if s.statusRepo != nil {
+		statuses, err := s.statusRepo.FindByProjectType(projectType)
+		if err == nil && len(statuses) > 0 {
+			return statuses
+		}
+	}
+	return models.DefaultProjectStatusSet(models.ProjectType(projectType))
+}
+
+// GetAllStatusSets возвращает наборы статусов всех типов проектов
+func (s *ProjectStatusService) GetAllStatusSets() map[string][]models.ProjectStatusDefinition {
+	sets := make(map[string][]models.ProjectStatusDefinition)
+	for _, projectType := range models.ValidProjectTypes() {
+		sets[string(projectType)] = s.GetStatusSet(string(projectType))
+	}
+	return sets
+}
+
+// ReplaceStatusSet сохраняет набор статусов для типа проекта
+func (s *ProjectStatusService) ReplaceStatusSet(projectType string, statuses []models.ProjectStatusDefinition) error {
+	if !models.IsValidProjectType(projectType) {
+		return errors.New("недопустимый тип проекта")
+	}
+	if len(statuses) == 0 {
+		return errors.New("набор статусов не может быть пустым")
+	}
+
+	seen := make(map[string]bool, len(statuses))
+	initial, completion := 0, 0
+	for i := range statuses {
+		st := &statuses[i]
+		st.ID = 0
+		st.ProjectType = projectType
+		if st.Status == "" {
+			return fmt.Errorf("статус #%d: название обязательно", i+1)
+		}
+		if seen[st.Status] {
+			return fmt.Errorf("статус %s указан несколько раз", st.Status)
+		}
+		seen[st.Status] = true
+		if st.IsInitial {
+			initial++
+		}
+		if st.IsCompletion {
+			completion++
+		}
+	}
+	if initial != 1 {
+		return errors.New("в наборе должен быть ровно один начальный статус")
+	}
+	if completion != 1 {
+		return errors.New("в наборе должен быть ровно один статус завершения")
 	}
+
+	return s.statusRepo.ReplaceForProjectType(projectType, statuses)
 }
 
-// Маппинг задач на статусы проекта
-// Каждая задача соответствует своему статусу проекта
-var taskToStatusMap = map[string]models.ProjectStatus{
-	"TASK-PREP-AUDIT":      models.ProjectStatusPrepAudit,
-	"TASK-AUDIT":           models.ProjectStatusAuditObject,
-	"TASK-ALCO-LIC":        models.ProjectStatusAlcoholLicense,
-	"TASK-WASTE":           models.ProjectStatusWaste,
-	"TASK-CONTOUR":         models.ProjectStatusContour,
-	"TASK-VISUALIZATION":   models.ProjectStatusVisualization,
-	"TASK-LOGISTICS":       models.ProjectStatusLogistics,
-	"TASK-LAYOUT":          models.ProjectStatusLayout,
-	"TASK-BUDGET-EQUIP":    models.ProjectStatusBudgetEquip,
-	"TASK-BUDGET-SECURITY": models.ProjectStatusBudgetSecurity,
-	"TASK-BUDGET-RSR":      models.ProjectStatusBudgetRSR,
-	"TASK-BUDGET-PIS":      models.ProjectStatusBudgetPIS,
-	"TASK-TOTAL-BUDGET":    models.ProjectStatusTotalBudget,
+// IsValidStatus проверяет, входит ли статус в набор статусов типа проекта
+func (s *ProjectStatusService) IsValidStatus(projectType string, status string) bool {
+	for _, st := range s.GetStatusSet(projectType) {
+		if st.Status == status {
+			return true
+		}
+	}
+	return false
 }
 
 // UpdateProjectStatus автоматически обновляет статус проекта на основе задач
@@ -53,15 +111,14 @@ func (s *ProjectStatusService) UpdateProjectStatus(projectID uint, userID uint)
 		return err
 	}
 
-	// Если проект уже в финальных статусах, не трогаем
-	finalStatuses := []string{
-		string(models.ProjectStatusOpened),
-		string(models.ProjectStatusClosed),
-		string(models.ProjectStatusArchived),
-		string(models.ProjectStatusFailed),
+	// Статус, установленный вручную, не перезаписываем
+	if project.StatusPinned {
+		return nil
 	}
-	for _, status := range finalStatuses {
-		if project.Status == status {
+
+	// Если проект уже в финальном статусе своего типа, не трогаем
+	for _, st := range s.GetStatusSet(project.ProjectType) {
+		if st.IsFinal && st.Status == project.Status {
 			return nil // Не меняем финальные статусы
 		}
 	}
@@ -73,7 +130,7 @@ func (s *ProjectStatusService) UpdateProjectStatus(projectID uint, userID uint)
 	}
 
 	// Определяем новый статус на основе задач
-	newStatus := s.determineProjectStatus(tasks)
+	newStatus := s.determineProjectStatus(project.ProjectType, tasks)
 
 	// Если статус не изменился, ничего не делаем
 	if project.Status == string(newStatus) {
@@ -82,8 +139,11 @@ func (s *ProjectStatusService) UpdateProjectStatus(projectID uint, userID uint)
 
 	oldStatus := project.Status
 
-	// Обновляем статус
-	if err := s.projectRepo.UpdateStatus(projectID, string(newStatus)); err != nil {
+	// Обновляем статус, только если его не изменили с момента чтения проекта
+	if err := s.projectRepo.UpdateStatus(projectID, oldStatus, string(newStatus)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Статус изменен параллельно; пересчитается при следующем изменении задач
+		}
 		return err
 	}
 
@@ -110,92 +170,90 @@ func (s *ProjectStatusService) UpdateProjectStatus(projectID uint, userID uint)
 	return nil
 }
 
-// determineProjectStatus определяет статус проекта на основе задач
-func (s *ProjectStatusService) determineProjectStatus(tasks []models.ProjectTask) models.ProjectStatus {
+// determineProjectStatus определяет статус проекта на основе задач.
+// Статус и его место в последовательности берутся из самих задач (ProjectStatus/StatusOrder,
+// скопированные из шаблона); учитываются только статусы из набора типа проекта
+func (s *ProjectStatusService) determineProjectStatus(projectType string, tasks []models.ProjectTask) models.ProjectStatus {
+	set := s.GetStatusSet(projectType)
+
+	allowed := make(map[string]bool, len(set))
+	initialStatus := models.ProjectStatusCreated
+	completionStatus := models.ProjectStatusOpened
+	for _, st := range set {
+		allowed[st.Status] = true
+		if st.IsInitial {
+			initialStatus = models.ProjectStatus(st.Status)
+		}
+		if st.IsCompletion {
+			completionStatus = models.ProjectStatus(st.Status)
+		}
+	}
+
 	if len(tasks) == 0 {
-		return models.ProjectStatusCreated
-	}
-
-	// Порядок задач в workflow (чем меньше, тем раньше в процессе)
-	taskOrder := map[string]int{
-		"TASK-PREP-AUDIT":      0,
-		"TASK-AUDIT":           1,
-		"TASK-ALCO-LIC":        2,
-		"TASK-WASTE":           3,
-		"TASK-CONTOUR":         4,
-		"TASK-VISUALIZATION":   5,
-		"TASK-LOGISTICS":       6,
-		"TASK-LAYOUT":          7,
-		"TASK-BUDGET-EQUIP":    8,
-		"TASK-BUDGET-SECURITY": 9,
-		"TASK-BUDGET-RSR":      10,
-		"TASK-BUDGET-PIS":      11,
-		"TASK-TOTAL-BUDGET":    12,
+		return initialStatus
 	}
 
-	// Приоритет 1: Ищем задачи "В работе"
-	// Если несколько - выбираем ПЕРВУЮ (с минимальным порядком)
-	var inProgressTasks []models.ProjectTask
-	for _, task := range tasks {
-		if task.Status == string(models.TaskStatusInProgress) && task.Code != nil {
-			if _, exists := taskToStatusMap[*task.Code]; exists {
-				inProgressTasks = append(inProgressTasks, task)
-			}
+	drivenStatus := func(task *models.ProjectTask) (models.ProjectStatus, bool) {
+		if task.ProjectStatus == nil || *task.ProjectStatus == "" || !allowed[*task.ProjectStatus] {
+			return "", false
 		}
+		return models.ProjectStatus(*task.ProjectStatus), true
 	}
 
-	if len(inProgressTasks) > 0 {
-		// Находим задачу с минимальным порядком среди тех, что в работе
-		minOrder := 999
-		var selectedTask *models.ProjectTask
-
-		for i := range inProgressTasks {
-			task := &inProgressTasks[i]
-			if order, exists := taskOrder[*task.Code]; exists {
-				if order < minOrder {
-					minOrder = order
-					selectedTask = task
-				}
-			}
+	// Приоритет 1: Ищем задачи "В работе"
+	// Если несколько - выбираем ПЕРВУЮ (с минимальным порядком статуса)
+	var selected *models.ProjectTask
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Status != string(models.TaskStatusInProgress) {
+			continue
 		}
-
-		if selectedTask != nil && selectedTask.Code != nil {
-			if status, exists := taskToStatusMap[*selectedTask.Code]; exists {
-				return status
-			}
+		if _, ok := drivenStatus(task); !ok {
+			continue
 		}
-	}
-
-	// Приоритет 2: Если нет задач "В работе", ищем последнюю завершенную
-	// Выбираем с максимальным порядком среди завершенных
-	maxOrder := 0
-	var lastCompletedStatus models.ProjectStatus = models.ProjectStatusCreated
-
-	for _, task := range tasks {
-		if task.Status == string(models.TaskStatusCompleted) && task.Code != nil {
-			if status, exists := taskToStatusMap[*task.Code]; exists {
-				if order, exists := taskOrder[*task.Code]; exists {
-					if order > maxOrder {
-						maxOrder = order
-						lastCompletedStatus = status
-					}
-				}
-			}
+		if selected == nil || task.StatusOrder < selected.StatusOrder {
+			selected = task
 		}
 	}
+	if selected != nil {
+		status, _ := drivenStatus(selected)
+		return status
+	}
 
 	// Специальная логика: если все задачи завершены на 100%
 	if s.allTasksCompleted(tasks) {
-		return models.ProjectStatusOpened
+		return completionStatus
 	}
 
-	// Специальная логика: если есть задачи РСР
-	if s.hasRSRTasks(tasks) {
-		return models.ProjectStatusRSR
+	// Статус этапа (например, РСР): задачи этапа начаты или завершены
+	for _, st := range set {
+		if st.Stage != "" && stageStarted(tasks, st.Stage) {
+			return models.ProjectStatus(st.Status)
+		}
+	}
+
+	// Приоритет 2: Если нет задач "В работе", ищем последнюю завершенную
+	// Выбираем с максимальным порядком среди завершенных
+	selected = nil
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Status != string(models.TaskStatusCompleted) {
+			continue
+		}
+		if _, ok := drivenStatus(task); !ok {
+			continue
+		}
+		if selected == nil || task.StatusOrder > selected.StatusOrder {
+			selected = task
+		}
+	}
+	if selected != nil {
+		status, _ := drivenStatus(selected)
+		return status
 	}
 
-	// Возвращаем последнюю завершенную или "Создан"
-	return lastCompletedStatus
+	// Возвращаем начальный статус
+	return initialStatus
 }
 
 // allTasksCompleted проверяет, завершены ли все задачи проекта
@@ -205,6 +263,9 @@ func (s *ProjectStatusService) allTasksCompleted(tasks []models.ProjectTask) boo
 	}
 
 	for _, task := range tasks {
+		if task.Status == string(models.TaskStatusRetired) {
+			continue // Исключенные из шаблона задачи не влияют на завершение
+		}
 		if task.Status != string(models.TaskStatusCompleted) {
 			return false
 		}
@@ -212,16 +273,13 @@ func (s *ProjectStatusService) allTasksCompleted(tasks []models.ProjectTask) boo
 	return true
 }
 
-// hasRSRTasks проверяет наличие задач РСР
-func (s *ProjectStatusService) hasRSRTasks(tasks []models.ProjectTask) bool {
+// stageStarted проверяет, есть ли у этапа задачи в работе или завершенные
+func stageStarted(tasks []models.ProjectTask, stage string) bool {
 	for _, task := range tasks {
-		taskNameLower := strings.ToLower(task.Name)
-		if (strings.Contains(taskNameLower, "смр") ||
-			strings.Contains(taskNameLower, "строительство") ||
-			strings.Contains(taskNameLower, "ремонт") ||
-			strings.Contains(taskNameLower, "рср")) &&
-			(task.Status == string(models.TaskStatusInProgress) ||
-				task.Status == string(models.TaskStatusCompleted)) {
+		if task.Stage == nil || *task.Stage != stage {
+			continue
+		}
+		if task.Status == string(models.TaskStatusInProgress) || task.Status == string(models.TaskStatusCompleted) {
 			return true
 		}
 	}
@@ -235,18 +293,23 @@ func (s *ProjectStatusService) CalculateProjectProgress(projectID uint) (float64
 		return 0, err
 	}
 
-	if len(tasks) == 0 {
-		return 0, nil
-	}
-
 	completed := 0
+	total := 0
 	for _, task := range tasks {
+		if task.Status == string(models.TaskStatusRetired) {
+			continue
+		}
+		total++
 		if task.Status == string(models.TaskStatusCompleted) {
 			completed++
 		}
 	}
 
-	return float64(completed) / float64(len(tasks)) * 100, nil
+	if total == 0 {
+		return 0, nil
+	}
+
+	return float64(completed) / float64(total) * 100, nil
 }
 
 // GetProjectStatusInfo возвращает информацию о текущем статусе
@@ -264,7 +327,7 @@ func (s *ProjectStatusService) GetProjectStatusInfo(projectID uint) (map[string]
 	progress, _ := s.CalculateProjectProgress(projectID)
 
 	// Определяем следующий возможный статус
-	nextStatus := s.determineProjectStatus(tasks)
+	nextStatus := s.determineProjectStatus(project.ProjectType, tasks)
 
 	return map[string]interface{}{
 		"currentStatus":   project.Status,
@@ -0,0 +1,162 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectStatusService_SuggestedStatus_ClosureLadder(t *testing.T) {
+	db := setupTestDB(t)
+	service := services.NewProjectStatusService(
+		repositories.NewProjectRepository(db),
+		repositories.NewTaskRepository(db),
+		repositories.NewUserActivityRepository(db),
+		repositories.NewProjectStatusRepository(db),
+	)
+
+	project := &models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeClosure), Status: string(models.ProjectStatusCreated)}
+	require.NoError(t, db.Create(project).Error)
+
+	newTask := func(name string, status models.ProjectStatus, order int, taskStatus models.TaskStatus) {
+		projectStatus := string(status)
+		task := &models.ProjectTask{
+			ProjectID:         project.ID,
+			Name:              name,
+			NormativeDeadline: time.Now(),
+			Status:            string(taskStatus),
+			ProjectStatus:     &projectStatus,
+			StatusOrder:       order,
+		}
+		require.NoError(t, db.Create(task).Error)
+	}
+	newTask("Подготовка", models.ProjectStatusClosurePrep, 1, models.TaskStatusCompleted)
+	newTask("Вывоз", models.ProjectStatusEquipmentRemoval, 2, models.TaskStatusInProgress)
+	// Статус не из набора закрытия игнорируется
+	newTask("РСР", models.ProjectStatusRSR, 0, models.TaskStatusInProgress)
+
+	info, err := service.GetProjectStatusInfo(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ProjectStatusEquipmentRemoval), info["suggestedStatus"])
+
+	// Когда все задачи завершены, проект получает статус завершения своего типа
+	require.NoError(t, db.Model(&models.ProjectTask{}).Where("\"ProjectId\" = ?", project.ID).
+		Update("Status", string(models.TaskStatusCompleted)).Error)
+	info, err = service.GetProjectStatusInfo(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ProjectStatusClosed), info["suggestedStatus"])
+}
+
+func TestProjectStatusService_CheckTransition(t *testing.T) {
+	db := setupTestDB(t)
+	service := services.NewProjectStatusService(
+		repositories.NewProjectRepository(db),
+		repositories.NewTaskRepository(db),
+		repositories.NewUserActivityRepository(db),
+		repositories.NewProjectStatusRepository(db),
+	)
+
+	project := &models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening), Status: string(models.ProjectStatusAuditObject)}
+	require.NoError(t, db.Create(project).Error)
+	require.NoError(t, db.Create(&models.ProjectTask{
+		ProjectID: project.ID, Name: "Аудит", NormativeDeadline: time.Now(), Status: string(models.TaskStatusInProgress),
+	}).Error)
+
+	failed := string(models.ProjectStatusFailed)
+	assert.ErrorIs(t, service.CheckTransition(project, failed, "", []string{models.RoleMP}), services.ErrStatusTransitionForbidden)
+	assert.ErrorIs(t, service.CheckTransition(project, failed, "", []string{models.RoleNOR}), services.ErrStatusReasonRequired)
+	assert.NoError(t, service.CheckTransition(project, failed, "Арендодатель отказался", []string{models.RoleNOR}))
+
+	// Открыть можно только после завершения всех задач
+	opened := string(models.ProjectStatusOpened)
+	assert.ErrorIs(t, service.CheckTransition(project, opened, "", []string{models.RoleMP}), services.ErrStatusGuardFailed)
+	assert.NoError(t, service.CheckTransition(project, string(models.ProjectStatusLayout), "", []string{models.RoleMP}))
+
+	project.Status = failed
+	assert.ErrorIs(t, service.CheckTransition(project, opened, "", []string{models.RoleAdmin}), services.ErrStatusTransitionNotAllowed)
+	assert.NoError(t, service.CheckTransition(project, string(models.ProjectStatusCreated), "Переговоры возобновлены", []string{models.RoleRNR}))
+}
+
+func TestProjectStatusService_UpdateProjectStatus_KeepsPinnedStatus(t *testing.T) {
+	db := setupTestDB(t)
+	projectRepo := repositories.NewProjectRepository(db)
+	service := services.NewProjectStatusService(
+		projectRepo,
+		repositories.NewTaskRepository(db),
+		repositories.NewUserActivityRepository(db),
+		repositories.NewProjectStatusRepository(db),
+	)
+
+	project := &models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening), Status: string(models.ProjectStatusLayout)}
+	require.NoError(t, db.Create(project).Error)
+	require.NoError(t, db.Model(project).Update("StatusPinned", true).Error)
+
+	auditStatus := string(models.ProjectStatusAuditObject)
+	require.NoError(t, db.Create(&models.ProjectTask{
+		ProjectID: project.ID, Name: "Аудит", NormativeDeadline: time.Now(), Status: string(models.TaskStatusInProgress),
+		ProjectStatus: &auditStatus, StatusOrder: 2,
+	}).Error)
+
+	require.NoError(t, service.UpdateProjectStatus(project.ID, 1))
+	reloaded, err := projectRepo.FindByID(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.ProjectStatusLayout), reloaded.Status)
+}
+
+func TestProjectStatusService_SuggestedStatus_RSRStage(t *testing.T) {
+	db := setupTestDB(t)
+	service := services.NewProjectStatusService(
+		repositories.NewProjectRepository(db),
+		repositories.NewTaskRepository(db),
+		repositories.NewUserActivityRepository(db),
+		repositories.NewProjectStatusRepository(db),
+	)
+
+	project := &models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening), Status: string(models.ProjectStatusCreated)}
+	require.NoError(t, db.Create(project).Error)
+
+	newTask := func(name, stage string, status models.ProjectStatus, order int, taskStatus models.TaskStatus) *models.ProjectTask {
+		task := &models.ProjectTask{
+			ProjectID:         project.ID,
+			Name:              name,
+			NormativeDeadline: time.Now(),
+			Status:            string(taskStatus),
+			Stage:             &stage,
+			StatusOrder:       order,
+		}
+		if status != "" {
+			projectStatus := string(status)
+			task.ProjectStatus = &projectStatus
+		}
+		require.NoError(t, db.Create(task).Error)
+		return task
+	}
+	suggested := func() string {
+		info, err := service.GetProjectStatusInfo(project.ID)
+		require.NoError(t, err)
+		return info["suggestedStatus"].(string)
+	}
+
+	newTask("Общий бюджет", "Бюджет", models.ProjectStatusTotalBudget, 12, models.TaskStatusCompleted)
+	repair := newTask("Ремонт торгового зала", models.StageRSR, "", 0, models.TaskStatusPending)
+	layout := newTask("Планировка", "Проектирование", models.ProjectStatusLayout, 7, models.TaskStatusInProgress)
+
+	// Задача в работе важнее этапа, который еще не начат
+	assert.Equal(t, string(models.ProjectStatusLayout), suggested())
+
+	// Начатый этап РСР важнее последней завершенной задачи, но уступает задачам в работе
+	require.NoError(t, db.Model(repair).Update("Status", string(models.TaskStatusInProgress)).Error)
+	assert.Equal(t, string(models.ProjectStatusLayout), suggested())
+	require.NoError(t, db.Model(layout).Update("Status", string(models.TaskStatusCompleted)).Error)
+	assert.Equal(t, string(models.ProjectStatusRSR), suggested())
+
+	// Когда завершено все, проект открыт
+	require.NoError(t, db.Model(repair).Update("Status", string(models.TaskStatusCompleted)).Error)
+	assert.Equal(t, string(models.ProjectStatusOpened), suggested())
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+
+	"gorm.io/gorm"
+)
+
+// ProjectTeamService управляет командой проекта и доступом к данным проектов
+type ProjectTeamService struct {
+	db         *gorm.DB
+	memberRepo repositories.ProjectMemberRepository
+	userRepo   repositories.UserRepository
+}
+
+func NewProjectTeamService(db *gorm.DB, memberRepo repositories.ProjectMemberRepository, userRepo repositories.UserRepository) *ProjectTeamService {
+	return &ProjectTeamService{
+		db:         db,
+		memberRepo: memberRepo,
+		userRepo:   userRepo,
+	}
+}
+
+// GetMembers возвращает команду проекта
+func (s *ProjectTeamService) GetMembers(projectID uint) ([]models.ProjectMember, error) {
+	return s.memberRepo.FindByProject(projectID)
+}
+
+// AddMember добавляет пользователя в команду проекта
+func (s *ProjectTeamService) AddMember(projectID uint, member *models.ProjectMember) error {
+	if !models.IsValidProjectRole(member.Role) {
+		return fmt.Errorf("недопустимая роль в проекте: %s", member.Role)
+	}
+	if _, err := s.userRepo.FindByID(member.UserID); err != nil {
+		return fmt.Errorf("пользователь %d не найден", member.UserID)
+	}
+
+	member.ID = 0
+	member.ProjectID = projectID
+	if err := s.memberRepo.Create(member); err != nil {
+		return err
+	}
+	user, _ := s.userRepo.FindByID(member.UserID)
+	member.User = user
+	return nil
+}
+
+// RemoveMember исключает участника из команды проекта
+func (s *ProjectTeamService) RemoveMember(projectID uint, memberID uint) error {
+	return s.memberRepo.Delete(projectID, memberID)
+}
+
+// CanViewProject проверяет, виден ли проект пользователю
+func (s *ProjectTeamService) CanViewProject(scope repositories.ProjectScope, projectID uint) (bool, error) {
+	return s.memberRepo.CanView(scope, projectID)
+}
+
+// ProjectIDOf возвращает ID проекта, к которому относится сущность
+func (s *ProjectTeamService) ProjectIDOf(entityType string, id uint) (uint, error) {
+	var target interface{}
+	switch entityType {
+	case models.EntityProject:
+		return id, nil
+	case models.EntityTask:
+		target = &models.ProjectTask{}
+	case models.EntityDocument:
+		target = &models.ProjectDocument{}
+	default:
+		return 0, fmt.Errorf("неизвестный тип сущности %s", entityType)
+	}
+
+	var projectID uint
+	err := s.db.Model(target).Select("\"ProjectId\"").Where("\"Id\" = ?", id).Scan(&projectID).Error
+	if err != nil {
+		return 0, err
+	}
+	if projectID == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return projectID, nil
+}
+
+// CanViewEntity проверяет доступ к сущности через ее проект
+func (s *ProjectTeamService) CanViewEntity(scope repositories.ProjectScope, entityType string, id uint) (bool, error) {
+	if scope.ViewAll {
+		return true, nil
+	}
+	projectID, err := s.ProjectIDOf(entityType, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return s.CanViewProject(scope, projectID)
+}
+
+// CanViewRequest проверяет доступ к заявке: участникам заявки, их заместителям и команде ее проекта
+func (s *ProjectTeamService) CanViewRequest(scope repositories.ProjectScope, request *models.Request) (bool, error) {
+	if scope.ViewAll {
+		return true, nil
+	}
+	for _, id := range append([]uint{scope.UserID}, scope.ActingFor...) {
+		if request.CreatedByUserID == id || request.AssignedToUserID == id {
+			return true, nil
+		}
+	}
+	if request.ProjectID == nil {
+		return false, nil
+	}
+	return s.CanViewProject(scope, *request.ProjectID)
+}
+
+// AreaOfProject возвращает область проекта (см. models.Project.Area)
+func (s *ProjectTeamService) AreaOfProject(projectID uint) (models.AccessArea, error) {
+	var project models.Project
+	if err := s.db.Preload("Store").Select("Id", "StoreId", "Region", "CFO").First(&project, projectID).Error; err != nil {
+		return models.AccessArea{}, err
+	}
+	return project.Area(), nil
+}
+
+// AreaOfEntity возвращает регион и ЦФО проекта, к которому относится сущность
+func (s *ProjectTeamService) AreaOfEntity(entityType string, id uint) (models.AccessArea, error) {
+	projectID, err := s.ProjectIDOf(entityType, id)
+	if err != nil {
+		return models.AccessArea{}, err
+	}
+	return s.AreaOfProject(projectID)
+}
+
+// HasPermissionFor проверяет право пользователя в области проекта сущности
+func (s *ProjectTeamService) HasPermissionFor(access *models.UserAccess, perm string, entityType string, id uint) (bool, error) {
+	if global, _ := access.Areas(perm); global {
+		return true, nil
+	}
+	area, err := s.AreaOfEntity(entityType, id)
+	if err != nil {
+		return false, err
+	}
+	return access.HasPermissionIn(perm, area.Region, area.CFO), nil
+}
+
+// CanEditTask проверяет право на изменение задачи.
+// task:edit разрешает любые задачи; task:edit_own — назначенные пользователю
+// или задачи проектов, где он в команде с ролью из ProjectRolesEditingTasks.
+// Заместитель может то же, что и замещаемый им сотрудник.
+// Учитываются только роли, действующие в регионе и ЦФО проекта
+func (s *ProjectTeamService) CanEditTask(userID uint, access *models.UserAccess, taskID uint) (bool, error) {
+	var task models.ProjectTask
+	if err := s.db.Select("Id", "ProjectId", "ResponsibleUserId").First(&task, taskID).Error; err != nil {
+		return false, err
+	}
+	perms, err := s.permissionsInProject(access, task.ProjectID)
+	if err != nil {
+		return false, err
+	}
+
+	if hasPermission(perms, models.PermTaskEdit) {
+		return true, nil
+	}
+	if !hasPermission(perms, models.PermTaskEditOwn) {
+		return false, nil
+	}
+	if task.ResponsibleUserID != nil && access.CanActFor(userID, uint(*task.ResponsibleUserID)) {
+		return true, nil
+	}
+	return s.hasEditingRole(task.ProjectID, userID, access)
+}
+
+// CanEditProjectFiles проверяет право на изменение документов проекта, не привязанных к задаче
+func (s *ProjectTeamService) CanEditProjectFiles(userID uint, access *models.UserAccess, projectID uint) (bool, error) {
+	perms, err := s.permissionsInProject(access, projectID)
+	if err != nil {
+		return false, err
+	}
+	if hasPermission(perms, models.PermTaskEdit) {
+		return true, nil
+	}
+	if !hasPermission(perms, models.PermTaskEditOwn) {
+		return false, nil
+	}
+	return s.hasEditingRole(projectID, userID, access)
+}
+
+// hasEditingRole проверяет, что пользователь или замещаемый им сотрудник в команде проекта с ролью,
+// позволяющей редактировать задачи
+func (s *ProjectTeamService) hasEditingRole(projectID uint, userID uint, access *models.UserAccess) (bool, error) {
+	for _, id := range append([]uint{userID}, access.ActingFor...) {
+		ok, err := s.memberRepo.HasRole(projectID, id, models.ProjectRolesEditingTasks)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// CanEditEntity проверяет право на изменение задачи или документа
+func (s *ProjectTeamService) CanEditEntity(userID uint, access *models.UserAccess, entityType string, id uint) (bool, error) {
+	switch entityType {
+	case models.EntityTask:
+		return s.CanEditTask(userID, access, id)
+	case models.EntityDocument:
+		var doc models.ProjectDocument
+		if err := s.db.Select("Id", "ProjectId", "TaskId").First(&doc, id).Error; err != nil {
+			return false, err
+		}
+		if doc.TaskID != nil {
+			return s.CanEditTask(userID, access, uint(*doc.TaskID))
+		}
+		return s.CanEditProjectFiles(userID, access, doc.ProjectID)
+	default:
+		return false, fmt.Errorf("неизвестный тип сущности %s", entityType)
+	}
+}
+
+// permissionsInProject возвращает права ролей, действующих в области проекта
+func (s *ProjectTeamService) permissionsInProject(access *models.UserAccess, projectID uint) ([]string, error) {
+	area, err := s.AreaOfProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return access.PermissionsIn(area.Region, area.CFO), nil
+}
+
+func hasPermission(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
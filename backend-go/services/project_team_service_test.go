@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectTeamService_ProjectVisibility(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	projectRepo := repositories.NewProjectRepository(db)
+	taskRepo := repositories.NewTaskRepository(db)
+	team := services.NewProjectTeamService(db, repositories.NewProjectMemberRepository(db), userRepo)
+
+	mp := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP}
+	mriz := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMRiZ}
+	require.NoError(t, db.Create(&mp).Error)
+	require.NoError(t, db.Create(&mriz).Error)
+
+	own := models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening)}
+	assigned := models.Project{StoreID: 2, ProjectType: string(models.ProjectTypeOpening)}
+	foreign := models.Project{StoreID: 3, ProjectType: string(models.ProjectTypeOpening)}
+	for _, p := range []*models.Project{&own, &assigned, &foreign} {
+		require.NoError(t, db.Create(p).Error)
+	}
+
+	require.NoError(t, team.AddMember(own.ID, &models.ProjectMember{UserID: mp.ID, Role: models.ProjectRoleMP}))
+	assert.Error(t, team.AddMember(own.ID, &models.ProjectMember{UserID: mriz.ID, Role: "Наблюдатель"}))
+
+	// Исполнитель задачи видит ее проект, даже не состоя в команде
+	responsible := int(mp.ID)
+	task := models.ProjectTask{ProjectID: assigned.ID, Name: "Аудит", NormativeDeadline: time.Now(), ResponsibleUserID: &responsible}
+	require.NoError(t, db.Create(&task).Error)
+	require.NoError(t, db.Create(&models.ProjectTask{ProjectID: foreign.ID, Name: "Чужая", NormativeDeadline: time.Now()}).Error)
+
+	scope := repositories.ProjectScope{UserID: mp.ID}
+	var ids []uint
+	require.NoError(t, scope.Apply(db.Model(&models.Project{}), "\"Id\"").Pluck("Id", &ids).Error)
+	assert.ElementsMatch(t, []uint{own.ID, assigned.ID}, ids)
+
+	tasks, err := taskRepo.FindAll(scope)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, task.ID, tasks[0].ID)
+
+	ok, err := team.CanViewEntity(scope, models.EntityProject, foreign.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = team.CanViewEntity(repositories.ProjectScope{UserID: mriz.ID, ViewAll: true}, models.EntityProject, foreign.ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Имена по ролям заполняются из команды
+	loaded, err := projectRepo.FindByID(own.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Иванов И.И.", loaded.MP)
+}
+
+func TestProjectTeamService_CanEditTask(t *testing.T) {
+	db := setupTestDB(t)
+	team := services.NewProjectTeamService(db, repositories.NewProjectMemberRepository(db), repositories.NewUserRepository(db))
+
+	owner := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMRiZ}
+	manager := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP}
+	senior := models.User{Name: "Смирнов С.С.", Login: "smirnov", Role: models.RoleMRiZ}
+	for _, u := range []*models.User{&owner, &manager, &senior} {
+		require.NoError(t, db.Create(u).Error)
+	}
+
+	project := models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening)}
+	require.NoError(t, db.Create(&project).Error)
+	require.NoError(t, team.AddMember(project.ID, &models.ProjectMember{UserID: manager.ID, Role: models.ProjectRoleMP}))
+	require.NoError(t, team.AddMember(project.ID, &models.ProjectMember{UserID: senior.ID, Role: models.ProjectRoleStMRiZ}))
+
+	responsible := int(owner.ID)
+	task := models.ProjectTask{ProjectID: project.ID, Name: "Аудит", NormativeDeadline: time.Now(), ResponsibleUserID: &responsible}
+	require.NoError(t, db.Create(&task).Error)
+
+	editOwn := models.NewGlobalAccess(models.RoleMRiZ, []string{models.PermTaskEditOwn})
+	cases := []struct {
+		name   string
+		user   uint
+		access *models.UserAccess
+		want   bool
+	}{
+		{"исполнитель задачи", owner.ID, editOwn, true},
+		{"МП проекта", manager.ID, editOwn, true},
+		{"участник без роли управления", senior.ID, editOwn, false},
+		{"право task:edit", senior.ID, models.NewGlobalAccess(models.RoleNOR, []string{models.PermTaskEdit}), true},
+		{"без прав на редактирование", owner.ID, models.NewGlobalAccess(models.RoleBA, []string{models.PermTaskView}), false},
+	}
+	for _, tc := range cases {
+		got, err := team.CanEditTask(tc.user, tc.access, task.ID)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.want, got, tc.name)
+	}
+
+	// Документ задачи наследует проверку задачи
+	taskID := int(task.ID)
+	doc := models.ProjectDocument{ProjectID: project.ID, TaskID: &taskID, Name: "Акт", Type: "Акт", UploadDate: time.Now(), FilePath: "a", FileName: "a"}
+	require.NoError(t, db.Create(&doc).Error)
+	ok, err := team.CanEditEntity(senior.ID, editOwn, models.EntityDocument, doc.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = team.CanEditEntity(owner.ID, editOwn, models.EntityDocument, doc.ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestProjectTeamService_RegionalRoles(t *testing.T) {
+	db := setupTestDB(t)
+	team := services.NewProjectTeamService(db, repositories.NewProjectMemberRepository(db), repositories.NewUserRepository(db))
+
+	manager := models.User{Name: "Смирнов С.С.", Login: "smirnov", Role: models.RoleRNR}
+	require.NoError(t, db.Create(&manager).Error)
+
+	moscow := models.Store{Code: "M1", Name: "Москва-1", Region: "Москва"}
+	kazan := models.Store{Code: "K1", Name: "Казань-1", Region: "Казань"}
+	require.NoError(t, db.Create(&moscow).Error)
+	require.NoError(t, db.Create(&kazan).Error)
+
+	local := models.Project{StoreID: moscow.ID, ProjectType: string(models.ProjectTypeOpening)}
+	remote := models.Project{StoreID: kazan.ID, ProjectType: string(models.ProjectTypeOpening)}
+	require.NoError(t, db.Create(&local).Error)
+	require.NoError(t, db.Create(&remote).Error)
+
+	// РНР в Москве, МП — без ограничения области
+	access := &models.UserAccess{Grants: []models.RoleGrant{
+		{Role: models.RoleRNR, Area: models.AccessArea{Region: "Москва"}, Permissions: []string{models.PermProjectViewAll, models.PermTaskEdit}},
+		{Role: models.RoleMP, Permissions: []string{models.PermTaskEditOwn}},
+	}}
+	global, areas := access.Areas(models.PermProjectViewAll)
+	require.False(t, global)
+
+	scope := repositories.ProjectScope{UserID: manager.ID, Areas: areas}
+	var ids []uint
+	require.NoError(t, scope.Apply(db.Model(&models.Project{}), "\"Id\"").Pluck("Id", &ids).Error)
+	assert.Equal(t, []uint{local.ID}, ids)
+
+	localTask := models.ProjectTask{ProjectID: local.ID, Name: "Аудит", NormativeDeadline: time.Now()}
+	remoteTask := models.ProjectTask{ProjectID: remote.ID, Name: "Аудит", NormativeDeadline: time.Now()}
+	require.NoError(t, db.Create(&localTask).Error)
+	require.NoError(t, db.Create(&remoteTask).Error)
+
+	ok, err := team.CanEditTask(manager.ID, access, localTask.ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// В Казани действует только task:edit_own роли МП
+	ok, err = team.CanEditTask(manager.ID, access, remoteTask.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.ElementsMatch(t, []string{models.RoleRNR, models.RoleMP}, access.RolesIn("Москва", ""))
+	assert.Equal(t, []string{models.RoleMP}, access.RolesIn("Казань", ""))
+}
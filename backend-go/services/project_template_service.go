@@ -5,16 +5,18 @@ import (
 	"fmt"
 	"portal-razvitie/models"
 	"portal-razvitie/repositories"
+	"time"
 
 	"github.com/lib/pq"
 )
 
 type ProjectTemplateService struct {
-	repo repositories.ProjectTemplateRepository
+	repo          repositories.ProjectTemplateRepository
+	statusService *ProjectStatusService
 }
 
-func NewProjectTemplateService(repo repositories.ProjectTemplateRepository) *ProjectTemplateService {
-	return &ProjectTemplateService{repo: repo}
+func NewProjectTemplateService(repo repositories.ProjectTemplateRepository, statusService *ProjectStatusService) *ProjectTemplateService {
+	return &ProjectTemplateService{repo: repo, statusService: statusService}
 }
 
 // GetAll возвращает все шаблоны
@@ -66,6 +68,10 @@ func (s *ProjectTemplateService) Update(template *models.ProjectTemplate) error
 		return errors.New("шаблон не найден")
 	}
 
+	// Счетчик версий меняется только через Publish
+	template.LatestVersion = existing.LatestVersion
+	template.HasDraftChanges = existing.HasDraftChanges || len(template.Tasks) > 0
+
 	// Если изменили IsDefault на true, нужно убрать флаг у других
 	if template.IsDefault && !existing.IsDefault {
 		if err := s.repo.SetDefault(template.ID); err != nil {
@@ -134,6 +140,8 @@ func (s *ProjectTemplateService) Clone(sourceID uint, newName string) (*models.P
 			ResponsibleRole: task.ResponsibleRole,
 			TaskType:        task.TaskType,
 			Order:           task.Order,
+			ProjectStatus:   task.ProjectStatus,
+			StatusOrder:     task.StatusOrder,
 		}
 		clone.Tasks = append(clone.Tasks, clonedTask)
 	}
@@ -167,6 +175,8 @@ func (s *ProjectTemplateService) ImportFromTaskDefinitions(name string, taskDefs
 			ResponsibleRole: def.ResponsibleRole,
 			TaskType:        def.TaskType,
 			Order:           i,
+			ProjectStatus:   def.ProjectStatus,
+			StatusOrder:     def.StatusOrder,
 		}
 		template.Tasks = append(template.Tasks, task)
 	}
@@ -191,6 +201,8 @@ func (s *ProjectTemplateService) ExportToTaskDefinitions(templateID uint) ([]mod
 			DependsOn:       pq.StringArray(task.DependsOn),
 			ResponsibleRole: task.ResponsibleRole,
 			TaskType:        task.TaskType,
+			ProjectStatus:   task.ProjectStatus,
+			StatusOrder:     task.StatusOrder,
 		}
 		taskDefs = append(taskDefs, taskDef)
 	}
@@ -215,6 +227,8 @@ func (s *ProjectTemplateService) UpdateTask(templateID uint, taskID uint, update
 			template.Tasks[i].DependsOn = updatedTask.DependsOn
 			template.Tasks[i].ResponsibleRole = updatedTask.ResponsibleRole
 			template.Tasks[i].Order = updatedTask.Order
+			template.Tasks[i].ProjectStatus = updatedTask.ProjectStatus
+			template.Tasks[i].StatusOrder = updatedTask.StatusOrder
 			found = true
 			break
 		}
@@ -224,6 +238,7 @@ func (s *ProjectTemplateService) UpdateTask(templateID uint, taskID uint, update
 		return errors.New("задача не найдена в шаблоне")
 	}
 
+	template.HasDraftChanges = true
 	return s.repo.Update(template)
 }
 
@@ -253,6 +268,8 @@ func (s *ProjectTemplateService) AddTaskFromDefinition(templateID uint, taskDef
 		ResponsibleRole:   taskDef.ResponsibleRole,
 		TaskType:          taskDef.TaskType,
 		Order:             len(template.Tasks), // Добавить в конец
+		ProjectStatus:     taskDef.ProjectStatus,
+		StatusOrder:       taskDef.StatusOrder,
 	}
 
 	// Создать задачу напрямую в базе (без обновления всего шаблона)
@@ -260,6 +277,10 @@ func (s *ProjectTemplateService) AddTaskFromDefinition(templateID uint, taskDef
 		return nil, fmt.Errorf("ошибка при создании задачи: %w", err)
 	}
 
+	if err := s.repo.MarkDraftChanged(templateID); err != nil {
+		return nil, err
+	}
+
 	return &newTask, nil
 }
 
@@ -284,7 +305,11 @@ func (s *ProjectTemplateService) DeleteTask(templateID uint, taskID uint) error
 	}
 
 	// Удалить задачу напрямую через репозиторий
-	return s.repo.DeleteTask(templateID, taskID)
+	if err := s.repo.DeleteTask(templateID, taskID); err != nil {
+		return err
+	}
+
+	return s.repo.MarkDraftChanged(templateID)
 }
 
 // AddCustomTask adds a new custom task to the template
@@ -310,5 +335,139 @@ func (s *ProjectTemplateService) AddCustomTask(templateID uint, taskData *models
 		return nil, fmt.Errorf("error creating task: %w", err)
 	}
 
+	if err := s.repo.MarkDraftChanged(templateID); err != nil {
+		return nil, err
+	}
+
 	return taskData, nil
 }
+
+// Publish фиксирует текущий черновик шаблона как новую неизменяемую версию
+func (s *ProjectTemplateService) Publish(templateID uint, userID uint, comment string) (*models.ProjectTemplateVersion, error) {
+	template, err := s.repo.FindByID(templateID)
+	if err != nil {
+		return nil, errors.New("шаблон не найден")
+	}
+
+	if len(template.Tasks) == 0 {
+		return nil, errors.New("нельзя опубликовать шаблон без задач")
+	}
+
+	if err := validateTemplateDependencies(template.Tasks); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateStatusMapping(template); err != nil {
+		return nil, err
+	}
+
+	version := &models.ProjectTemplateVersion{
+		ProjectTemplateID: template.ID,
+		Version:           template.LatestVersion + 1,
+		Name:              template.Name,
+		Category:          template.Category,
+		Comment:           comment,
+		PublishedAt:       time.Now().UTC(),
+	}
+	if userID != 0 {
+		version.PublishedByUserID = &userID
+	}
+
+	for _, task := range template.Tasks {
+		version.Tasks = append(version.Tasks, models.TemplateVersionTask{
+			Code:            task.Code,
+			Name:            task.Name,
+			Duration:        task.Duration,
+			Stage:           task.Stage,
+			DependsOn:       append(pq.StringArray{}, task.DependsOn...),
+			ResponsibleRole: task.ResponsibleRole,
+			TaskType:        task.TaskType,
+			Order:           task.Order,
+			TaskTemplateID:  task.TaskTemplateID,
+			ProjectStatus:   task.ProjectStatus,
+			StatusOrder:     task.StatusOrder,
+		})
+	}
+
+	if err := s.repo.CreateVersion(template, version); err != nil {
+		return nil, fmt.Errorf("ошибка при публикации версии: %w", err)
+	}
+
+	return version, nil
+}
+
+// GetVersions возвращает список опубликованных версий шаблона
+func (s *ProjectTemplateService) GetVersions(templateID uint) ([]models.ProjectTemplateVersion, error) {
+	if _, err := s.repo.FindByID(templateID); err != nil {
+		return nil, errors.New("шаблон не найден")
+	}
+	return s.repo.FindVersions(templateID)
+}
+
+// GetVersion возвращает конкретную версию шаблона вместе с задачами
+func (s *ProjectTemplateService) GetVersion(templateID uint, version int) (*models.ProjectTemplateVersion, error) {
+	return s.repo.FindVersion(templateID, version)
+}
+
+// validateStatusMapping проверяет, что задачи ссылаются на статусы из набора типа проекта.
+// Категория шаблона совпадает с типом проекта; для прочих категорий проверка не выполняется
+func (s *ProjectTemplateService) validateStatusMapping(template *models.ProjectTemplate) error {
+	if s.statusService == nil || !models.IsValidProjectType(template.Category) {
+		return nil
+	}
+	for _, task := range template.Tasks {
+		if task.ProjectStatus != "" && !s.statusService.IsValidStatus(template.Category, task.ProjectStatus) {
+			return fmt.Errorf("задача %s: статуса \"%s\" нет в наборе статусов типа \"%s\"", task.Code, task.ProjectStatus, template.Category)
+		}
+	}
+	return nil
+}
+
+// validateTemplateDependencies проверяет, что зависимости ссылаются на задачи шаблона
+// и не образуют циклов
+func validateTemplateDependencies(tasks []models.TemplateTask) error {
+	deps := make(map[string][]string, len(tasks))
+	for _, t := range tasks {
+		deps[t.Code] = t.DependsOn
+	}
+
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("задача %s зависит от отсутствующей задачи %s", t.Code, dep)
+			}
+		}
+	}
+
+	// Поиск цикла обходом в глубину
+	const (
+		unvisited = iota
+		inStack
+		done
+	)
+	state := make(map[string]int, len(tasks))
+	var visit func(code string) error
+	visit = func(code string) error {
+		switch state[code] {
+		case inStack:
+			return fmt.Errorf("циклическая зависимость через задачу %s", code)
+		case done:
+			return nil
+		}
+		state[code] = inStack
+		for _, dep := range deps[code] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[code] = done
+		return nil
+	}
+	for _, t := range tasks {
+		if err := visit(t.Code); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
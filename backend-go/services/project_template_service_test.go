@@ -0,0 +1,72 @@
+package services_test
+
+import (
+	"testing"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectTemplateService_PublishVersions(t *testing.T) {
+	db := setupTestDB(t)
+	repo := repositories.NewProjectTemplateRepository(db)
+	service := services.NewProjectTemplateService(repo, nil)
+
+	empty := models.ProjectTemplate{Name: "Пустой"}
+	require.NoError(t, service.Create(&empty))
+	_, err := service.Publish(empty.ID, 0, "")
+	assert.Error(t, err)
+
+	template := models.ProjectTemplate{Name: "Открытие", Tasks: []models.TemplateTask{
+		{Code: "TASK-A", Name: "Аудит", Duration: 2, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP, Order: 0},
+		{Code: "TASK-B", Name: "Обмер", Duration: 1, DependsOn: pq.StringArray{"TASK-A"}, ResponsibleRole: models.RoleMP, Order: 1},
+	}}
+	require.NoError(t, service.Create(&template))
+
+	v1, err := service.Publish(template.ID, 0, "Первая версия")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	stored, err := service.GetByID(template.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.LatestVersion)
+	assert.False(t, stored.HasDraftChanges)
+
+	// Изменение черновика помечает шаблон, но не меняет опубликованную версию
+	_, err = service.AddCustomTask(template.ID, &models.TemplateTask{Code: "TASK-C", Name: "Планировка", Duration: 3, DependsOn: pq.StringArray{"TASK-B"}, ResponsibleRole: models.RoleMP})
+	require.NoError(t, err)
+	stored, err = service.GetByID(template.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.HasDraftChanges)
+
+	v2, err := service.Publish(template.ID, 0, "Планировка")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v2.Version)
+
+	snapshot, err := service.GetVersion(template.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, snapshot.Tasks, 2)
+	assert.Equal(t, []string{"TASK-A"}, []string(snapshot.Tasks[1].DependsOn))
+	latest, err := service.GetVersion(template.ID, 2)
+	require.NoError(t, err)
+	assert.Len(t, latest.Tasks, 3)
+
+	versions, err := service.GetVersions(template.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Equal(t, "Первая версия", versions[1].Comment)
+
+	// Черновик с зависимостью от удаленной задачи не публикуется
+	for _, task := range stored.Tasks {
+		if task.Code == "TASK-B" {
+			require.NoError(t, service.DeleteTask(template.ID, task.ID))
+		}
+	}
+	_, err = service.Publish(template.ID, 0, "")
+	assert.ErrorContains(t, err, "TASK-C зависит от отсутствующей задачи TASK-B")
+}
@@ -1,24 +1,32 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"portal-razvitie/cache"
 	"portal-razvitie/models"
 
 	"gorm.io/gorm"
 )
 
+// ErrUnknownPermission право отсутствует в каталоге models.PermissionCatalog
+var ErrUnknownPermission = errors.New("неизвестное право")
+
+// RBACService единственный источник прав ролей: таблицы Role/Permission и кэш прав по коду роли
 type RBACService struct {
-	db    *gorm.DB
-	cache *cache.PermissionCache // Dependency injection for cache ideally, but currently assumes global or passed instance
+	db          *gorm.DB
+	cache       *cache.PermissionCache
+	broadcaster cache.InvalidationBroadcaster
 }
 
-func NewRBACService(db *gorm.DB) *RBACService {
+func NewRBACService(db *gorm.DB, permCache *cache.PermissionCache, broadcaster cache.InvalidationBroadcaster) *RBACService {
+	if broadcaster == nil {
+		broadcaster = cache.NoopBroadcaster{}
+	}
 	return &RBACService{
-		db: db,
-		// Assuming we might inject cache later, but for now logic uses the global one or we can wrap it.
-		// Let's use the global one inside methods for now to minimize changes, or better:
-		// We can assign the global instance here if we want to mock it later.
-		cache: cache.GetCache(),
+		db:          db,
+		cache:       permCache,
+		broadcaster: broadcaster,
 	}
 }
 
@@ -38,6 +46,27 @@ func (s *RBACService) GetAllPermissions() ([]models.Permission, error) {
 	return perms, nil
 }
 
+// GetRolePermissions возвращает коды прав роли, сначала из кэша.
+// Для неизвестной роли возвращается пустой список
+func (s *RBACService) GetRolePermissions(roleCode string) ([]string, error) {
+	if perms, ok := s.cache.Get(roleCode); ok {
+		return perms, nil
+	}
+
+	var role models.Role
+	err := s.db.Preload("Permissions").Where(&models.Role{Code: roleCode}).First(&role).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	perms := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		perms = append(perms, p.Code)
+	}
+	s.cache.Set(roleCode, perms)
+	return perms, nil
+}
+
 func (s *RBACService) CreateRole(code, name string) (*models.Role, error) {
 	role := models.Role{
 		Code: code,
@@ -46,10 +75,18 @@ func (s *RBACService) CreateRole(code, name string) (*models.Role, error) {
 	if err := s.db.Create(&role).Error; err != nil {
 		return nil, err
 	}
+	// Роль могла быть закэширована как неизвестная
+	s.invalidate(role.Code)
 	return &role, nil
 }
 
 func (s *RBACService) UpdateRolePermissions(roleID string, permissionCodes []string) (*models.Role, error) {
+	for _, code := range permissionCodes {
+		if !models.IsKnownPermission(code) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, code)
+		}
+	}
+
 	var role models.Role
 	if err := s.db.First(&role, roleID).Error; err != nil {
 		return nil, err
@@ -65,9 +102,7 @@ func (s *RBACService) UpdateRolePermissions(roleID string, permissionCodes []str
 	if err := s.db.Model(&role).Association("Permissions").Replace(perms); err != nil {
 		return nil, err
 	}
-
-	// Invalidate cache
-	s.cache.Invalidate(role.Code)
+	s.invalidate(role.Code)
 
 	// Return updated role
 	if err := s.db.Preload("Permissions").First(&role, role.ID).Error; err != nil {
@@ -75,3 +110,9 @@ func (s *RBACService) UpdateRolePermissions(roleID string, permissionCodes []str
 	}
 	return &role, nil
 }
+
+// invalidate сбрасывает права роли в кэше этой реплики и рассылает инвалидацию остальным
+func (s *RBACService) invalidate(roleCode string) {
+	s.cache.Invalidate(roleCode)
+	s.broadcaster.Broadcast(roleCode)
+}
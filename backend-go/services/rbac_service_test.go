@@ -0,0 +1,87 @@
+package services_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"portal-razvitie/cache"
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingBroadcaster struct {
+	roles []string
+}
+
+func (b *recordingBroadcaster) Broadcast(roleCode string) {
+	b.roles = append(b.roles, roleCode)
+}
+
+func TestRBACService_RolePermissionsCache(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, database.SeedRBAC(db))
+
+	permCache := cache.NewPermissionCache(time.Minute)
+	broadcaster := &recordingBroadcaster{}
+	service := services.NewRBACService(db, permCache, broadcaster)
+
+	perms, err := service.GetRolePermissions(models.RoleMP)
+	require.NoError(t, err)
+	assert.Contains(t, perms, models.PermTaskEditOwn)
+	assert.NotContains(t, perms, models.PermTaskEdit)
+	_, cached := permCache.Get(models.RoleMP)
+	assert.True(t, cached)
+
+	var role models.Role
+	require.NoError(t, db.Where(&models.Role{Code: models.RoleMP}).First(&role).Error)
+	roleID := strconv.FormatUint(uint64(role.ID), 10)
+
+	_, err = service.UpdateRolePermissions(roleID, []string{"project:fly"})
+	assert.ErrorIs(t, err, services.ErrUnknownPermission)
+
+	_, err = service.UpdateRolePermissions(roleID, []string{models.PermProjectView})
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.RoleMP}, broadcaster.roles)
+
+	perms, err = service.GetRolePermissions(models.RoleMP)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.PermProjectView}, perms)
+
+	// Повторный запуск синхронизации не возвращает настроенной роли права по умолчанию
+	require.NoError(t, database.SeedRBAC(db))
+	require.NoError(t, db.Preload("Permissions").First(&role, role.ID).Error)
+	assert.Len(t, role.Permissions, 1)
+}
+
+func TestSeedRBAC_SelfServicePermissionsForCustomRoles(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, database.SeedRBAC(db))
+
+	var view models.Permission
+	require.NoError(t, db.Where(&models.Permission{Code: models.PermProjectView}).First(&view).Error)
+	custom := models.Role{Code: "auditor", Name: "Аудитор", Permissions: []models.Permission{view}}
+	require.NoError(t, db.Create(&custom).Error)
+
+	// Право комментирования появляется после обновления: его получают все роли, включая пользовательские
+	var comment models.Permission
+	require.NoError(t, db.Where(&models.Permission{Code: models.PermCommentCreate}).First(&comment).Error)
+	var roles []models.Role
+	require.NoError(t, db.Find(&roles).Error)
+	for i := range roles {
+		require.NoError(t, db.Model(&roles[i]).Association("Permissions").Delete(&comment))
+	}
+	require.NoError(t, db.Delete(&comment).Error)
+	require.NoError(t, database.SeedRBAC(db))
+
+	var codes []string
+	require.NoError(t, db.Preload("Permissions").First(&custom, custom.ID).Error)
+	for _, p := range custom.Permissions {
+		codes = append(codes, p.Code)
+	}
+	assert.ElementsMatch(t, []string{models.PermProjectView, models.PermCommentCreate}, codes)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"portal-razvitie/events"
 	"portal-razvitie/models"
 	"portal-razvitie/repositories"
@@ -10,21 +11,36 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrRequestForbidden действие с заявкой доступно только инициатору или только ответственному
+// (и их заместителям)
+var ErrRequestForbidden = errors.New("недостаточно прав для действия с заявкой")
+
+// RequestUpdate поля заявки, которые инициатор может изменить после создания
+type RequestUpdate struct {
+	Title       string
+	Description string
+	Priority    string
+	DueDate     *time.Time
+}
+
 type RequestService struct {
 	repo                *repositories.RequestRepository
 	notificationService *NotificationService
 	eventBus            *events.InMemoryEventBus
+	absences            *AbsenceService
 }
 
 func NewRequestService(
 	db *gorm.DB,
 	notifService *NotificationService,
 	eventBus *events.InMemoryEventBus,
+	absences *AbsenceService,
 ) *RequestService {
 	return &RequestService{
 		repo:                repositories.NewRequestRepository(db),
 		notificationService: notifService,
 		eventBus:            eventBus,
+		absences:            absences,
 	}
 }
 
@@ -38,6 +54,11 @@ func (s *RequestService) CreateRequest(request *models.Request) error {
 	// Установка значений по умолчанию
 	request.SetDefaultValues()
 
+	// Заявку отсутствующему сотруднику получает его заместитель, если это не сам инициатор
+	if assignee, from := s.absences.ResolveAssignee(request.AssignedToUserID); assignee != request.CreatedByUserID {
+		request.AssignedToUserID, request.DelegatedFromUserID = assignee, from
+	}
+
 	// Создание заявки
 	if err := s.repo.Create(request); err != nil {
 		return err
@@ -53,8 +74,9 @@ func (s *RequestService) CreateRequest(request *models.Request) error {
 
 	// Создание уведомления для ответственного
 	if s.notificationService != nil {
-		s.notificationService.SendNotification(
+		s.notificationService.SendAssignmentNotification(
 			createdRequest.AssignedToUserID,
+			createdRequest.DelegatedFromUserID,
 			"Новая заявка",
 			"Вам назначена новая заявка: "+createdRequest.Title,
 			"request_assigned",
@@ -78,19 +100,19 @@ func (s *RequestService) GetRequest(id uint) (*models.Request, error) {
 	return s.repo.FindByID(id)
 }
 
-// GetAllRequests возвращает все заявки
-func (s *RequestService) GetAllRequests() ([]models.Request, error) {
-	return s.repo.FindAll()
+// GetAllRequests возвращает все доступные заявки
+func (s *RequestService) GetAllRequests(scope repositories.ProjectScope) ([]models.Request, error) {
+	return s.repo.FindAll(scope)
 }
 
 // GetRequestsByCreator возвращает заявки, созданные пользователем
-func (s *RequestService) GetRequestsByCreator(userID uint) ([]models.Request, error) {
-	return s.repo.FindByCreatedByUser(userID)
+func (s *RequestService) GetRequestsByCreator(scope repositories.ProjectScope, userID uint) ([]models.Request, error) {
+	return s.repo.FindByCreatedByUser(scope, userID)
 }
 
 // GetRequestsByAssignee возвращает заявки, назначенные пользователю
-func (s *RequestService) GetRequestsByAssignee(userID uint) ([]models.Request, error) {
-	return s.repo.FindByAssignedToUser(userID)
+func (s *RequestService) GetRequestsByAssignee(scope repositories.ProjectScope, userID uint) ([]models.Request, error) {
+	return s.repo.FindByAssignedToUser(scope, userID)
 }
 
 // TakeInWork переводит заявку в работу
@@ -101,8 +123,8 @@ func (s *RequestService) TakeInWork(requestID uint, userID uint) error {
 	}
 
 	// Проверка, что пользователь является ответственным
-	if request.AssignedToUserID != userID {
-		return errors.New("только ответственный может взять заявку в работу")
+	if !s.absences.CanActFor(userID, request.AssignedToUserID) {
+		return fmt.Errorf("%w: только ответственный может взять заявку в работу", ErrRequestForbidden)
 	}
 
 	// Проверка статуса
@@ -151,8 +173,8 @@ func (s *RequestService) AnswerRequest(requestID uint, userID uint, response str
 	}
 
 	// Проверка, что пользователь является ответственным
-	if request.AssignedToUserID != userID {
-		return errors.New("только ответственный может ответить на заявку")
+	if !s.absences.CanActFor(userID, request.AssignedToUserID) {
+		return fmt.Errorf("%w: только ответственный может ответить на заявку", ErrRequestForbidden)
 	}
 
 	// Проверка, что заявка может быть отвечена
@@ -204,8 +226,8 @@ func (s *RequestService) CloseRequest(requestID uint, userID uint) error {
 	}
 
 	// Проверка, что пользователь является инициатором
-	if request.CreatedByUserID != userID {
-		return errors.New("только инициатор может закрыть заявку")
+	if !s.absences.CanActFor(userID, request.CreatedByUserID) {
+		return fmt.Errorf("%w: только инициатор может закрыть заявку", ErrRequestForbidden)
 	}
 
 	// Проверка, что заявка может быть закрыта
@@ -253,8 +275,8 @@ func (s *RequestService) RejectRequest(requestID uint, userID uint, reason strin
 	}
 
 	// Проверка, что пользователь является ответственным
-	if request.AssignedToUserID != userID {
-		return errors.New("только ответственный может отклонить заявку")
+	if !s.absences.CanActFor(userID, request.AssignedToUserID) {
+		return fmt.Errorf("%w: только ответственный может отклонить заявку", ErrRequestForbidden)
 	}
 
 	if reason == "" {
@@ -295,14 +317,39 @@ func (s *RequestService) RejectRequest(requestID uint, userID uint, reason strin
 	return nil
 }
 
-// UpdateRequest обновляет заявку
-func (s *RequestService) UpdateRequest(request *models.Request) error {
+// UpdateRequest изменяет название, описание, приоритет и срок заявки; участники и статус
+// меняются только действиями с заявкой
+func (s *RequestService) UpdateRequest(id uint, userID uint, input RequestUpdate) (*models.Request, error) {
+	request, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Проверка, что пользователь является инициатором
+	if !s.absences.CanActFor(userID, request.CreatedByUserID) {
+		return nil, fmt.Errorf("%w: только инициатор может изменить заявку", ErrRequestForbidden)
+	}
+
+	if request.Status == string(models.RequestStatusClosed) || request.Status == string(models.RequestStatusRejected) {
+		return nil, errors.New("закрытую заявку изменить нельзя")
+	}
+
+	request.Title = input.Title
+	request.Description = input.Description
+	if input.Priority != "" {
+		request.Priority = input.Priority
+	}
+	request.DueDate = input.DueDate
+
 	// Валидация
 	if err := request.Validate(); err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.repo.Update(request)
+	if err := s.repo.Update(request); err != nil {
+		return nil, err
+	}
+	return request, nil
 }
 
 // DeleteRequest удаляет заявку
@@ -313,8 +360,8 @@ func (s *RequestService) DeleteRequest(id uint, userID uint) error {
 	}
 
 	// Только инициатор может удалить заявку
-	if request.CreatedByUserID != userID {
-		return errors.New("только инициатор может удалить заявку")
+	if !s.absences.CanActFor(userID, request.CreatedByUserID) {
+		return fmt.Errorf("%w: только инициатор может удалить заявку", ErrRequestForbidden)
 	}
 
 	// Можно удалить только новые заявки
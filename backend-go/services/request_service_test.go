@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"testing"
+
+	"portal-razvitie/events"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestService_ParticipantRights(t *testing.T) {
+	db := setupTestDB(t)
+	absences := services.NewAbsenceService(repositories.NewAbsenceRepository(db), repositories.NewUserRepository(db))
+	service := services.NewRequestService(db, nil, events.NewEventBus(), absences)
+
+	author := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMP, IsActive: true}
+	assignee := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	outsider := models.User{Name: "Сидоров С.С.", Login: "sidorov", Role: models.RoleMP, IsActive: true}
+	for _, u := range []*models.User{&author, &assignee, &outsider} {
+		require.NoError(t, db.Create(u).Error)
+	}
+	request := models.Request{Title: "Планировка", CreatedByUserID: author.ID, AssignedToUserID: assignee.ID}
+	require.NoError(t, service.CreateRequest(&request))
+
+	// Изменять и удалять заявку может только инициатор
+	_, err := service.UpdateRequest(request.ID, assignee.ID, services.RequestUpdate{Title: "Чужая правка"})
+	assert.ErrorIs(t, err, services.ErrRequestForbidden)
+	assert.ErrorIs(t, service.DeleteRequest(request.ID, outsider.ID), services.ErrRequestForbidden)
+
+	// Меняются только разрешенные поля: участники и статус остаются прежними
+	updated, err := service.UpdateRequest(request.ID, author.ID, services.RequestUpdate{Title: "Планировка v2", Priority: string(models.RequestPriorityHigh)})
+	require.NoError(t, err)
+	assert.Equal(t, "Планировка v2", updated.Title)
+	assert.Equal(t, string(models.RequestPriorityHigh), updated.Priority)
+	assert.Equal(t, assignee.ID, updated.AssignedToUserID)
+	assert.Equal(t, string(models.RequestStatusNew), updated.Status)
+
+	// Действия ответственного недоступны инициатору и посторонним
+	assert.ErrorIs(t, service.TakeInWork(request.ID, author.ID), services.ErrRequestForbidden)
+	assert.ErrorIs(t, service.AnswerRequest(request.ID, outsider.ID, "Готово"), services.ErrRequestForbidden)
+	assert.ErrorIs(t, service.RejectRequest(request.ID, author.ID, "Нет"), services.ErrRequestForbidden)
+	require.NoError(t, service.TakeInWork(request.ID, assignee.ID))
+	require.NoError(t, service.AnswerRequest(request.ID, assignee.ID, "Готово"))
+
+	// Закрывает заявку инициатор
+	assert.ErrorIs(t, service.CloseRequest(request.ID, assignee.ID), services.ErrRequestForbidden)
+	require.NoError(t, service.CloseRequest(request.ID, author.ID))
+	_, err = service.UpdateRequest(request.ID, author.ID, services.RequestUpdate{Title: "После закрытия"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"portal-razvitie/repositories"
+
+	"gorm.io/gorm"
+)
+
+// Типы результатов поиска
+const (
+	SearchProject  = "project"
+	SearchStore    = "store"
+	SearchTask     = "task"
+	SearchComment  = "comment"
+	SearchRequest  = "request"
+	SearchDocument = "document"
+)
+
+// Ограничения выдачи поиска
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// Ошибки запроса поиска
+var (
+	ErrSearchQueryEmpty  = errors.New("введите текст для поиска")
+	ErrSearchTypeUnknown = errors.New("неизвестный тип результатов поиска")
+)
+
+// Маркеры найденных слов во фрагменте: ставятся до экранирования HTML и заменяются на <mark>
+const (
+	searchMarkStart = "\x02"
+	searchMarkStop  = "\x03"
+)
+
+// searchHeadlineOptions параметры ts_headline: до двух фрагментов по 10–25 слов
+const searchHeadlineOptions = `StartSel="` + searchMarkStart + `", StopSel="` + searchMarkStop + `"` +
+	", MaxFragments=2, MinWords=10, MaxWords=25, FragmentDelimiter=\" … \""
+
+// searchSnippetRunes длина фрагмента вокруг первого найденного слова без PostgreSQL
+const searchSnippetRunes = 160
+
+// SearchQuery запрос глобального поиска
+type SearchQuery struct {
+	Text  string
+	Types []string // Пусто — все типы
+	Limit int
+}
+
+// SearchResult найденная сущность. Snippet — фрагмент текста, найденные слова в <mark>,
+// остальной текст экранирован для вставки в HTML
+type SearchResult struct {
+	Type      string  `json:"type"`
+	ID        uint    `json:"id"`
+	ProjectID *uint   `json:"projectId,omitempty"`
+	TaskID    *uint   `json:"taskId,omitempty"`
+	Title     string  `json:"title"`
+	Snippet   string  `json:"snippet"`
+	Rank      float64 `json:"rank"`
+}
+
+// searchText текст, по которому ищется сущность: выражение над колонками одной таблицы.
+// По каждому тексту в PostgreSQL построен GIN-индекс (SearchService.CreateIndexes)
+type searchText struct {
+	table string
+	expr  string
+}
+
+// searchSource таблица с текстами одного типа результатов
+type searchSource struct {
+	kind    string
+	texts   []searchText
+	columns string // Колонки результата: "Id", "ProjectId", "TaskId" и "Title"
+	// from ограничивает строки видимыми пользователю
+	from func(db *gorm.DB, scope repositories.ProjectScope) *gorm.DB
+}
+
+// searchSources источники поиска. Магазины видны всем пользователям, остальное — через проекты
+var searchSources = []searchSource{
+	{
+		kind:  SearchProject,
+		texts: []searchText{{"Projects", `COALESCE("Address", '')`}},
+		columns: `"Projects"."Id" AS "Id", "Projects"."Id" AS "ProjectId", NULL AS "TaskId",
+			COALESCE((SELECT "Name" FROM "Stores" WHERE "Stores"."Id" = "Projects"."StoreId"), '') AS "Title"`,
+		from: func(db *gorm.DB, scope repositories.ProjectScope) *gorm.DB {
+			return scope.Apply(db.Table("Projects"), `"Projects"."Id"`)
+		},
+	},
+	{
+		kind:    SearchStore,
+		texts:   []searchText{{"Stores", `COALESCE("Code", '') || ' ' || COALESCE("Name", '')`}},
+		columns: `"Stores"."Id" AS "Id", NULL AS "ProjectId", NULL AS "TaskId", "Stores"."Name" AS "Title"`,
+		from: func(db *gorm.DB, scope repositories.ProjectScope) *gorm.DB {
+			return db.Table("Stores")
+		},
+	},
+	{
+		kind:    SearchTask,
+		texts:   []searchText{{"ProjectTasks", `COALESCE("Name", '')`}},
+		columns: `"ProjectTasks"."Id" AS "Id", "ProjectTasks"."ProjectId" AS "ProjectId", "ProjectTasks"."Id" AS "TaskId", "ProjectTasks"."Name" AS "Title"`,
+		from: func(db *gorm.DB, scope repositories.ProjectScope) *gorm.DB {
+			return scope.Apply(db.Table("ProjectTasks"), `"ProjectTasks"."ProjectId"`)
+		},
+	},
+	{
+		kind:    SearchComment,
+		texts:   []searchText{{"TaskComment", `COALESCE("Content", '')`}},
+		columns: `"TaskComment"."ID" AS "Id", "ProjectTasks"."ProjectId" AS "ProjectId", "ProjectTasks"."Id" AS "TaskId", "ProjectTasks"."Name" AS "Title"`,
+		from: func(db *gorm.DB, scope repositories.ProjectScope) *gorm.DB {
+			q := db.Table("TaskComment").Joins(`JOIN "ProjectTasks" ON "ProjectTasks"."Id" = "TaskComment"."TaskId"`)
+			return scope.Apply(q, `"ProjectTasks"."ProjectId"`)
+		},
+	},
+	{
+		kind:    SearchRequest,
+		texts:   []searchText{{"Requests", `COALESCE("Title", '') || ' ' || COALESCE("Description", '') || ' ' || COALESCE("Response", '')`}},
+		columns: `"Requests"."Id" AS "Id", "Requests"."ProjectId" AS "ProjectId", "Requests"."TaskId" AS "TaskId", "Requests"."Title" AS "Title"`,
+		from: func(db *gorm.DB, scope repositories.ProjectScope) *gorm.DB {
+			return scope.ApplyToRequests(db.Table("Requests"))
+		},
+	},
+	{
+		// Название документа и текст текущей версии, извлеченный при построении предпросмотра
+		kind:    SearchDocument,
+		texts:   []searchText{{"ProjectDocuments", `COALESCE("Name", '')`}, {"DocumentPreviews", `COALESCE("Text", '')`}},
+		columns: `"ProjectDocuments"."Id" AS "Id", "ProjectDocuments"."ProjectId" AS "ProjectId", "ProjectDocuments"."TaskId" AS "TaskId", "ProjectDocuments"."Name" AS "Title"`,
+		from: func(db *gorm.DB, scope repositories.ProjectScope) *gorm.DB {
+			q := db.Table("ProjectDocuments").Joins(`LEFT JOIN "DocumentPreviews" ON "DocumentPreviews"."DocumentId" = "ProjectDocuments"."Id" AND "DocumentPreviews"."Version" = "ProjectDocuments"."Version"`)
+			return scope.Apply(q, `"ProjectDocuments"."ProjectId"`)
+		},
+	},
+}
+
+// SearchService глобальный поиск по проектам, магазинам, задачам, комментариям, заявкам и документам.
+// В PostgreSQL — полнотекстовый поиск с русским словарем (морфология, ранжирование, подсветка
+// ts_headline). В других СУБД (тесты на SQLite) работает только упрощенный запасной путь, не равный
+// полнотекстовому: LIKE по вхождению всех слов запроса без морфологии и ранжирования, а LOWER
+// в SQLite не переводит кириллицу в нижний регистр, поэтому русские слова ищутся с учетом регистра
+type SearchService struct {
+	db *gorm.DB
+}
+
+func NewSearchService(db *gorm.DB) *SearchService {
+	return &SearchService{db: db}
+}
+
+// CreateIndexes создает GIN-индексы полнотекстового поиска. Выражения индексов совпадают
+// с выражениями запросов SearchService, иначе PostgreSQL их не использует. Для других СУБД ничего не делает
+func (s *SearchService) CreateIndexes() error {
+	if s.db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, source := range searchSources {
+		for _, text := range source.texts {
+			sql := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_%s_search" ON %q USING GIN (%s)`,
+				text.table, text.table, searchVector(text.expr))
+			if err := s.db.Exec(sql).Error; err != nil {
+				return fmt.Errorf("индекс поиска %s: %w", text.table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Search ищет среди сущностей, видимых пользователю, и возвращает лучшие результаты по убыванию ранга
+func (s *SearchService) Search(scope repositories.ProjectScope, query SearchQuery) ([]SearchResult, error) {
+	text := strings.Join(strings.Fields(query.Text), " ")
+	if text == "" {
+		return nil, ErrSearchQueryEmpty
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	kinds := make(map[string]bool)
+	for _, kind := range query.Types {
+		kinds[kind] = true
+	}
+	for kind := range kinds {
+		if !isSearchKind(kind) {
+			return nil, fmt.Errorf("%w: %s", ErrSearchTypeUnknown, kind)
+		}
+	}
+
+	results := make([]SearchResult, 0)
+	for _, source := range searchSources {
+		if len(kinds) > 0 && !kinds[source.kind] {
+			continue
+		}
+		found, err := s.searchSource(source, scope, text, limit)
+		if err != nil {
+			return nil, fmt.Errorf("поиск (%s): %w", source.kind, err)
+		}
+		results = append(results, found...)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank > results[j].Rank })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+type searchRow struct {
+	ID        uint    `gorm:"column:Id"`
+	ProjectID *uint   `gorm:"column:ProjectId"`
+	TaskID    *uint   `gorm:"column:TaskId"`
+	Title     string  `gorm:"column:Title"`
+	Snippet   string  `gorm:"column:Snippet"`
+	Rank      float64 `gorm:"column:Rank"`
+}
+
+// searchSource лучшие limit совпадений одного источника
+func (s *SearchService) searchSource(source searchSource, scope repositories.ProjectScope, text string, limit int) ([]SearchResult, error) {
+	db := s.db.Session(&gorm.Session{NewDB: true})
+	q := source.from(db, scope)
+	exprs := make([]string, len(source.texts))
+	for i, t := range source.texts {
+		exprs[i] = t.expr
+	}
+	body := strings.Join(exprs, " || ' ' || ")
+
+	var rows []searchRow
+	var terms []string
+	if s.db.Dialector.Name() == "postgres" {
+		const tsquery = "websearch_to_tsquery('russian', ?)"
+		var matches, ranks []string
+		var args []interface{}
+		for _, expr := range exprs {
+			matches = append(matches, searchVector(expr)+" @@ "+tsquery)
+			ranks = append(ranks, "ts_rank("+searchVector(expr)+", "+tsquery+")")
+			args = append(args, text)
+		}
+		q = q.Select(source.columns+
+			", ts_headline('russian', "+body+", "+tsquery+", ?) AS \"Snippet\""+
+			", "+strings.Join(ranks, " + ")+" AS \"Rank\"",
+			append([]interface{}{text, searchHeadlineOptions}, args...)...).
+			Where("("+strings.Join(matches, " OR ")+")", args...).
+			Order(`"Rank" DESC`)
+	} else {
+		terms = strings.Fields(strings.ToLower(text))
+		q = q.Select(source.columns + ", " + body + " AS \"Snippet\", 0 AS \"Rank\"")
+		for _, term := range terms {
+			q = q.Where("LOWER("+body+") LIKE ? ESCAPE '\\'", "%"+escapeLike(term)+"%")
+		}
+		q = q.Order(`"Id" DESC`)
+	}
+	if err := q.Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		snippet, rank := row.Snippet, row.Rank
+		if terms != nil {
+			snippet, rank = highlightTerms(snippet, terms)
+		}
+		results = append(results, SearchResult{
+			Type:      source.kind,
+			ID:        row.ID,
+			ProjectID: row.ProjectID,
+			TaskID:    row.TaskID,
+			Title:     row.Title,
+			Snippet:   renderSnippet(snippet),
+			Rank:      rank,
+		})
+	}
+	return results, nil
+}
+
+func isSearchKind(kind string) bool {
+	for _, source := range searchSources {
+		if source.kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func searchVector(expr string) string {
+	return "to_tsvector('russian', " + expr + ")"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// highlightTerms вырезает фрагмент вокруг первого найденного слова и отмечает вхождения слов.
+// Ранг — доля текста, занятая найденными словами
+func highlightTerms(text string, terms []string) (string, float64) {
+	text = strings.Join(strings.Fields(text), " ")
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// Смена регистра изменила длину в байтах: позиции в тексте не совпадут
+		return truncateRunes(text, searchSnippetRunes), 0
+	}
+
+	first, matched := -1, 0
+	for _, term := range terms {
+		for i := strings.Index(lower, term); i >= 0; {
+			matched += len(term)
+			if first < 0 || i < first {
+				first = i
+			}
+			next := strings.Index(lower[i+len(term):], term)
+			if next < 0 {
+				break
+			}
+			i += len(term) + next
+		}
+	}
+	if first < 0 || len(text) == 0 {
+		return truncateRunes(text, searchSnippetRunes), 0
+	}
+
+	// Фрагмент начинается за треть длины до первого вхождения
+	start := first
+	for back := searchSnippetRunes / 3; back > 0 && start > 0; back-- {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; n < searchSnippetRunes && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	var out strings.Builder
+	if start > 0 {
+		out.WriteString("… ")
+	}
+	for i := start; i < end; {
+		term := matchingTerm(lower[i:], terms)
+		if term == "" || i+len(term) > end {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			out.WriteString(text[i : i+size])
+			i += size
+			continue
+		}
+		out.WriteString(searchMarkStart + text[i:i+len(term)] + searchMarkStop)
+		i += len(term)
+	}
+	if end < len(text) {
+		out.WriteString(" …")
+	}
+	return out.String(), float64(matched) / float64(len(text))
+}
+
+func matchingTerm(s string, terms []string) string {
+	for _, term := range terms {
+		if strings.HasPrefix(s, term) {
+			return term
+		}
+	}
+	return ""
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + " …"
+}
+
+// renderSnippet экранирует фрагмент для HTML и заменяет маркеры найденных слов на <mark>
+func renderSnippet(snippet string) string {
+	snippet = html.EscapeString(strings.Join(strings.Fields(snippet), " "))
+	return strings.NewReplacer(searchMarkStart, "<mark>", searchMarkStop, "</mark>").Replace(snippet)
+}
@@ -0,0 +1,158 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestSearchService(t *testing.T) {
+	db := setupTestDB(t)
+	files, _ := newTestS3(t)
+	docs := services.NewDocumentService(db, files)
+	previews := services.NewDocumentPreviewService(db, docs, nil)
+	docs.SetPreviewService(previews)
+	search := services.NewSearchService(db)
+	require.NoError(t, search.CreateIndexes())
+	ctx := context.Background()
+
+	user := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	other := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMP, IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+	require.NoError(t, db.Create(&other).Error)
+
+	store := models.Store{Code: "MSK-017", Name: "Магазин у парка"}
+	require.NoError(t, db.Create(&store).Error)
+	mine := models.Project{StoreID: store.ID, ProjectType: "Новый", Address: "ул. садовая, 5: арендодатель отказал в площадке тбо"}
+	foreign := models.Project{StoreID: store.ID, ProjectType: "Новый", Address: "ул. лесная, 1: арендодатель согласовал площадку"}
+	require.NoError(t, db.Create(&mine).Error)
+	require.NoError(t, db.Create(&foreign).Error)
+	require.NoError(t, db.Create(&models.ProjectMember{ProjectID: mine.ID, UserID: user.ID, Role: models.ProjectRoleMP}).Error)
+
+	task := models.ProjectTask{ProjectID: mine.ID, Name: "Согласование площадки тбо"}
+	foreignTask := models.ProjectTask{ProjectID: foreign.ID, Name: "Согласование площадки тбо"}
+	require.NoError(t, db.Create(&task).Error)
+	require.NoError(t, db.Create(&foreignTask).Error)
+	require.NoError(t, db.Create(&models.TaskComment{TaskID: task.ID, UserID: user.ID, Content: "арендодатель против <контейнеров> во дворе"}).Error)
+	require.NoError(t, db.Create(&models.TaskComment{TaskID: foreignTask.ID, UserID: other.ID, Content: "арендодатель не отвечает"}).Error)
+
+	own := models.Request{Title: "Письмо арендодателю", Description: "арендодатель просит схему площадки тбо", CreatedByUserID: user.ID, AssignedToUserID: other.ID}
+	hidden := models.Request{Title: "Запрос арендодателю", CreatedByUserID: other.ID, AssignedToUserID: other.ID, ProjectID: &foreign.ID}
+	require.NoError(t, db.Create(&own).Error)
+	require.NoError(t, db.Create(&hidden).Error)
+
+	// Текст документа извлекается при построении предпросмотра
+	docx := zipFile(t, map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			`<w:p><w:r><w:t>Уведомление: арендодатель отказывает в размещении площадки</w:t></w:r></w:p></w:body></w:document>`,
+	})
+	doc := models.ProjectDocument{ProjectID: mine.ID, Type: "Письмо"}
+	require.NoError(t, docs.Upload(ctx, &doc, services.DocumentUpload{Name: "letter.docx", Size: int64(len(docx))}, bytes.NewReader(docx)))
+	_, err := previews.ProcessPending(ctx)
+	require.NoError(t, err)
+
+	scope := repositories.ProjectScope{UserID: user.ID}
+	results, err := search.Search(scope, services.SearchQuery{Text: "  арендодатель  "})
+	require.NoError(t, err)
+	found := map[string][]uint{}
+	for _, r := range results {
+		found[r.Type] = append(found[r.Type], r.ID)
+	}
+	assert.Equal(t, []uint{mine.ID}, found[services.SearchProject])
+	assert.Len(t, found[services.SearchComment], 1)
+	assert.Equal(t, []uint{own.ID}, found[services.SearchRequest])
+	assert.Equal(t, []uint{doc.ID}, found[services.SearchDocument])
+	assert.Empty(t, found[services.SearchTask])
+
+	// Найденные слова подсвечены, остальной текст экранирован
+	for _, r := range results {
+		assert.Contains(t, r.Snippet, "<mark>арендодатель</mark>")
+		if r.Type == services.SearchComment {
+			assert.Contains(t, r.Snippet, "&lt;контейнеров&gt;")
+			assert.Equal(t, task.ID, *r.TaskID)
+			assert.Equal(t, task.Name, r.Title)
+		}
+	}
+
+	// Все слова запроса; фильтр по типам
+	results, err = search.Search(scope, services.SearchQuery{Text: "площадки тбо", Types: []string{services.SearchTask}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, task.ID, results[0].ID)
+	assert.Equal(t, mine.ID, *results[0].ProjectID)
+
+	// Магазины видны всем; код ищется как слово
+	results, err = search.Search(scope, services.SearchQuery{Text: "msk-017"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, services.SearchStore, results[0].Type)
+	assert.Equal(t, "Магазин у парка", results[0].Title)
+
+	// Без ограничений видимости находится и чужой проект
+	results, err = search.Search(repositories.AllProjectsScope(), services.SearchQuery{Text: "арендодатель", Types: []string{services.SearchProject}, Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+	results, err = search.Search(repositories.AllProjectsScope(), services.SearchQuery{Text: "арендодатель", Types: []string{services.SearchProject}})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	_, err = search.Search(scope, services.SearchQuery{Text: " "})
+	assert.ErrorIs(t, err, services.ErrSearchQueryEmpty)
+	_, err = search.Search(scope, services.SearchQuery{Text: "тбо", Types: []string{"users"}})
+	assert.ErrorIs(t, err, services.ErrSearchTypeUnknown)
+}
+
+// TestSearchService_PostgresQueries проверяет SQL, который строится для PostgreSQL: тесты на SQLite
+// проходят по запасному пути LIKE, поэтому запросы полнотекстового поиска собираются без подключения (DryRun)
+func TestSearchService_PostgresQueries(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=dry_run"}), &gorm.Config{
+		NamingStrategy:       &database.CustomNamingStrategy{},
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	require.NoError(t, err)
+	var statements []string
+	capture := func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:capture", capture))
+	require.NoError(t, db.Callback().Raw().After("gorm:raw").Register("test:capture", capture))
+	require.NoError(t, db.Callback().Row().After("gorm:row").Register("test:capture", capture))
+	search := services.NewSearchService(db)
+
+	// Индексы строятся по тем же выражениям, что и условия запросов, иначе PostgreSQL их не использует
+	require.NoError(t, search.CreateIndexes())
+	indexes := statements
+	require.Len(t, indexes, 7)
+	assert.Contains(t, indexes[0], `CREATE INDEX IF NOT EXISTS "idx_Projects_search" ON "Projects" USING GIN (to_tsvector('russian', COALESCE("Address", '')))`)
+
+	statements = nil
+	// Запрос только строится: чтение результатов в DryRun не поддерживается
+	_, err = search.Search(repositories.ProjectScope{UserID: 7}, services.SearchQuery{Text: "арендодатель -отказ", Types: []string{services.SearchDocument}, Limit: 5})
+	assert.ErrorIs(t, err, gorm.ErrDryRunModeUnsupported)
+	require.NotEmpty(t, statements)
+	sql := statements[len(statements)-1]
+	assert.Contains(t, sql, `to_tsvector('russian', COALESCE("Name", '')) @@ websearch_to_tsquery('russian', 'арендодатель -отказ')`)
+	assert.Contains(t, sql, `to_tsvector('russian', COALESCE("Text", '')) @@ websearch_to_tsquery('russian', 'арендодатель -отказ')`)
+	assert.Contains(t, sql, `ts_headline('russian', COALESCE("Name", '') || ' ' || COALESCE("Text", ''), websearch_to_tsquery('russian', 'арендодатель -отказ'), 'StartSel=`)
+	assert.Contains(t, sql, `ts_rank(to_tsvector('russian', COALESCE("Name", '')), websearch_to_tsquery('russian', 'арендодатель -отказ')) + ts_rank(`)
+	assert.Contains(t, sql, `ORDER BY "Rank" DESC LIMIT 5`)
+	assert.Contains(t, sql, `"UserId" IN (7)`)
+	for _, index := range indexes {
+		if strings.Contains(index, `ON "DocumentPreviews"`) {
+			assert.Contains(t, index, `to_tsvector('russian', COALESCE("Text", ''))`)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ошибки проверки токена сеанса
+var (
+	ErrSessionInvalid = errors.New("токен сеанса недействителен")
+	ErrSessionExpired = errors.New("сеанс истек, войдите заново")
+)
+
+// SessionTokenPrefix начало токена сеанса; по нему AuthMiddleware отличает сеанс от персонального токена
+const SessionTokenPrefix = "prs_"
+
+// DefaultSessionTTL сколько действует сеанс после входа
+const DefaultSessionTTL = 12 * time.Hour
+
+// Session токен, выданный при входе; передается в заголовке Authorization: Bearer
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SessionService выдает и проверяет токены сеансов, подписанные HMAC-SHA256.
+// Токены не хранятся в БД: ключ общий для всех реплик, а деактивация пользователя
+// проверяется при каждом запросе
+type SessionService struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewSessionService(secret string, ttl time.Duration) *SessionService {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	return &SessionService{key: []byte(secret), ttl: ttl, now: time.Now}
+}
+
+// Issue выдает токен сеанса пользователя
+func (s *SessionService) Issue(userID uint) Session {
+	expiresAt := s.now().Add(s.ttl).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", userID, expiresAt.Unix())))
+	return Session{
+		Token:     SessionTokenPrefix + payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload)),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Verify проверяет подпись и срок токена и возвращает ID пользователя
+func (s *SessionService) Verify(token string) (uint, error) {
+	encoded, signature, ok := strings.Cut(strings.TrimPrefix(token, SessionTokenPrefix), ".")
+	if !ok || !strings.HasPrefix(token, SessionTokenPrefix) {
+		return 0, ErrSessionInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return 0, ErrSessionInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, ErrSessionInvalid
+	}
+	uidStr, expStr, ok := strings.Cut(string(payload), ":")
+	if !ok {
+		return 0, ErrSessionInvalid
+	}
+	userID, err := strconv.ParseUint(uidStr, 10, 64)
+	if err != nil {
+		return 0, ErrSessionInvalid
+	}
+	expiresAt, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil {
+		return 0, ErrSessionInvalid
+	}
+	if !s.now().Before(time.Unix(expiresAt, 0)) {
+		return 0, ErrSessionExpired
+	}
+	return uint(userID), nil
+}
+
+func (s *SessionService) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
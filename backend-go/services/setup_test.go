@@ -1,6 +1,8 @@
 package services_test
 
 import (
+	"path/filepath"
+	"portal-razvitie/database"
 	"portal-razvitie/models"
 	"testing"
 
@@ -9,7 +11,19 @@ import (
 )
 
 func setupTestDB(t *testing.T) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	return openTestDB(t, ":memory:")
+}
+
+// setupFileTestDB открывает базу в файле: в отличие от :memory: все соединения пула
+// видят одни и те же таблицы, поэтому чтения мимо транзакции работают как в Postgres
+func setupFileTestDB(t *testing.T) *gorm.DB {
+	return openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+}
+
+func openTestDB(t *testing.T, dsn string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		NamingStrategy: &database.CustomNamingStrategy{},
+	})
 	if err != nil {
 		t.Fatalf("failed to connect database: %v", err)
 	}
@@ -17,14 +31,37 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	// AutoMigrate models needed for services tests
 	err = db.AutoMigrate(
 		&models.User{},
+		&models.UserRole{},
+		&models.UserAbsence{},
+		&models.APIToken{},
+		&models.AssignmentRule{},
 		&models.Store{},
 		&models.Project{},
+		&models.ProjectMember{},
 		&models.ProjectTask{},
 		&models.ProjectDocument{},
+		&models.DocumentRevision{},
+		&models.DocumentType{},
+		&models.UploadSession{},
+		&models.DocumentLink{},
+		&models.DocumentLinkAccess{},
+		&models.DocumentPreview{},
+		&models.DocumentExtractionRule{},
+		&models.DocumentExtraction{},
 		&models.Notification{},
 		&models.UserActivity{},
 		&models.Role{},
 		&models.Permission{},
+		&models.TaskDefinition{},
+		&models.ProjectTemplate{},
+		&models.TemplateTask{},
+		&models.ProjectTemplateVersion{},
+		&models.TemplateVersionTask{},
+		&models.TaskTemplate{},
+		&models.TaskFieldTemplate{},
+		&models.ProjectStatusDefinition{},
+		&models.Request{},
+		&models.TaskComment{},
 	)
 	if err != nil {
 		t.Fatalf("failed to migrate database: %v", err)
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"portal-razvitie/models"
+	"portal-razvitie/oidc"
+
+	"gorm.io/gorm"
+)
+
+// Ошибки входа через SSO
+var (
+	ErrSSONoRole     = errors.New("группы пользователя не сопоставлены ни с одной ролью портала")
+	ErrSSOLoginTaken = errors.New("логин уже занят учетной записью портала; привязать ее к входу через провайдера может администратор")
+)
+
+// SSOConfig сопоставление групп провайдера ролям портала
+type SSOConfig struct {
+	GroupsClaim string            // Утверждение ID-токена с группами (допускается путь через точку)
+	GroupRoles  map[string]string // Группа → Role.Code. Пустая карта — роли ведутся только в портале
+}
+
+// SSOService вход через OpenID Connect (код авторизации + PKCE) с созданием пользователей при первом входе
+type SSOService struct {
+	db       *gorm.DB
+	auth     *AuthService
+	provider *oidc.Provider
+	sealer   *oidc.StateSealer
+	cfg      SSOConfig
+}
+
+func NewSSOService(db *gorm.DB, auth *AuthService, provider *oidc.Provider, sealer *oidc.StateSealer, cfg SSOConfig) *SSOService {
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return &SSOService{db: db, auth: auth, provider: provider, sealer: sealer, cfg: cfg}
+}
+
+// AuthorizationURL начинает вход: возвращает адрес страницы входа провайдера.
+// code_verifier и nonce зашифрованы в state, поэтому вход можно завершить на любой реплике.
+// binding — значение из cookie браузера (oidc.NewBinding), в котором вход должен завершиться
+func (s *SSOService) AuthorizationURL(ctx context.Context, binding string) (string, error) {
+	flow := oidc.NewFlow(binding)
+	state, err := s.sealer.Seal(flow)
+	if err != nil {
+		return "", err
+	}
+	return s.provider.AuthCodeURL(ctx, state, flow.Nonce, flow.CodeChallenge())
+}
+
+// Callback завершает вход по коду от провайдера и возвращает пользователя с его правами.
+// state, выданный другому браузеру (binding не совпадает), отклоняется как oidc.ErrInvalidState
+func (s *SSOService) Callback(ctx context.Context, code, state, binding string) (*models.User, []string, error) {
+	flow, err := s.sealer.Open(state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !flow.BoundTo(binding) {
+		return nil, nil, oidc.ErrInvalidState
+	}
+	claims, err := s.provider.Exchange(ctx, code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.provision(claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	access, err := s.auth.GetUserAccess(user)
+	if err != nil {
+		return user, []string{}, nil
+	}
+	return user, access.Permissions(), nil
+}
+
+// provision находит пользователя по subject провайдера, привязывает существующего по подтвержденному email
+// или создает нового. Если задано сопоставление групп, набор ролей пользователя берется из провайдера
+func (s *SSOService) provision(claims *oidc.Claims) (*models.User, error) {
+	roles, err := s.mapRoles(claims.Strings(s.cfg.GroupsClaim))
+	if err != nil {
+		return nil, err
+	}
+	managedRoles := len(s.cfg.GroupRoles) > 0
+	if managedRoles && len(roles) == 0 {
+		return nil, ErrSSONoRole
+	}
+
+	login := claims.PreferredUsername
+	if login == "" {
+		login = claims.Email
+	}
+	if login == "" {
+		login = claims.Subject
+	}
+	name := claims.Name
+	if name == "" {
+		name = login
+	}
+
+	var user models.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("\"ExternalSubject\" = ?", claims.Subject).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = s.findLinkable(tx, claims, login, &user)
+		}
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if len(roles) == 0 {
+				return ErrSSONoRole
+			}
+			user = models.User{Name: name, Login: login, Role: roles[0], IsActive: true}
+		case err != nil:
+			return err
+		case !user.IsActive:
+			return ErrUserInactive
+		}
+
+		subject := claims.Subject
+		user.ExternalSubject = &subject
+		user.Name = name
+		if managedRoles && !containsString(roles, user.Role) {
+			user.Role = roles[0]
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if managedRoles {
+			return syncUserRoles(tx, user.ID, roles)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// findLinkable ищет при первом входе локальную учетную запись для привязки. Привязка выполняется
+// только по email, подтвержденному провайдером: preferred_username пользователь может сменить у провайдера сам.
+// Остальные учетные записи привязывает администратор (UserInput.ExternalSubject).
+// Если логин занят непривязанной учетной записью, вход отклоняется, чтобы не создать двойника
+func (s *SSOService) findLinkable(tx *gorm.DB, claims *oidc.Claims, login string, user *models.User) error {
+	if claims.Email != "" && claims.EmailVerified {
+		err := tx.Where("\"Login\" = ? AND \"ExternalSubject\" IS NULL", claims.Email).First(user).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	var taken int64
+	if err := tx.Model(&models.User{}).Where("\"Login\" = ?", login).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrSSOLoginTaken
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// mapRoles переводит группы провайдера в коды существующих ролей (без повторов, в порядке групп)
+func (s *SSOService) mapRoles(groups []string) ([]string, error) {
+	var codes []string
+	for _, group := range groups {
+		code, ok := s.cfg.GroupRoles[strings.TrimSpace(group)]
+		if ok && !containsString(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	var existing []string
+	if err := s.db.Model(&models.Role{}).Where("\"Code\" IN ?", codes).Pluck("Code", &existing).Error; err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if containsString(existing, code) {
+			roles = append(roles, code)
+		} else {
+			log.Printf("⚠️ SSO group mapping refers to unknown role %q", code)
+		}
+	}
+	return roles, nil
+}
+
+// syncUserRoles оставляет пользователю только роли из списка: назначения этих ролей (с их областями)
+// сохраняются, недостающие роли добавляются без ограничения области
+func syncUserRoles(tx *gorm.DB, userID uint, roles []string) error {
+	var current []models.UserRole
+	if err := tx.Where("\"UserId\" = ?", userID).Find(&current).Error; err != nil {
+		return err
+	}
+	assigned := make(map[string]bool)
+	for _, r := range current {
+		if !containsString(roles, r.RoleCode) {
+			if err := tx.Delete(&models.UserRole{}, r.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		assigned[r.RoleCode] = true
+	}
+	for _, code := range roles {
+		if !assigned[code] {
+			if err := tx.Create(&models.UserRole{UserID: userID, RoleCode: code}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
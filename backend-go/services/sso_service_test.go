@@ -0,0 +1,126 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"portal-razvitie/cache"
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/oidc"
+	"portal-razvitie/oidc/oidctest"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ssoLogin проходит вход целиком в одном браузере: страница провайдера сразу возвращает код на redirect_uri
+func ssoLogin(t *testing.T, service *services.SSOService) (*models.User, []string, error) {
+	code, state, binding := ssoStart(t, service)
+	return service.Callback(context.Background(), code, state, binding)
+}
+
+// ssoStart начинает вход и возвращает код и state от провайдера вместе с привязкой браузера
+func ssoStart(t *testing.T, service *services.SSOService) (string, string, string) {
+	binding := oidc.NewBinding()
+	authURL, err := service.AuthorizationURL(context.Background(), binding)
+	require.NoError(t, err)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return callback.Query().Get("code"), callback.Query().Get("state"), binding
+}
+
+func TestSSOService_ProvisioningAndRoleMapping(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, database.SeedRBAC(db))
+
+	server, idp := oidctest.NewServer("portal", oidctest.Identity{
+		Subject: "u-1", PreferredUsername: "ivanov", Name: "Иванов И.И.", Groups: []string{"portal-managers"},
+	})
+	defer server.Close()
+
+	sealer, err := oidc.NewStateSealer("secret")
+	require.NoError(t, err)
+	provider := oidc.NewProvider(oidc.Config{Issuer: server.URL, ClientID: "portal", RedirectURL: "http://portal.local/auth/callback"}, nil)
+	rbac := services.NewRBACService(db, cache.NewPermissionCache(time.Minute), &recordingBroadcaster{})
+	auth := services.NewAuthService(db, rbac)
+	auth.SetSessionService(services.NewSessionService("session-secret", time.Hour))
+	service := services.NewSSOService(db, auth, provider, sealer, services.SSOConfig{
+		GroupRoles: map[string]string{"portal-managers": models.RoleMP, "portal-heads": models.RoleNOR},
+	})
+
+	// Первый вход создает пользователя с ролью из группы
+	user, perms, err := ssoLogin(t, service)
+	require.NoError(t, err)
+	assert.Equal(t, "ivanov", user.Login)
+	assert.Equal(t, models.RoleMP, user.Role)
+	assert.Contains(t, perms, models.PermTaskEditOwn)
+
+	// Вход завершается токеном сеанса, по которому пользователь проходит аутентификацию
+	session := auth.IssueSession(user)
+	require.NotNil(t, session)
+	byToken, _, err := auth.GetUserBySession(session.Token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, byToken.ID)
+	_, _, err = auth.GetUserBySession(session.Token + "x")
+	assert.ErrorIs(t, err, services.ErrSessionInvalid)
+
+	// Повторный вход с другими группами заменяет роли
+	idp.SetIdentity(oidctest.Identity{Subject: "u-1", PreferredUsername: "ivanov", Name: "Иванов И.И.", Groups: []string{"portal-heads"}})
+	again, _, err := ssoLogin(t, service)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Equal(t, models.RoleNOR, again.Role)
+	var roles []string
+	require.NoError(t, db.Model(&models.UserRole{}).Where("\"UserId\" = ?", user.ID).Pluck("RoleCode", &roles).Error)
+	assert.Equal(t, []string{models.RoleNOR}, roles)
+
+	// Совпадение preferred_username (его можно сменить у провайдера) не привязывает локальную учетную запись
+	local := models.User{Name: "Петров П.П.", Login: "petrov@example.com", Role: models.RoleMP, IsActive: true}
+	require.NoError(t, db.Create(&local).Error)
+	idp.SetIdentity(oidctest.Identity{Subject: "u-2", PreferredUsername: "petrov@example.com", Groups: []string{"portal-managers"}})
+	_, _, err = ssoLogin(t, service)
+	assert.ErrorIs(t, err, services.ErrSSOLoginTaken)
+
+	// Неподтвержденный email тоже не привязывает
+	idp.SetIdentity(oidctest.Identity{Subject: "u-2", PreferredUsername: "petrov", Email: "petrov@example.com", Groups: []string{"portal-managers"}})
+	unverified, _, err := ssoLogin(t, service)
+	require.NoError(t, err)
+	assert.NotEqual(t, local.ID, unverified.ID)
+
+	// Подтвержденный провайдером email привязывает учетную запись с таким логином
+	idp.SetIdentity(oidctest.Identity{Subject: "u-4", PreferredUsername: "p.petrov", Email: "petrov@example.com", EmailVerified: true, Groups: []string{"portal-managers"}})
+	linked, _, err := ssoLogin(t, service)
+	require.NoError(t, err)
+	assert.Equal(t, local.ID, linked.ID)
+
+	// Без сопоставленных групп вход запрещен
+	idp.SetIdentity(oidctest.Identity{Subject: "u-3", PreferredUsername: "sidorov", Groups: []string{"guests"}})
+	_, _, err = ssoLogin(t, service)
+	assert.ErrorIs(t, err, services.ErrSSONoRole)
+
+	// Поддельный state отклоняется
+	_, _, err = service.Callback(context.Background(), "code", "forged", oidc.NewBinding())
+	assert.ErrorIs(t, err, oidc.ErrInvalidState)
+
+	// Код и state, полученные в браузере атакующего, не завершают вход в другом браузере
+	idp.SetIdentity(oidctest.Identity{Subject: "u-1", PreferredUsername: "ivanov", Groups: []string{"portal-heads"}})
+	code, state, binding := ssoStart(t, service)
+	_, _, err = service.Callback(context.Background(), code, state, oidc.NewBinding())
+	assert.ErrorIs(t, err, oidc.ErrInvalidState)
+	_, _, err = service.Callback(context.Background(), code, state, "")
+	assert.ErrorIs(t, err, oidc.ErrInvalidState)
+	_, _, err = service.Callback(context.Background(), code, state, binding)
+	assert.NoError(t, err)
+}
@@ -16,6 +16,8 @@ type TaskService struct {
 	workflowService      WorkflowServiceInterface
 	eventBus             events.EventBus
 	projectStatusService *ProjectStatusService
+	absences             *AbsenceService
+	assignments          *AssignmentService
 }
 
 func NewTaskService(
@@ -25,6 +27,8 @@ func NewTaskService(
 	workflowService WorkflowServiceInterface,
 	eventBus events.EventBus,
 	projectStatusService *ProjectStatusService,
+	absences *AbsenceService,
+	assignments *AssignmentService,
 ) *TaskService {
 	return &TaskService{
 		repo:                 repo,
@@ -33,11 +37,13 @@ func NewTaskService(
 		workflowService:      workflowService,
 		eventBus:             eventBus,
 		projectStatusService: projectStatusService,
+		absences:             absences,
+		assignments:          assignments,
 	}
 }
 
-func (s *TaskService) GetAllTasks() ([]models.ProjectTask, error) {
-	return s.repo.FindAll()
+func (s *TaskService) GetAllTasks(scope repositories.ProjectScope) ([]models.ProjectTask, error) {
+	return s.repo.FindAll(scope)
 }
 
 func (s *TaskService) GetProjectTasks(projectId uint) ([]models.ProjectTask, error) {
@@ -63,16 +69,18 @@ func (s *TaskService) CreateTask(task *models.ProjectTask, actorId uint) error {
 		if err == nil {
 			uid := int(user.ID)
 			task.ResponsibleUserID = &uid
-		} else {
-			// Try by Role
-			users, err2 := s.userRepo.FindByRole(task.Responsible)
-			if err2 == nil && len(users) > 0 {
-				uid := int(users[0].ID)
-				task.ResponsibleUserID = &uid
+		} else if s.assignments != nil {
+			// Try by Role: исполнителя выбирает стратегия назначения роли
+			project, _ := s.projectRepo.FindByID(task.ProjectID)
+			if err := s.assignments.AssignTask(task, project); err != nil {
+				log.Printf("⚠️ Failed to assign task %s: %v", task.Name, err)
 			}
 		}
 	}
 
+	// Задачи отсутствующего сотрудника получает его заместитель
+	routeToDelegate(s.absences, task)
+
 	// Auto-assign Order if not set
 	if task.Order == 0 {
 		maxOrder, err := s.repo.GetMaxOrderByProject(task.ProjectID)
@@ -274,7 +282,3 @@ func (s *TaskService) DeleteTask(id uint, actorId uint) error {
 func (s *TaskService) CleanupOldTasks() (int64, error) {
 	return s.repo.DeleteOld()
 }
-
-func (s *TaskService) GetRecentTasks(limit int) ([]models.ProjectTask, error) {
-	return s.repo.FindRecent(limit)
-}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestTaskService_UpdateTask(t *testing.T) {
@@ -21,7 +22,7 @@ func TestTaskService_UpdateTask(t *testing.T) {
 	projectRepo := repositories.NewProjectRepository(db)
 
 	eventBus := events.NewEventBus()
-	service := services.NewTaskService(repo, projectRepo, userRepo, mockWorkflow, eventBus, nil)
+	service := services.NewTaskService(repo, projectRepo, userRepo, mockWorkflow, eventBus, nil, nil, nil)
 
 	// Create
 	task := &models.ProjectTask{Name: "Task 1", Status: "Создана"}
@@ -42,12 +43,14 @@ func TestTaskService_UpdateStatus_Completion(t *testing.T) {
 	db := setupTestDB(t)
 	repo := repositories.NewTaskRepository(db)
 	mockWorkflow := &MockWorkflowService{}
+	mockWorkflow.On("ValidateTaskCompletion", mock.Anything).Return(nil)
+	mockWorkflow.On("ProcessTaskCompletion", mock.Anything, "TEST-CODE").Return(nil)
 
 	userRepo := repositories.NewUserRepository(db)
 	projectRepo := repositories.NewProjectRepository(db)
 
 	eventBus := events.NewEventBus()
-	service := services.NewTaskService(repo, projectRepo, userRepo, mockWorkflow, eventBus, nil)
+	service := services.NewTaskService(repo, projectRepo, userRepo, mockWorkflow, eventBus, nil, nil, nil)
 
 	// Create
 	code := "TEST-CODE"
@@ -80,7 +83,7 @@ func TestTaskService_DeleteTask_LogsActivity(t *testing.T) {
 	listener := listeners.NewActivityListener(activityService)
 	listener.Register(eventBus)
 
-	service := services.NewTaskService(repo, projectRepo, userRepo, mockWorkflow, eventBus, nil)
+	service := services.NewTaskService(repo, projectRepo, userRepo, mockWorkflow, eventBus, nil, nil, nil)
 
 	// Create
 	task := &models.ProjectTask{Name: "Task To Delete", Status: "Создана"}
@@ -0,0 +1,531 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Экспорт и импорт графа задач шаблона в BPMN 2.0 (совместимо с Camunda Modeler).
+// Задача шаблона — task-элемент BPMN, зависимости — sequenceFlow.
+// Роль исполнителя хранится в camunda:candidateGroups, код, длительность,
+// этап, порядок и статус проекта — в camunda:properties.
+
+const (
+	bpmnNamespace    = "http://www.omg.org/spec/BPMN/20100524/MODEL"
+	bpmnDINamespace  = "http://www.omg.org/spec/BPMN/20100524/DI"
+	bpmnDCNamespace  = "http://www.omg.org/spec/DD/20100524/DC"
+	bpmnDINamespace2 = "http://www.omg.org/spec/DD/20100524/DI"
+	camundaNamespace = "http://camunda.org/schema/1.0/bpmn"
+)
+
+// Элементы BPMN, которые импортируются как задачи шаблона
+var bpmnTaskElements = map[string]bool{
+	"task":             true,
+	"userTask":         true,
+	"serviceTask":      true,
+	"manualTask":       true,
+	"scriptTask":       true,
+	"sendTask":         true,
+	"receiveTask":      true,
+	"businessRuleTask": true,
+}
+
+var bpmnIDPattern = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_.\-]*$`)
+
+// Структуры для записи: имена с префиксами пишутся как есть
+
+type bpmnOutDefinitions struct {
+	XMLName         xml.Name       `xml:"bpmn:definitions"`
+	XmlnsBpmn       string         `xml:"xmlns:bpmn,attr"`
+	XmlnsBpmndi     string         `xml:"xmlns:bpmndi,attr"`
+	XmlnsDc         string         `xml:"xmlns:dc,attr"`
+	XmlnsDi         string         `xml:"xmlns:di,attr"`
+	XmlnsCamunda    string         `xml:"xmlns:camunda,attr"`
+	ID              string         `xml:"id,attr"`
+	TargetNamespace string         `xml:"targetNamespace,attr"`
+	Process         bpmnOutProcess `xml:"bpmn:process"`
+	Diagram         bpmnOutDiagram `xml:"bpmndi:BPMNDiagram"`
+}
+
+type bpmnOutProcess struct {
+	ID           string        `xml:"id,attr"`
+	Name         string        `xml:"name,attr"`
+	IsExecutable bool          `xml:"isExecutable,attr"`
+	Nodes        []bpmnOutNode `xml:",any"`
+	Flows        []bpmnOutFlow `xml:"bpmn:sequenceFlow"`
+}
+
+type bpmnOutNode struct {
+	XMLName         xml.Name
+	ID              string           `xml:"id,attr"`
+	Name            string           `xml:"name,attr,omitempty"`
+	CandidateGroups string           `xml:"camunda:candidateGroups,attr,omitempty"`
+	Extension       *bpmnOutExtElems `xml:"bpmn:extensionElements,omitempty"`
+	Incoming        []string         `xml:"bpmn:incoming"`
+	Outgoing        []string         `xml:"bpmn:outgoing"`
+}
+
+type bpmnOutExtElems struct {
+	Properties []bpmnProperty `xml:"camunda:properties>camunda:property"`
+}
+
+type bpmnProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type bpmnOutFlow struct {
+	ID        string `xml:"id,attr"`
+	SourceRef string `xml:"sourceRef,attr"`
+	TargetRef string `xml:"targetRef,attr"`
+}
+
+type bpmnOutDiagram struct {
+	ID    string       `xml:"id,attr"`
+	Plane bpmnOutPlane `xml:"bpmndi:BPMNPlane"`
+}
+
+type bpmnOutPlane struct {
+	ID          string         `xml:"id,attr"`
+	BpmnElement string         `xml:"bpmnElement,attr"`
+	Shapes      []bpmnOutShape `xml:"bpmndi:BPMNShape"`
+	Edges       []bpmnOutEdge  `xml:"bpmndi:BPMNEdge"`
+}
+
+type bpmnOutShape struct {
+	ID          string        `xml:"id,attr"`
+	BpmnElement string        `xml:"bpmnElement,attr"`
+	Bounds      bpmnOutBounds `xml:"dc:Bounds"`
+}
+
+type bpmnOutBounds struct {
+	X      int `xml:"x,attr"`
+	Y      int `xml:"y,attr"`
+	Width  int `xml:"width,attr"`
+	Height int `xml:"height,attr"`
+}
+
+type bpmnOutEdge struct {
+	ID          string         `xml:"id,attr"`
+	BpmnElement string         `xml:"bpmnElement,attr"`
+	Waypoints   []bpmnOutPoint `xml:"di:waypoint"`
+}
+
+type bpmnOutPoint struct {
+	X int `xml:"x,attr"`
+	Y int `xml:"y,attr"`
+}
+
+// Структуры для чтения: сопоставление по локальным именам без учета префиксов
+
+type bpmnInDefinitions struct {
+	Processes []bpmnInProcess `xml:"process"`
+}
+
+type bpmnInProcess struct {
+	ID       string          `xml:"id,attr"`
+	Name     string          `xml:"name,attr"`
+	Elements []bpmnInElement `xml:",any"`
+}
+
+type bpmnInElement struct {
+	XMLName         xml.Name
+	ID              string         `xml:"id,attr"`
+	Name            string         `xml:"name,attr"`
+	SourceRef       string         `xml:"sourceRef,attr"`
+	TargetRef       string         `xml:"targetRef,attr"`
+	CandidateGroups string         `xml:"candidateGroups,attr"`
+	Properties      []bpmnProperty `xml:"extensionElements>properties>property"`
+}
+
+// Размеры элементов схемы
+const (
+	bpmnTaskWidth    = 100
+	bpmnTaskHeight   = 80
+	bpmnEventSize    = 36
+	bpmnGatewaySize  = 50
+	bpmnColumnWidth  = 200
+	bpmnRowHeight    = 120
+	bpmnMarginX      = 100
+	bpmnMarginY      = 80
+	bpmnGatewayShift = 75 // Смещение шлюза слияния влево от задачи
+)
+
+// MarshalBPMN строит BPMN 2.0 XML по документу обмена.
+// Задачи с несколькими зависимостями получают параллельный шлюз слияния
+func (s *TemplateExchangeService) MarshalBPMN(doc *TemplateExchangeDocument) ([]byte, error) {
+	tasks := append([]TemplateExchangeTask{}, doc.Tasks...)
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Order < tasks[j].Order })
+
+	// ID элемента — код задачи (или его безопасная форма), а не позиция: ID не меняются,
+	// когда задачи добавляются или переставляются, и диффы выгрузок остаются читаемыми
+	ids := make(map[string]string, len(tasks))
+	used := map[string]bool{"StartEvent_1": true, "EndEvent_1": true}
+	for _, t := range tasks {
+		id := t.Code
+		if !bpmnIDPattern.MatchString(id) {
+			id = "Task_" + bpmnSafeID(t.Code)
+		}
+		for base, n := id, 2; used[id]; n++ {
+			id = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[id] = true
+		ids[t.Code] = id
+	}
+
+	successors := make(map[string][]string)
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := ids[dep]; !ok {
+				return nil, fmt.Errorf("задача %s зависит от отсутствующей задачи %s", t.Code, dep)
+			}
+			successors[dep] = append(successors[dep], t.Code)
+		}
+	}
+
+	// Колонка задачи — длина самого длинного пути зависимостей
+	column := make(map[string]int, len(tasks))
+	byCode := make(map[string]*TemplateExchangeTask, len(tasks))
+	for i := range tasks {
+		byCode[tasks[i].Code] = &tasks[i]
+	}
+	var depth func(code string, guard int) (int, error)
+	depth = func(code string, guard int) (int, error) {
+		if c, ok := column[code]; ok {
+			return c, nil
+		}
+		if guard > len(tasks) {
+			return 0, fmt.Errorf("циклическая зависимость через задачу %s", code)
+		}
+		c := 1
+		for _, dep := range byCode[code].DependsOn {
+			d, err := depth(dep, guard+1)
+			if err != nil {
+				return 0, err
+			}
+			if d+1 > c {
+				c = d + 1
+			}
+		}
+		column[code] = c
+		return c, nil
+	}
+	maxColumn := 0
+	for _, t := range tasks {
+		c, err := depth(t.Code, 0)
+		if err != nil {
+			return nil, err
+		}
+		if c > maxColumn {
+			maxColumn = c
+		}
+	}
+
+	process := bpmnOutProcess{
+		ID:           "Process_" + bpmnSafeID(doc.Template.Name),
+		Name:         doc.Template.Name,
+		IsExecutable: false,
+	}
+	plane := bpmnOutPlane{ID: "BPMNPlane_1", BpmnElement: process.ID}
+
+	nodes := make(map[string]*bpmnOutNode)
+	var order []string
+	addNode := func(n bpmnOutNode) {
+		order = append(order, n.ID)
+		nodes[n.ID] = &n
+	}
+	type point struct{ x, y, w, h int }
+	layout := make(map[string]point)
+
+	rows := make(map[int]int)
+	nextRow := func(col int) int {
+		r := rows[col]
+		rows[col]++
+		return r
+	}
+
+	addNode(bpmnOutNode{XMLName: xml.Name{Local: "bpmn:startEvent"}, ID: "StartEvent_1", Name: "Старт"})
+	layout["StartEvent_1"] = point{bpmnMarginX, bpmnMarginY + (bpmnTaskHeight-bpmnEventSize)/2, bpmnEventSize, bpmnEventSize}
+
+	for _, t := range tasks {
+		id := ids[t.Code]
+		props := []bpmnProperty{
+			{Name: "code", Value: t.Code},
+			{Name: "duration", Value: strconv.Itoa(t.Duration)},
+			{Name: "order", Value: strconv.Itoa(t.Order)},
+		}
+		if t.Stage != "" {
+			props = append(props, bpmnProperty{Name: "stage", Value: t.Stage})
+		}
+		if t.TaskTemplateCode != "" {
+			props = append(props, bpmnProperty{Name: "taskTemplateCode", Value: t.TaskTemplateCode})
+		}
+		if t.ProjectStatus != "" {
+			props = append(props,
+				bpmnProperty{Name: "projectStatus", Value: t.ProjectStatus},
+				bpmnProperty{Name: "statusOrder", Value: strconv.Itoa(t.StatusOrder)})
+		}
+		addNode(bpmnOutNode{
+			XMLName:         xml.Name{Local: "bpmn:" + bpmnElementForTaskType(t.TaskType)},
+			ID:              id,
+			Name:            t.Name,
+			CandidateGroups: t.ResponsibleRole,
+			Extension:       &bpmnOutExtElems{Properties: props},
+		})
+		col := column[t.Code]
+		layout[id] = point{bpmnMarginX + col*bpmnColumnWidth, bpmnMarginY + nextRow(col)*bpmnRowHeight, bpmnTaskWidth, bpmnTaskHeight}
+	}
+
+	endCol := maxColumn + 1
+	addNode(bpmnOutNode{XMLName: xml.Name{Local: "bpmn:endEvent"}, ID: "EndEvent_1", Name: "Завершение"})
+	layout["EndEvent_1"] = point{bpmnMarginX + endCol*bpmnColumnWidth, bpmnMarginY + (bpmnTaskHeight-bpmnEventSize)/2, bpmnEventSize, bpmnEventSize}
+
+	flowSeq := 0
+	addFlow := func(source, target string) {
+		flowSeq++
+		id := fmt.Sprintf("Flow_%d", flowSeq)
+		process.Flows = append(process.Flows, bpmnOutFlow{ID: id, SourceRef: source, TargetRef: target})
+		nodes[source].Outgoing = append(nodes[source].Outgoing, id)
+		nodes[target].Incoming = append(nodes[target].Incoming, id)
+
+		from, to := layout[source], layout[target]
+		plane.Edges = append(plane.Edges, bpmnOutEdge{
+			ID:          id + "_di",
+			BpmnElement: id,
+			Waypoints: []bpmnOutPoint{
+				{X: from.x + from.w, Y: from.y + from.h/2},
+				{X: to.x, Y: to.y + to.h/2},
+			},
+		})
+	}
+
+	// Параллельный шлюз слияния перед элементом с несколькими входами
+	joinFor := func(target string, sources []string) {
+		if len(sources) == 1 {
+			addFlow(sources[0], target)
+			return
+		}
+		gw := "Gateway_" + target
+		addNode(bpmnOutNode{XMLName: xml.Name{Local: "bpmn:parallelGateway"}, ID: gw})
+		t := layout[target]
+		layout[gw] = point{t.x - bpmnGatewayShift, t.y + (t.h-bpmnGatewaySize)/2, bpmnGatewaySize, bpmnGatewaySize}
+		for _, src := range sources {
+			addFlow(src, gw)
+		}
+		addFlow(gw, target)
+	}
+
+	var terminal []string
+	for _, t := range tasks {
+		id := ids[t.Code]
+		if len(t.DependsOn) == 0 {
+			addFlow("StartEvent_1", id)
+		} else {
+			var sources []string
+			for _, dep := range t.DependsOn {
+				sources = append(sources, ids[dep])
+			}
+			joinFor(id, sources)
+		}
+		if len(successors[t.Code]) == 0 {
+			terminal = append(terminal, id)
+		}
+	}
+	if len(terminal) > 0 {
+		joinFor("EndEvent_1", terminal)
+	} else {
+		addFlow("StartEvent_1", "EndEvent_1")
+	}
+
+	for _, id := range order {
+		process.Nodes = append(process.Nodes, *nodes[id])
+		p := layout[id]
+		plane.Shapes = append(plane.Shapes, bpmnOutShape{
+			ID:          id + "_di",
+			BpmnElement: id,
+			Bounds:      bpmnOutBounds{X: p.x, Y: p.y, Width: p.w, Height: p.h},
+		})
+	}
+
+	defs := bpmnOutDefinitions{
+		XmlnsBpmn:       bpmnNamespace,
+		XmlnsBpmndi:     bpmnDINamespace,
+		XmlnsDc:         bpmnDCNamespace,
+		XmlnsDi:         bpmnDINamespace2,
+		XmlnsCamunda:    camundaNamespace,
+		ID:              "Definitions_1",
+		TargetNamespace: "http://bpmn.io/schema/bpmn",
+		Process:         process,
+		Diagram:         bpmnOutDiagram{ID: "BPMNDiagram_1", Plane: plane},
+	}
+
+	out, err := xml.MarshalIndent(defs, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// UnmarshalBPMN разбирает BPMN 2.0 XML в документ обмена.
+// Зависимости задачи — ближайшие предшествующие задачи, шлюзы и события пропускаются
+func (s *TemplateExchangeService) UnmarshalBPMN(data []byte) (*TemplateExchangeDocument, error) {
+	var defs bpmnInDefinitions
+	if err := xml.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("некорректный BPMN: %w", err)
+	}
+	if len(defs.Processes) == 0 {
+		return nil, errors.New("в BPMN не найден процесс")
+	}
+	if len(defs.Processes) > 1 {
+		return nil, errors.New("BPMN должен содержать ровно один процесс")
+	}
+	process := defs.Processes[0]
+
+	elements := make(map[string]*bpmnInElement)
+	predecessors := make(map[string][]string)
+	var taskIDs []string
+	for i := range process.Elements {
+		el := &process.Elements[i]
+		switch {
+		case el.XMLName.Local == "sequenceFlow":
+			predecessors[el.TargetRef] = append(predecessors[el.TargetRef], el.SourceRef)
+		case bpmnTaskElements[el.XMLName.Local]:
+			elements[el.ID] = el
+			taskIDs = append(taskIDs, el.ID)
+		default:
+			elements[el.ID] = el
+		}
+	}
+	if len(taskIDs) == 0 {
+		return nil, errors.New("в процессе BPMN нет задач")
+	}
+
+	codes := make(map[string]string, len(taskIDs))
+	for _, id := range taskIDs {
+		code := bpmnPropertyValue(elements[id].Properties, "code")
+		if code == "" {
+			code = id
+		}
+		codes[id] = code
+	}
+
+	// Ближайшие задачи-предшественники через шлюзы и промежуточные события
+	var taskPredecessors func(id string, visited map[string]bool) []string
+	taskPredecessors = func(id string, visited map[string]bool) []string {
+		var result []string
+		for _, src := range predecessors[id] {
+			if visited[src] {
+				continue
+			}
+			visited[src] = true
+			if el := elements[src]; el != nil && bpmnTaskElements[el.XMLName.Local] {
+				result = append(result, codes[src])
+				continue
+			}
+			result = append(result, taskPredecessors(src, visited)...)
+		}
+		return result
+	}
+
+	doc := &TemplateExchangeDocument{
+		FormatVersion: TemplateExchangeFormatVersion,
+		Template:      TemplateExchangeHeader{Name: process.Name},
+		Tasks:         []TemplateExchangeTask{},
+		TaskTemplates: []TaskTemplateExchange{},
+	}
+	if doc.Template.Name == "" {
+		doc.Template.Name = process.ID
+	}
+
+	for i, id := range taskIDs {
+		el := elements[id]
+		task := TemplateExchangeTask{
+			Code:             codes[id],
+			Name:             el.Name,
+			Stage:            bpmnPropertyValue(el.Properties, "stage"),
+			DependsOn:        taskPredecessors(id, map[string]bool{}),
+			ResponsibleRole:  el.CandidateGroups,
+			TaskType:         bpmnTaskTypeForElement(el.XMLName.Local),
+			Order:            i,
+			TaskTemplateCode: bpmnPropertyValue(el.Properties, "taskTemplateCode"),
+			ProjectStatus:    bpmnPropertyValue(el.Properties, "projectStatus"),
+		}
+		if task.Name == "" {
+			task.Name = task.Code
+		}
+		if v := bpmnPropertyValue(el.Properties, "duration"); v != "" {
+			d, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("задача %s: некорректная длительность %q", task.Code, v)
+			}
+			task.Duration = d
+		}
+		if v := bpmnPropertyValue(el.Properties, "order"); v != "" {
+			if o, err := strconv.Atoi(v); err == nil {
+				task.Order = o
+			}
+		}
+		if v := bpmnPropertyValue(el.Properties, "statusOrder"); v != "" {
+			if o, err := strconv.Atoi(v); err == nil {
+				task.StatusOrder = o
+			}
+		}
+		doc.Tasks = append(doc.Tasks, task)
+	}
+
+	return doc, nil
+}
+
+func bpmnPropertyValue(props []bpmnProperty, name string) string {
+	for _, p := range props {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// bpmnElementForTaskType UserTask -> userTask
+func bpmnElementForTaskType(taskType string) string {
+	if taskType == "" {
+		return "userTask"
+	}
+	runes := []rune(taskType)
+	runes[0] = unicode.ToLower(runes[0])
+	name := string(runes)
+	if !bpmnTaskElements[name] {
+		return "userTask"
+	}
+	return name
+}
+
+// bpmnTaskTypeForElement userTask -> UserTask
+func bpmnTaskTypeForElement(element string) string {
+	if element == "task" {
+		return "UserTask"
+	}
+	runes := []rune(element)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func bpmnSafeID(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "1"
+	}
+	return b.String()
+}
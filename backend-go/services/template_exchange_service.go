@@ -0,0 +1,422 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"time"
+
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// TemplateExchangeFormatVersion версия формата файла обмена шаблонами
+const TemplateExchangeFormatVersion = 1
+
+// MaxTemplateImportSize предельный размер импортируемого файла шаблона
+const MaxTemplateImportSize = 5 << 20
+
+// TemplateExchangeDocument переносимое представление шаблона проекта
+// (экспорт с тестового стенда и импорт на продуктив)
+type TemplateExchangeDocument struct {
+	FormatVersion int                    `json:"formatVersion" yaml:"formatVersion"`
+	ExportedAt    time.Time              `json:"exportedAt" yaml:"exportedAt"`
+	SourceVersion int                    `json:"sourceVersion" yaml:"sourceVersion"` // 0 — черновик
+	Template      TemplateExchangeHeader `json:"template" yaml:"template"`
+	Tasks         []TemplateExchangeTask `json:"tasks" yaml:"tasks"`
+	TaskTemplates []TaskTemplateExchange `json:"taskTemplates" yaml:"taskTemplates"`
+}
+
+type TemplateExchangeHeader struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	Category    string `json:"category" yaml:"category"`
+}
+
+type TemplateExchangeTask struct {
+	Code             string   `json:"code" yaml:"code"`
+	Name             string   `json:"name" yaml:"name"`
+	Duration         int      `json:"duration" yaml:"duration"`
+	Stage            string   `json:"stage" yaml:"stage"`
+	DependsOn        []string `json:"dependsOn" yaml:"dependsOn"`
+	ResponsibleRole  string   `json:"responsibleRole" yaml:"responsibleRole"`
+	TaskType         string   `json:"taskType" yaml:"taskType"`
+	Order            int      `json:"order" yaml:"order"`
+	TaskTemplateCode string   `json:"taskTemplateCode,omitempty" yaml:"taskTemplateCode,omitempty"` // Ссылка на TaskTemplate по коду, а не по ID
+	ProjectStatus    string   `json:"projectStatus,omitempty" yaml:"projectStatus,omitempty"`
+	StatusOrder      int      `json:"statusOrder" yaml:"statusOrder"`
+}
+
+// TaskTemplateExchange шаблон задачи с полями, без идентификаторов БД
+type TaskTemplateExchange struct {
+	Code        string                  `json:"code" yaml:"code"`
+	Name        string                  `json:"name" yaml:"name"`
+	Description string                  `json:"description" yaml:"description"`
+	Category    string                  `json:"category" yaml:"category"`
+	IsActive    bool                    `json:"isActive" yaml:"isActive"`
+	Fields      []TaskFieldExchangeItem `json:"fields" yaml:"fields"`
+}
+
+type TaskFieldExchangeItem struct {
+	FieldKey        string  `json:"fieldKey" yaml:"fieldKey"`
+	FieldLabel      string  `json:"fieldLabel" yaml:"fieldLabel"`
+	FieldType       string  `json:"fieldType" yaml:"fieldType"`
+	IsRequired      bool    `json:"isRequired" yaml:"isRequired"`
+	IsVisible       bool    `json:"isVisible" yaml:"isVisible"`
+	IsReadOnly      bool    `json:"isReadOnly" yaml:"isReadOnly"`
+	DefaultValue    *string `json:"defaultValue,omitempty" yaml:"defaultValue,omitempty"`
+	ValidationRules *string `json:"validationRules,omitempty" yaml:"validationRules,omitempty"`
+	Options         *string `json:"options,omitempty" yaml:"options,omitempty"`
+	Order           int     `json:"order" yaml:"order"`
+	Section         string  `json:"section" yaml:"section"`
+	Placeholder     *string `json:"placeholder,omitempty" yaml:"placeholder,omitempty"`
+	HelpText        *string `json:"helpText,omitempty" yaml:"helpText,omitempty"`
+}
+
+// TemplateImportResult результат импорта шаблона
+type TemplateImportResult struct {
+	Template             *models.ProjectTemplate `json:"template"`
+	CreatedTaskTemplates []string                `json:"createdTaskTemplates"`
+	ReusedTaskTemplates  []string                `json:"reusedTaskTemplates"` // Уже существовали с тем же кодом и не перезаписывались
+	Warnings             []string                `json:"warnings"`
+}
+
+// TemplateExchangeService экспорт и импорт шаблонов проектов (JSON/YAML, BPMN 2.0)
+type TemplateExchangeService struct {
+	db               *gorm.DB
+	templateRepo     repositories.ProjectTemplateRepository
+	taskTemplateRepo repositories.TaskTemplateRepository
+}
+
+func NewTemplateExchangeService(
+	db *gorm.DB,
+	templateRepo repositories.ProjectTemplateRepository,
+	taskTemplateRepo repositories.TaskTemplateRepository,
+) *TemplateExchangeService {
+	return &TemplateExchangeService{
+		db:               db,
+		templateRepo:     templateRepo,
+		taskTemplateRepo: taskTemplateRepo,
+	}
+}
+
+// Export собирает документ обмена по черновику шаблона (version = 0)
+// или по опубликованной версии
+func (s *TemplateExchangeService) Export(templateID uint, version int) (*TemplateExchangeDocument, error) {
+	template, err := s.templateRepo.FindByID(templateID)
+	if err != nil {
+		return nil, errors.New("шаблон не найден")
+	}
+
+	doc := &TemplateExchangeDocument{
+		FormatVersion: TemplateExchangeFormatVersion,
+		ExportedAt:    time.Now().UTC(),
+		SourceVersion: version,
+		Template: TemplateExchangeHeader{
+			Name:        template.Name,
+			Description: template.Description,
+			Category:    template.Category,
+		},
+		Tasks:         []TemplateExchangeTask{},
+		TaskTemplates: []TaskTemplateExchange{},
+	}
+
+	var blueprints []models.TemplateTask
+	if version > 0 {
+		v, err := s.templateRepo.FindVersion(templateID, version)
+		if err != nil {
+			return nil, fmt.Errorf("версия %d шаблона не найдена", version)
+		}
+		for _, vt := range v.Tasks {
+			blueprints = append(blueprints, models.TemplateTask{
+				Code:            vt.Code,
+				Name:            vt.Name,
+				Duration:        vt.Duration,
+				Stage:           vt.Stage,
+				DependsOn:       vt.DependsOn,
+				ResponsibleRole: vt.ResponsibleRole,
+				TaskType:        vt.TaskType,
+				Order:           vt.Order,
+				TaskTemplateID:  vt.TaskTemplateID,
+				ProjectStatus:   vt.ProjectStatus,
+				StatusOrder:     vt.StatusOrder,
+			})
+		}
+	} else {
+		blueprints = template.Tasks
+	}
+
+	taskTemplateCodes := make(map[uint]string)
+	for _, bp := range blueprints {
+		task := TemplateExchangeTask{
+			Code:            bp.Code,
+			Name:            bp.Name,
+			Duration:        bp.Duration,
+			Stage:           bp.Stage,
+			DependsOn:       append([]string{}, bp.DependsOn...),
+			ResponsibleRole: bp.ResponsibleRole,
+			TaskType:        bp.TaskType,
+			Order:           bp.Order,
+			ProjectStatus:   bp.ProjectStatus,
+			StatusOrder:     bp.StatusOrder,
+		}
+
+		if bp.TaskTemplateID != nil {
+			code, seen := taskTemplateCodes[*bp.TaskTemplateID]
+			if !seen {
+				tt, err := s.taskTemplateRepo.FindByID(*bp.TaskTemplateID)
+				if err != nil {
+					return nil, fmt.Errorf("шаблон задачи %d для %s не найден", *bp.TaskTemplateID, bp.Code)
+				}
+				code = tt.Code
+				taskTemplateCodes[tt.ID] = code
+				doc.TaskTemplates = append(doc.TaskTemplates, toTaskTemplateExchange(tt))
+			}
+			task.TaskTemplateCode = code
+		}
+
+		doc.Tasks = append(doc.Tasks, task)
+	}
+
+	return doc, nil
+}
+
+// MarshalDocument сериализует документ в JSON или YAML
+func (s *TemplateExchangeService) MarshalDocument(doc *TemplateExchangeDocument, format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(doc)
+	case "json":
+		return json.MarshalIndent(doc, "", "  ")
+	default:
+		return nil, fmt.Errorf("неподдерживаемый формат: %s", format)
+	}
+}
+
+// UnmarshalDocument разбирает документ в JSON или YAML
+func (s *TemplateExchangeService) UnmarshalDocument(data []byte, format string) (*TemplateExchangeDocument, error) {
+	var doc TemplateExchangeDocument
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(data, &doc)
+	case "json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый формат: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("некорректный документ: %w", err)
+	}
+	return &doc, nil
+}
+
+// Import создает новый неактивный шаблон из документа обмена.
+// Шаблоны задач сопоставляются по коду: существующие не перезаписываются,
+// отсутствующие создаются
+func (s *TemplateExchangeService) Import(doc *TemplateExchangeDocument, name string) (*TemplateImportResult, error) {
+	if doc.FormatVersion == 0 || doc.FormatVersion > TemplateExchangeFormatVersion {
+		return nil, fmt.Errorf("неподдерживаемая версия формата: %d", doc.FormatVersion)
+	}
+	if name == "" {
+		name = doc.Template.Name
+	}
+	if name == "" {
+		return nil, errors.New("название шаблона обязательно")
+	}
+	if len(doc.Tasks) == 0 {
+		return nil, errors.New("в документе нет задач")
+	}
+
+	result := &TemplateImportResult{
+		CreatedTaskTemplates: []string{},
+		ReusedTaskTemplates:  []string{},
+		Warnings:             []string{},
+	}
+
+	template := &models.ProjectTemplate{
+		Name:            name,
+		Description:     doc.Template.Description,
+		Category:        doc.Template.Category,
+		IsActive:        false, // Импортированный шаблон включается вручную после проверки
+		IsDefault:       false,
+		HasDraftChanges: true,
+	}
+
+	codes := make(map[string]bool, len(doc.Tasks))
+	for i, t := range doc.Tasks {
+		if t.Code == "" || t.Name == "" {
+			return nil, fmt.Errorf("задача #%d: код и название обязательны", i+1)
+		}
+		if codes[t.Code] {
+			return nil, fmt.Errorf("код задачи %s встречается несколько раз", t.Code)
+		}
+		codes[t.Code] = true
+		if t.Duration <= 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("задача %s: длительность не задана, установлен 1 день", t.Code))
+			t.Duration = 1
+		}
+		taskType := t.TaskType
+		if taskType == "" {
+			taskType = "UserTask"
+		}
+		template.Tasks = append(template.Tasks, models.TemplateTask{
+			Code:            t.Code,
+			Name:            t.Name,
+			Duration:        t.Duration,
+			Stage:           t.Stage,
+			DependsOn:       pq.StringArray(append([]string{}, t.DependsOn...)),
+			ResponsibleRole: t.ResponsibleRole,
+			TaskType:        taskType,
+			Order:           t.Order,
+			ProjectStatus:   t.ProjectStatus,
+			StatusOrder:     t.StatusOrder,
+		})
+	}
+
+	if err := validateTemplateDependencies(template.Tasks); err != nil {
+		return nil, err
+	}
+
+	docTaskTemplates := make(map[string]*TaskTemplateExchange, len(doc.TaskTemplates))
+	for i := range doc.TaskTemplates {
+		docTaskTemplates[doc.TaskTemplates[i].Code] = &doc.TaskTemplates[i]
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		taskTemplateRepo := repositories.NewTaskTemplateRepository(tx)
+		resolved := make(map[string]uint)
+
+		for i, t := range doc.Tasks {
+			if t.TaskTemplateCode == "" {
+				continue
+			}
+			id, ok := resolved[t.TaskTemplateCode]
+			if !ok {
+				if existing, err := taskTemplateRepo.FindByCode(t.TaskTemplateCode); err == nil {
+					id = existing.ID
+					result.ReusedTaskTemplates = append(result.ReusedTaskTemplates, existing.Code)
+				} else {
+					src := docTaskTemplates[t.TaskTemplateCode]
+					if src == nil {
+						result.Warnings = append(result.Warnings, fmt.Sprintf("задача %s: шаблон задачи %s не найден, связь не установлена", t.Code, t.TaskTemplateCode))
+						continue
+					}
+					tt := fromTaskTemplateExchange(src)
+					if err := tt.Validate(); err != nil {
+						return fmt.Errorf("шаблон задачи %s: %w", src.Code, err)
+					}
+					for j := range tt.Fields {
+						if err := tt.Fields[j].Validate(); err != nil {
+							return fmt.Errorf("шаблон задачи %s, поле %s: %w", src.Code, tt.Fields[j].FieldKey, err)
+						}
+					}
+					if err := taskTemplateRepo.Create(tt); err != nil {
+						return err
+					}
+					if err := restoreTaskTemplateFlags(tx, tt, src); err != nil {
+						return err
+					}
+					id = tt.ID
+					result.CreatedTaskTemplates = append(result.CreatedTaskTemplates, tt.Code)
+				}
+				resolved[t.TaskTemplateCode] = id
+			}
+			template.Tasks[i].TaskTemplateID = &id
+		}
+
+		if err := repositories.NewProjectTemplateRepository(tx).Create(template); err != nil {
+			return err
+		}
+		// default:true у IsActive перекрывает нулевое значение при создании
+		template.IsActive = false
+		return tx.Model(&models.ProjectTemplate{}).Where("\"ID\" = ?", template.ID).
+			Update("IsActive", false).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Template = template
+	return result, nil
+}
+
+// restoreTaskTemplateFlags возвращает false в поля с default:true,
+// которые GORM заполнил значением по умолчанию при создании
+func restoreTaskTemplateFlags(tx *gorm.DB, tt *models.TaskTemplate, src *TaskTemplateExchange) error {
+	if !src.IsActive {
+		if err := tx.Model(&models.TaskTemplate{}).Where("id = ?", tt.ID).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		tt.IsActive = false
+	}
+	for i := range tt.Fields {
+		if !src.Fields[i].IsVisible {
+			if err := tx.Model(&models.TaskFieldTemplate{}).Where("id = ?", tt.Fields[i].ID).Update("is_visible", false).Error; err != nil {
+				return err
+			}
+			tt.Fields[i].IsVisible = false
+		}
+	}
+	return nil
+}
+
+func toTaskTemplateExchange(tt *models.TaskTemplate) TaskTemplateExchange {
+	item := TaskTemplateExchange{
+		Code:        tt.Code,
+		Name:        tt.Name,
+		Description: tt.Description,
+		Category:    tt.Category,
+		IsActive:    tt.IsActive,
+		Fields:      []TaskFieldExchangeItem{},
+	}
+	for _, f := range tt.Fields {
+		item.Fields = append(item.Fields, TaskFieldExchangeItem{
+			FieldKey:        f.FieldKey,
+			FieldLabel:      f.FieldLabel,
+			FieldType:       f.FieldType,
+			IsRequired:      f.IsRequired,
+			IsVisible:       f.IsVisible,
+			IsReadOnly:      f.IsReadOnly,
+			DefaultValue:    f.DefaultValue,
+			ValidationRules: f.ValidationRules,
+			Options:         f.Options,
+			Order:           f.Order,
+			Section:         f.Section,
+			Placeholder:     f.Placeholder,
+			HelpText:        f.HelpText,
+		})
+	}
+	return item
+}
+
+func fromTaskTemplateExchange(item *TaskTemplateExchange) *models.TaskTemplate {
+	tt := &models.TaskTemplate{
+		Code:        item.Code,
+		Name:        item.Name,
+		Description: item.Description,
+		Category:    item.Category,
+		IsActive:    item.IsActive,
+	}
+	for _, f := range item.Fields {
+		tt.Fields = append(tt.Fields, models.TaskFieldTemplate{
+			FieldKey:        f.FieldKey,
+			FieldLabel:      f.FieldLabel,
+			FieldType:       f.FieldType,
+			IsRequired:      f.IsRequired,
+			IsVisible:       f.IsVisible,
+			IsReadOnly:      f.IsReadOnly,
+			DefaultValue:    f.DefaultValue,
+			ValidationRules: f.ValidationRules,
+			Options:         f.Options,
+			Order:           f.Order,
+			Section:         f.Section,
+			Placeholder:     f.Placeholder,
+			HelpText:        f.HelpText,
+		})
+	}
+	return tt
+}
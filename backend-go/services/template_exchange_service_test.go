@@ -0,0 +1,120 @@
+package services_test
+
+import (
+	"testing"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateExchangeService_RoundTrip(t *testing.T) {
+	db := setupTestDB(t)
+	templateRepo := repositories.NewProjectTemplateRepository(db)
+	taskTemplateRepo := repositories.NewTaskTemplateRepository(db)
+	service := services.NewTemplateExchangeService(db, templateRepo, taskTemplateRepo)
+
+	taskTemplate := &models.TaskTemplate{
+		Code:     "AUDIT-FORM",
+		Name:     "Форма аудита",
+		Category: "Аудит",
+		IsActive: true,
+		Fields: []models.TaskFieldTemplate{
+			{FieldKey: "area", FieldLabel: "Площадь", FieldType: "number"},
+		},
+	}
+	require.NoError(t, taskTemplateRepo.Create(taskTemplate))
+
+	source := &models.ProjectTemplate{
+		Name:     "Открытие",
+		Category: "Открытие",
+		Tasks: []models.TemplateTask{
+			{Code: "TASK-A", Name: "Аудит", Duration: 2, Stage: "Аудит", DependsOn: pq.StringArray{}, ResponsibleRole: "МП", TaskType: "UserTask", Order: 0, TaskTemplateID: &taskTemplate.ID},
+			{Code: "TASK-B", Name: "Планировка", Duration: 3, Stage: "Проектирование", DependsOn: pq.StringArray{"TASK-A"}, ResponsibleRole: "МРиЗ", TaskType: "UserTask", Order: 1},
+			{Code: "TASK-C", Name: "Логистика", Duration: 1, Stage: "Логистика", DependsOn: pq.StringArray{"TASK-A"}, ResponsibleRole: "МРиЗ", TaskType: "UserTask", Order: 2},
+			{Code: "TASK-D", Name: "Бюджет", Duration: 1, Stage: "Бюджет", DependsOn: pq.StringArray{"TASK-B", "TASK-C"}, ResponsibleRole: "МРиЗ", TaskType: "ServiceTask", Order: 3},
+		},
+	}
+	require.NoError(t, templateRepo.Create(source))
+
+	doc, err := service.Export(source.ID, 0)
+	require.NoError(t, err)
+	assert.Len(t, doc.Tasks, 4)
+	require.Len(t, doc.TaskTemplates, 1)
+	assert.Equal(t, "AUDIT-FORM", doc.Tasks[0].TaskTemplateCode)
+
+	// YAML: документ переживает сериализацию и импортируется как новый шаблон
+	data, err := service.MarshalDocument(doc, "yaml")
+	require.NoError(t, err)
+	parsed, err := service.UnmarshalDocument(data, "yaml")
+	require.NoError(t, err)
+
+	result, err := service.Import(parsed, "Открытие (прод)")
+	require.NoError(t, err)
+	assert.False(t, result.Template.IsActive)
+	assert.Equal(t, []string{"AUDIT-FORM"}, result.ReusedTaskTemplates)
+
+	imported, err := templateRepo.FindByID(result.Template.ID)
+	require.NoError(t, err)
+	require.Len(t, imported.Tasks, 4)
+	assert.Equal(t, []string{"TASK-B", "TASK-C"}, []string(imported.Tasks[3].DependsOn))
+	assert.Equal(t, taskTemplate.ID, *imported.Tasks[0].TaskTemplateID)
+
+	// BPMN: граф зависимостей восстанавливается через шлюз слияния
+	xmlData, err := service.MarshalBPMN(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(xmlData), "bpmn:parallelGateway")
+	// ID элементов берутся из кодов задач, а не из их позиции
+	assert.Contains(t, string(xmlData), `id="TASK-D"`)
+	assert.NotContains(t, string(xmlData), `id="Task_`)
+
+	fromBPMN, err := service.UnmarshalBPMN(xmlData)
+	require.NoError(t, err)
+	require.Len(t, fromBPMN.Tasks, 4)
+	byCode := map[string]services.TemplateExchangeTask{}
+	for _, task := range fromBPMN.Tasks {
+		byCode[task.Code] = task
+	}
+	assert.ElementsMatch(t, []string{"TASK-B", "TASK-C"}, byCode["TASK-D"].DependsOn)
+	assert.Equal(t, "ServiceTask", byCode["TASK-D"].TaskType)
+	assert.Equal(t, 3, byCode["TASK-B"].Duration)
+	assert.Equal(t, "МРиЗ", byCode["TASK-B"].ResponsibleRole)
+	assert.Empty(t, byCode["TASK-A"].DependsOn)
+
+	// Коды, недопустимые как ID, приводятся к безопасной форме без совпадений; сами коды сохраняются
+	doc.Tasks = []services.TemplateExchangeTask{
+		{Code: "1-A", Name: "Первая", Duration: 1},
+		{Code: "1 A", Name: "Вторая", Duration: 1, DependsOn: []string{"1-A"}},
+	}
+	xmlData, err = service.MarshalBPMN(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(xmlData), `id="Task_1_A"`)
+	assert.Contains(t, string(xmlData), `id="Task_1_A_2"`)
+	fromBPMN, err = service.UnmarshalBPMN(xmlData)
+	require.NoError(t, err)
+	require.Len(t, fromBPMN.Tasks, 2)
+	assert.Equal(t, "1 A", fromBPMN.Tasks[1].Code)
+	assert.Equal(t, []string{"1-A"}, fromBPMN.Tasks[1].DependsOn)
+}
+
+func TestTemplateExchangeService_ImportRejectsCycle(t *testing.T) {
+	db := setupTestDB(t)
+	service := services.NewTemplateExchangeService(db,
+		repositories.NewProjectTemplateRepository(db), repositories.NewTaskTemplateRepository(db))
+
+	doc := &services.TemplateExchangeDocument{
+		FormatVersion: services.TemplateExchangeFormatVersion,
+		Template:      services.TemplateExchangeHeader{Name: "Цикл"},
+		Tasks: []services.TemplateExchangeTask{
+			{Code: "A", Name: "A", Duration: 1, DependsOn: []string{"B"}},
+			{Code: "B", Name: "B", Duration: 1, DependsOn: []string{"A"}},
+		},
+	}
+
+	_, err := service.Import(doc, "")
+	assert.Error(t, err)
+}
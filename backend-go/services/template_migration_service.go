@@ -0,0 +1,327 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"portal-razvitie/events"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TemplateMigrationPlan описывает изменения задач проекта при переходе на другую версию шаблона
+type TemplateMigrationPlan struct {
+	ProjectID     uint     `json:"projectId"`
+	FromVersionID *uint    `json:"fromVersionId"`
+	ToVersionID   uint     `json:"toVersionId"`
+	ToVersion     int      `json:"toVersion"`
+	Added         []string `json:"added"`         // Новые задачи версии
+	Updated       []string `json:"updated"`       // Незавершенные задачи, параметры которых изменились
+	Retired       []string `json:"retired"`       // Незавершенные задачи, удаленные из версии
+	KeptCompleted []string `json:"keptCompleted"` // Завершенные задачи, удаленные из версии (история сохраняется)
+	Applied       bool     `json:"applied"`
+}
+
+// TemplateMigrationService переводит работающие проекты на новую версию шаблона
+type TemplateMigrationService struct {
+	db              *gorm.DB
+	templateRepo    repositories.ProjectTemplateRepository
+	projectRepo     repositories.ProjectRepository
+	workflowService WorkflowServiceInterface
+	eventBus        events.EventBus
+	assignments     *AssignmentService
+	absences        *AbsenceService
+}
+
+func NewTemplateMigrationService(
+	db *gorm.DB,
+	templateRepo repositories.ProjectTemplateRepository,
+	projectRepo repositories.ProjectRepository,
+	workflowService WorkflowServiceInterface,
+	eventBus events.EventBus,
+) *TemplateMigrationService {
+	return &TemplateMigrationService{
+		db:              db,
+		templateRepo:    templateRepo,
+		projectRepo:     projectRepo,
+		workflowService: workflowService,
+		eventBus:        eventBus,
+		assignments:     NewAssignmentService(db),
+	}
+}
+
+// SetAssignmentService задает общий сервис назначения (правила и стратегии те же, что при создании проекта)
+func (s *TemplateMigrationService) SetAssignmentService(assignments *AssignmentService) {
+	s.assignments = assignments
+}
+
+// SetAbsenceService включает передачу новых задач заместителям отсутствующих исполнителей
+func (s *TemplateMigrationService) SetAbsenceService(absences *AbsenceService) {
+	s.absences = absences
+}
+
+// PlanMigration рассчитывает изменения без их применения
+func (s *TemplateMigrationService) PlanMigration(projectID uint, version int) (*TemplateMigrationPlan, error) {
+	_, target, tasks, err := s.load(projectID, version)
+	if err != nil {
+		return nil, err
+	}
+	plan, _ := buildMigrationPlan(projectID, target, tasks)
+	return plan, nil
+}
+
+// MigrateProject переводит проект на указанную версию шаблона:
+// добавляет новые задачи, исключает удаленные (завершенные остаются в истории)
+// и пересчитывает сроки
+func (s *TemplateMigrationService) MigrateProject(projectID uint, version int, actorID uint) (*TemplateMigrationPlan, error) {
+	project, target, tasks, err := s.load(projectID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, targetByCode := buildMigrationPlan(projectID, target, tasks)
+	plan.FromVersionID = project.TemplateVersionID
+
+	existing := make(map[string]*models.ProjectTask, len(tasks))
+	for i := range tasks {
+		if tasks[i].Code != nil {
+			existing[*tasks[i].Code] = &tasks[i]
+		}
+	}
+
+	var created []models.ProjectTask
+	now := time.Now().UTC()
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, code := range plan.Retired {
+			task := existing[code]
+			task.Status = string(models.TaskStatusRetired)
+			task.IsActive = false
+			task.UpdatedAt = &now
+			if err := tx.Save(task).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, code := range plan.Updated {
+			task := existing[code]
+			applyVersionTask(task, targetByCode[code])
+			task.UpdatedAt = &now
+			if err := tx.Save(task).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, code := range plan.Added {
+			vt := targetByCode[code]
+			task := models.ProjectTask{
+				ProjectID:          projectID,
+				Responsible:        vt.ResponsibleRole,
+				NormativeDeadline:  now.AddDate(0, 0, vt.Duration),
+				PlannedStartDate:   &now,
+				Status:             string(models.TaskStatusPending),
+				CreatedAt:          &now,
+				CustomFieldsValues: func() *string { s := "{}"; return &s }(),
+			}
+			applyVersionTask(&task, vt)
+
+			// Исполнитель выбирается так же, как при создании проекта
+			if err := s.assignments.WithTx(tx).AssignTask(&task, project); err != nil {
+				log.Printf("⚠️ Failed to assign task %s: %v", code, err)
+			}
+			routeToDelegate(s.absences, &task)
+
+			if err := tx.Create(&task).Error; err != nil {
+				return err
+			}
+			existing[code] = &task
+			created = append(created, task)
+		}
+
+		// Активируем ожидающие задачи, все зависимости которых уже выполнены
+		for _, vt := range target.Tasks {
+			task := existing[vt.Code]
+			if task == nil || task.Status != string(models.TaskStatusPending) {
+				continue
+			}
+			ready := true
+			for _, dep := range vt.DependsOn {
+				if d := existing[dep]; d != nil && !d.IsCompleted() {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			task.Status = string(models.TaskStatusAssigned)
+			task.IsActive = true
+			task.StartedAt = &now
+			if err := tx.Save(task).Error; err != nil {
+				return err
+			}
+			for i := range created {
+				if created[i].ID == task.ID {
+					created[i] = *task
+				}
+			}
+		}
+
+		return tx.Model(&models.Project{}).Where("\"Id\" = ?", projectID).
+			Update("TemplateVersionID", target.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.Applied = true
+
+	if s.workflowService != nil {
+		if err := s.workflowService.RecalculateProjectTimeline(projectID); err != nil {
+			log.Printf("[TemplateMigration] Error recalculating timeline for project %d: %v", projectID, err)
+		}
+	}
+
+	for i := range created {
+		s.eventBus.Publish(events.TaskCreatedEvent{Task: &created[i], ActorID: actorID})
+	}
+
+	projectName := fmt.Sprintf("Проект #%d", projectID)
+	if project.Store != nil {
+		projectName = project.Store.Name
+	}
+	s.eventBus.Publish(events.ProjectTemplateMigratedEvent{
+		ProjectID:   projectID,
+		ProjectName: projectName,
+		Version:     target.Version,
+		ActorID:     actorID,
+	})
+
+	return plan, nil
+}
+
+func (s *TemplateMigrationService) load(projectID uint, version int) (*models.Project, *models.ProjectTemplateVersion, []models.ProjectTask, error) {
+	project, err := s.projectRepo.FindByID(projectID)
+	if err != nil {
+		return nil, nil, nil, errors.New("проект не найден")
+	}
+	if project.TemplateID == nil {
+		return nil, nil, nil, errors.New("проект создан без шаблона")
+	}
+
+	target, err := s.templateRepo.FindVersion(*project.TemplateID, version)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("версия %d шаблона не найдена", version)
+	}
+
+	var tasks []models.ProjectTask
+	if err := s.db.Where("\"ProjectId\" = ?", projectID).Order("\"Order\" ASC").Find(&tasks).Error; err != nil {
+		return nil, nil, nil, err
+	}
+
+	return project, target, tasks, nil
+}
+
+// buildMigrationPlan сравнивает задачи проекта с задачами версии по коду
+func buildMigrationPlan(projectID uint, target *models.ProjectTemplateVersion, tasks []models.ProjectTask) (*TemplateMigrationPlan, map[string]*models.TemplateVersionTask) {
+	plan := &TemplateMigrationPlan{
+		ProjectID:     projectID,
+		ToVersionID:   target.ID,
+		ToVersion:     target.Version,
+		Added:         []string{},
+		Updated:       []string{},
+		Retired:       []string{},
+		KeptCompleted: []string{},
+	}
+
+	targetByCode := make(map[string]*models.TemplateVersionTask, len(target.Tasks))
+	for i := range target.Tasks {
+		targetByCode[target.Tasks[i].Code] = &target.Tasks[i]
+	}
+
+	// Код считается присутствующим, если есть хотя бы одна неисключенная задача с ним.
+	// Исключенные задачи не учитываются: если код вернулся в шаблон, задача заводится заново,
+	// но только когда ее еще не завели при прошлой миграции (порядок задач здесь не важен)
+	seen := make(map[string]bool, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Code == nil {
+			continue // Задачи, добавленные вручную, не относятся к шаблону
+		}
+		code := *task.Code
+		if task.Status == string(models.TaskStatusRetired) {
+			continue
+		}
+		seen[code] = true
+
+		vt, inTarget := targetByCode[code]
+		switch {
+		case !inTarget && task.IsCompleted():
+			plan.KeptCompleted = append(plan.KeptCompleted, code)
+		case !inTarget:
+			plan.Retired = append(plan.Retired, code)
+		case !task.IsCompleted() && versionTaskChanged(task, vt):
+			plan.Updated = append(plan.Updated, code)
+		}
+	}
+
+	for _, vt := range target.Tasks {
+		if !seen[vt.Code] {
+			plan.Added = append(plan.Added, vt.Code)
+		}
+	}
+
+	return plan, targetByCode
+}
+
+// applyVersionTask переносит параметры задачи версии в задачу проекта
+func applyVersionTask(task *models.ProjectTask, vt *models.TemplateVersionTask) {
+	code := vt.Code
+	stage := vt.Stage
+	days := vt.Duration
+	depsBytes, _ := json.Marshal([]string(vt.DependsOn))
+	deps := string(depsBytes)
+
+	task.Code = &code
+	task.Name = vt.Name
+	task.TaskType = vt.TaskType
+	task.Stage = &stage
+	task.Days = &days
+	task.DependsOn = &deps
+	task.Order = vt.Order
+	task.TaskTemplateID = vt.TaskTemplateID
+	projectStatus := vt.ProjectStatus
+	task.ProjectStatus = &projectStatus
+	task.StatusOrder = vt.StatusOrder
+}
+
+func versionTaskChanged(task *models.ProjectTask, vt *models.TemplateVersionTask) bool {
+	if task.Name != vt.Name || task.Order != vt.Order {
+		return true
+	}
+	if task.Days == nil || *task.Days != vt.Duration {
+		return true
+	}
+	if task.Stage == nil || *task.Stage != vt.Stage {
+		return true
+	}
+	if task.ProjectStatus == nil || *task.ProjectStatus != vt.ProjectStatus || task.StatusOrder != vt.StatusOrder {
+		return true
+	}
+	var deps []string
+	if task.DependsOn != nil && *task.DependsOn != "" {
+		_ = json.Unmarshal([]byte(*task.DependsOn), &deps)
+	}
+	if len(deps) != len(vt.DependsOn) {
+		return true
+	}
+	for i := range deps {
+		if deps[i] != vt.DependsOn[i] {
+			return true
+		}
+	}
+	return false
+}
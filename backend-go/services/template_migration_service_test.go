@@ -0,0 +1,197 @@
+package services_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"portal-razvitie/events"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// projectTaskFrom задача проекта, созданная по задаче версии шаблона
+func projectTaskFrom(t *testing.T, projectID uint, vt models.TemplateVersionTask, status models.TaskStatus) models.ProjectTask {
+	deps, err := json.Marshal([]string(vt.DependsOn))
+	require.NoError(t, err)
+	code, stage, days, dependsOn, projectStatus := vt.Code, vt.Stage, vt.Duration, string(deps), vt.ProjectStatus
+	return models.ProjectTask{
+		ProjectID: projectID, Code: &code, Name: vt.Name, Stage: &stage, Days: &days, DependsOn: &dependsOn,
+		Order: vt.Order, ProjectStatus: &projectStatus, StatusOrder: vt.StatusOrder,
+		Responsible: vt.ResponsibleRole, NormativeDeadline: time.Now(), Status: string(status),
+	}
+}
+
+func TestTemplateMigrationService_PlanAndMigrate(t *testing.T) {
+	db := setupTestDB(t)
+	templateRepo := repositories.NewProjectTemplateRepository(db)
+	templates := services.NewProjectTemplateService(templateRepo, nil)
+	migration := services.NewTemplateMigrationService(db, templateRepo, repositories.NewProjectRepository(db), nil, events.NewEventBus())
+	require.NoError(t, db.Create(&models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}).Error)
+
+	template := models.ProjectTemplate{Name: "Открытие", Tasks: []models.TemplateTask{
+		{Code: "TASK-A", Name: "Аудит", Duration: 2, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP, Order: 0},
+		{Code: "TASK-B", Name: "Обмер", Duration: 1, DependsOn: pq.StringArray{"TASK-A"}, ResponsibleRole: models.RoleMP, Order: 1},
+		{Code: "TASK-C", Name: "Планировка", Duration: 3, DependsOn: pq.StringArray{"TASK-B"}, ResponsibleRole: models.RoleMP, Order: 2},
+		{Code: "TASK-D", Name: "Фото", Duration: 1, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP, Order: 3},
+	}}
+	require.NoError(t, templates.Create(&template))
+	v1, err := templates.Publish(template.ID, 0, "")
+	require.NoError(t, err)
+
+	// Проект на первой версии: аудит и фото завершены, обмер в работе, планировка ждет обмера
+	project := models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening), TemplateID: &template.ID, TemplateVersionID: &v1.ID}
+	require.NoError(t, db.Create(&project).Error)
+	statuses := map[string]models.TaskStatus{
+		"TASK-A": models.TaskStatusCompleted, "TASK-B": models.TaskStatusInProgress,
+		"TASK-C": models.TaskStatusPending, "TASK-D": models.TaskStatusCompleted,
+	}
+	for _, vt := range v1.Tasks {
+		task := projectTaskFrom(t, project.ID, vt, statuses[vt.Code])
+		require.NoError(t, db.Create(&task).Error)
+	}
+
+	// Вторая версия: обмер дольше, планировка и фото удалены, добавлен бюджет после аудита
+	stored, err := templates.GetByID(template.ID)
+	require.NoError(t, err)
+	for _, task := range stored.Tasks {
+		switch task.Code {
+		case "TASK-B":
+			task.Duration = 4
+			require.NoError(t, templates.UpdateTask(template.ID, task.ID, &task))
+		case "TASK-C", "TASK-D":
+			require.NoError(t, templates.DeleteTask(template.ID, task.ID))
+		}
+	}
+	_, err = templates.AddCustomTask(template.ID, &models.TemplateTask{Code: "TASK-E", Name: "Бюджет", Duration: 2, DependsOn: pq.StringArray{"TASK-A"}, ResponsibleRole: models.RoleMP})
+	require.NoError(t, err)
+	v2, err := templates.Publish(template.ID, 0, "")
+	require.NoError(t, err)
+
+	taskByCode := func(code string) *models.ProjectTask {
+		var task models.ProjectTask
+		err := db.Where("\"ProjectId\" = ? AND \"Code\" = ?", project.ID, code).First(&task).Error
+		if err != nil {
+			return nil
+		}
+		return &task
+	}
+
+	// План ничего не меняет
+	plan, err := migration.PlanMigration(project.ID, 2)
+	require.NoError(t, err)
+	assert.False(t, plan.Applied)
+	assert.Equal(t, []string{"TASK-E"}, plan.Added)
+	assert.Equal(t, []string{"TASK-B"}, plan.Updated)
+	assert.Equal(t, []string{"TASK-C"}, plan.Retired)
+	assert.Equal(t, []string{"TASK-D"}, plan.KeptCompleted)
+	assert.Nil(t, taskByCode("TASK-E"))
+	assert.Equal(t, string(models.TaskStatusPending), taskByCode("TASK-C").Status)
+	assert.Equal(t, 1, *taskByCode("TASK-B").Days)
+
+	// Применение: незавершенная удаленная задача исключается, завершенная остается в истории
+	applied, err := migration.MigrateProject(project.ID, 2, 0)
+	require.NoError(t, err)
+	assert.True(t, applied.Applied)
+	assert.Equal(t, plan.Added, applied.Added)
+	assert.Equal(t, &v1.ID, applied.FromVersionID)
+
+	retired := taskByCode("TASK-C")
+	assert.Equal(t, string(models.TaskStatusRetired), retired.Status)
+	assert.False(t, retired.IsActive)
+	assert.Equal(t, string(models.TaskStatusCompleted), taskByCode("TASK-D").Status)
+	assert.Equal(t, 4, *taskByCode("TASK-B").Days)
+	assert.Equal(t, string(models.TaskStatusInProgress), taskByCode("TASK-B").Status)
+
+	// Новая задача зависит только от завершенного аудита и сразу назначается
+	added := taskByCode("TASK-E")
+	require.NotNil(t, added)
+	assert.Equal(t, string(models.TaskStatusAssigned), added.Status)
+	assert.NotNil(t, added.ResponsibleUserID)
+
+	var reloaded models.Project
+	require.NoError(t, db.First(&reloaded, project.ID).Error)
+	assert.Equal(t, v2.ID, *reloaded.TemplateVersionID)
+
+	// Повторная миграция на ту же версию ничего не меняет
+	again, err := migration.PlanMigration(project.ID, 2)
+	require.NoError(t, err)
+	assert.Empty(t, again.Added)
+	assert.Empty(t, again.Updated)
+	assert.Empty(t, again.Retired)
+
+	// Третья версия возвращает планировку: исключенная задача заводится заново один раз
+	_, err = templates.AddCustomTask(template.ID, &models.TemplateTask{Code: "TASK-C", Name: "Планировка", Duration: 3, DependsOn: pq.StringArray{"TASK-B"}, ResponsibleRole: models.RoleMP})
+	require.NoError(t, err)
+	_, err = templates.Publish(template.ID, 0, "")
+	require.NoError(t, err)
+	readded, err := migration.MigrateProject(project.ID, 3, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TASK-C"}, readded.Added)
+
+	// Исключенная задача, идущая после новой, не делает код снова "добавленным"
+	require.NoError(t, db.Model(retired).Update("Order", 100).Error)
+	again, err = migration.PlanMigration(project.ID, 3)
+	require.NoError(t, err)
+	assert.Empty(t, again.Added)
+	var copies int64
+	require.NoError(t, db.Model(&models.ProjectTask{}).Where("\"ProjectId\" = ? AND \"Code\" = ?", project.ID, "TASK-C").Count(&copies).Error)
+	assert.Equal(t, int64(2), copies)
+
+	_, err = migration.PlanMigration(project.ID, 4)
+	assert.Error(t, err)
+}
+
+func TestTemplateMigrationService_AssignsAddedTasks(t *testing.T) {
+	db := setupFileTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	templateRepo := repositories.NewProjectTemplateRepository(db)
+	templates := services.NewProjectTemplateService(templateRepo, nil)
+	absences := services.NewAbsenceService(repositories.NewAbsenceRepository(db), userRepo)
+	migration := services.NewTemplateMigrationService(db, templateRepo, repositories.NewProjectRepository(db), nil, events.NewEventBus())
+	migration.SetAssignmentService(services.NewAssignmentService(db))
+	migration.SetAbsenceService(absences)
+
+	// Первый по списку МП занят, свободный МП в отпуске — задача уходит его заместителю
+	busy := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	free := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMP, IsActive: true}
+	delegate := models.User{Name: "Сидоров С.С.", Login: "sidorov", Role: models.RoleBA, IsActive: true}
+	for _, u := range []*models.User{&busy, &free, &delegate} {
+		require.NoError(t, db.Create(u).Error)
+	}
+	today := time.Now()
+	require.NoError(t, absences.CreateAbsence(free.ID, &models.UserAbsence{DelegateID: delegate.ID, StartDate: today, EndDate: today.AddDate(0, 0, 7)}))
+
+	template := models.ProjectTemplate{Name: "Открытие", Tasks: []models.TemplateTask{
+		{Code: "TASK-A", Name: "Аудит", Duration: 2, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP, Order: 0},
+	}}
+	require.NoError(t, templateRepo.Create(&template))
+	v1, err := templates.Publish(template.ID, 0, "")
+	require.NoError(t, err)
+
+	project := models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening), TemplateID: &template.ID, TemplateVersionID: &v1.ID}
+	require.NoError(t, db.Create(&project).Error)
+	busyID, codeA := int(busy.ID), "TASK-A"
+	require.NoError(t, db.Create(&models.ProjectTask{ProjectID: project.ID, Code: &codeA, Name: "Аудит", NormativeDeadline: today,
+		Responsible: models.RoleMP, ResponsibleUserID: &busyID, Status: string(models.TaskStatusInProgress)}).Error)
+
+	_, err = templates.AddCustomTask(template.ID, &models.TemplateTask{Code: "TASK-B", Name: "Обмер", Duration: 1, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP})
+	require.NoError(t, err)
+	_, err = templates.Publish(template.ID, 0, "")
+	require.NoError(t, err)
+
+	_, err = migration.MigrateProject(project.ID, 2, busy.ID)
+	require.NoError(t, err)
+
+	var added models.ProjectTask
+	require.NoError(t, db.Where("\"ProjectId\" = ? AND \"Code\" = ?", project.ID, "TASK-B").First(&added).Error)
+	require.NotNil(t, added.ResponsibleUserID)
+	assert.Equal(t, int(delegate.ID), *added.ResponsibleUserID)
+	require.NotNil(t, added.DelegatedFromUserID)
+	assert.Equal(t, int(free.ID), *added.DelegatedFromUserID)
+}
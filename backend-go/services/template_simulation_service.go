@@ -0,0 +1,421 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TemplateSimulationRequest параметры пробного прогона шаблона.
+// Если переданы Tasks, шаблон берется из запроса, иначе — сохраненный TemplateID
+type TemplateSimulationRequest struct {
+	TemplateID  *uint                 `json:"templateId"`
+	Version     int                   `json:"version"` // 0 — та же версия, что выберется при создании проекта
+	Draft       bool                  `json:"draft"`   // Прогнать неопубликованный черновик
+	Tasks       []models.TemplateTask `json:"tasks"`
+	StartDate   time.Time             `json:"-"`
+	Region      string                `json:"region"`
+	ProjectType string                `json:"projectType"`
+}
+
+// SimulatedTask задача, которую создал бы шаблон
+type SimulatedTask struct {
+	Code              string    `json:"code"`
+	Name              string    `json:"name"`
+	Stage             string    `json:"stage"`
+	ResponsibleRole   string    `json:"responsibleRole"`
+	ResponsibleUserID *int      `json:"responsibleUserId"`
+	DependsOn         []string  `json:"dependsOn"`
+	Duration          int       `json:"duration"`
+	StartDate         time.Time `json:"startDate"`
+	Deadline          time.Time `json:"deadline"`
+	InitialStatus     string    `json:"initialStatus"`
+	SlackDays         int       `json:"slackDays"` // Резерв времени: на сколько дней можно сдвинуть без сдвига проекта
+	Critical          bool      `json:"critical"`
+}
+
+// SimulatedStatusChange смена статуса проекта по ходу прогона
+type SimulatedStatusChange struct {
+	Date     time.Time `json:"date"`
+	Status   string    `json:"status"`
+	TaskCode string    `json:"taskCode"` // Задача, событие которой привело к смене
+	Event    string    `json:"event"`    // start | complete
+}
+
+// TemplateSimulationResult результат пробного прогона
+type TemplateSimulationResult struct {
+	TemplateID     *uint                   `json:"templateId"`
+	VersionID      *uint                   `json:"versionId"`
+	StartDate      time.Time               `json:"startDate"`
+	EndDate        time.Time               `json:"endDate"`
+	TotalDays      int                     `json:"totalDays"`
+	Tasks          []SimulatedTask         `json:"tasks"`
+	CriticalPath   []string                `json:"criticalPath"`
+	StatusSequence []SimulatedStatusChange `json:"statusSequence"`
+	Warnings       []string                `json:"warnings"`
+}
+
+// TemplateSimulationService прогоняет генерацию задач по шаблону в откатываемой транзакции, ничего не сохраняя
+type TemplateSimulationService struct {
+	templateRepo    repositories.ProjectTemplateRepository
+	workflowService *WorkflowService
+	statusService   *ProjectStatusService
+}
+
+func NewTemplateSimulationService(
+	templateRepo repositories.ProjectTemplateRepository,
+	workflowService *WorkflowService,
+	statusService *ProjectStatusService,
+) *TemplateSimulationService {
+	return &TemplateSimulationService{
+		templateRepo:    templateRepo,
+		workflowService: workflowService,
+		statusService:   statusService,
+	}
+}
+
+// Simulate строит задачи так же, как GenerateProjectTasksWithTx, рассчитывает критический путь
+// и последовательность статусов проекта при выполнении задач точно в срок
+func (s *TemplateSimulationService) Simulate(req TemplateSimulationRequest) (*TemplateSimulationResult, error) {
+	if req.StartDate.IsZero() {
+		return nil, errors.New("дата старта обязательна")
+	}
+	if req.ProjectType != "" && !models.IsValidProjectType(req.ProjectType) {
+		return nil, errors.New("недопустимый тип проекта")
+	}
+
+	if req.ProjectType == "" {
+		req.ProjectType = string(models.ProjectTypeOpening)
+	}
+
+	project := &models.Project{
+		ProjectType: req.ProjectType,
+		Region:      req.Region,
+		Status:      string(models.ProjectStatusCreated),
+		CreatedAt:   req.StartDate.UTC(),
+		TemplateID:  req.TemplateID,
+	}
+
+	result := &TemplateSimulationResult{
+		TemplateID:     req.TemplateID,
+		StartDate:      project.CreatedAt,
+		Tasks:          []SimulatedTask{},
+		CriticalPath:   []string{},
+		StatusSequence: []SimulatedStatusChange{},
+		Warnings:       []string{},
+	}
+
+	var blueprints []taskBlueprint
+	switch {
+	case len(req.Tasks) > 0:
+		inline := append([]models.TemplateTask{}, req.Tasks...)
+		sort.SliceStable(inline, func(i, j int) bool { return inline[i].Order < inline[j].Order })
+		blueprints = blueprintsFromTemplateTasks(inline)
+	case req.TemplateID == nil:
+		return nil, errors.New("нужно указать шаблон или передать задачи")
+	case req.Draft:
+		template, err := s.templateRepo.FindByID(*req.TemplateID)
+		if err != nil {
+			return nil, errors.New("шаблон не найден")
+		}
+		blueprints = blueprintsFromTemplateTasks(template.Tasks)
+	default:
+		if _, err := s.templateRepo.FindByID(*req.TemplateID); err != nil {
+			return nil, errors.New("шаблон не найден")
+		}
+		if req.Version > 0 {
+			v, err := s.templateRepo.FindVersion(*req.TemplateID, req.Version)
+			if err != nil {
+				return nil, fmt.Errorf("версия %d шаблона не найдена", req.Version)
+			}
+			project.TemplateVersionID = &v.ID
+		}
+		bps, version, err := s.workflowService.loadBlueprints(project)
+		if err != nil {
+			return nil, err
+		}
+		if version != nil {
+			result.VersionID = &version.ID
+		} else {
+			result.Warnings = append(result.Warnings, "у шаблона нет опубликованных версий, использован черновик")
+		}
+		blueprints = bps
+	}
+
+	if len(blueprints) == 0 {
+		return nil, errors.New("в шаблоне нет задач")
+	}
+
+	result.Warnings = append(result.Warnings, s.validateBlueprints(req.ProjectType, blueprints)...)
+
+	tasks, err := s.generate(project, blueprints)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, bp := range blueprints {
+		t := tasks[i]
+		result.Tasks = append(result.Tasks, SimulatedTask{
+			Code:              bp.Code,
+			Name:              bp.Name,
+			Stage:             bp.Stage,
+			ResponsibleRole:   bp.ResponsibleRole,
+			ResponsibleUserID: t.ResponsibleUserID,
+			DependsOn:         append([]string{}, bp.DependsOn...),
+			Duration:          bp.Duration,
+			StartDate:         *t.PlannedStartDate,
+			Deadline:          t.NormativeDeadline,
+			InitialStatus:     t.Status,
+		})
+		if bp.ResponsibleRole != "" && t.ResponsibleUserID == nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("задача %s: нет пользователей с ролью %s, исполнитель не будет назначен", bp.Code, bp.ResponsibleRole))
+		}
+	}
+
+	result.EndDate = result.StartDate
+	for _, t := range result.Tasks {
+		if t.Deadline.After(result.EndDate) {
+			result.EndDate = t.Deadline
+		}
+	}
+	result.TotalDays = daysBetween(result.StartDate, result.EndDate)
+
+	result.CriticalPath = computeCriticalPath(result.Tasks, result.EndDate)
+	result.StatusSequence = s.simulateStatuses(req.ProjectType, tasks)
+
+	return result, nil
+}
+
+// generate повторяет GenerateProjectTasksWithTx в транзакции, которая затем откатывается.
+// Задачи сохраняются по ходу генерации, чтобы стратегии назначения (по очереди, по загрузке)
+// видели уже назначенные задачи проекта, как при его создании. Магазин и проект временные
+func (s *TemplateSimulationService) generate(project *models.Project, blueprints []taskBlueprint) ([]models.ProjectTask, error) {
+	tx := s.workflowService.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+
+	store := models.Store{Code: "SIMULATION", Name: "Пробный прогон шаблона", Region: project.Region}
+	if err := tx.Create(&store).Error; err != nil {
+		return nil, err
+	}
+	project.StoreID = store.ID
+	if err := tx.Create(project).Error; err != nil {
+		return nil, err
+	}
+
+	assignments := s.workflowService.assignments.WithTx(tx)
+	taskMap := make(map[string]*models.ProjectTask, len(blueprints))
+	tasks := make([]models.ProjectTask, 0, len(blueprints))
+	for _, bp := range blueprints {
+		task := s.workflowService.buildProjectTask(project, bp, taskMap)
+		if err := assignments.AssignTask(&task, project); err != nil {
+			return nil, err
+		}
+		routeToDelegate(s.workflowService.absences, &task)
+		if err := tx.Create(&task).Error; err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+		taskCopy := task
+		taskMap[bp.Code] = &taskCopy
+	}
+	return tasks, nil
+}
+
+// validateBlueprints собирает предупреждения, не мешающие генерации, но искажающие результат
+func (s *TemplateSimulationService) validateBlueprints(projectType string, blueprints []taskBlueprint) []string {
+	var warnings []string
+
+	allowed := make(map[string]bool)
+	for _, st := range s.statusService.GetStatusSet(projectType) {
+		allowed[st.Status] = true
+	}
+
+	position := make(map[string]int, len(blueprints))
+	for i, bp := range blueprints {
+		if _, dup := position[bp.Code]; dup {
+			warnings = append(warnings, fmt.Sprintf("код задачи %s встречается несколько раз", bp.Code))
+			continue
+		}
+		position[bp.Code] = i
+	}
+
+	var unmapped []string
+	for i, bp := range blueprints {
+		if bp.Duration <= 0 {
+			warnings = append(warnings, fmt.Sprintf("задача %s: длительность %d дн.", bp.Code, bp.Duration))
+		}
+		if bp.ResponsibleRole == "" {
+			warnings = append(warnings, fmt.Sprintf("задача %s: не указана ответственная роль", bp.Code))
+		}
+		for _, dep := range bp.DependsOn {
+			pos, ok := position[dep]
+			switch {
+			case !ok:
+				warnings = append(warnings, fmt.Sprintf("задача %s зависит от отсутствующей задачи %s — зависимость будет проигнорирована", bp.Code, dep))
+			case pos >= i:
+				warnings = append(warnings, fmt.Sprintf("задача %s стоит раньше своей зависимости %s — при генерации зависимость не учтется", bp.Code, dep))
+			}
+		}
+		switch {
+		case bp.ProjectStatus == "":
+			unmapped = append(unmapped, bp.Code)
+		case !allowed[bp.ProjectStatus]:
+			unmapped = append(unmapped, bp.Code)
+			warnings = append(warnings, fmt.Sprintf("задача %s: статуса \"%s\" нет в наборе статусов типа \"%s\"", bp.Code, bp.ProjectStatus, projectType))
+		}
+	}
+
+	if len(unmapped) == len(blueprints) {
+		warnings = append(warnings, "ни одна задача не влияет на статус проекта")
+	} else if len(unmapped) > 0 {
+		warnings = append(warnings, "задачи не влияют на статус проекта: "+strings.Join(unmapped, ", "))
+	}
+
+	return warnings
+}
+
+// simulateStatuses проходит по событиям начала и завершения задач в хронологическом порядке
+// и фиксирует каждую смену статуса проекта по determineProjectStatus
+func (s *TemplateSimulationService) simulateStatuses(projectType string, tasks []models.ProjectTask) []SimulatedStatusChange {
+	type event struct {
+		at       time.Time
+		index    int
+		complete bool
+	}
+
+	events := make([]event, 0, len(tasks)*2)
+	for i, t := range tasks {
+		events = append(events, event{at: *t.PlannedStartDate, index: i})
+		events = append(events, event{at: t.NormativeDeadline, index: i, complete: true})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+		// В один момент сначала завершения, затем старты следующих задач
+		return events[i].complete && !events[j].complete
+	})
+
+	state := make([]models.ProjectTask, len(tasks))
+	copy(state, tasks)
+
+	current := string(models.ProjectStatusCreated)
+	sequence := []SimulatedStatusChange{}
+	if len(events) > 0 {
+		current = string(s.statusService.determineProjectStatus(projectType, state))
+		sequence = append(sequence, SimulatedStatusChange{Date: events[0].at, Status: current})
+	}
+
+	for _, e := range events {
+		kind := "start"
+		if e.complete {
+			kind = "complete"
+			state[e.index].Status = string(models.TaskStatusCompleted)
+		} else {
+			state[e.index].Status = string(models.TaskStatusInProgress)
+		}
+
+		status := string(s.statusService.determineProjectStatus(projectType, state))
+		if status == current {
+			continue
+		}
+		current = status
+		code := ""
+		if state[e.index].Code != nil {
+			code = *state[e.index].Code
+		}
+		sequence = append(sequence, SimulatedStatusChange{Date: e.at, Status: status, TaskCode: code, Event: kind})
+	}
+
+	return sequence
+}
+
+// computeCriticalPath рассчитывает резерв времени задач и возвращает цепочку,
+// определяющую дату окончания проекта (от первой задачи к последней)
+func computeCriticalPath(tasks []SimulatedTask, projectEnd time.Time) []string {
+	byCode := make(map[string]*SimulatedTask, len(tasks))
+	successors := make(map[string][]string)
+	for i := range tasks {
+		byCode[tasks[i].Code] = &tasks[i]
+	}
+	for _, t := range tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := byCode[dep]; ok {
+				successors[dep] = append(successors[dep], t.Code)
+			}
+		}
+	}
+
+	// Обратный проход: поздний срок окончания = min(поздний старт последователей) - 1 день
+	latestFinish := make(map[string]time.Time, len(tasks))
+	var lateFinish func(code string, guard int) time.Time
+	lateFinish = func(code string, guard int) time.Time {
+		if lf, ok := latestFinish[code]; ok {
+			return lf
+		}
+		lf := projectEnd
+		if guard <= len(tasks) {
+			for _, succ := range successors[code] {
+				st := byCode[succ]
+				latestStart := lateFinish(succ, guard+1).AddDate(0, 0, -st.Duration)
+				if candidate := latestStart.AddDate(0, 0, -1); candidate.Before(lf) {
+					lf = candidate
+				}
+			}
+		}
+		latestFinish[code] = lf
+		return lf
+	}
+
+	for i := range tasks {
+		slack := daysBetween(tasks[i].Deadline, lateFinish(tasks[i].Code, 0))
+		if slack < 0 {
+			slack = 0
+		}
+		tasks[i].SlackDays = slack
+		tasks[i].Critical = slack == 0
+	}
+
+	// Цепочка: от задачи, заканчивающейся последней, назад по определяющей зависимости
+	var last *SimulatedTask
+	for i := range tasks {
+		if last == nil || tasks[i].Deadline.After(last.Deadline) {
+			last = &tasks[i]
+		}
+	}
+
+	var path []string
+	visited := make(map[string]bool)
+	for current := last; current != nil && !visited[current.Code]; {
+		visited[current.Code] = true
+		path = append(path, current.Code)
+
+		var driver *SimulatedTask
+		for _, dep := range current.DependsOn {
+			d := byCode[dep]
+			if d == nil {
+				continue
+			}
+			if driver == nil || d.Deadline.After(driver.Deadline) {
+				driver = d
+			}
+		}
+		current = driver
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Round(time.Hour).Hours() / 24)
+}
@@ -0,0 +1,70 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateSimulationService_Simulate(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	projectRepo := repositories.NewProjectRepository(db)
+	templateRepo := repositories.NewProjectTemplateRepository(db)
+	workflow := services.NewWorkflowService(userRepo, projectRepo, nil, db)
+	statusService := services.NewProjectStatusService(projectRepo, nil, nil, repositories.NewProjectStatusRepository(db))
+	service := services.NewTemplateSimulationService(templateRepo, workflow, statusService)
+
+	require.NoError(t, db.Create(&models.User{Name: "МП", Login: "mp", Role: models.RoleMP}).Error)
+	require.NoError(t, db.Create(&models.User{Name: "МП 2", Login: "mp2", Role: models.RoleMP}).Error)
+
+	start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	result, err := service.Simulate(services.TemplateSimulationRequest{
+		StartDate: start,
+		Tasks: []models.TemplateTask{
+			{Code: "TASK-PREP-AUDIT", Name: "Подготовка", Duration: 2, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP, Order: 0, ProjectStatus: string(models.ProjectStatusPrepAudit), StatusOrder: 1},
+			{Code: "TASK-AUDIT", Name: "Аудит", Duration: 1, DependsOn: pq.StringArray{"TASK-PREP-AUDIT"}, ResponsibleRole: models.RoleMP, Order: 1, ProjectStatus: string(models.ProjectStatusAuditObject), StatusOrder: 2},
+			{Code: "TASK-WASTE", Name: "ТБО", Duration: 5, DependsOn: pq.StringArray{"TASK-AUDIT"}, ResponsibleRole: models.RoleMP, Order: 2, ProjectStatus: string(models.ProjectStatusWaste), StatusOrder: 4},
+			{Code: "TASK-CONTOUR", Name: "Контур", Duration: 1, DependsOn: pq.StringArray{"TASK-AUDIT", "TASK-MISSING"}, ResponsibleRole: models.RoleMRiZ, Order: 3, ProjectStatus: string(models.ProjectStatusContour), StatusOrder: 5},
+		},
+	})
+	require.NoError(t, err)
+
+	// Ничего не сохранено
+	for _, table := range []interface{}{&models.ProjectTask{}, &models.Project{}, &models.Store{}} {
+		var count int64
+		require.NoError(t, db.Model(table).Count(&count).Error)
+		assert.Zero(t, count)
+	}
+
+	require.Len(t, result.Tasks, 4)
+	assert.Equal(t, start, result.Tasks[0].StartDate)
+	assert.Equal(t, start.AddDate(0, 0, 3), result.Tasks[1].StartDate)
+	// Назначение видит уже назначенные задачи прогона: задачи одной роли распределяются по загрузке
+	require.NotNil(t, result.Tasks[0].ResponsibleUserID)
+	require.NotNil(t, result.Tasks[1].ResponsibleUserID)
+	assert.NotEqual(t, *result.Tasks[0].ResponsibleUserID, *result.Tasks[1].ResponsibleUserID)
+
+	// Самая длинная ветка идет через ТБО, у контура есть резерв
+	assert.Equal(t, []string{"TASK-PREP-AUDIT", "TASK-AUDIT", "TASK-WASTE"}, result.CriticalPath)
+	assert.False(t, result.Tasks[3].Critical)
+	assert.Equal(t, 4, result.Tasks[3].SlackDays)
+
+	var statuses []string
+	for _, change := range result.StatusSequence {
+		statuses = append(statuses, change.Status)
+	}
+	assert.Equal(t, string(models.ProjectStatusCreated), statuses[0])
+	assert.Contains(t, statuses, string(models.ProjectStatusAuditObject))
+	assert.Equal(t, string(models.ProjectStatusOpened), statuses[len(statuses)-1])
+
+	assert.Contains(t, result.Warnings, "задача TASK-CONTOUR зависит от отсутствующей задачи TASK-MISSING — зависимость будет проигнорирована")
+	assert.Contains(t, result.Warnings, "задача TASK-CONTOUR: нет пользователей с ролью МРиЗ, исполнитель не будет назначен")
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"portal-razvitie/antivirus"
+	"portal-razvitie/models"
+)
+
+// Ошибки политики загрузки файлов
+var (
+	ErrUploadTooLarge        = errors.New("файл превышает допустимый размер")
+	ErrUploadForbidden       = errors.New("исполняемые файлы и скрипты загружать нельзя")
+	ErrUploadContentMismatch = errors.New("содержимое файла не соответствует расширению")
+	ErrUploadInfected        = errors.New("в файле обнаружен вирус")
+	ErrUploadScanFailed      = errors.New("не удалось проверить файл антивирусом")
+	ErrUploadTooLargeToScan  = errors.New("файл больше лимита антивирусной проверки")
+)
+
+// Типы содержимого, которые определяются по сигнатуре в дополнение к http.DetectContentType
+const (
+	contentTypeOLE        = "application/x-ole-storage" // .doc, .xls, .ppt до Office 2007
+	contentTypeDOCX       = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	contentTypeXLSX       = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	contentTypePPTX       = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	contentTypeZIP        = "application/zip"
+	contentTypeDWG        = "image/vnd.dwg"
+	contentTypeExecutable = "application/x-executable"
+	contentTypeScript     = "text/x-shellscript"
+)
+
+// sniffLen сколько байт начала файла читается для определения типа
+const sniffLen = 512
+
+// signatures сигнатуры форматов, которых нет в http.DetectContentType
+var signatures = []struct {
+	prefix      string
+	contentType string
+}{
+	{"MZ", contentTypeExecutable},               // Windows PE
+	{"\x7fELF", contentTypeExecutable},          // Linux
+	{"\xfe\xed\xfa\xce", contentTypeExecutable}, // Mach-O
+	{"\xfe\xed\xfa\xcf", contentTypeExecutable}, // Mach-O 64
+	{"\xce\xfa\xed\xfe", contentTypeExecutable}, // Mach-O, little-endian
+	{"\xcf\xfa\xed\xfe", contentTypeExecutable}, // Mach-O 64, little-endian
+	{"#!", contentTypeScript},                   // Скрипт с интерпретатором
+	{"\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", contentTypeOLE},
+	{"AC10", contentTypeDWG},
+	{"II*\x00", "image/tiff"},
+	{"MM\x00*", "image/tiff"},
+	{"7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+}
+
+// blockedContentTypes не принимаются ни под каким расширением
+var blockedContentTypes = []string{contentTypeExecutable, contentTypeScript}
+
+// blockedExtensions исполняемые файлы и скрипты, которые не принимаются даже без сигнатуры
+var blockedExtensions = []string{
+	".exe", ".dll", ".com", ".scr", ".msi", ".bat", ".cmd", ".ps1", ".vbs", ".vbe", ".js", ".jse", ".wsf", ".hta", ".jar", ".sh", ".lnk",
+}
+
+// extensionContentTypes какие типы содержимого допустимы для расширения.
+// Файлы с расширениями не из списка проверяются только по справочнику типов документов
+var extensionContentTypes = map[string][]string{
+	".pdf":  {"application/pdf"},
+	".doc":  {contentTypeOLE},
+	".xls":  {contentTypeOLE},
+	".ppt":  {contentTypeOLE},
+	".docx": {contentTypeDOCX},
+	".xlsx": {contentTypeXLSX},
+	".pptx": {contentTypePPTX},
+	".dwg":  {contentTypeDWG},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".gif":  {"image/gif"},
+	".bmp":  {"image/bmp"},
+	".webp": {"image/webp"},
+	".tif":  {"image/tiff"},
+	".tiff": {"image/tiff"},
+	".zip":  {contentTypeZIP, contentTypeDOCX, contentTypeXLSX, contentTypePPTX},
+	".rar":  {"application/x-rar-compressed"},
+	".7z":   {"application/x-7z-compressed"},
+	".txt":  {"text/plain"},
+	".csv":  {"text/plain"},
+}
+
+// UploadPolicy проверяет загружаемый файл: общий и заданный типом документа лимит размера,
+// тип содержимого по сигнатуре (а не по заголовку клиента) и, если настроен, антивирус
+type UploadPolicy struct {
+	docTypes *DocumentTypeService
+	maxSize  int64
+	scanner  antivirus.Scanner
+	// Лимит размера потока антивируса (StreamMaxLength в clamd.conf); 0 — без проверки до отправки
+	scanLimit int64
+}
+
+// NewUploadPolicy создает политику; maxSize 0 — без общего лимита, scanner nil — без антивируса
+func NewUploadPolicy(docTypes *DocumentTypeService, maxSize int64, scanner antivirus.Scanner) *UploadPolicy {
+	return &UploadPolicy{docTypes: docTypes, maxSize: maxSize, scanner: scanner}
+}
+
+// SetScanLimit задает лимит антивируса: файлы больше него отклоняются до загрузки,
+// а не после передачи. Лимит не должен превышать StreamMaxLength в clamd.conf
+func (p *UploadPolicy) SetScanLimit(limit int64) {
+	p.scanLimit = limit
+}
+
+// MaxSize общий лимит размера файла в байтах
+func (p *UploadPolicy) MaxSize() int64 {
+	return p.maxSize
+}
+
+// Check проверяет файл перед сохранением. Заявленный клиентом ContentType в upload заменяется
+// определенным по содержимому. docType nil — документ без типа (старые документы).
+// После проверки content перемотан в начало
+func (p *UploadPolicy) Check(ctx context.Context, docType *models.DocumentType, upload *DocumentUpload, content io.ReadSeeker) error {
+	if err := p.CheckDeclared(docType, upload.Name, upload.Size); err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(upload.Name))
+	detected, err := DetectContentType(content, upload.Size)
+	if err != nil {
+		return err
+	}
+	mediaType := baseContentType(detected)
+	if containsString(blockedContentTypes, mediaType) {
+		return fmt.Errorf("%w: %s", ErrUploadForbidden, upload.Name)
+	}
+	if expected, ok := extensionContentTypes[ext]; ok && !containsString(expected, mediaType) {
+		return fmt.Errorf("%w: %s определен как %s", ErrUploadContentMismatch, upload.Name, mediaType)
+	}
+
+	if docType != nil {
+		if err := p.docTypes.ValidateFile(docType, upload.Name, detected, upload.Size); err != nil {
+			return err
+		}
+	}
+
+	if err := p.scan(ctx, content); err != nil {
+		return err
+	}
+	upload.ContentType = detected
+	return nil
+}
+
+// CheckDeclared проверяет то, что известно до получения файла: имя и размер.
+// Докачиваемая загрузка отклоняется сразу, а не после передачи сотен мегабайт
+func (p *UploadPolicy) CheckDeclared(docType *models.DocumentType, name string, size int64) error {
+	if p.maxSize > 0 && size > p.maxSize {
+		return fmt.Errorf("%w: не больше %d МБ", ErrUploadTooLarge, p.maxSize>>20)
+	}
+	if p.scanner != nil && p.scanLimit > 0 && size > p.scanLimit {
+		return fmt.Errorf("%w: не больше %d МБ", ErrUploadTooLargeToScan, p.scanLimit>>20)
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if containsString(blockedExtensions, ext) {
+		return fmt.Errorf("%w: %s", ErrUploadForbidden, ext)
+	}
+	if docType != nil {
+		return p.docTypes.ValidateFile(docType, name, "", size)
+	}
+	return nil
+}
+
+func (p *UploadPolicy) scan(ctx context.Context, content io.ReadSeeker) error {
+	if p.scanner == nil {
+		return nil
+	}
+	result, err := p.scanner.Scan(ctx, content)
+	if _, seekErr := content.Seek(0, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	if errors.Is(err, antivirus.ErrTooLarge) {
+		return fmt.Errorf("%w: %v", ErrUploadTooLargeToScan, err)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUploadScanFailed, err)
+	}
+	if result.Infected {
+		return fmt.Errorf("%w: %s", ErrUploadInfected, result.Signature)
+	}
+	return nil
+}
+
+// DetectContentType определяет тип содержимого по сигнатуре в начале файла. Архивы ZIP
+// уточняются до форматов Office Open XML, если content позволяет читать произвольные смещения.
+// content перематывается в начало
+func DetectContentType(content io.ReadSeeker, size int64) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	head = head[:n]
+
+	for _, sig := range signatures {
+		if bytes.HasPrefix(head, []byte(sig.prefix)) {
+			return sig.contentType, nil
+		}
+	}
+	detected := http.DetectContentType(head)
+	if detected == contentTypeZIP {
+		if reader, ok := content.(io.ReaderAt); ok {
+			return officeContentType(reader, size), nil
+		}
+	}
+	return detected, nil
+}
+
+// officeContentType отличает документы Office Open XML от обычных ZIP-архивов по их каталогам
+func officeContentType(content io.ReaderAt, size int64) string {
+	archive, err := zip.NewReader(content, size)
+	if err != nil {
+		return contentTypeZIP
+	}
+	hasContentTypes := false
+	for _, f := range archive.File {
+		if f.Name == "[Content_Types].xml" {
+			hasContentTypes = true
+		}
+	}
+	if !hasContentTypes {
+		return contentTypeZIP
+	}
+	for _, f := range archive.File {
+		switch {
+		case strings.HasPrefix(f.Name, "word/"):
+			return contentTypeDOCX
+		case strings.HasPrefix(f.Name, "xl/"):
+			return contentTypeXLSX
+		case strings.HasPrefix(f.Name, "ppt/"):
+			return contentTypePPTX
+		}
+	}
+	return contentTypeZIP
+}
+
+// baseContentType тип содержимого без параметров: "text/plain; charset=utf-8" → "text/plain"
+func baseContentType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
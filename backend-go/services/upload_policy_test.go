@@ -0,0 +1,112 @@
+package services_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"portal-razvitie/antivirus"
+	"portal-razvitie/antivirus/clamdtest"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func officeFile(t *testing.T, part string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"[Content_Types].xml", part} {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte("<xml/>"))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestUploadPolicy_ContentInspection(t *testing.T) {
+	db := setupTestDB(t)
+	policy := services.NewUploadPolicy(services.NewDocumentTypeService(db), 1<<20, nil)
+	ctx := context.Background()
+
+	check := func(docType *models.DocumentType, name string, data []byte) (services.DocumentUpload, error) {
+		upload := services.DocumentUpload{Name: name, ContentType: "application/octet-stream", Size: int64(len(data))}
+		err := policy.Check(ctx, docType, &upload, bytes.NewReader(data))
+		return upload, err
+	}
+
+	// Тип содержимого берется из сигнатуры, а не от клиента
+	upload, err := check(nil, "Договор.pdf", []byte("%PDF-1.7\n..."))
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", upload.ContentType)
+
+	upload, err = check(nil, "Смета.xlsx", officeFile(t, "xl/workbook.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", upload.ContentType)
+
+	// Переименованные файлы и исполняемые файлы отклоняются
+	_, err = check(nil, "Смета.xlsx", officeFile(t, "word/document.xml"))
+	assert.ErrorIs(t, err, services.ErrUploadContentMismatch)
+	_, err = check(nil, "photo.pdf", []byte("\x89PNG\r\n\x1a\n0000"))
+	assert.ErrorIs(t, err, services.ErrUploadContentMismatch)
+	_, err = check(nil, "Акт.pdf", append([]byte("MZ\x90\x00"), make([]byte, 64)...))
+	assert.ErrorIs(t, err, services.ErrUploadForbidden)
+	_, err = check(nil, "Акт.data", []byte("\x7fELF\x02\x01"))
+	assert.ErrorIs(t, err, services.ErrUploadForbidden)
+	_, err = check(nil, "setup.exe", []byte("hello"))
+	assert.ErrorIs(t, err, services.ErrUploadForbidden)
+
+	// Общий лимит и лимит типа документа
+	_, err = check(nil, "big.txt", bytes.Repeat([]byte("a"), 1<<20+1))
+	assert.ErrorIs(t, err, services.ErrUploadTooLarge)
+	scan := &models.DocumentType{Code: "scan", Name: "Скан", MimeTypes: pq.StringArray{"application/pdf"}, MaxSize: 100}
+	_, err = check(scan, "scan.docx", officeFile(t, "word/document.xml"))
+	assert.ErrorIs(t, err, services.ErrDocumentFileRejected)
+	_, err = check(scan, "scan.pdf", append([]byte("%PDF-1.4\n"), make([]byte, 200)...))
+	assert.ErrorIs(t, err, services.ErrDocumentFileRejected)
+	_, err = check(scan, "scan.pdf", []byte("%PDF-1.4\n"))
+	assert.NoError(t, err)
+}
+
+func TestUploadPolicy_Antivirus(t *testing.T) {
+	db := setupTestDB(t)
+	daemon := clamdtest.NewServer()
+	defer daemon.Close()
+	clamd := antivirus.NewClamd(daemon.Addr, 5*time.Second)
+	require.NoError(t, clamd.Ping(context.Background()))
+	policy := services.NewUploadPolicy(services.NewDocumentTypeService(db), 0, clamd)
+
+	check := func(data []byte) error {
+		upload := services.DocumentUpload{Name: "notes.txt", Size: int64(len(data))}
+		content := bytes.NewReader(data)
+		err := policy.Check(context.Background(), nil, &upload, content)
+		// После проверки файл читается с начала
+		rest, _ := io.ReadAll(content)
+		assert.Equal(t, data, rest)
+		return err
+	}
+
+	// Поток больше одного блока INSTREAM
+	assert.NoError(t, check(bytes.Repeat([]byte("чистый текст "), 10000)))
+	err := check([]byte("начало " + clamdtest.EICAR + " конец"))
+	assert.ErrorIs(t, err, services.ErrUploadInfected)
+	assert.Contains(t, err.Error(), "Eicar-Test-Signature")
+	assert.Equal(t, 2, daemon.Scanned())
+
+	// Превышение StreamMaxLength — отдельная ошибка, а не недоступный антивирус
+	daemon.SetStreamMaxLength(1000)
+	assert.ErrorIs(t, check(bytes.Repeat([]byte("a"), 5000)), services.ErrUploadTooLargeToScan)
+	// С заданным лимитом такой файл отклоняется до передачи демону
+	policy.SetScanLimit(1000)
+	assert.ErrorIs(t, policy.CheckDeclared(nil, "big.txt", 5000), services.ErrUploadTooLargeToScan)
+
+	// Недоступный демон не пропускает файл
+	daemon.Close()
+	assert.ErrorIs(t, check([]byte("text")), services.ErrUploadScanFailed)
+}
@@ -0,0 +1,517 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"portal-razvitie/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Ошибки докачиваемой загрузки
+var (
+	ErrUploadSessionNotFound = errors.New("сеанс загрузки не найден или истек")
+	ErrUploadSessionInvalid  = errors.New("имя файла и размер обязательны, SHA-256 — 64 шестнадцатеричных символа")
+	ErrUploadOffsetMismatch  = errors.New("смещение части не совпадает с принятым размером файла")
+	ErrUploadChunkOverflow   = errors.New("часть выходит за объявленный размер файла")
+	ErrUploadChecksum        = errors.New("контрольная сумма не совпадает")
+	ErrUploadIncomplete      = errors.New("файл загружен не полностью")
+	ErrUploadCompleting      = errors.New("файл уже собирается в документ, повторите запрос позже")
+)
+
+// Параметры сеансов по умолчанию
+const (
+	DefaultUploadChunkSize  = 8 << 20
+	DefaultUploadSessionTTL = 24 * time.Hour
+)
+
+// UploadSessionInput параметры нового сеанса. DocumentID — загрузка новой версии документа,
+// иначе создается документ проекта (и задачи) с типом Type
+type UploadSessionInput struct {
+	ProjectID  uint   `json:"projectId"`
+	TaskID     *int   `json:"taskId"`
+	DocumentID *uint  `json:"documentId"`
+	Type       string `json:"type"`
+	FileName   string `json:"fileName"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	Comment    string `json:"comment"`
+}
+
+// UploadSessionService принимает большие файлы частями: сеанс создается с объявленными именем
+// и размером, части пишутся по смещению в файл каталога сеансов, после последней части файл
+// сверяется с SHA-256, проверяется политикой загрузки и сохраняется как документ.
+// Каталог сеансов должен быть общим для всех реплик
+type UploadSessionService struct {
+	db        *gorm.DB
+	docs      *DocumentService
+	docTypes  *DocumentTypeService
+	policy    *UploadPolicy
+	dir       string
+	chunkSize int64
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+func NewUploadSessionService(db *gorm.DB, docs *DocumentService, docTypes *DocumentTypeService, policy *UploadPolicy, dir string) *UploadSessionService {
+	return &UploadSessionService{
+		db:        db,
+		docs:      docs,
+		docTypes:  docTypes,
+		policy:    policy,
+		dir:       dir,
+		chunkSize: DefaultUploadChunkSize,
+		ttl:       DefaultUploadSessionTTL,
+		locks:     make(map[string]*sessionLock),
+	}
+}
+
+// Create открывает сеанс. Имя и размер проверяются политикой загрузки сразу
+func (s *UploadSessionService) Create(user *models.User, input UploadSessionInput) (*models.UploadSession, error) {
+	input.FileName = filepath.Base(strings.TrimSpace(input.FileName))
+	input.SHA256 = strings.ToLower(strings.TrimSpace(input.SHA256))
+	if input.FileName == "" || input.FileName == "." || input.Size <= 0 || !validSHA256(input.SHA256) {
+		return nil, ErrUploadSessionInvalid
+	}
+
+	session := &models.UploadSession{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		ProjectID: input.ProjectID,
+		TaskID:    input.TaskID,
+		FileName:  input.FileName,
+		Size:      input.Size,
+		SHA256:    input.SHA256,
+		Comment:   input.Comment,
+		Status:    models.UploadSessionActive,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+
+	docType, err := s.sessionDocumentType(session, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.CheckDeclared(docType, session.FileName, session.Size); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(s.path(session.ID))
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	if err := s.db.Create(session).Error; err != nil {
+		os.Remove(s.path(session.ID))
+		return nil, err
+	}
+	session.ChunkSize = s.chunkSize
+	return session, nil
+}
+
+// sessionDocumentType заполняет документ и тип сеанса: для новой версии — из документа,
+// для нового документа — из справочника
+func (s *UploadSessionService) sessionDocumentType(session *models.UploadSession, input UploadSessionInput) (*models.DocumentType, error) {
+	if input.DocumentID == nil {
+		docType, err := s.docTypes.Resolve(input.Type)
+		if err != nil {
+			return nil, err
+		}
+		session.TypeCode = docType.Code
+		return docType, nil
+	}
+
+	doc, err := s.docs.GetByID(int(*input.DocumentID))
+	if err != nil {
+		return nil, err
+	}
+	session.DocumentID = &doc.ID
+	session.ProjectID = doc.ProjectID
+	session.TaskID = doc.TaskID
+	session.TypeCode = doc.TypeCode
+	return s.documentType(doc.TypeCode)
+}
+
+// Get возвращает сеанс пользователя: по offset клиент продолжает прерванную загрузку
+func (s *UploadSessionService) Get(userID uint, id string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := s.db.Where("\"Id\" = ? AND \"UserId\" = ? AND \"ExpiresAt\" > ?", id, userID, time.Now()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUploadSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.ChunkSize = s.chunkSize
+	return &session, nil
+}
+
+// WriteChunk дописывает часть с позиции offset, которая должна совпадать с уже принятым размером.
+// digest — SHA-256 части от клиента (nil — не сверяется); при несовпадении часть отбрасывается.
+// Часть сначала принимается во временный файл, затем смещение занимается условным обновлением
+// сеанса: из двух запросов с одним смещением (в том числе на разных репликах) часть пишет только
+// один, второй получает ErrUploadOffsetMismatch
+func (s *UploadSessionService) WriteChunk(userID uint, id string, offset int64, chunk io.Reader, digest []byte) (*models.UploadSession, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != models.UploadSessionActive {
+		return nil, ErrUploadSessionNotFound
+	}
+	if offset != session.Received {
+		return session, ErrUploadOffsetMismatch
+	}
+
+	part, err := os.CreateTemp(s.dir, filepath.Base(id)+".part-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(part.Name())
+	defer part.Close()
+
+	// Читаем на байт больше остатка, чтобы заметить лишние данные.
+	// Обрыв соединения: принятое до обрыва не засчитывается, клиент повторит часть целиком
+	hash := sha256.New()
+	remaining := session.Size - session.Received
+	written, err := io.Copy(io.MultiWriter(part, hash), io.LimitReader(chunk, remaining+1))
+	switch {
+	case err != nil:
+		return nil, err
+	case written > remaining:
+		return session, ErrUploadChunkOverflow
+	case digest != nil && !bytes.Equal(hash.Sum(nil), digest):
+		return session, ErrUploadChecksum
+	}
+
+	received, expires := offset+written, time.Now().Add(s.ttl)
+	result := s.db.Model(&models.UploadSession{}).
+		Where("\"Id\" = ? AND \"Status\" = ? AND \"Received\" = ?", id, models.UploadSessionActive, offset).
+		Updates(map[string]interface{}{"Received": received, "ExpiresAt": expires})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Смещение заняла другая реплика: клиент продолжит с принятого ею размера
+		if current, err := s.Get(userID, id); err == nil {
+			session = current
+		}
+		return session, ErrUploadOffsetMismatch
+	}
+
+	if err := s.appendPart(id, offset, part); err != nil {
+		// Возвращаем смещение, чтобы клиент повторил часть
+		if rollback := s.db.Model(&models.UploadSession{}).
+			Where("\"Id\" = ? AND \"Received\" = ?", id, received).
+			Update("Received", offset).Error; rollback != nil {
+			log.Printf("⚠️ Upload session %s: offset %d not rolled back: %v", id, offset, rollback)
+		}
+		return nil, err
+	}
+
+	session.Received, session.ExpiresAt = received, expires
+	return session, nil
+}
+
+// appendPart переносит принятую часть в файл сеанса с позиции offset
+func (s *UploadSessionService) appendPart(id string, offset int64, part *os.File) error {
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path(id), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, part); err != nil {
+		file.Truncate(offset)
+		return err
+	}
+	return nil
+}
+
+// Complete собирает документ из принятого файла. Повторный вызов после успеха возвращает тот же документ,
+// поэтому клиент может повторить запрос, если ответ потерялся.
+// Сборку занимает условное обновление статуса: из двух запросов (в том числе на разных репликах)
+// документ создает только один, второй возвращает его документ или ErrUploadCompleting, пока сборка идет
+func (s *UploadSessionService) Complete(ctx context.Context, user *models.User, id string) (*models.ProjectDocument, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.Get(user.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != models.UploadSessionActive {
+		return s.completed(session)
+	}
+	if session.Received != session.Size {
+		return nil, fmt.Errorf("%w: принято %d из %d байт", ErrUploadIncomplete, session.Received, session.Size)
+	}
+
+	claim := s.db.Model(&models.UploadSession{}).
+		Where("\"Id\" = ? AND \"Status\" = ?", id, models.UploadSessionActive).
+		Update("Status", models.UploadSessionCompleting)
+	if claim.Error != nil {
+		return nil, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		// Сборку заняла другая реплика
+		if session, err = s.Get(user.ID, id); err != nil {
+			return nil, err
+		}
+		return s.completed(session)
+	}
+	done := false
+	defer func() {
+		if !done {
+			s.release(id)
+		}
+	}()
+
+	file, err := os.Open(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Файл, который не прошел сверку или проверку, не докачать: сеанс закрывается
+	if session.SHA256 != "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != session.SHA256 {
+			s.remove(session.ID)
+			return nil, ErrUploadChecksum
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	docType, err := s.documentType(session.TypeCode)
+	if err != nil {
+		return nil, err
+	}
+	upload := DocumentUpload{Name: session.FileName, Size: session.Size, Comment: session.Comment, UploadedBy: user}
+	if err := s.policy.Check(ctx, docType, &upload, file); err != nil {
+		if !errors.Is(err, ErrUploadScanFailed) {
+			s.remove(session.ID)
+		}
+		return nil, err
+	}
+
+	var doc *models.ProjectDocument
+	if session.DocumentID != nil {
+		if doc, err = s.docs.GetByID(int(*session.DocumentID)); err != nil {
+			return nil, err
+		}
+		if _, err := s.docs.AddRevision(ctx, doc, upload, file); err != nil {
+			return nil, err
+		}
+	} else {
+		doc = &models.ProjectDocument{ProjectID: session.ProjectID, TaskID: session.TaskID, TypeCode: session.TypeCode, Status: "Доступен"}
+		if docType != nil {
+			doc.Type = docType.Name
+		}
+		if err := s.docs.Upload(ctx, doc, upload, file); err != nil {
+			return nil, err
+		}
+	}
+
+	// Запись сеанса остается до истечения срока, чтобы повторный Complete вернул документ
+	if err := s.db.Model(session).Updates(map[string]interface{}{
+		"Status":     models.UploadSessionCompleted,
+		"DocumentId": doc.ID,
+		"ExpiresAt":  time.Now().Add(s.ttl),
+	}).Error; err != nil {
+		log.Printf("⚠️ Upload session %s completed, but not marked: %v", id, err)
+	}
+	done = true
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("⚠️ Upload session %s: temporary file not removed: %v", id, err)
+	}
+	return doc, nil
+}
+
+// completed возвращает документ завершенного сеанса; сеанс, который еще собирается, — ErrUploadCompleting
+func (s *UploadSessionService) completed(session *models.UploadSession) (*models.ProjectDocument, error) {
+	if session.Status == models.UploadSessionCompleted && session.DocumentID != nil {
+		return s.docs.GetByID(int(*session.DocumentID))
+	}
+	return nil, ErrUploadCompleting
+}
+
+// release возвращает сеанс к загрузке после неудачной сборки, чтобы клиент мог повторить Complete
+func (s *UploadSessionService) release(id string) {
+	if err := s.db.Model(&models.UploadSession{}).
+		Where("\"Id\" = ? AND \"Status\" = ?", id, models.UploadSessionCompleting).
+		Update("Status", models.UploadSessionActive).Error; err != nil {
+		log.Printf("⚠️ Upload session %s: completion claim not released: %v", id, err)
+	}
+}
+
+// Abort отменяет сеанс и удаляет принятые части
+func (s *UploadSessionService) Abort(userID uint, id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	if _, err := s.Get(userID, id); err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+// CleanupExpired удаляет истекшие сеансы вместе с их файлами, а также файлы без сеанса.
+// Сеанс удаляется под блокировкой и только если он все еще истек: часть, принятая
+// в это время, продлевает сеанс
+func (s *UploadSessionService) CleanupExpired() (int, error) {
+	var expired []string
+	if err := s.db.Model(&models.UploadSession{}).Where("\"ExpiresAt\" <= ?", time.Now()).Pluck("Id", &expired).Error; err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, id := range expired {
+		ok, err := s.removeExpired(id)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed++
+		}
+	}
+
+	// Файлы, для которых записи уже нет (например, после сбоя при создании сеанса)
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return removed, err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < s.ttl {
+			continue
+		}
+		var count int64
+		sessionID, _, _ := strings.Cut(entry.Name(), ".")
+		if err := s.db.Model(&models.UploadSession{}).Where("\"Id\" = ?", sessionID).Count(&count).Error; err == nil && count == 0 {
+			os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	return removed, nil
+}
+
+// removeExpired удаляет сеанс, если он истек; false — сеанс продлен или уже удален
+func (s *UploadSessionService) removeExpired(id string) (bool, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	result := s.db.Where("\"Id\" = ? AND \"ExpiresAt\" <= ?", id, time.Now()).Delete(&models.UploadSession{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return true, err
+	}
+	return true, nil
+}
+
+// StartCleanup запускает фоновую очистку истекших сеансов
+func (s *UploadSessionService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if removed, err := s.CleanupExpired(); err != nil {
+				log.Printf("⚠️ Upload sessions cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("🧹 Removed %d expired upload sessions", removed)
+			}
+		}
+	}()
+}
+
+// remove удаляет сеанс и его файл
+func (s *UploadSessionService) remove(id string) error {
+	if err := s.db.Where("\"Id\" = ?", id).Delete(&models.UploadSession{}).Error; err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// lock сериализует запросы одного сеанса: части должны писаться строго по порядку
+func (s *UploadSessionService) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sessionLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *UploadSessionService) documentType(code string) (*models.DocumentType, error) {
+	if code == "" {
+		return nil, nil
+	}
+	docType, err := s.docTypes.GetByCode(code)
+	if errors.Is(err, ErrUnknownDocumentType) {
+		return nil, nil
+	}
+	return docType, err
+}
+
+// path файл сеанса; id — UUID, сформированный сервером
+func (s *UploadSessionService) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id))
+}
+
+func validSHA256(value string) bool {
+	if value == "" {
+		return true
+	}
+	decoded, err := hex.DecodeString(value)
+	return err == nil && len(decoded) == sha256.Size
+}
@@ -0,0 +1,189 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"portal-razvitie/database"
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+	"portal-razvitie/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadSessionService_ResumableUpload(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, database.SeedDocumentTypes(db))
+	files, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	docs := services.NewDocumentService(db, files)
+	docTypes := services.NewDocumentTypeService(db)
+	sessionDir := t.TempDir()
+	service := services.NewUploadSessionService(db, docs, docTypes, services.NewUploadPolicy(docTypes, 1<<20, nil), sessionDir)
+	ctx := context.Background()
+
+	user := &models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	content := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("планировка "), 2000)...)
+	sum := sha256.Sum256(content)
+
+	// Имя и размер проверяются до передачи файла
+	_, err = service.Create(user, services.UploadSessionInput{ProjectID: 1, Type: "technical-plan", FileName: "plan.exe", Size: 10})
+	assert.ErrorIs(t, err, services.ErrUploadForbidden)
+	_, err = service.Create(user, services.UploadSessionInput{ProjectID: 1, Type: "technical-plan", FileName: "plan.pdf", Size: 2 << 20})
+	assert.ErrorIs(t, err, services.ErrUploadTooLarge)
+	_, err = service.Create(user, services.UploadSessionInput{ProjectID: 1, Type: "Тех план", FileName: "plan.pdf", Size: 10})
+	assert.ErrorIs(t, err, services.ErrUnknownDocumentType)
+
+	session, err := service.Create(user, services.UploadSessionInput{
+		ProjectID: 1, Type: "Технический план", FileName: "plan.pdf", Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:]),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "technical-plan", session.TypeCode)
+	_, err = service.Get(user.ID+1, session.ID)
+	assert.ErrorIs(t, err, services.ErrUploadSessionNotFound)
+
+	// Первая часть, повтор не с того места и часть с неверной суммой не меняют принятый размер
+	first := content[:8000]
+	session, err = service.WriteChunk(user.ID, session.ID, 0, bytes.NewReader(first), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8000), session.Received)
+	session, err = service.WriteChunk(user.ID, session.ID, 0, bytes.NewReader(first), nil)
+	assert.ErrorIs(t, err, services.ErrUploadOffsetMismatch)
+	assert.Equal(t, int64(8000), session.Received)
+	wrong := sha256.Sum256([]byte("другое"))
+	_, err = service.WriteChunk(user.ID, session.ID, 8000, bytes.NewReader(content[8000:16000]), wrong[:])
+	assert.ErrorIs(t, err, services.ErrUploadChecksum)
+	_, err = service.Complete(ctx, user, session.ID)
+	assert.ErrorIs(t, err, services.ErrUploadIncomplete)
+
+	// Продолжение после обрыва: смещение берется из сеанса
+	session, err = service.Get(user.ID, session.ID)
+	require.NoError(t, err)
+	rest := content[session.Received:]
+	_, err = service.WriteChunk(user.ID, session.ID, session.Received, bytes.NewReader(append(append([]byte{}, rest...), 'x')), nil)
+	assert.ErrorIs(t, err, services.ErrUploadChunkOverflow)
+	restSum := sha256.Sum256(rest)
+	session, err = service.WriteChunk(user.ID, session.ID, session.Received, bytes.NewReader(rest), restSum[:])
+	require.NoError(t, err)
+	assert.Equal(t, session.Size, session.Received)
+
+	// Сборку уже заняла другая реплика: второй документ не создается
+	require.NoError(t, db.Model(&models.UploadSession{}).Where("\"Id\" = ?", session.ID).Update("Status", models.UploadSessionCompleting).Error)
+	_, err = service.Complete(ctx, user, session.ID)
+	assert.ErrorIs(t, err, services.ErrUploadCompleting)
+	var count int64
+	require.NoError(t, db.Model(&models.ProjectDocument{}).Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, db.Model(&models.UploadSession{}).Where("\"Id\" = ?", session.ID).Update("Status", models.UploadSessionActive).Error)
+
+	doc, err := service.Complete(ctx, user, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Технический план", doc.Type)
+	assert.Equal(t, "application/pdf", doc.ContentType)
+	assert.Equal(t, hex.EncodeToString(sum[:]), doc.SHA256)
+	stored, err := docs.Open(ctx, doc)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(stored)
+	stored.Close()
+	assert.Equal(t, content, data)
+	_, err = os.Stat(filepath.Join(sessionDir, session.ID))
+	assert.True(t, os.IsNotExist(err))
+
+	// Повторное завершение (ответ потерялся) возвращает тот же документ
+	again, err := service.Complete(ctx, user, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, doc.ID, again.ID)
+
+	// Новая версия с неверной общей суммой отклоняется при завершении, сеанс закрывается
+	version, err := service.Create(user, services.UploadSessionInput{DocumentID: &doc.ID, FileName: "plan-v2.pdf", Size: 9, SHA256: hex.EncodeToString(wrong[:])})
+	require.NoError(t, err)
+	_, err = service.WriteChunk(user.ID, version.ID, 0, bytes.NewReader([]byte("%PDF-1.7\n")), nil)
+	require.NoError(t, err)
+	_, err = service.Complete(ctx, user, version.ID)
+	assert.ErrorIs(t, err, services.ErrUploadChecksum)
+	_, err = service.Get(user.ID, version.ID)
+	assert.ErrorIs(t, err, services.ErrUploadSessionNotFound)
+
+	version, err = service.Create(user, services.UploadSessionInput{DocumentID: &doc.ID, FileName: "plan-v2.pdf", Size: 9})
+	require.NoError(t, err)
+	_, err = service.WriteChunk(user.ID, version.ID, 0, bytes.NewReader([]byte("%PDF-1.7\n")), nil)
+	require.NoError(t, err)
+	updated, err := service.Complete(ctx, user, version.ID)
+	require.NoError(t, err)
+	assert.Equal(t, doc.ID, updated.ID)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, "plan-v2.pdf", updated.Name)
+
+	// Брошенный сеанс удаляется вместе с принятыми частями
+	abandoned, err := service.Create(user, services.UploadSessionInput{ProjectID: 1, Type: "technical-plan", FileName: "draft.pdf", Size: 100})
+	require.NoError(t, err)
+	_, err = service.WriteChunk(user.ID, abandoned.ID, 0, bytes.NewReader([]byte("%PDF")), nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&models.UploadSession{}).Where("\"Id\" = ?", abandoned.ID).
+		UpdateColumn("ExpiresAt", time.Now().Add(-time.Minute)).Error)
+	removed, err := service.CleanupExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = os.Stat(filepath.Join(sessionDir, abandoned.ID))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// raceReader перед выдачей данных выполняет before — запрос другой реплики с тем же смещением
+type raceReader struct {
+	io.Reader
+	before func()
+}
+
+func (r *raceReader) Read(p []byte) (int, error) {
+	if r.before != nil {
+		r.before()
+		r.before = nil
+	}
+	return r.Reader.Read(p)
+}
+
+func TestUploadSessionService_OffsetConflictAcrossReplicas(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, database.SeedDocumentTypes(db))
+	files, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	docs := services.NewDocumentService(db, files)
+	docTypes := services.NewDocumentTypeService(db)
+	sessionDir := t.TempDir()
+	policy := services.NewUploadPolicy(docTypes, 1<<20, nil)
+	// Две реплики с общей базой и каталогом сеансов, но своими блокировками в памяти
+	first := services.NewUploadSessionService(db, docs, docTypes, policy, sessionDir)
+	second := services.NewUploadSessionService(db, docs, docTypes, policy, sessionDir)
+
+	user := &models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	session, err := first.Create(user, services.UploadSessionInput{ProjectID: 1, Type: "technical-plan", FileName: "plan.pdf", Size: 8})
+	require.NoError(t, err)
+
+	// Пока первая реплика принимает часть, вторая занимает то же смещение
+	chunk := &raceReader{Reader: bytes.NewReader([]byte("AAAA")), before: func() {
+		_, err := second.WriteChunk(user.ID, session.ID, 0, bytes.NewReader([]byte("%PDF")), nil)
+		require.NoError(t, err)
+	}}
+	current, err := first.WriteChunk(user.ID, session.ID, 0, chunk, nil)
+	assert.ErrorIs(t, err, services.ErrUploadOffsetMismatch)
+	assert.Equal(t, int64(4), current.Received)
+
+	// Проигравшая часть не попадает в файл, временные файлы частей удалены
+	data, err := os.ReadFile(filepath.Join(sessionDir, session.ID))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("%PDF"), data)
+	entries, err := os.ReadDir(sessionDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ошибки управления пользователями
+var (
+	ErrUserInvalid          = errors.New("имя, логин и роль обязательны")
+	ErrUserLoginTaken       = errors.New("логин уже занят")
+	ErrUserSubjectTaken     = errors.New("учетная запись провайдера уже привязана к другому пользователю")
+	ErrUserUnknownRole      = errors.New("роль не найдена")
+	ErrUserPrimaryRole      = errors.New("основная роль должна быть среди ролей пользователя")
+	ErrUserCapacity         = errors.New("загрузка должна быть больше 0 и не больше 7 дней в неделю")
+	ErrUserInactive         = errors.New("пользователь деактивирован")
+	ErrReassignRequired     = errors.New("у пользователя есть открытые задачи или заявки: укажите, кому их передать")
+	ErrInvalidSuccessor     = errors.New("передать задачи можно только другому активному пользователю")
+	ErrCannotDeactivateSelf = errors.New("нельзя деактивировать самого себя")
+)
+
+// UserInput данные для создания и изменения пользователя
+type UserInput struct {
+	Name   string `json:"name"`
+	Login  string `json:"login"`
+	Role   string `json:"role"` // Основная роль; при пустом значении — первая из Roles
+	Avatar string `json:"avatar"`
+	// Все роли пользователя с областью действия. При создании без ролей
+	// назначается основная роль без ограничений; при изменении nil оставляет роли как есть
+	Roles []models.UserRole `json:"roles"`
+	// Дней работы в неделю для отчета о загрузке; nil оставляет как есть (при создании — 5)
+	WeeklyCapacity *float64 `json:"weeklyCapacity"`
+	// Привязка к учетной записи провайдера SSO (sub); nil оставляет как есть, пустая строка отвязывает
+	ExternalSubject *string `json:"externalSubject"`
+}
+
+// DeactivationResult сколько объектов передано преемнику
+type DeactivationResult struct {
+	User        *models.User `json:"user"`
+	Tasks       int64        `json:"tasks"`
+	Requests    int64        `json:"requests"`
+	Memberships int64        `json:"memberships"`
+	Absences    int64        `json:"absences"` // Отсутствия других пользователей, где он был заместителем
+}
+
+// openRequestStatuses заявки, которые ждут действий ответственного
+var openRequestStatuses = []string{string(models.RequestStatusNew), string(models.RequestStatusInProgress)}
+
+// UserService управляет жизненным циклом пользователей
+type UserService struct {
+	db       *gorm.DB
+	userRepo repositories.UserRepository
+}
+
+func NewUserService(db *gorm.DB, userRepo repositories.UserRepository) *UserService {
+	return &UserService{db: db, userRepo: userRepo}
+}
+
+func (s *UserService) GetUsers(includeInactive bool) ([]models.User, error) {
+	return s.userRepo.FindAll(includeInactive)
+}
+
+// GetUser возвращает пользователя вместе с ролями
+func (s *UserService) GetUser(id uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Roles, err = s.userRepo.FindRoles(id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateUser создает активного пользователя
+func (s *UserService) CreateUser(input UserInput) (*models.User, error) {
+	user := &models.User{IsActive: true}
+	if len(input.Roles) == 0 {
+		input.Roles = []models.UserRole{{RoleCode: input.Role}}
+	}
+	if err := s.apply(user, &input); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.ReplaceRoles(user.ID, input.Roles); err != nil {
+		return nil, err
+	}
+	user.Roles = input.Roles
+	return user, nil
+}
+
+// UpdateUser меняет данные и роль пользователя
+func (s *UserService) UpdateUser(id uint, input UserInput) (*models.User, error) {
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if input.Roles == nil {
+		// Роли не меняются, но основная роль должна остаться среди них
+		if input.Roles, err = s.userRepo.FindRoles(id); err != nil {
+			return nil, err
+		}
+		if err := s.apply(user, &input); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.apply(user, &input); err != nil {
+			return nil, err
+		}
+		if err := s.userRepo.ReplaceRoles(id, input.Roles); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	user.Roles = input.Roles
+	return user, nil
+}
+
+func (s *UserService) apply(user *models.User, input *UserInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Login = strings.TrimSpace(input.Login)
+	if input.Role == "" && len(input.Roles) > 0 {
+		input.Role = input.Roles[0].RoleCode
+	}
+	if input.Name == "" || input.Login == "" || input.Role == "" {
+		return ErrUserInvalid
+	}
+	if input.WeeklyCapacity != nil && (*input.WeeklyCapacity <= 0 || *input.WeeklyCapacity > 7) {
+		return ErrUserCapacity
+	}
+
+	existing, err := s.userRepo.FindByLogin(input.Login)
+	if err == nil && existing.ID != user.ID {
+		return ErrUserLoginTaken
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err := s.validateRoles(input); err != nil {
+		return err
+	}
+	if err := s.applyExternalSubject(user, input.ExternalSubject); err != nil {
+		return err
+	}
+
+	user.Name = input.Name
+	user.Login = input.Login
+	user.Role = input.Role
+	user.Avatar = input.Avatar
+	if input.WeeklyCapacity != nil {
+		user.WeeklyCapacity = *input.WeeklyCapacity
+	}
+	return nil
+}
+
+// applyExternalSubject привязывает пользователя к учетной записи провайдера SSO
+func (s *UserService) applyExternalSubject(user *models.User, subject *string) error {
+	if subject == nil {
+		return nil
+	}
+	value := strings.TrimSpace(*subject)
+	if value == "" {
+		user.ExternalSubject = nil
+		return nil
+	}
+	var taken int64
+	if err := s.db.Model(&models.User{}).Where("\"ExternalSubject\" = ? AND \"ID\" <> ?", value, user.ID).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrUserSubjectTaken
+	}
+	user.ExternalSubject = &value
+	return nil
+}
+
+// validateRoles проверяет, что роли существуют, а основная роль назначена.
+// Пустой список допустим только для пользователей без назначений (до миграции)
+func (s *UserService) validateRoles(input *UserInput) error {
+	codes := map[string]bool{input.Role: true}
+	primaryAssigned := len(input.Roles) == 0
+	for i := range input.Roles {
+		r := &input.Roles[i]
+		r.Region = strings.TrimSpace(r.Region)
+		r.CFO = strings.TrimSpace(r.CFO)
+		codes[r.RoleCode] = true
+		if r.RoleCode == input.Role {
+			primaryAssigned = true
+		}
+	}
+	if !primaryAssigned {
+		return ErrUserPrimaryRole
+	}
+
+	for code := range codes {
+		var role models.Role
+		if err := s.db.Where(&models.Role{Code: code}).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %s", ErrUserUnknownRole, code)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Deactivate отключает пользователя вместо удаления.
+// Незавершенные задачи, открытые назначенные заявки и места в командах проектов передаются преемнику.
+// Без преемника деактивация возможна, только если передавать нечего. Заявку, созданную самим преемником,
+// передать ему нельзя — ее нужно переназначить заранее. Замещения, где пользователь был заместителем,
+// завершаются (текущие) или удаляются (будущие)
+func (s *UserService) Deactivate(id uint, successorID *uint, actorID uint) (*DeactivationResult, error) {
+	if id == actorID {
+		return nil, ErrCannotDeactivateSelf
+	}
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var successor *models.User
+	if successorID != nil {
+		successor, err = s.userRepo.FindByID(*successorID)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && (!successor.IsActive || successor.ID == id)) {
+			return nil, ErrInvalidSuccessor
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &DeactivationResult{User: user}
+	now := time.Now().UTC()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		openTasks := func() *gorm.DB {
+			return tx.Model(&models.ProjectTask{}).
+				Where("\"ResponsibleUserId\" = ? AND \"Status\" NOT IN ?", id, models.ClosedTaskStatuses())
+		}
+		openRequests := func() *gorm.DB {
+			return tx.Model(&models.Request{}).
+				Where("\"AssignedToUserId\" = ? AND \"Status\" IN ?", id, openRequestStatuses)
+		}
+
+		if successor == nil {
+			var tasks, requests int64
+			if err := openTasks().Count(&tasks).Error; err != nil {
+				return err
+			}
+			if err := openRequests().Count(&requests).Error; err != nil {
+				return err
+			}
+			if tasks > 0 || requests > 0 {
+				return fmt.Errorf("%w (задач: %d, заявок: %d)", ErrReassignRequired, tasks, requests)
+			}
+		} else {
+			// Нельзя назначить заявку ее автору: такие заявки останутся за деактивированным
+			var own int64
+			if err := openRequests().Where("\"CreatedByUserId\" = ?", successor.ID).Count(&own).Error; err != nil {
+				return err
+			}
+			if own > 0 {
+				return fmt.Errorf("%w (заявок, созданных преемником: %d)", ErrReassignRequired, own)
+			}
+
+			// Имя ответственного в задаче меняется, только если там было имя, а не роль
+			res := openTasks().Updates(map[string]interface{}{
+				"ResponsibleUserId": successor.ID,
+				"Responsible": gorm.Expr("CASE WHEN \"Responsible\" = ? THEN ? ELSE \"Responsible\" END",
+					user.Name, successor.Name),
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Tasks = res.RowsAffected
+
+			res = openRequests().Update("AssignedToUserId", successor.ID)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Requests = res.RowsAffected
+
+			// Места в командах передаются, если у преемника еще нет этой роли в проекте
+			res = tx.Model(&models.ProjectMember{}).
+				Where("\"UserId\" = ?", id).
+				Where("NOT EXISTS (SELECT 1 FROM \"ProjectMembers\" pm WHERE pm.\"ProjectId\" = \"ProjectMembers\".\"ProjectId\" AND pm.\"Role\" = \"ProjectMembers\".\"Role\" AND pm.\"UserId\" = ?)", successor.ID).
+				Update("UserId", successor.ID)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Memberships = res.RowsAffected
+
+			// Остальные места дублируют роль преемника
+			if err := tx.Where("\"UserId\" = ?", id).Delete(&models.ProjectMember{}).Error; err != nil {
+				return err
+			}
+		}
+
+		// Работа отсутствующих не должна уходить деактивированному заместителю
+		res := tx.Where("\"DelegateId\" = ? AND \"StartDate\" > ?", id, now).Delete(&models.UserAbsence{})
+		if res.Error != nil {
+			return res.Error
+		}
+		result.Absences = res.RowsAffected
+		res = tx.Model(&models.UserAbsence{}).
+			Where("\"DelegateId\" = ? AND \"StartDate\" <= ? AND \"EndDate\" >= ?", id, now, now).
+			Update("EndDate", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		result.Absences += res.RowsAffected
+
+		user.IsActive = false
+		user.DeactivatedAt = &now
+		return tx.Model(user).Updates(map[string]interface{}{"IsActive": false, "DeactivatedAt": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Activate возвращает доступ деактивированному пользователю
+func (s *UserService) Activate(id uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(user).Updates(map[string]interface{}{"IsActive": true, "DeactivatedAt": nil}).Error; err != nil {
+		return nil, err
+	}
+	user.IsActive = true
+	user.DeactivatedAt = nil
+	return user, nil
+}
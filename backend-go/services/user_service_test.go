@@ -0,0 +1,99 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/repositories"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserService_DeactivateReassignsWork(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	service := services.NewUserService(db, userRepo)
+
+	admin := models.User{Name: "Админов А.А.", Login: "admin", Role: models.RoleAdmin, IsActive: true}
+	leaving := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	successor := models.User{Name: "Сидоров С.С.", Login: "sidorov", Role: models.RoleMP, IsActive: true}
+	for _, u := range []*models.User{&admin, &leaving, &successor} {
+		require.NoError(t, db.Create(u).Error)
+	}
+
+	project := models.Project{StoreID: 1, ProjectType: string(models.ProjectTypeOpening)}
+	require.NoError(t, db.Create(&project).Error)
+	require.NoError(t, db.Create(&models.ProjectMember{ProjectID: project.ID, UserID: leaving.ID, Role: models.ProjectRoleMP}).Error)
+
+	leavingID := int(leaving.ID)
+	open := models.ProjectTask{ProjectID: project.ID, Name: "Аудит", NormativeDeadline: time.Now(),
+		Responsible: leaving.Name, ResponsibleUserID: &leavingID, Status: string(models.TaskStatusInProgress)}
+	done := models.ProjectTask{ProjectID: project.ID, Name: "Обмер", NormativeDeadline: time.Now(),
+		Responsible: models.RoleMP, ResponsibleUserID: &leavingID, Status: string(models.TaskStatusCompleted)}
+	retired := models.ProjectTask{ProjectID: project.ID, Name: "Старая задача шаблона", NormativeDeadline: time.Now(),
+		Responsible: leaving.Name, ResponsibleUserID: &leavingID, Status: string(models.TaskStatusRetired)}
+	require.NoError(t, db.Create(&open).Error)
+	require.NoError(t, db.Create(&done).Error)
+	require.NoError(t, db.Create(&retired).Error)
+
+	request := models.Request{Title: "Планировка", CreatedByUserID: admin.ID, AssignedToUserID: leaving.ID, Status: string(models.RequestStatusNew)}
+	require.NoError(t, db.Create(&request).Error)
+
+	// Без преемника открытую работу передать некому
+	_, err := service.Deactivate(leaving.ID, nil, admin.ID)
+	assert.ErrorIs(t, err, services.ErrReassignRequired)
+	_, err = service.Deactivate(admin.ID, nil, admin.ID)
+	assert.ErrorIs(t, err, services.ErrCannotDeactivateSelf)
+
+	// Заявку, созданную преемником, передать ему нельзя: деактивация отклоняется, пока ее не переназначат
+	own := models.Request{Title: "Вывеска", CreatedByUserID: successor.ID, AssignedToUserID: leaving.ID, Status: string(models.RequestStatusNew)}
+	require.NoError(t, db.Create(&own).Error)
+	_, err = service.Deactivate(leaving.ID, &successor.ID, admin.ID)
+	assert.ErrorIs(t, err, services.ErrReassignRequired)
+	require.NoError(t, db.Model(&own).Update("AssignedToUserID", admin.ID).Error)
+
+	// Замещения, где уходящий был заместителем: текущее завершается, будущее удаляется, прошедшее не меняется
+	today := time.Now()
+	current := models.UserAbsence{UserID: admin.ID, DelegateID: leaving.ID, StartDate: today.AddDate(0, 0, -1), EndDate: today.AddDate(0, 0, 5)}
+	future := models.UserAbsence{UserID: admin.ID, DelegateID: leaving.ID, StartDate: today.AddDate(0, 0, 10), EndDate: today.AddDate(0, 0, 12)}
+	past := models.UserAbsence{UserID: admin.ID, DelegateID: leaving.ID, StartDate: today.AddDate(0, 0, -10), EndDate: today.AddDate(0, 0, -8)}
+	for _, a := range []*models.UserAbsence{&current, &future, &past} {
+		require.NoError(t, db.Create(a).Error)
+	}
+
+	result, err := service.Deactivate(leaving.ID, &successor.ID, admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Tasks)
+	assert.Equal(t, int64(1), result.Requests)
+	assert.Equal(t, int64(1), result.Memberships)
+	assert.Equal(t, int64(2), result.Absences)
+
+	var absences []models.UserAbsence
+	require.NoError(t, db.Order("\"StartDate\"").Find(&absences).Error)
+	require.Len(t, absences, 2)
+	assert.Equal(t, past.EndDate.Unix(), absences[0].EndDate.Unix())
+	assert.False(t, absences[1].EndDate.After(time.Now()))
+
+	// Завершенные и исключенные из шаблона задачи остаются за прежним исполнителем
+	var reloadedOpen, reloadedDone, reloadedRetired models.ProjectTask
+	require.NoError(t, db.First(&reloadedOpen, open.ID).Error)
+	require.NoError(t, db.First(&reloadedDone, done.ID).Error)
+	require.NoError(t, db.First(&reloadedRetired, retired.ID).Error)
+	assert.Equal(t, int(successor.ID), *reloadedOpen.ResponsibleUserID)
+	assert.Equal(t, successor.Name, reloadedOpen.Responsible)
+	assert.Equal(t, leavingID, *reloadedDone.ResponsibleUserID)
+	assert.Equal(t, leavingID, *reloadedRetired.ResponsibleUserID)
+
+	var reloadedRequest models.Request
+	require.NoError(t, db.First(&reloadedRequest, request.ID).Error)
+	assert.Equal(t, successor.ID, reloadedRequest.AssignedToUserID)
+
+	// Деактивированный пользователь не получает новые задачи по роли
+	users, err := userRepo.FindByRole(models.RoleMP)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, successor.ID, users[0].ID)
+}
@@ -2,11 +2,11 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"portal-razvitie/models"
 	"portal-razvitie/repositories"
-	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -26,6 +26,9 @@ type WorkflowService struct {
 	notifService *NotificationService
 	projectRepo  repositories.ProjectRepository
 	db           *gorm.DB
+	absences     *AbsenceService
+	assignments  *AssignmentService
+	docTypes     *DocumentTypeService // Справочник типов документов: обязательные документы задач
 }
 
 func NewWorkflowService(userRepo repositories.UserRepository, projectRepo repositories.ProjectRepository, notifService *NotificationService, db *gorm.DB) *WorkflowService {
@@ -34,6 +37,8 @@ func NewWorkflowService(userRepo repositories.UserRepository, projectRepo reposi
 		projectRepo:  projectRepo,
 		notifService: notifService,
 		db:           db,
+		assignments:  NewAssignmentService(db),
+		docTypes:     NewDocumentTypeService(db),
 	}
 	svc.SeedDefinitions()
 	return svc
@@ -55,6 +60,16 @@ func (s *WorkflowService) SetDB(db *gorm.DB) {
 	s.db = db
 }
 
+// SetAssignmentService задает сервис автоматического назначения исполнителей по роли
+func (s *WorkflowService) SetAssignmentService(assignments *AssignmentService) {
+	s.assignments = assignments
+}
+
+// SetAbsenceService включает передачу задач отсутствующих сотрудников заместителям
+func (s *WorkflowService) SetAbsenceService(absences *AbsenceService) {
+	s.absences = absences
+}
+
 // Helper to format nullable date
 func formatDate(t *time.Time) string {
 	if t == nil {
@@ -66,25 +81,25 @@ func formatDate(t *time.Time) string {
 // Default definitions for seeding
 var DefaultStoreOpeningTasks = []models.TaskDefinition{
 	// Этап 1: Инициализация и Аудит
-	{Code: "TASK-PREP-AUDIT", Name: "Подготовка к аудиту", Duration: 2, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Инициализация"},
-	{Code: "TASK-AUDIT", Name: "Аудит объекта", Duration: 1, DependsOn: pq.StringArray{"TASK-PREP-AUDIT"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Аудит"},
+	{Code: "TASK-PREP-AUDIT", Name: "Подготовка к аудиту", Duration: 2, DependsOn: pq.StringArray{}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Инициализация", ProjectStatus: string(models.ProjectStatusPrepAudit), StatusOrder: 0},
+	{Code: "TASK-AUDIT", Name: "Аудит объекта", Duration: 1, DependsOn: pq.StringArray{"TASK-PREP-AUDIT"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Аудит", ProjectStatus: string(models.ProjectStatusAuditObject), StatusOrder: 1},
 
 	// Этап 2: Параллельные ветки после аудита
-	{Code: "TASK-ALCO-LIC", Name: "Алкогольная лицензия", Duration: 2, DependsOn: pq.StringArray{"TASK-AUDIT"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Лицензирование"},
-	{Code: "TASK-WASTE", Name: "Площадка ТБО", Duration: 2, DependsOn: pq.StringArray{"TASK-AUDIT"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "ТБО"},
-	{Code: "TASK-CONTOUR", Name: "Контур планировки", Duration: 1, DependsOn: pq.StringArray{"TASK-AUDIT"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Проектирование"},
+	{Code: "TASK-ALCO-LIC", Name: "Алкогольная лицензия", Duration: 2, DependsOn: pq.StringArray{"TASK-AUDIT"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Лицензирование", ProjectStatus: string(models.ProjectStatusAlcoholLicense), StatusOrder: 2},
+	{Code: "TASK-WASTE", Name: "Площадка ТБО", Duration: 2, DependsOn: pq.StringArray{"TASK-AUDIT"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "ТБО", ProjectStatus: string(models.ProjectStatusWaste), StatusOrder: 3},
+	{Code: "TASK-CONTOUR", Name: "Контур планировки", Duration: 1, DependsOn: pq.StringArray{"TASK-AUDIT"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Проектирование", ProjectStatus: string(models.ProjectStatusContour), StatusOrder: 4},
 
 	// Этап 3: Детальное проектирование (после контура)
-	{Code: "TASK-VISUALIZATION", Name: "Визуализация", Duration: 1, DependsOn: pq.StringArray{"TASK-CONTOUR"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Проектирование"},
-	{Code: "TASK-LOGISTICS", Name: "Оценка логистики", Duration: 2, DependsOn: pq.StringArray{"TASK-CONTOUR"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Логистика"},
-	{Code: "TASK-LAYOUT", Name: "Планировка с расстановкой", Duration: 2, DependsOn: pq.StringArray{"TASK-CONTOUR"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Проектирование"},
+	{Code: "TASK-VISUALIZATION", Name: "Визуализация", Duration: 1, DependsOn: pq.StringArray{"TASK-CONTOUR"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Проектирование", ProjectStatus: string(models.ProjectStatusVisualization), StatusOrder: 5},
+	{Code: "TASK-LOGISTICS", Name: "Оценка логистики", Duration: 2, DependsOn: pq.StringArray{"TASK-CONTOUR"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Логистика", ProjectStatus: string(models.ProjectStatusLogistics), StatusOrder: 6},
+	{Code: "TASK-LAYOUT", Name: "Планировка с расстановкой", Duration: 2, DependsOn: pq.StringArray{"TASK-CONTOUR"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Проектирование", ProjectStatus: string(models.ProjectStatusLayout), StatusOrder: 7},
 
 	// Этап 4: Бюджетирование
-	{Code: "TASK-BUDGET-EQUIP", Name: "Расчет бюджета оборудования", Duration: 2, DependsOn: pq.StringArray{"TASK-VISUALIZATION", "TASK-LAYOUT"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет"},
-	{Code: "TASK-BUDGET-SECURITY", Name: "Расчет бюджета СБ", Duration: 2, DependsOn: pq.StringArray{"TASK-LAYOUT"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет"},
-	{Code: "TASK-BUDGET-RSR", Name: "ТЗ и расчет бюджета РСР", Duration: 1, DependsOn: pq.StringArray{"TASK-BUDGET-SECURITY"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет"},
-	{Code: "TASK-BUDGET-PIS", Name: "Расчет бюджета ПиС", Duration: 1, DependsOn: pq.StringArray{"TASK-BUDGET-RSR", "TASK-BUDGET-EQUIP"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет"},
-	{Code: "TASK-TOTAL-BUDGET", Name: "Общий бюджет проекта", Duration: 1, DependsOn: pq.StringArray{"TASK-BUDGET-PIS"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Бюджет"},
+	{Code: "TASK-BUDGET-EQUIP", Name: "Расчет бюджета оборудования", Duration: 2, DependsOn: pq.StringArray{"TASK-VISUALIZATION", "TASK-LAYOUT"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет", ProjectStatus: string(models.ProjectStatusBudgetEquip), StatusOrder: 8},
+	{Code: "TASK-BUDGET-SECURITY", Name: "Расчет бюджета СБ", Duration: 2, DependsOn: pq.StringArray{"TASK-LAYOUT"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет", ProjectStatus: string(models.ProjectStatusBudgetSecurity), StatusOrder: 9},
+	{Code: "TASK-BUDGET-RSR", Name: "ТЗ и расчет бюджета РСР", Duration: 1, DependsOn: pq.StringArray{"TASK-BUDGET-SECURITY"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет", ProjectStatus: string(models.ProjectStatusBudgetRSR), StatusOrder: 10},
+	{Code: "TASK-BUDGET-PIS", Name: "Расчет бюджета ПиС", Duration: 1, DependsOn: pq.StringArray{"TASK-BUDGET-RSR", "TASK-BUDGET-EQUIP"}, ResponsibleRole: models.RoleMRiZ, TaskType: "UserTask", Stage: "Бюджет", ProjectStatus: string(models.ProjectStatusBudgetPIS), StatusOrder: 11},
+	{Code: "TASK-TOTAL-BUDGET", Name: "Общий бюджет проекта", Duration: 1, DependsOn: pq.StringArray{"TASK-BUDGET-PIS"}, ResponsibleRole: models.RoleMP, TaskType: "UserTask", Stage: "Бюджет", ProjectStatus: string(models.ProjectStatusTotalBudget), StatusOrder: 12},
 }
 
 func (s *WorkflowService) SeedDefinitions() {
@@ -98,6 +113,38 @@ func (s *WorkflowService) SeedDefinitions() {
 			}
 		}
 	}
+	s.backfillStatusMapping()
+}
+
+// backfillStatusMapping fills the task -> project status mapping for rows created before it was stored
+// on tasks (NULL column). Empty string means "does not drive project status" and is left as is.
+func (s *WorkflowService) backfillStatusMapping() {
+	tables := []interface{}{&models.TaskDefinition{}, &models.TemplateTask{}, &models.TemplateVersionTask{}, &models.ProjectTask{}}
+	for _, def := range DefaultStoreOpeningTasks {
+		for _, table := range tables {
+			if err := s.db.Model(table).
+				Where("\"Code\" = ? AND \"ProjectStatus\" IS NULL", def.Code).
+				Updates(map[string]interface{}{"ProjectStatus": def.ProjectStatus, "StatusOrder": def.StatusOrder}).Error; err != nil {
+				log.Printf("Error backfilling status mapping for %s: %v", def.Code, err)
+			}
+		}
+	}
+}
+
+// taskBlueprint normalizes the task source (template version, draft template or legacy definitions)
+type taskBlueprint struct {
+	Code            string
+	Name            string
+	Duration        int
+	Stage           string
+	DependsOn       []string
+	ResponsibleRole string
+	TaskType        string
+	UserID          *int
+	Order           int
+	TaskTemplateID  *uint
+	ProjectStatus   string
+	StatusOrder     int
 }
 
 // GenerateProjectTasksWithTx creates the full task roadmap for a new project using a transaction
@@ -105,52 +152,86 @@ func (s *WorkflowService) GenerateProjectTasksWithTx(tx *gorm.DB, project *model
 	var createdTasks []models.ProjectTask
 	taskMap := make(map[string]*models.ProjectTask) // Map By Code
 
-	// Helper struct to normalize task source
-	type TaskBlueprint struct {
-		Code            string
-		Name            string
-		Duration        int
-		Stage           string
-		DependsOn       []string
-		ResponsibleRole string
-		TaskType        string
-		UserID          *int
-		Order           int
-		TaskTemplateID  *uint
+	blueprints, version, err := s.loadBlueprints(project)
+	if err != nil {
+		return nil, err
+	}
+
+	if version != nil {
+		project.TemplateVersionID = &version.ID
+		if err := tx.Model(&models.Project{}).Where("\"Id\" = ?", project.ID).
+			Update("TemplateVersionID", version.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	for _, taskDef := range blueprints {
+		newTask := s.buildProjectTask(project, taskDef, taskMap)
+		if err := s.assignments.WithTx(tx).AssignTask(&newTask, project); err != nil {
+			log.Printf("⚠️ Failed to assign task %s: %v", taskDef.Code, err)
+		}
+		routeToDelegate(s.absences, &newTask)
+
+		if err := tx.Create(&newTask).Error; err != nil {
+			return nil, err
+		}
+
+		createdTasks = append(createdTasks, newTask)
+
+		// Store for next iterations
+		taskCopy := newTask
+		taskMap[taskDef.Code] = &taskCopy
 	}
 
-	var blueprints []TaskBlueprint
+	return createdTasks, nil
+}
+
+// loadBlueprints determines the source of project tasks: published template version,
+// draft template tasks (template never published) or legacy global TaskDefinitions
+func (s *WorkflowService) loadBlueprints(project *models.Project) ([]taskBlueprint, *models.ProjectTemplateVersion, error) {
+	var blueprints []taskBlueprint
 
-	// 1. Determine Source of Tasks
+	var version *models.ProjectTemplateVersion
 	if project.TemplateID != nil {
-		var templateTasks []models.TemplateTask
-		if err := s.db.Where("\"ProjectTemplateID\" = ?", *project.TemplateID).Order("\"Order\" ASC").Find(&templateTasks).Error; err != nil {
-			return nil, fmt.Errorf("failed to load template tasks: %w", err)
+		v, err := s.resolveTemplateVersion(project)
+		if err != nil {
+			return nil, nil, err
 		}
+		version = v
+	}
 
-		for _, t := range templateTasks {
-			// pq.StringArray to []string
-			deps := []string(t.DependsOn)
-			blueprints = append(blueprints, TaskBlueprint{
+	if version != nil {
+		// Published template version: immutable snapshot
+		for _, t := range version.Tasks {
+			blueprints = append(blueprints, taskBlueprint{
 				Code:            t.Code,
 				Name:            t.Name,
 				Duration:        t.Duration,
 				Stage:           t.Stage,
-				DependsOn:       deps,
+				DependsOn:       []string(t.DependsOn),
 				ResponsibleRole: t.ResponsibleRole,
 				TaskType:        t.TaskType,
 				Order:           t.Order,
 				TaskTemplateID:  t.TaskTemplateID,
+				ProjectStatus:   t.ProjectStatus,
+				StatusOrder:     t.StatusOrder,
 			})
 		}
+	} else if project.TemplateID != nil {
+		// Template was never published: fall back to its draft tasks
+		var templateTasks []models.TemplateTask
+		if err := s.db.Where("\"ProjectTemplateID\" = ?", *project.TemplateID).Order("\"Order\" ASC").Find(&templateTasks).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to load template tasks: %w", err)
+		}
+		blueprints = blueprintsFromTemplateTasks(templateTasks)
 	} else {
 		// Legacy: Use Global TaskDefinitions
 		var taskDefs []models.TaskDefinition
 		if err := s.db.Order("\"ID\"").Find(&taskDefs).Error; err != nil {
-			return nil, fmt.Errorf("failed to load task definitions: %w", err)
+			return nil, nil, fmt.Errorf("failed to load task definitions: %w", err)
 		}
 		for i, def := range taskDefs {
-			blueprints = append(blueprints, TaskBlueprint{
+			blueprints = append(blueprints, taskBlueprint{
 				Code:            def.Code,
 				Name:            def.Name,
 				Duration:        def.Duration,
@@ -160,97 +241,140 @@ func (s *WorkflowService) GenerateProjectTasksWithTx(tx *gorm.DB, project *model
 				TaskType:        def.TaskType,
 				UserID:          def.ResponsibleUserID,
 				Order:           i,
+				ProjectStatus:   def.ProjectStatus,
+				StatusOrder:     def.StatusOrder,
 			})
 		}
 	}
 
-	for _, taskDef := range blueprints {
-		// 1. Calculate Start Date Logic
-		startDate := project.CreatedAt
+	return blueprints, version, nil
+}
 
-		// Find max end date of dependencies
-		if len(taskDef.DependsOn) > 0 {
-			var maxPrevEndDate time.Time
-			foundDeps := false
+func blueprintsFromTemplateTasks(templateTasks []models.TemplateTask) []taskBlueprint {
+	var blueprints []taskBlueprint
+	for _, t := range templateTasks {
+		// pq.StringArray to []string
+		deps := []string(t.DependsOn)
+		blueprints = append(blueprints, taskBlueprint{
+			Code:            t.Code,
+			Name:            t.Name,
+			Duration:        t.Duration,
+			Stage:           t.Stage,
+			DependsOn:       deps,
+			ResponsibleRole: t.ResponsibleRole,
+			TaskType:        t.TaskType,
+			Order:           t.Order,
+			TaskTemplateID:  t.TaskTemplateID,
+			ProjectStatus:   t.ProjectStatus,
+			StatusOrder:     t.StatusOrder,
+		})
+	}
+	return blueprints
+}
 
-			for _, depCode := range taskDef.DependsOn {
-				if prevTask, exists := taskMap[depCode]; exists {
-					foundDeps = true
-					if prevTask.NormativeDeadline.After(maxPrevEndDate) {
-						maxPrevEndDate = prevTask.NormativeDeadline
-					}
-				}
-			}
+// buildProjectTask schedules a blueprint after its already built dependencies (taskMap) without saving it.
+// The responsible user is resolved separately by AssignmentService
+func (s *WorkflowService) buildProjectTask(project *models.Project, taskDef taskBlueprint, taskMap map[string]*models.ProjectTask) models.ProjectTask {
+	// 1. Calculate Start Date Logic
+	startDate := project.CreatedAt
 
-			if foundDeps {
-				nextDay := maxPrevEndDate.AddDate(0, 0, 1)
-				startDate = time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), 0, 0, 0, 0, time.UTC)
-			}
-		}
+	// Find max end date of dependencies
+	if len(taskDef.DependsOn) > 0 {
+		var maxPrevEndDate time.Time
+		foundDeps := false
 
-		// 2. Calculate Deadline
-		deadline := startDate.AddDate(0, 0, taskDef.Duration)
-
-		// 3. Determine Initial Status
-		status := "Ожидание"
-		isActive := false
-
-		if len(taskDef.DependsOn) == 0 {
-			status = "Назначена"
-			isActive = true // First tasks are active
-		}
-
-		// 4. Create Struct
-		// Нужно создать копии, чтобы gorm корректно взял указатели
-		codeVal := taskDef.Code
-		stageVal := taskDef.Stage
-		daysVal := taskDef.Duration
-
-		// Serialize dependsOn
-		depsBytes, _ := json.Marshal(taskDef.DependsOn)
-		depsStr := string(depsBytes)
-
-		newTask := models.ProjectTask{
-			ProjectID:          project.ID,
-			Name:               taskDef.Name,
-			Code:               &codeVal,
-			TaskType:           taskDef.TaskType,
-			Responsible:        taskDef.ResponsibleRole,
-			ResponsibleUserID:  taskDef.UserID,
-			NormativeDeadline:  deadline,
-			PlannedStartDate:   &startDate,
-			Status:             status,
-			IsActive:           isActive,
-			Stage:              &stageVal,
-			CreatedAt:          &startDate,
-			Days:               &daysVal,
-			DependsOn:          &depsStr,
-			Order:              taskDef.Order,
-			TaskTemplateID:     taskDef.TaskTemplateID,
-			CustomFieldsValues: func() *string { s := "{}"; return &s }(),
-		}
-
-		// Resolve ResponsibleUserID
-		if s.userRepo != nil && newTask.ResponsibleUserID == nil && newTask.Responsible != "" {
-			users, err := s.userRepo.FindByRole(newTask.Responsible)
-			if err == nil && len(users) > 0 {
-				uid := int(users[0].ID)
-				newTask.ResponsibleUserID = &uid
+		for _, depCode := range taskDef.DependsOn {
+			if prevTask, exists := taskMap[depCode]; exists {
+				foundDeps = true
+				if prevTask.NormativeDeadline.After(maxPrevEndDate) {
+					maxPrevEndDate = prevTask.NormativeDeadline
+				}
 			}
 		}
 
-		if err := tx.Create(&newTask).Error; err != nil {
-			return nil, err
+		if foundDeps {
+			nextDay := maxPrevEndDate.AddDate(0, 0, 1)
+			startDate = time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), 0, 0, 0, 0, time.UTC)
 		}
+	}
 
-		createdTasks = append(createdTasks, newTask)
+	// 2. Calculate Deadline
+	deadline := startDate.AddDate(0, 0, taskDef.Duration)
 
-		// Store for next iterations
-		taskCopy := newTask
-		taskMap[codeVal] = &taskCopy
+	// 3. Determine Initial Status
+	status := "Ожидание"
+	isActive := false
+
+	if len(taskDef.DependsOn) == 0 {
+		status = "Назначена"
+		isActive = true // First tasks are active
 	}
 
-	return createdTasks, nil
+	// 4. Create Struct
+	// Нужно создать копии, чтобы gorm корректно взял указатели
+	codeVal := taskDef.Code
+	stageVal := taskDef.Stage
+	daysVal := taskDef.Duration
+	projectStatusVal := taskDef.ProjectStatus // Always non-nil: NULL is reserved for rows before the mapping existed
+
+	// Serialize dependsOn
+	depsBytes, _ := json.Marshal(taskDef.DependsOn)
+	depsStr := string(depsBytes)
+
+	newTask := models.ProjectTask{
+		ProjectID:          project.ID,
+		Name:               taskDef.Name,
+		Code:               &codeVal,
+		TaskType:           taskDef.TaskType,
+		Responsible:        taskDef.ResponsibleRole,
+		ResponsibleUserID:  taskDef.UserID,
+		NormativeDeadline:  deadline,
+		PlannedStartDate:   &startDate,
+		Status:             status,
+		IsActive:           isActive,
+		Stage:              &stageVal,
+		CreatedAt:          &startDate,
+		Days:               &daysVal,
+		DependsOn:          &depsStr,
+		Order:              taskDef.Order,
+		TaskTemplateID:     taskDef.TaskTemplateID,
+		ProjectStatus:      &projectStatusVal,
+		StatusOrder:        taskDef.StatusOrder,
+		CustomFieldsValues: func() *string { s := "{}"; return &s }(),
+	}
+
+	return newTask
+}
+
+// resolveTemplateVersion returns the template version the project should be generated from:
+// the explicitly requested one, otherwise the latest published. Nil means the template has no versions yet.
+func (s *WorkflowService) resolveTemplateVersion(project *models.Project) (*models.ProjectTemplateVersion, error) {
+	var version models.ProjectTemplateVersion
+	preloadTasks := func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"Order\" ASC, \"ID\" ASC")
+	}
+
+	if project.TemplateVersionID != nil {
+		if err := s.db.Preload("Tasks", preloadTasks).First(&version, *project.TemplateVersionID).Error; err != nil {
+			return nil, fmt.Errorf("failed to load template version: %w", err)
+		}
+		if version.ProjectTemplateID != *project.TemplateID {
+			return nil, fmt.Errorf("template version %d does not belong to template %d", version.ID, *project.TemplateID)
+		}
+		return &version, nil
+	}
+
+	err := s.db.Preload("Tasks", preloadTasks).
+		Where("\"ProjectTemplateID\" = ?", *project.TemplateID).
+		Order("\"Version\" DESC").
+		First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template version: %w", err)
+	}
+	return &version, nil
 }
 
 // ProcessTaskCompletion checks if subsequent tasks should be activated and reschedules dependent tasks
@@ -284,8 +408,8 @@ func (s *WorkflowService) ProcessTaskCompletion(projectID uint, completedTaskCod
 			continue
 		}
 
-		// Skip completed tasks - their history is frozen
-		if task.Status == "Завершена" {
+		// Skip completed tasks - their history is frozen. Retired tasks are no longer scheduled
+		if task.Status == "Завершена" || task.Status == string(models.TaskStatusRetired) {
 			continue
 		}
 
@@ -375,8 +499,9 @@ func (s *WorkflowService) ProcessTaskCompletion(projectID uint, completedTaskCod
 func (s *WorkflowService) RecalculateProjectTimeline(projectID uint) error {
 	log.Printf("[Workflow] Recalculating timeline for project %d", projectID)
 
+	// Process in template order so dependencies are rescheduled before their dependents
 	var projectTasks []models.ProjectTask
-	if err := s.db.Where("\"ProjectId\" = ?", projectID).Find(&projectTasks).Error; err != nil {
+	if err := s.db.Where("\"ProjectId\" = ?", projectID).Order("\"Order\" ASC, \"Id\" ASC").Find(&projectTasks).Error; err != nil {
 		return err
 	}
 
@@ -392,8 +517,8 @@ func (s *WorkflowService) RecalculateProjectTimeline(projectID uint) error {
 	for i := range projectTasks {
 		task := &projectTasks[i]
 
-		// Skip completed tasks - their dates are frozen
-		if task.Status == "Завершена" {
+		// Skip completed tasks - their dates are frozen. Retired tasks are no longer scheduled
+		if task.Status == "Завершена" || task.Status == string(models.TaskStatusRetired) {
 			continue
 		}
 
@@ -524,9 +649,6 @@ func (s *WorkflowService) ValidateTaskCompletion(task models.ProjectTask) error
 		if !hasStr(task.ProjectFolderLink) {
 			return fmt.Errorf("Поле 'Ссылка на папку проекта' обязательно")
 		}
-		if err := s.checkDocExists(task.ProjectID, "Технический план"); err != nil {
-			return err
-		}
 
 	case "TASK-AUDIT": // 2. Аудит объекта
 		if !hasTime(task.ActualAuditDate) {
@@ -548,85 +670,37 @@ func (s *WorkflowService) ValidateTaskCompletion(task models.ProjectTask) error
 		if !hasTime(task.PlanningContourAgreementDate) {
 			return fmt.Errorf("Поле 'Дата согласования контура' обязательно")
 		}
-		if err := s.checkDocExists(task.ProjectID, "Фотографии объекта"); err != nil {
-			return err
-		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Обмерный план", []string{".dwg"}); err != nil {
-			return err
-		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Предварительный контур", []string{".dwg"}); err != nil {
-			return err
-		}
 
 	case "TASK-VISUALIZATION": // 5. Визуализация
 		if !hasTime(task.VisualizationAgreementDate) {
 			return fmt.Errorf("Поле 'Дата согласования визуализации' обязательно")
 		}
-		if err := s.checkDocExists(task.ProjectID, "Концепт визуализации"); err != nil {
-			return err
-		}
-		if err := s.checkDocExists(task.ProjectID, "Выписка ЕГРН"); err != nil {
-			return err
-		}
-		if err := s.checkDocExists(task.ProjectID, "Визуализация внешнего вида магазина"); err != nil {
-			return err
-		}
 
 	case "TASK-LOGISTICS": // 6. Оценка логистики
 		// logisticsNbkpEligibility is a string/enum, just check existence if required (checkbox/choice)
 		if !hasStr(task.LogisticsNbkpEligibility) {
 			return fmt.Errorf("Поле 'Возможность НБКП' обязательно")
 		}
-		if err := s.checkDocExists(task.ProjectID, "Схема подъездных путей"); err != nil {
-			return err
-		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Оценка логистики и подъездных путей", []string{".pdf"}); err != nil {
-			return err
-		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Оценка возможности НБКП", []string{".pdf"}); err != nil {
-			return err
-		}
 
 	case "TASK-LAYOUT": // 7. Планировка с расстановкой
 		if !hasTime(task.LayoutAgreementDate) {
 			return fmt.Errorf("Поле 'Дата согласования планировки' обязательно")
 		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Технологическая планировка (DWG)", []string{".dwg"}); err != nil {
-			return err
-		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Технологическая планировка (PDF)", []string{".pdf"}); err != nil {
-			return err
-		}
 
 	case "TASK-BUDGET-EQUIP": // 8. Расчет бюджета оборудования
 		if !hasFloat(task.EquipmentCostNoVat) {
 			return fmt.Errorf("Поле 'Сумма затрат на оборудование без НДС' обязательно")
 		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Расчет затрат на оборудование", []string{".xls", ".xlsx"}); err != nil {
-			return err
-		}
 
 	case "TASK-BUDGET-SECURITY": // 9. Расчет бюджета СБ
 		if !hasFloat(task.SecurityBudgetNoVat) {
 			return fmt.Errorf("Поле 'Сумма бюджета СБ без НДС' обязательно")
 		}
-		if err := s.checkDocExists(task.ProjectID, "Анкета СБ"); err != nil {
-			return err
-		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Расчет затрат на оборудование СБ", []string{".xls", ".xlsx"}); err != nil {
-			return err
-		}
 
 	case "TASK-BUDGET-RSR": // 10. ТЗ и расчет бюджета РСР
 		if !hasFloat(task.RsrBudgetNoVat) {
 			return fmt.Errorf("Поле 'Сумма бюджета РСР без НДС' обязательно")
 		}
-		if err := s.checkDocExists(task.ProjectID, "Распределительная ведомость"); err != nil {
-			return err
-		}
-		if err := s.checkDocExistsWithExt(task.ProjectID, "Расчет бюджета РСР", []string{".xls", ".xlsx"}); err != nil {
-			return err
-		}
 
 	case "TASK-BUDGET-PIS": // 11. Расчет бюджета ПиС
 		if !hasFloat(task.PisBudgetNoVat) {
@@ -639,48 +713,19 @@ func (s *WorkflowService) ValidateTaskCompletion(task models.ProjectTask) error
 		}
 	}
 
-	return nil
-}
-
-func (s *WorkflowService) checkDocExists(projectID uint, docType string) error {
-	var count int64
-	if err := s.db.Model(&models.ProjectDocument{}).
-		Where("\"ProjectId\" = ? AND \"Type\" = ?", projectID, docType).
-		Count(&count).Error; err != nil {
-		return err
-	}
-	if count == 0 {
-		return fmt.Errorf("Необходим документ: %s", docType)
-	}
-	return nil
+	// Обязательные документы задаются справочником типов документов
+	return s.checkRequiredDocuments(task)
 }
 
-func (s *WorkflowService) checkDocExistsWithExt(projectID uint, docType string, allowedExts []string) error {
-	var docs []models.ProjectDocument
-	if err := s.db.Where("\"ProjectId\" = ? AND \"Type\" = ?", projectID, docType).Find(&docs).Error; err != nil {
+// checkRequiredDocuments проверяет документы, обязательные для задачи по справочнику типов документов.
+// Формат проверяется по последней версии документа
+func (s *WorkflowService) checkRequiredDocuments(task models.ProjectTask) error {
+	missing, err := s.docTypes.MissingForTask(task.ProjectID, *task.Code)
+	if err != nil {
 		return err
 	}
-
-	if len(docs) == 0 {
-		return fmt.Errorf("Необходим документ: %s", docType)
-	}
-
-	valid := false
-	for _, doc := range docs {
-		name := strings.ToLower(doc.FileName)
-		for _, ext := range allowedExts {
-			if strings.HasSuffix(name, strings.ToLower(ext)) {
-				valid = true
-				break
-			}
-		}
-		if valid {
-			break
-		}
-	}
-
-	if !valid {
-		return fmt.Errorf("Документ '%s' должен иметь формат: %s", docType, strings.Join(allowedExts, ", "))
+	if len(missing) > 0 {
+		return missing[0]
 	}
 	return nil
 }
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"portal-razvitie/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultWorkloadWeeks = 8
+	maxWorkloadWeeks     = 26
+)
+
+// WorkloadFilter параметры отчета о загрузке
+type WorkloadFilter struct {
+	Role   string // Пользователи с этой ролью (основной или назначенной)
+	Region string // Пользователи, чья роль назначена в этом регионе
+	Weeks  int    // Горизонт планирования в неделях
+}
+
+// WorkloadCounts открытые задачи или заявки пользователя
+type WorkloadCounts struct {
+	Open     int            `json:"open"`
+	Overdue  int            `json:"overdue"`
+	ByStatus map[string]int `json:"byStatus"`
+}
+
+// WorkloadWeek плановая трудоемкость пользователя на неделю (в днях)
+type WorkloadWeek struct {
+	WeekStart    time.Time `json:"weekStart"`
+	Effort       float64   `json:"effort"`
+	OverCapacity bool      `json:"overCapacity"`
+}
+
+// UserWorkload загрузка одного пользователя
+type UserWorkload struct {
+	UserID       uint           `json:"userId"`
+	Name         string         `json:"name"`
+	Role         string         `json:"role"`
+	Capacity     float64        `json:"capacity"` // Дней работы в неделю
+	Tasks        WorkloadCounts `json:"tasks"`
+	Requests     WorkloadCounts `json:"requests"`
+	Weeks        []WorkloadWeek `json:"weeks"`
+	OverCapacity bool           `json:"overCapacity"` // Перегружен хотя бы в одну из недель
+}
+
+// WorkloadReport отчет о загрузке команды. Перегруженные пользователи идут первыми
+type WorkloadReport struct {
+	From       time.Time      `json:"from"`
+	Weeks      int            `json:"weeks"`
+	Overloaded int            `json:"overloaded"`
+	Users      []UserWorkload `json:"users"`
+}
+
+// WorkloadService строит отчет о загрузке по открытым задачам и заявкам
+type WorkloadService struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewWorkloadService(db *gorm.DB) *WorkloadService {
+	return &WorkloadService{db: db, now: time.Now}
+}
+
+// GetWorkload считает по каждому пользователю открытые и просроченные задачи и заявки
+// и плановую трудоемкость задач по неделям.
+// Трудоемкость задачи (Days, а без него — длительность) равномерно распределяется по дням
+// от PlannedStartDate до NormativeDeadline, в неделю учитываются только будни
+func (s *WorkloadService) GetWorkload(filter WorkloadFilter) (*WorkloadReport, error) {
+	if filter.Weeks <= 0 {
+		filter.Weeks = defaultWorkloadWeeks
+	}
+	if filter.Weeks > maxWorkloadWeeks {
+		filter.Weeks = maxWorkloadWeeks
+	}
+
+	now := s.now()
+	from := startOfWeek(now)
+	report := &WorkloadReport{From: from, Weeks: filter.Weeks, Users: []UserWorkload{}}
+
+	users, err := s.users(filter)
+	if err != nil || len(users) == 0 {
+		return report, err
+	}
+	ids := make([]uint, 0, len(users))
+	byID := make(map[uint]*UserWorkload, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+		report.Users = append(report.Users, UserWorkload{
+			UserID:   u.ID,
+			Name:     u.Name,
+			Role:     u.Role,
+			Capacity: u.WeeklyCapacity,
+			Tasks:    WorkloadCounts{ByStatus: map[string]int{}},
+			Requests: WorkloadCounts{ByStatus: map[string]int{}},
+			Weeks:    newWorkloadWeeks(from, filter.Weeks),
+		})
+	}
+	for i := range report.Users {
+		byID[report.Users[i].UserID] = &report.Users[i]
+	}
+
+	var tasks []models.ProjectTask
+	if err := s.db.Select("Id", "ResponsibleUserId", "Status", "PlannedStartDate", "NormativeDeadline", "Days").
+		Where("\"ResponsibleUserId\" IN ? AND \"Status\" NOT IN ?", ids, models.ClosedTaskStatuses()).
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		w := byID[uint(*t.ResponsibleUserID)]
+		overdue := t.NormativeDeadline.Before(now)
+		w.Tasks.add(t.Status, overdue)
+		spreadEffort(w.Weeks, t, from, startOfDay(now))
+	}
+
+	var requests []models.Request
+	openRequests := []string{string(models.RequestStatusNew), string(models.RequestStatusInProgress)}
+	if err := s.db.Select("Id", "AssignedToUserId", "Status", "DueDate").
+		Where("\"AssignedToUserId\" IN ? AND \"Status\" IN ?", ids, openRequests).
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range requests {
+		byID[r.AssignedToUserID].Requests.add(r.Status, r.DueDate != nil && r.DueDate.Before(now))
+	}
+
+	for i := range report.Users {
+		w := &report.Users[i]
+		for j := range w.Weeks {
+			w.Weeks[j].Effort = math.Round(w.Weeks[j].Effort*10) / 10
+			if w.Weeks[j].Effort > w.Capacity {
+				w.Weeks[j].OverCapacity = true
+				w.OverCapacity = true
+			}
+		}
+		if w.OverCapacity {
+			report.Overloaded++
+		}
+	}
+	sort.SliceStable(report.Users, func(i, j int) bool {
+		return report.Users[i].OverCapacity && !report.Users[j].OverCapacity
+	})
+	return report, nil
+}
+
+// users возвращает активных пользователей по фильтру роли и региона
+func (s *WorkloadService) users(filter WorkloadFilter) ([]models.User, error) {
+	query := s.db.Where("\"IsActive\" = ?", true)
+	if filter.Role != "" {
+		assigned := s.db.Session(&gorm.Session{NewDB: true}).Model(&models.UserRole{}).Select("\"UserId\"").
+			Where("\"RoleCode\" = ?", filter.Role)
+		query = query.Where("(\"Role\" = ? OR \"ID\" IN (?))", filter.Role, assigned)
+	}
+	if filter.Region != "" {
+		regional := s.db.Session(&gorm.Session{NewDB: true}).Model(&models.UserRole{}).Select("\"UserId\"").
+			Where("\"Region\" = ?", filter.Region)
+		if filter.Role != "" {
+			regional = regional.Where("\"RoleCode\" = ?", filter.Role)
+		}
+		query = query.Where("\"ID\" IN (?)", regional)
+	}
+
+	var users []models.User
+	err := query.Order("\"Name\"").Find(&users).Error
+	return users, err
+}
+
+func (c *WorkloadCounts) add(status string, overdue bool) {
+	c.Open++
+	c.ByStatus[status]++
+	if overdue {
+		c.Overdue++
+	}
+}
+
+func newWorkloadWeeks(from time.Time, count int) []WorkloadWeek {
+	weeks := make([]WorkloadWeek, count)
+	for i := range weeks {
+		weeks[i].WeekStart = from.AddDate(0, 0, 7*i)
+	}
+	return weeks
+}
+
+// spreadEffort распределяет трудоемкость задачи по будням недель отчета.
+// Просроченная задача продолжает занимать исполнителя в том же темпе до конца текущей недели
+func spreadEffort(weeks []WorkloadWeek, task models.ProjectTask, from, today time.Time) {
+	end := startOfDay(task.NormativeDeadline)
+	start := end
+	if task.PlannedStartDate != nil && task.PlannedStartDate.Before(end) {
+		start = startOfDay(*task.PlannedStartDate)
+	}
+	spanDays := daysBetweenDates(start, end) + 1
+
+	effort := float64(spanDays)
+	if task.Days != nil && *task.Days > 0 {
+		effort = float64(*task.Days)
+	}
+	perDay := effort / float64(spanDays)
+
+	if end.Before(today) {
+		end = from.AddDate(0, 0, 6)
+	}
+	if start.Before(from) {
+		start = from
+	}
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+			continue
+		}
+		week := daysBetweenDates(from, date) / 7
+		if week >= len(weeks) {
+			break
+		}
+		weeks[week].Effort += perDay
+	}
+}
+
+// daysBetweenDates число календарных дней между началами дней (устойчиво к переходу на летнее время)
+func daysBetweenDates(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+// startOfWeek возвращает начало недели (понедельник)
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
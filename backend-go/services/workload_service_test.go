@@ -0,0 +1,74 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"portal-razvitie/models"
+	"portal-razvitie/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkloadService_GetWorkload(t *testing.T) {
+	db := setupTestDB(t)
+	service := services.NewWorkloadService(db)
+
+	busy := models.User{Name: "Иванов И.И.", Login: "ivanov", Role: models.RoleMP, IsActive: true}
+	normal := models.User{Name: "Петров П.П.", Login: "petrov", Role: models.RoleMP, IsActive: true}
+	analyst := models.User{Name: "Сидоров С.С.", Login: "sidorov", Role: models.RoleBA, IsActive: true}
+	for _, u := range []*models.User{&busy, &normal, &analyst} {
+		require.NoError(t, db.Create(u).Error)
+	}
+	require.NoError(t, db.Create(&models.UserRole{UserID: normal.ID, RoleCode: models.RoleMP, Region: "Урал"}).Error)
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+
+	task := func(user models.User, start, deadline time.Time, days int, status models.TaskStatus) {
+		uid := int(user.ID)
+		require.NoError(t, db.Create(&models.ProjectTask{ProjectID: 1, Name: "Задача", ResponsibleUserID: &uid,
+			PlannedStartDate: &start, NormativeDeadline: deadline, Days: &days, Status: string(status)}).Error)
+	}
+	// Две параллельные задачи на две недели — по 10 дней работы в неделю при норме 5
+	task(busy, weekStart, weekStart.AddDate(0, 0, 13), 14, models.TaskStatusInProgress)
+	task(busy, weekStart, weekStart.AddDate(0, 0, 13), 14, models.TaskStatusAssigned)
+	task(busy, weekStart, weekStart.AddDate(0, 0, 13), 14, models.TaskStatusCompleted)
+	// Просроченная задача занимает исполнителя до конца текущей недели
+	task(normal, today.AddDate(0, 0, -19), today.AddDate(0, 0, -10), 10, models.TaskStatusInProgress)
+
+	overdue := today.AddDate(0, 0, -1)
+	require.NoError(t, db.Create(&models.Request{Title: "Планировка", CreatedByUserID: busy.ID, AssignedToUserID: normal.ID,
+		Status: string(models.RequestStatusNew), DueDate: &overdue}).Error)
+
+	report, err := service.GetWorkload(services.WorkloadFilter{Role: models.RoleMP, Weeks: 4})
+	require.NoError(t, err)
+	require.Len(t, report.Users, 2)
+	assert.Equal(t, 1, report.Overloaded)
+	assert.Equal(t, weekStart, report.From)
+
+	first := report.Users[0]
+	assert.Equal(t, busy.ID, first.UserID)
+	assert.True(t, first.OverCapacity)
+	assert.Equal(t, 2, first.Tasks.Open)
+	assert.Equal(t, 1, first.Tasks.ByStatus[string(models.TaskStatusAssigned)])
+	require.Len(t, first.Weeks, 4)
+	assert.Equal(t, 10.0, first.Weeks[0].Effort)
+	assert.True(t, first.Weeks[1].OverCapacity)
+	assert.Equal(t, 0.0, first.Weeks[2].Effort)
+
+	second := report.Users[1]
+	assert.False(t, second.OverCapacity)
+	assert.Equal(t, 1, second.Tasks.Overdue)
+	assert.Equal(t, 5.0, second.Weeks[0].Effort)
+	assert.Equal(t, 1, second.Requests.Overdue)
+
+	// Фильтр по региону роли
+	report, err = service.GetWorkload(services.WorkloadFilter{Role: models.RoleMP, Region: "Урал"})
+	require.NoError(t, err)
+	require.Len(t, report.Users, 1)
+	assert.Equal(t, normal.ID, report.Users[0].UserID)
+	assert.Len(t, report.Users[0].Weeks, 8)
+}
@@ -0,0 +1,125 @@
+// Package s3test реализует S3-совместимое хранилище в памяти (адресация path-style, как у MinIO)
+// для тестов и локальной проверки: PUT, GET, HEAD и DELETE объектов и подписанные ссылки
+package s3test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// Server фиктивное хранилище. Проверяет, что запрос подписан ключом доступа AccessKey
+type Server struct {
+	AccessKey string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]object
+}
+
+func New(accessKey string, buckets ...string) *Server {
+	s := &Server{AccessKey: accessKey, buckets: map[string]map[string]object{}}
+	for _, b := range buckets {
+		s.buckets[b] = map[string]object{}
+	}
+	return s
+}
+
+// NewServer запускает хранилище на случайном локальном порту
+func NewServer(accessKey string, buckets ...string) (*httptest.Server, *Server) {
+	s := New(accessKey, buckets...)
+	return httptest.NewServer(s), s
+}
+
+// Keys возвращает ключи объектов бакета
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if !ok || key == "" {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "<Error><Code>IncompleteBody</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength >= 0 && int64(len(data)) != r.ContentLength {
+			http.Error(w, "<Error><Code>IncompleteBody</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		objects[key] = object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now()}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		if obj.contentType != "" {
+			w.Header().Set("Content-Type", obj.contentType)
+		}
+		if disposition := r.URL.Query().Get("response-content-disposition"); disposition != "" {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorized принимает подпись в заголовке Authorization или в строке запроса (подписанная ссылка)
+func (s *Server) authorized(r *http.Request) bool {
+	credential := "Credential=" + s.AccessKey + "/"
+	if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		return strings.Contains(r.Header.Get("Authorization"), credential)
+	}
+
+	q := r.URL.Query()
+	if !strings.HasPrefix(q.Get("X-Amz-Credential"), s.AccessKey+"/") || q.Get("X-Amz-Signature") == "" {
+		return false
+	}
+	signed, err := time.Parse("20060102T150405Z", q.Get("X-Amz-Date"))
+	expires, errExp := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil || errExp != nil {
+		return false
+	}
+	return time.Now().Before(signed.Add(time.Duration(expires) * time.Second))
+}
@@ -0,0 +1,87 @@
+// Package storage хранит файлы документов: на локальном диске или в S3-совместимом хранилище
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Ошибки хранилища
+var (
+	ErrNotFound           = errors.New("storage: object not found")
+	ErrInvalidKey         = errors.New("storage: invalid object key")
+	ErrPresignUnsupported = errors.New("storage: presigned links are not supported by the backend")
+)
+
+// Backend имена реализаций для конфигурации
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Object метаданные сохраненного объекта
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage хранилище объектов по ключу вида "projects/12/<uuid>_file.pdf"
+type Storage interface {
+	// Put сохраняет объект; size = -1, если размер заранее неизвестен
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Delete удаляет объект; отсутствие объекта не считается ошибкой
+	Delete(ctx context.Context, key string) error
+	// PresignGet возвращает временную ссылку на скачивание в обход API
+	PresignGet(ctx context.Context, key string, ttl time.Duration, filename string) (string, error)
+}
+
+// Config выбор и параметры хранилища
+type Config struct {
+	Backend  string // local или s3
+	LocalDir string
+
+	S3Endpoint  string // Например, https://storage.yandexcloud.net или http://localhost:9000 (MinIO)
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool // Адрес вида endpoint/bucket/key (MinIO); иначе bucket.endpoint/key
+}
+
+// New создает хранилище по конфигурации
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", BackendLocal:
+		return NewLocal(cfg.LocalDir)
+	case BackendS3:
+		return NewS3(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		}, nil)
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
+	}
+}
+
+// CleanKey проверяет ключ: относительный путь без "..", разделитель "/"
+func CleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/")
+	cleaned := path.Clean(key)
+	if key == "" || cleaned == "." || cleaned != key || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}